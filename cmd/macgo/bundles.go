@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tmc/macgo/internal/bundle"
+)
+
+func runBundles(args []string) error {
+	if len(args) < 1 {
+		bundlesUsage()
+		return fmt.Errorf("missing subcommand")
+	}
+	switch args[0] {
+	case "list":
+		return bundlesList()
+	case "show":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: macgo bundles show <bundle.app|bundle-id|executable>")
+		}
+		return bundlesShow(args[1])
+	case "verify":
+		return bundlesVerify(args[1:])
+	case "manifest":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: macgo bundles manifest <bundle.app|bundle-id|executable>")
+		}
+		return bundlesManifest(args[1])
+	case "prune":
+		return bundlesPrune(args[1:])
+	default:
+		bundlesUsage()
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func bundlesUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: macgo bundles <subcommand> [arguments]
+
+Subcommands:
+  list                  list bundles created by macgo, most recently used first
+  show <bundle>         show a bundle's index entry, by path, bundle ID or executable
+  verify [-manifest f] <bundle>
+                        check a bundle's files against its manifest, or another
+  manifest <bundle>     print the manifest of a bundle's files and hashes
+  prune [-older-than d] remove bundles not used recently
+`)
+}
+
+func bundlesList() error {
+	entries, err := bundle.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "macgo bundles: no bundles in the index")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST USED\tBUNDLE ID\tPATH")
+	for _, e := range entries {
+		path := e.Path
+		if _, err := os.Stat(path); err != nil {
+			path += " (missing)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.LastUsed.Local().Format(time.DateTime), e.BundleID, path)
+	}
+	return w.Flush()
+}
+
+func bundlesShow(query string) error {
+	e, err := bundle.FindIndexEntry(query)
+	if err != nil {
+		return err
+	}
+	identity := e.Identity
+	switch identity {
+	case "":
+		identity = "unsigned"
+	case "-":
+		identity = "ad-hoc"
+	}
+	fmt.Printf("Path:       %s\n", e.Path)
+	fmt.Printf("Bundle ID:  %s\n", e.BundleID)
+	fmt.Printf("Source:     %s\n", e.Source)
+	fmt.Printf("Hash:       %s\n", e.Hash)
+	fmt.Printf("Identity:   %s\n", identity)
+	fmt.Printf("Created:    %s\n", e.Created.Local().Format(time.DateTime))
+	fmt.Printf("Last used:  %s\n", e.LastUsed.Local().Format(time.DateTime))
+	return nil
+}
+
+// bundlePath returns the bundle named by query: a bundle directory, or
+// a bundle path, bundle ID or executable in the index.
+func bundlePath(query string) (string, error) {
+	if info, err := os.Stat(query); err == nil && info.IsDir() {
+		return query, nil
+	}
+	e, err := bundle.FindIndexEntry(query)
+	if err != nil {
+		return "", err
+	}
+	return e.Path, nil
+}
+
+func bundlesVerify(args []string) error {
+	fs := flag.NewFlagSet("bundles verify", flag.ExitOnError)
+	manifest := fs.String("manifest", "", "check against this manifest, such as one from another machine, instead of the bundle's own")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: macgo bundles verify [-manifest file] <bundle.app|bundle-id|executable>")
+	}
+	path, err := bundlePath(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	diffs, err := bundle.VerifyManifest(path, *manifest)
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%s does not match the manifest", path)
+	}
+	fmt.Printf("%s matches the manifest\n", path)
+	return nil
+}
+
+func bundlesManifest(query string) error {
+	path, err := bundlePath(query)
+	if err != nil {
+		return err
+	}
+	m, err := bundle.BuildManifest(path)
+	if err != nil {
+		return err
+	}
+	data, err := m.MarshalText()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func bundlesPrune(args []string) error {
+	fs := flag.NewFlagSet("bundles prune", flag.ExitOnError)
+	olderThan := fs.String("older-than", "30d", "remove bundles last used longer ago than this (e.g. 7d, 12h)")
+	dryRun := fs.Bool("n", false, "print the bundles that would be removed without removing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid -older-than: %w", err)
+	}
+	removed, err := bundle.Prune(time.Now().Add(-age), *dryRun)
+	for _, e := range removed {
+		if *dryRun {
+			fmt.Printf("would remove %s\n", e.Path)
+		} else {
+			fmt.Printf("removed %s\n", e.Path)
+		}
+	}
+	return err
+}
+
+// parseAge parses a duration, also accepting a whole number of days
+// such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
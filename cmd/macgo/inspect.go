@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/tmc/macgo/codesign"
+	"github.com/tmc/macgo/internal/icns"
+	"github.com/tmc/macgo/internal/plist"
+	"github.com/tmc/macgo/notary"
 )
 
 func runInspect(args []string) error {
@@ -45,13 +50,76 @@ func runInspect(args []string) error {
 		fmt.Printf("CDHash:     %s\n", cdhash)
 	}
 
-	// Verify signature.
+	// TCC grants follow the designated requirement.
+	if dr, err := codesign.DesignatedRequirement(target); err == nil {
+		fmt.Printf("Designated: %s\n", dr)
+	}
+
+	// A stapled ticket lets Gatekeeper accept the bundle offline.
+	if fi, err := os.Stat(target); err == nil && fi.IsDir() {
+		switch err := notary.CheckTicket(target); {
+		case errors.Is(err, notary.ErrNotStapled):
+			fmt.Println("Ticket:     not stapled")
+		case err != nil:
+			fmt.Printf("Ticket:     INVALID (%v)\n", err)
+		default:
+			fmt.Println("Ticket:     stapled")
+		}
+		printIcon(target)
+	}
+
+	// Verify signature. The offline check names each modified page, slot
+	// or file; codesign additionally evaluates certificate trust.
 	absPath, _ := filepath.Abs(target)
-	if err := codesign.VerifySignature(absPath); err != nil {
+	mismatches, err := codesign.VerifyOffline(absPath)
+	switch {
+	case err != nil:
 		fmt.Printf("Verified:   FAIL (%v)\n", err)
-	} else {
-		fmt.Println("Verified:   OK")
+	case len(mismatches) > 0:
+		fmt.Println("Verified:   FAIL")
+		for _, m := range mismatches {
+			fmt.Printf("  %s\n", m)
+		}
+	default:
+		if err := codesign.VerifySignature(absPath); err != nil {
+			fmt.Printf("Verified:   FAIL (%v)\n", err)
+		} else {
+			fmt.Println("Verified:   OK")
+		}
 	}
 
 	return nil
 }
+
+// printIcon lists the image types in the bundle's app icon.
+func printIcon(bundlePath string) {
+	data, err := os.ReadFile(filepath.Join(bundlePath, "Contents", "Info.plist"))
+	if err != nil {
+		return
+	}
+	var info struct {
+		IconFile string `plist:"CFBundleIconFile"`
+	}
+	if plist.Unmarshal(data, &info) != nil || info.IconFile == "" {
+		fmt.Println("Icon:       none")
+		return
+	}
+	name := info.IconFile
+	if filepath.Ext(name) == "" {
+		name += ".icns"
+	}
+	data, err = os.ReadFile(filepath.Join(bundlePath, "Contents", "Resources", name))
+	if err != nil {
+		fmt.Printf("Icon:       MISSING (%v)\n", err)
+		return
+	}
+	icons, err := icns.Parse(data)
+	if err != nil {
+		fmt.Printf("Icon:       INVALID (%v)\n", err)
+		return
+	}
+	fmt.Printf("Icon:       %s\n", name)
+	for _, ic := range icons {
+		fmt.Printf("  %s %-10s %s %dx%d\n", ic.Type, ic, ic.Format, ic.Width, ic.Height)
+	}
+}
@@ -1,12 +1,15 @@
-// Command macgo provides signing diagnostics, bundle inspection, and code
-// signing for macOS app bundles.
+// Command macgo provides signing diagnostics, bundle inspection, code
+// signing, and notarization for macOS app bundles.
 //
 // Usage:
 //
-//	macgo doctor          signing environment diagnostics
-//	macgo sign <path>     sign a bundle
-//	macgo inspect <path>  show bundle/signature info
-//	macgo version         print version
+//	macgo doctor           signing environment diagnostics
+//	macgo sign <path>      sign a bundle
+//	macgo inspect <path>   show bundle/signature info
+//	macgo notarize <path>  submit a bundle for notarization
+//	macgo staple <path>    staple a notarization ticket to a bundle
+//	macgo bundles <cmd>    list, show, verify or prune bundles created by macgo
+//	macgo version          print version
 package main
 
 import (
@@ -31,6 +34,12 @@ func main() {
 		err = runSign(os.Args[2:])
 	case "inspect":
 		err = runInspect(os.Args[2:])
+	case "notarize":
+		err = runNotarize(os.Args[2:])
+	case "staple":
+		err = runStaple(os.Args[2:])
+	case "bundles":
+		err = runBundles(os.Args[2:])
 	case "version":
 		fmt.Println("macgo", version)
 	case "-h", "--help", "help":
@@ -51,9 +60,12 @@ func usage() {
 	fmt.Fprintf(os.Stderr, `Usage: macgo <command> [arguments]
 
 Commands:
-  doctor          signing environment diagnostics
-  sign <path>     sign a bundle
-  inspect <path>  show bundle/signature info
-  version         print version
+  doctor           signing environment diagnostics
+  sign <path>      sign a bundle
+  inspect <path>   show bundle/signature info
+  notarize <path>  submit a bundle for notarization
+  staple <path>    staple a notarization ticket to a bundle
+  bundles <cmd>    list, show, verify or prune bundles created by macgo
+  version          print version
 `)
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tmc/macgo/notary"
+)
+
+func runNotarize(args []string) error {
+	fs := flag.NewFlagSet("notarize", flag.ExitOnError)
+	keyPath := fs.String("key", os.Getenv("MACGO_NOTARY_KEY"), "App Store Connect API key (.p8)")
+	keyID := fs.String("key-id", os.Getenv("MACGO_NOTARY_KEY_ID"), "API key ID (default: from an AuthKey_<ID>.p8 file name)")
+	issuer := fs.String("issuer", os.Getenv("MACGO_NOTARY_ISSUER"), "API key issuer ID (omit for individual keys)")
+	baseURL := fs.String("url", os.Getenv("MACGO_NOTARY_URL"), "notary API base URL (default: "+notary.DefaultBaseURL+")")
+	wait := fs.Bool("wait", true, "wait for processing to finish and print the log")
+	staple := fs.Bool("staple", true, "staple the ticket to an accepted bundle (requires -wait)")
+	timeout := fs.Duration("timeout", time.Hour, "how long to wait")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: macgo notarize [flags] <bundle.app|archive.zip|.dmg|.pkg>\n\nFlags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nFlags default to MACGO_NOTARY_KEY, MACGO_NOTARY_KEY_ID, MACGO_NOTARY_ISSUER and MACGO_NOTARY_URL.\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing bundle path")
+	}
+	if *keyPath == "" {
+		return fmt.Errorf("no API key; use -key or MACGO_NOTARY_KEY")
+	}
+	if *keyID == "" {
+		id, ok := strings.CutPrefix(strings.TrimSuffix(filepath.Base(*keyPath), ".p8"), "AuthKey_")
+		if !ok {
+			return fmt.Errorf("no API key ID; use -key-id or MACGO_NOTARY_KEY_ID")
+		}
+		*keyID = id
+	}
+	key, err := notary.LoadKey(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	c := &notary.Client{
+		Credentials: notary.Credentials{KeyID: *keyID, IssuerID: *issuer, Key: key},
+		BaseURL:     *baseURL,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "macgo notarize: uploading %s\n", fs.Arg(0))
+	sub, err := c.Submit(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Submission: %s\n", sub.ID)
+	if !*wait {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "macgo notarize: waiting for %s\n", sub.ID)
+	sub, err = c.Wait(ctx, sub.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Status:     %s\n", sub.Status)
+
+	log, err := c.Log(ctx, sub.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "macgo notarize: warning: %v\n", err)
+	} else {
+		if log.StatusSummary != "" {
+			fmt.Printf("Summary:    %s\n", log.StatusSummary)
+		}
+		for _, issue := range log.Issues {
+			fmt.Printf("  %s\n", issue)
+			if issue.DocURL != "" {
+				fmt.Printf("    see %s\n", issue.DocURL)
+			}
+		}
+	}
+	if sub.Status != notary.StatusAccepted {
+		return fmt.Errorf("submission %s: %s", sub.ID, sub.Status)
+	}
+	if fi, err := os.Stat(fs.Arg(0)); *staple && err == nil && fi.IsDir() {
+		// Tickets can take a moment to be published after acceptance.
+		switch err := (&notary.Stapler{}).Staple(ctx, fs.Arg(0)); {
+		case errors.Is(err, notary.ErrNoTicket):
+			fmt.Fprintf(os.Stderr, "macgo notarize: warning: ticket not published yet; run macgo staple %s later\n", fs.Arg(0))
+		case err != nil:
+			return err
+		default:
+			fmt.Println("Stapled:    yes")
+		}
+	}
+	return nil
+}
+
+func runStaple(args []string) error {
+	fs := flag.NewFlagSet("staple", flag.ExitOnError)
+	ticketURL := fs.String("url", os.Getenv("MACGO_TICKET_URL"), "ticket lookup URL (default: "+notary.DefaultTicketURL+")")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: macgo staple [flags] <bundle.app>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing bundle path")
+	}
+	s := &notary.Stapler{TicketURL: *ticketURL}
+	if err := s.Staple(context.Background(), fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "macgo staple: stapled ticket to %s\n", fs.Arg(0))
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -8,15 +9,22 @@ import (
 	"strings"
 
 	"github.com/tmc/macgo/codesign"
+	"github.com/tmc/macgo/internal/codesig"
+	"github.com/tmc/macgo/internal/tsp"
 )
 
 func runSign(args []string) error {
 	fs := flag.NewFlagSet("sign", flag.ExitOnError)
 	identity := fs.String("identity", "", "signing identity (default: best available, use - for ad-hoc)")
 	entitlements := fs.String("entitlements", "", "path to entitlements plist")
+	identityFile := fs.String("identity-file", "", "PKCS#12 or PEM identity to sign with instead of the keychain")
+	identityKey := fs.String("identity-key", "", "PEM private key for -identity-file, if separate")
+	policy := fs.String("timestamp", os.Getenv("MACGO_TIMESTAMP_POLICY"), "secure timestamp: required, optional or none (default: required)")
+	tsaURL := fs.String("tsa", os.Getenv("MACGO_TIMESTAMP_URL"), "RFC 3161 time-stamping authority URL (default: "+tsp.DefaultURL+")")
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: macgo sign [flags] <bundle.app>\n\nFlags:\n")
 		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nThe -identity-file password is read from MACGO_IDENTITY_PASSWORD.\n")
 	}
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -27,6 +35,20 @@ func runSign(args []string) error {
 		return fmt.Errorf("missing bundle path")
 	}
 	bundlePath := fs.Arg(0)
+	switch *policy {
+	case "", "required", "optional", "none":
+	default:
+		return fmt.Errorf("invalid -timestamp %q: want required, optional or none", *policy)
+	}
+
+	if *identityFile != "" {
+		p := codesign.FileProvider{
+			Path:     *identityFile,
+			KeyPath:  *identityKey,
+			Password: os.Getenv("MACGO_IDENTITY_PASSWORD"),
+		}
+		return signWithFile(bundlePath, p, *identity, *entitlements, timestamper(*policy, *tsaURL))
+	}
 
 	// Resolve identity.
 	id := *identity
@@ -43,7 +65,15 @@ func runSign(args []string) error {
 	// Build codesign args.
 	csArgs := []string{"--sign", id, "--force"}
 	if id != "-" {
-		csArgs = append(csArgs, "--timestamp", "--options", "runtime")
+		switch {
+		case *policy == "none":
+			csArgs = append(csArgs, "--timestamp=none")
+		case *tsaURL != "":
+			csArgs = append(csArgs, "--timestamp="+*tsaURL)
+		default:
+			csArgs = append(csArgs, "--timestamp")
+		}
+		csArgs = append(csArgs, "--options", "runtime")
 	}
 	if *entitlements != "" {
 		csArgs = append(csArgs, "--entitlements", *entitlements)
@@ -68,3 +98,77 @@ func runSign(args []string) error {
 
 	return nil
 }
+
+// signWithFile signs bundlePath with the built-in signer, using an identity
+// from a PKCS#12 or PEM file instead of the keychain.
+func signWithFile(bundlePath string, p codesign.FileProvider, name, entitlements string, timestamp func([]byte) ([]byte, error)) error {
+	id, err := codesign.FindIdentity(p, name)
+	if err != nil {
+		return err
+	}
+	_, info, err := codesig.MainExecutable(bundlePath)
+	if err != nil {
+		return err
+	}
+	identifier, _ := info["CFBundleIdentifier"].(string)
+	if identifier == "" {
+		return fmt.Errorf("%s: Info.plist has no CFBundleIdentifier", bundlePath)
+	}
+
+	opts := codesig.SignOptions{
+		Identifier:  identifier,
+		TeamID:      id.TeamID(),
+		Flags:       codesig.FlagRuntime,
+		Key:         id.Key,
+		Certificate: id.Certificate,
+		Chain:       id.Chain,
+		Timestamp:   timestamp,
+	}
+	if entitlements != "" {
+		if opts.Entitlements, err = os.ReadFile(entitlements); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "macgo sign: using %s from %s\n", id.Name, p.Path)
+	if err := codesig.SignBundle(bundlePath, opts); err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	mismatches, err := codesign.VerifyOffline(bundlePath)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "macgo sign: warning: verification failed: %v\n", err)
+	case len(mismatches) > 0:
+		for _, m := range mismatches {
+			fmt.Fprintf(os.Stderr, "macgo sign: warning: %s\n", m)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "macgo sign: verified OK\n")
+	}
+	return nil
+}
+
+// timestamper returns the function that time-stamps signatures from
+// signWithFile under the given policy, or nil for "none".
+func timestamper(policy, url string) func([]byte) ([]byte, error) {
+	if policy == "none" {
+		return nil
+	}
+	client := &tsp.Client{URL: url}
+	var failed bool
+	return func(signature []byte) ([]byte, error) {
+		if failed {
+			return nil, nil
+		}
+		tok, err := client.Timestamp(context.Background(), signature)
+		switch {
+		case err != nil && policy == "optional":
+			failed = true
+			fmt.Fprintf(os.Stderr, "macgo sign: warning: signing without a secure timestamp: %v\n", err)
+			return nil, nil
+		case err != nil:
+			return nil, err
+		}
+		return tok.Raw, nil
+	}
+}
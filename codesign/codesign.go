@@ -17,21 +17,11 @@ import (
 //
 // Returns the certificate name/identity string, or empty string if none found.
 func FindDeveloperID() string {
-	cmd := exec.Command("security", "find-identity", "-v", "-p", "codesigning")
-	output, err := cmd.Output()
+	id, err := FindIdentity(KeychainProvider{}, "Developer ID Application")
 	if err != nil {
 		return ""
 	}
-
-	for _, line := range strings.Split(string(output), "\n") {
-		if strings.Contains(line, "Developer ID Application") {
-			if id := extractQuoted(line); id != "" {
-				return id
-			}
-		}
-	}
-
-	return ""
+	return id.Name
 }
 
 // FindBestIdentity returns the strongest available signing identity.
@@ -39,39 +29,14 @@ func FindDeveloperID() string {
 // Returns empty string if no Apple-issued identity is found; callers
 // should fall back to ad-hoc ("-") when appropriate.
 func FindBestIdentity() string {
-	cmd := exec.Command("security", "find-identity", "-v", "-p", "codesigning")
-	output, err := cmd.Output()
+	ids, err := KeychainProvider{}.Identities()
 	if err != nil {
 		return ""
 	}
-
-	var appleDev string
-	for _, line := range strings.Split(string(output), "\n") {
-		if strings.Contains(line, "Developer ID Application") {
-			if id := extractQuoted(line); id != "" {
-				return id
-			}
-		}
-		if appleDev == "" && strings.Contains(line, "Apple Development") {
-			if id := extractQuoted(line); id != "" {
-				appleDev = id
-			}
-		}
+	if id := bestIdentity(ids); id != nil {
+		return id.Name
 	}
-	return appleDev
-}
-
-// extractQuoted returns the first double-quoted substring in line.
-func extractQuoted(line string) string {
-	start := strings.Index(line, `"`)
-	if start == -1 {
-		return ""
-	}
-	end := strings.LastIndex(line, `"`)
-	if end <= start {
-		return ""
-	}
-	return line[start+1 : end]
+	return ""
 }
 
 // ValidateCodeSignIdentity checks if the provided code signing identity is valid
@@ -90,17 +55,16 @@ func ValidateCodeSignIdentity(identity string) error {
 	}
 
 	// Check if identity exists in keychain
-	cmd := exec.Command("security", "find-identity", "-v", "-p", "codesigning")
-	output, err := cmd.Output()
+	ids, err := KeychainProvider{}.Identities()
 	if err != nil {
-		return fmt.Errorf("failed to query keychain: %w", err)
+		return err
 	}
-
-	if !strings.Contains(string(output), identity) {
-		return fmt.Errorf("code signing identity not found in keychain: %s", identity)
+	for _, id := range ids {
+		if strings.Contains(id.Name, identity) || strings.EqualFold(id.SHA1(), identity) {
+			return nil
+		}
 	}
-
-	return nil
+	return fmt.Errorf("code signing identity not found in keychain: %s", identity)
 }
 
 // ListAvailableIdentities returns a list of available code signing identities
@@ -108,26 +72,15 @@ func ValidateCodeSignIdentity(identity string) error {
 //
 // Returns a slice of identity strings that can be used with code signing tools.
 func ListAvailableIdentities() ([]string, error) {
-	cmd := exec.Command("security", "find-identity", "-v", "-p", "codesigning")
-	output, err := cmd.Output()
+	ids, err := KeychainProvider{}.Identities()
 	if err != nil {
-		return nil, fmt.Errorf("failed to query keychain: %w", err)
+		return nil, err
 	}
 
 	var identities []string
-	lines := strings.Split(string(output), "\n")
-
-	for _, line := range lines {
-		if strings.Contains(line, "valid identities found") {
-			continue
-		}
-		if !strings.Contains(line, "invalid") {
-			if id := extractQuoted(line); id != "" {
-				identities = append(identities, id)
-			}
-		}
+	for _, id := range ids {
+		identities = append(identities, id.Name)
 	}
-
 	return identities, nil
 }
 
@@ -135,8 +88,12 @@ func ListAvailableIdentities() ([]string, error) {
 // Returns nil if the signature is valid, error otherwise.
 //
 // This function performs a deep verification of the code signature,
-// including all embedded frameworks and resources.
+// including all embedded frameworks and resources. When the codesign tool
+// is not installed, it falls back to VerifyOffline.
 func VerifySignature(bundlePath string) error {
+	if _, err := exec.LookPath("codesign"); err != nil {
+		return verifyOffline(bundlePath)
+	}
 	cmd := exec.Command("codesign", "--verify", "--deep", "--strict", bundlePath)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -145,40 +102,6 @@ func VerifySignature(bundlePath string) error {
 	return nil
 }
 
-// GetSignatureInfo retrieves detailed information about the bundle's code signature.
-// Returns a map containing signature details such as signing identity, team ID,
-// and other code signing attributes.
-//
-// The returned map may contain keys such as:
-//   - "Authority": The signing authority/certificate name
-//   - "TeamIdentifier": The developer team ID
-//   - "Identifier": The bundle identifier used for signing
-//   - "Format": The signature format
-func GetSignatureInfo(bundlePath string) (map[string]string, error) {
-	cmd := exec.Command("codesign", "--display", "--verbose", bundlePath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get signature info: %w", err)
-	}
-
-	info := make(map[string]string)
-	lines := strings.Split(string(output), "\n")
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.Contains(line, "=") {
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				info[key] = value
-			}
-		}
-	}
-
-	return info, nil
-}
-
 // HasDeveloperIDCertificate checks if the system has any Developer ID certificates
 // installed. This is useful for determining whether automatic code signing is possible.
 //
@@ -210,15 +133,14 @@ func ExtractTeamIDFromCertificate(identity string) string {
 }
 
 // GetCertificateTeamID retrieves the team ID from the first available
-// Developer ID certificate. This combines FindDeveloperID and
-// ExtractTeamIDFromCertificate for convenience.
+// Developer ID certificate, reading it from the certificate itself.
 //
 // Returns the team ID from the certificate, or empty string if no
 // Developer ID certificate is found or no team ID can be extracted.
 func GetCertificateTeamID() string {
-	identity := FindDeveloperID()
-	if identity == "" {
+	id, err := FindIdentity(KeychainProvider{}, "Developer ID Application")
+	if err != nil {
 		return ""
 	}
-	return ExtractTeamIDFromCertificate(identity)
+	return id.TeamID()
 }
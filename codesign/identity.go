@@ -0,0 +1,260 @@
+package codesign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tmc/macgo/internal/keychain"
+	"github.com/tmc/macgo/internal/pkcs12"
+	"github.com/tmc/macgo/teamid"
+)
+
+// Identity is a code signing identity: a certificate and, when macgo can
+// use it directly, the certificate's private key.
+type Identity struct {
+	// Name is the certificate's common name, for example
+	// "Developer ID Application: Company Name (ABC123DEF4)".
+	Name string
+
+	// Certificate is the signing certificate. Keychain identities whose
+	// certificate could not be exported have a nil Certificate.
+	Certificate *x509.Certificate
+
+	// Chain holds intermediate certificates to embed after Certificate.
+	Chain []*x509.Certificate
+
+	// Key is the private key for Certificate. It is nil for keychain
+	// identities, whose keys never leave the keychain; those are signed
+	// with Apple's codesign tool.
+	Key crypto.Signer
+
+	// keychainSHA1 is the fingerprint security reported for a keychain
+	// identity, used when Certificate is nil.
+	keychainSHA1 string
+}
+
+// NewIdentity returns an identity for cert and key. It fails if key is not
+// the private key for cert.
+func NewIdentity(cert *x509.Certificate, key crypto.Signer, chain ...*x509.Certificate) (*Identity, error) {
+	pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(key.Public()) {
+		return nil, fmt.Errorf("private key does not match certificate %q", cert.Subject.CommonName)
+	}
+	return &Identity{Name: cert.Subject.CommonName, Certificate: cert, Chain: chain, Key: key}, nil
+}
+
+// SHA1 returns the upper-case hex SHA-1 fingerprint of the certificate.
+// It identifies the identity unambiguously to codesign --sign.
+func (id *Identity) SHA1() string {
+	if id.Certificate == nil {
+		return id.keychainSHA1
+	}
+	sum := sha1.Sum(id.Certificate.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// TeamID returns the identity's Apple Developer Team ID, read from the
+// certificate, or "" if it has none.
+func (id *Identity) TeamID() string {
+	if id.Certificate == nil {
+		return ExtractTeamIDFromCertificate(id.Name)
+	}
+	teamID, err := teamid.FromCertificate(id.Certificate)
+	if err != nil {
+		return ""
+	}
+	return teamID
+}
+
+// IdentityProvider supplies code signing identities.
+type IdentityProvider interface {
+	// Identities returns the available identities.
+	Identities() ([]*Identity, error)
+}
+
+// KeychainProvider provides the valid code signing identities in the
+// macOS keychain. It needs the security tool and an unlocked keychain.
+// Its identities have no Key.
+type KeychainProvider struct {
+	// Keychains optionally restricts the search to these keychain files.
+	// The default search list is used when empty.
+	Keychains []string
+}
+
+// Identities implements IdentityProvider.
+func (p KeychainProvider) Identities() ([]*Identity, error) {
+	found, err := keychain.FindIdentities(p.Keychains...)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]*Identity, len(found))
+	for i, f := range found {
+		ids[i] = &Identity{Name: f.Name, Certificate: f.Certificate, keychainSHA1: f.SHA1}
+	}
+	return ids, nil
+}
+
+// FileProvider provides the identity stored in a PKCS#12 (.p12, .pfx)
+// file or in PEM files, for signing on machines without a keychain such
+// as CI runners.
+type FileProvider struct {
+	// Path is a PKCS#12 file, or a PEM file holding the certificate
+	// followed by any intermediates and, optionally, the private key.
+	Path string
+
+	// KeyPath is a PEM file holding the private key when it is not in
+	// Path. Only used for PEM identities.
+	KeyPath string
+
+	// Password decrypts a PKCS#12 file.
+	Password string
+}
+
+// Identities implements IdentityProvider. It returns exactly one identity.
+func (p FileProvider) Identities() ([]*Identity, error) {
+	id, err := p.Identity()
+	if err != nil {
+		return nil, err
+	}
+	return []*Identity{id}, nil
+}
+
+// Identity loads the identity from the provider's files.
+func (p FileProvider) Identity() (*Identity, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read identity: %w", err)
+	}
+	if !bytes.Contains(data, []byte("-----BEGIN ")) {
+		key, cert, chain, err := pkcs12.Decode(data, p.Password)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Path, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported private key type %T", p.Path, key)
+		}
+		return NewIdentity(cert, signer, chain...)
+	}
+
+	if p.KeyPath != "" {
+		keyData, err := os.ReadFile(p.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read identity key: %w", err)
+		}
+		data = append(append(data, '\n'), keyData...)
+	}
+	var certs []*x509.Certificate
+	var key crypto.Signer
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Path, err)
+			}
+			certs = append(certs, cert)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			if key != nil {
+				return nil, fmt.Errorf("%s: more than one private key", p.Path)
+			}
+			if key, err = parsePrivateKey(block); err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Path, err)
+			}
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, fmt.Errorf("%s: encrypted PEM private keys are not supported; use a PKCS#12 file", p.Path)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no certificate found", p.Path)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%s: no private key found", p.Path)
+	}
+	return NewIdentity(certs[0], key, certs[1:]...)
+}
+
+// parsePrivateKey parses a PKCS#8, PKCS#1 or SEC 1 private key.
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// ErrNoIdentity is returned by FindIdentity when no identity matches.
+var ErrNoIdentity = errors.New("no matching code signing identity")
+
+// FindIdentity returns the identity from p matching name, which may be a
+// full certificate name, a prefix such as "Developer ID Application", or
+// a SHA-1 fingerprint. An empty name selects the strongest identity, with
+// the same preference as FindBestIdentity; providers holding a single
+// identity, such as FileProvider, return it regardless of its type.
+func FindIdentity(p IdentityProvider, name string) (*Identity, error) {
+	ids, err := p.Identities()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		if id := bestIdentity(ids); id != nil {
+			return id, nil
+		}
+		if len(ids) == 1 {
+			return ids[0], nil
+		}
+		return nil, ErrNoIdentity
+	}
+	for _, id := range ids {
+		if id.Name == name || strings.EqualFold(id.SHA1(), name) {
+			return id, nil
+		}
+	}
+	for _, id := range ids {
+		if strings.HasPrefix(id.Name, name) {
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoIdentity, name)
+}
+
+// bestIdentity returns the first Developer ID Application identity,
+// otherwise the first Apple Development identity, otherwise nil.
+func bestIdentity(ids []*Identity) *Identity {
+	var appleDev *Identity
+	for _, id := range ids {
+		if strings.Contains(id.Name, "Developer ID Application") {
+			return id
+		}
+		if appleDev == nil && strings.Contains(id.Name, "Apple Development") {
+			appleDev = id
+		}
+	}
+	return appleDev
+}
@@ -0,0 +1,153 @@
+package codesign
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/pkcs12"
+	"github.com/tmc/macgo/internal/testcert"
+)
+
+func writePEM(t *testing.T, path string, blocks ...*pem.Block) {
+	t.Helper()
+	var data []byte
+	for _, b := range blocks {
+		data = append(data, pem.EncodeToMemory(b)...)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	const cn = "Developer ID Application: Example Corp (ABCDE12345)"
+	cert, key := testcert.CodeSigning(t, cn, "ABCDE12345")
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12, err := pkcs12.Encode(rand.Reader, key, cert, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certBlock := &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+	writePEM(t, filepath.Join(dir, "combined.pem"), certBlock, &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	writePEM(t, filepath.Join(dir, "cert.pem"), certBlock)
+	writePEM(t, filepath.Join(dir, "key.pem"), &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})
+	if err := os.WriteFile(filepath.Join(dir, "identity.p12"), p12, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		p    FileProvider
+	}{
+		{"combined PEM", FileProvider{Path: filepath.Join(dir, "combined.pem")}},
+		{"separate key", FileProvider{Path: filepath.Join(dir, "cert.pem"), KeyPath: filepath.Join(dir, "key.pem")}},
+		{"PKCS#12", FileProvider{Path: filepath.Join(dir, "identity.p12"), Password: "secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := FindIdentity(tt.p, "")
+			if err != nil {
+				t.Fatalf("FindIdentity: %v", err)
+			}
+			if id.Name != cn {
+				t.Errorf("Name = %q, want %q", id.Name, cn)
+			}
+			if id.Key == nil || !id.Certificate.Equal(cert) {
+				t.Error("identity is missing its key or certificate")
+			}
+			if got := id.TeamID(); got != "ABCDE12345" {
+				t.Errorf("TeamID() = %q, want ABCDE12345", got)
+			}
+			if got := id.SHA1(); len(got) != 40 || strings.ToUpper(got) != got {
+				t.Errorf("SHA1() = %q, want 40 upper-case hex digits", got)
+			}
+		})
+	}
+
+	// Errors: wrong password, certificate without key, mismatched key.
+	if _, err := (FileProvider{Path: filepath.Join(dir, "identity.p12"), Password: "wrong"}).Identity(); !errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		t.Errorf("wrong password: %v", err)
+	}
+	if _, err := (FileProvider{Path: filepath.Join(dir, "cert.pem")}).Identity(); err == nil || !strings.Contains(err.Error(), "no private key") {
+		t.Errorf("certificate only: %v", err)
+	}
+	_, otherKey := testcert.CodeSigning(t, "Other", "")
+	otherSEC1, err := x509.MarshalECPrivateKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "other.pem"), &pem.Block{Type: "EC PRIVATE KEY", Bytes: otherSEC1})
+	if _, err := (FileProvider{Path: filepath.Join(dir, "cert.pem"), KeyPath: filepath.Join(dir, "other.pem")}).Identity(); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("mismatched key: %v", err)
+	}
+}
+
+// staticProvider is an IdentityProvider over a fixed list.
+type staticProvider []*Identity
+
+func (p staticProvider) Identities() ([]*Identity, error) { return p, nil }
+
+func TestFindIdentity(t *testing.T) {
+	var ids staticProvider
+	for _, cn := range []string{
+		"Apple Development: dev@example.com (FGHIJ67890)",
+		"Developer ID Application: Example Corp (ABCDE12345)",
+		"Developer ID Installer: Example Corp (ABCDE12345)",
+	} {
+		cert, key := testcert.CodeSigning(t, cn, "")
+		id, err := NewIdentity(cert, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"", 1},
+		{"Developer ID Application: Example Corp (ABCDE12345)", 1},
+		{"Developer ID Installer", 2},
+		{"Apple Development", 0},
+		{strings.ToLower(ids[2].SHA1()), 2},
+	}
+	for _, tt := range tests {
+		id, err := FindIdentity(ids, tt.name)
+		if err != nil {
+			t.Errorf("FindIdentity(%q): %v", tt.name, err)
+			continue
+		}
+		if id != ids[tt.want] {
+			t.Errorf("FindIdentity(%q) = %q, want %q", tt.name, id.Name, ids[tt.want].Name)
+		}
+		if got, want := id.TeamID(), ExtractTeamIDFromCertificate(id.Name); got != want {
+			t.Errorf("%q: TeamID() = %q, want %q", id.Name, got, want)
+		}
+	}
+
+	if _, err := FindIdentity(ids, "3rd Party Mac Developer"); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("FindIdentity(unknown) = %v, want ErrNoIdentity", err)
+	}
+	if _, err := FindIdentity(staticProvider{ids[2]}, ""); err != nil {
+		t.Errorf("FindIdentity on a single identity: %v", err)
+	}
+	if _, err := FindIdentity(staticProvider{}, ""); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("FindIdentity on no identities = %v, want ErrNoIdentity", err)
+	}
+}
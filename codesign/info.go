@@ -0,0 +1,179 @@
+package codesign
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/codesig"
+	"github.com/tmc/macgo/internal/plist"
+	"github.com/tmc/macgo/internal/tsp"
+)
+
+// oidSigningTime is the CMS signing-time attribute.
+var oidSigningTime = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+// GetSignatureInfo retrieves detailed information about the bundle's code signature.
+// Returns a map containing signature details such as signing identity, team ID,
+// and other code signing attributes.
+//
+// The signature is read directly from the Mach-O file, so this works on any
+// platform. Keys and values mirror the output of `codesign --display
+// --verbose`, split at the first "=" of each line. The returned map may
+// contain keys such as:
+//   - "Authority": The signing authority/certificate name
+//   - "TeamIdentifier": The developer team ID
+//   - "Identifier": The bundle identifier used for signing
+//   - "Format": The signature format
+//   - "CDHash": The code directory hash
+func GetSignatureInfo(bundlePath string) (map[string]string, error) {
+	lines, err := displayLines(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signature info: %w", err)
+	}
+
+	info := make(map[string]string)
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, "=")
+		if ok {
+			info[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return info, nil
+}
+
+// displayLines returns the lines `codesign --display --verbose=3` would
+// print for path, which may be a bundle or a bare Mach-O file.
+func displayLines(path string) ([]string, error) {
+	exe := path
+	var info map[string]any
+	var resources string
+	if fi, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		if exe, info, err = codesig.MainExecutable(path); err != nil {
+			return nil, err
+		}
+		resources = filepath.Join(path, "Contents", "_CodeSignature", "CodeResources")
+	}
+
+	f, err := codesig.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	slice := hostSlice(f)
+	if slice.Signature == nil {
+		return nil, fmt.Errorf("%s: %w", path, codesig.ErrNotSigned)
+	}
+	sig := slice.Signature
+	cd := sig.CodeDirectory()
+
+	format := "Mach-O thin (" + slice.Arch() + ")"
+	if f.Fat {
+		format = "Mach-O universal (" + strings.Join(f.Archs(), " ") + ")"
+	}
+	if info != nil {
+		format = "app bundle with " + format
+	}
+
+	lines := []string{
+		"Executable=" + exe,
+		"Identifier=" + cd.Identifier,
+		"Format=" + format,
+		fmt.Sprintf("CodeDirectory v=%x size=%d flags=%s hashes=%d+%d location=embedded",
+			cd.Version, len(cd.Raw), cd.Flags, len(cd.CodeHashes), len(cd.SpecialHashes)),
+		fmt.Sprintf("Hash type=%s size=%d", cd.HashType, cd.HashSize),
+	}
+	if h := cd.CDHash(); len(h) >= 20 {
+		lines = append(lines, "CDHash="+hex.EncodeToString(h[:20]))
+	}
+
+	if len(sig.CMS) == 0 {
+		lines = append(lines, "Signature=adhoc")
+	} else {
+		lines = append(lines, fmt.Sprintf("Signature size=%d", len(sig.CMS)))
+		if sd, err := cms.Parse(sig.CMS); err == nil && len(sd.Signers) > 0 {
+			for _, cert := range chain(sd) {
+				lines = append(lines, "Authority="+cert)
+			}
+			// A secure timestamp replaces the signer's own claimed time.
+			signer := sd.Signers[0]
+			var t time.Time
+			if v, ok := signer.Attribute(cms.OIDTimeStampToken); ok {
+				if tok, err := tsp.Verify(v.FullBytes, signer.Signature); err == nil {
+					lines = append(lines, "Timestamp="+tok.Time.Local().Format("Jan 2, 2006 at 3:04:05 PM"))
+				}
+			} else if v, ok := signer.Attribute(oidSigningTime); ok {
+				if _, err := asn1.Unmarshal(v.FullBytes, &t); err == nil {
+					lines = append(lines, "Signed Time="+t.Local().Format("Jan 2, 2006 at 3:04:05 PM"))
+				}
+			}
+		}
+	}
+
+	if info != nil {
+		lines = append(lines, fmt.Sprintf("Info.plist entries=%d", len(info)))
+	}
+	if cd.TeamID != "" {
+		lines = append(lines, "TeamIdentifier="+cd.TeamID)
+	} else {
+		lines = append(lines, "TeamIdentifier=not set")
+	}
+	if cd.Flags&codesig.FlagRuntime != 0 && cd.Runtime != 0 {
+		lines = append(lines, fmt.Sprintf("Runtime Version=%d.%d.%d", cd.Runtime>>16, cd.Runtime>>8&0xff, cd.Runtime&0xff))
+	}
+	if resources != "" {
+		if line, ok := sealedResourcesLine(resources); ok {
+			lines = append(lines, line)
+		} else {
+			lines = append(lines, "Sealed Resources=none")
+		}
+	}
+	lines = append(lines, fmt.Sprintf("Internal requirements count=%d size=%d", sig.RequirementCount(), len(sig.Requirements)))
+	return lines, nil
+}
+
+// hostSlice returns the slice codesign would display: the one matching the
+// running architecture, or the first.
+func hostSlice(f *codesig.File) *codesig.Slice {
+	arch := runtime.GOARCH
+	if arch == "amd64" {
+		arch = "x86_64"
+	}
+	if s := f.Slice(arch); s != nil {
+		return s
+	}
+	return f.Slices[0]
+}
+
+// chain returns the common names of the signer's certificate chain, leaf
+// first, as codesign lists Authority lines.
+func chain(sd *cms.SignedData) []string {
+	var names []string
+	for _, cert := range sd.Chain(sd.Signers[0]) {
+		names = append(names, cert.Subject.CommonName)
+	}
+	return names
+}
+
+// sealedResourcesLine summarizes a CodeResources file.
+func sealedResourcesLine(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	var res struct {
+		Files2 map[string]any `plist:"files2"`
+		Rules2 map[string]any `plist:"rules2"`
+	}
+	if err := plist.Unmarshal(data, &res); err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("Sealed Resources version=2 rules=%d files=%d", len(res.Rules2), len(res.Files2)), true
+}
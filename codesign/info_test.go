@@ -0,0 +1,87 @@
+package codesign
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/testbuild"
+)
+
+// buildDarwin cross-compiles an empty program for darwin/goarch into dir.
+func buildDarwin(t *testing.T, dir, goarch string) string {
+	t.Helper()
+	return testbuild.Darwin(t, goarch, filepath.Join(dir, "hello"))
+}
+
+func TestGetSignatureInfo(t *testing.T) {
+	app := filepath.Join(t.TempDir(), "Hello.app")
+	macOS := filepath.Join(app, "Contents", "MacOS")
+	if err := os.MkdirAll(macOS, 0755); err != nil {
+		t.Fatal(err)
+	}
+	buildDarwin(t, macOS, "arm64")
+	infoPlist := `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>hello</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.hello</string>
+</dict>
+</plist>
+`
+	if err := os.WriteFile(filepath.Join(app, "Contents", "Info.plist"), []byte(infoPlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := GetSignatureInfo(app)
+	if err != nil {
+		t.Fatalf("GetSignatureInfo: %v", err)
+	}
+	want := map[string]string{
+		"Executable":                  filepath.Join(macOS, "hello"),
+		"Format":                      "app bundle with Mach-O thin (arm64)",
+		"Signature":                   "adhoc",
+		"TeamIdentifier":              "not set",
+		"Hash type":                   "sha256 size=32",
+		"Info.plist entries":          "2",
+		"Sealed Resources":            "none",
+		"Internal requirements count": "0 size=0",
+	}
+	for k, v := range want {
+		if info[k] != v {
+			t.Errorf("info[%q] = %q, want %q", k, info[k], v)
+		}
+	}
+	if info["Identifier"] == "" {
+		t.Error("missing Identifier")
+	}
+	if len(info["CDHash"]) != 40 {
+		t.Errorf("CDHash = %q, want 40 hex digits", info["CDHash"])
+	}
+	if cd := info["CodeDirectory v"]; !strings.Contains(cd, "flags=0x20002(adhoc,linker-signed)") {
+		t.Errorf("CodeDirectory = %q", cd)
+	}
+	if _, ok := info["Authority"]; ok {
+		t.Error("ad-hoc signature should have no Authority")
+	}
+
+	// A bare executable is accepted too.
+	info, err = GetSignatureInfo(filepath.Join(macOS, "hello"))
+	if err != nil {
+		t.Fatalf("GetSignatureInfo(executable): %v", err)
+	}
+	if info["Format"] != "Mach-O thin (arm64)" {
+		t.Errorf("Format = %q", info["Format"])
+	}
+}
+
+func TestGetSignatureInfoUnsigned(t *testing.T) {
+	exe := buildDarwin(t, t.TempDir(), "amd64")
+	_, err := GetSignatureInfo(exe)
+	if err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("GetSignatureInfo() = %v, want not signed error", err)
+	}
+}
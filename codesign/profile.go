@@ -0,0 +1,235 @@
+package codesign
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/plist"
+)
+
+// Profile is a parsed provisioning profile (.provisionprofile).
+type Profile struct {
+	// Name is the profile name shown in the developer portal.
+	Name string
+
+	// UUID identifies the profile.
+	UUID string
+
+	// TeamIDs lists the teams the profile belongs to, usually one.
+	TeamIDs []string
+
+	// TeamName is the name of the team.
+	TeamName string
+
+	// AppIDPrefixes lists the application identifier prefixes, usually
+	// the team ID.
+	AppIDPrefixes []string
+
+	// CreationDate and ExpirationDate bound the profile's validity.
+	CreationDate   time.Time
+	ExpirationDate time.Time
+
+	// ProvisionedDevices lists the device UDIDs of a development profile.
+	// Distribution profiles have none.
+	ProvisionedDevices []string
+
+	// ProvisionsAllDevices is set for Developer ID and enterprise
+	// profiles, which are valid on any device.
+	ProvisionsAllDevices bool
+
+	// Platforms lists the platforms the profile is for, such as "OSX".
+	Platforms []string
+
+	// Entitlements holds the entitlements the profile allows. Values may
+	// be wildcards, such as "ABC123DEF4.*".
+	Entitlements map[string]any
+
+	// DeveloperCertificates lists the certificates allowed to sign code
+	// using the profile.
+	DeveloperCertificates []*x509.Certificate
+
+	// Content is the profile's property list.
+	Content []byte
+
+	// Path is the file the profile was read from, if any.
+	Path string
+}
+
+// profilePlist mirrors the keys of a provisioning profile's property list.
+type profilePlist struct {
+	Name                        string
+	UUID                        string
+	TeamIdentifier              []string
+	TeamName                    string
+	ApplicationIdentifierPrefix []string
+	CreationDate                time.Time
+	ExpirationDate              time.Time
+	ProvisionedDevices          []string
+	ProvisionsAllDevices        bool
+	Platform                    []string
+	Entitlements                map[string]any
+	DeveloperCertificates       [][]byte
+}
+
+// ReadProfile reads and parses the provisioning profile at path.
+func ReadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read provisioning profile: %w", err)
+	}
+	p, err := ParseProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p.Path = path
+	return p, nil
+}
+
+// ParseProfile parses a provisioning profile: a property list in a signed
+// CMS envelope. It checks the envelope's signature but not that the
+// signer chains to Apple, and it does not reject expired profiles.
+func ParseProfile(data []byte) (*Profile, error) {
+	sd, err := cms.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("provisioning profile: %w", err)
+	}
+	if len(sd.Content) == 0 {
+		return nil, fmt.Errorf("provisioning profile: envelope has no content")
+	}
+	for _, s := range sd.Signers {
+		if err := s.Verify(sd.Content); err != nil {
+			return nil, fmt.Errorf("provisioning profile: %w", err)
+		}
+	}
+
+	var pl profilePlist
+	if err := plist.Unmarshal(sd.Content, &pl); err != nil {
+		return nil, fmt.Errorf("provisioning profile: %w", err)
+	}
+	p := &Profile{
+		Name:                 pl.Name,
+		UUID:                 pl.UUID,
+		TeamIDs:              pl.TeamIdentifier,
+		TeamName:             pl.TeamName,
+		AppIDPrefixes:        pl.ApplicationIdentifierPrefix,
+		CreationDate:         pl.CreationDate,
+		ExpirationDate:       pl.ExpirationDate,
+		ProvisionedDevices:   pl.ProvisionedDevices,
+		ProvisionsAllDevices: pl.ProvisionsAllDevices,
+		Platforms:            pl.Platform,
+		Entitlements:         pl.Entitlements,
+		Content:              sd.Content,
+	}
+	for _, der := range pl.DeveloperCertificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("provisioning profile: developer certificate: %w", err)
+		}
+		p.DeveloperCertificates = append(p.DeveloperCertificates, cert)
+	}
+	return p, nil
+}
+
+// Expired reports whether the profile's expiration date has passed.
+func (p *Profile) Expired() bool {
+	return !p.ExpirationDate.IsZero() && time.Now().After(p.ExpirationDate)
+}
+
+// ApplicationIdentifier returns the application identifier the profile
+// grants, such as "ABC123DEF4.com.example.app" or "ABC123DEF4.*".
+func (p *Profile) ApplicationIdentifier() string {
+	id, _ := p.Entitlements["com.apple.application-identifier"].(string)
+	return id
+}
+
+// ProfileDirs returns the directories where Xcode and the developer
+// portal tools install provisioning profiles.
+func ProfileDirs() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{
+		filepath.Join(home, "Library", "MobileDevice", "Provisioning Profiles"),
+		filepath.Join(home, "Library", "Developer", "Xcode", "UserData", "Provisioning Profiles"),
+	}
+}
+
+// ErrNoProfile is returned by FindProfile when no profile matches.
+var ErrNoProfile = errors.New("no matching provisioning profile")
+
+// FindProfile returns the best macOS provisioning profile in dirs for the
+// bundle ID and team. An empty teamID matches any team. Expired profiles,
+// profiles for other platforms and unreadable files are skipped.
+//
+// A profile whose application identifier names the bundle ID exactly
+// beats a wildcard profile, and a longer wildcard beats a shorter one.
+// Among equally specific profiles, the one expiring last wins.
+func FindProfile(bundleID, teamID string, dirs ...string) (*Profile, error) {
+	var best *Profile
+	bestScore := -1
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !isProfileFile(e.Name()) {
+				continue
+			}
+			p, err := ReadProfile(filepath.Join(dir, e.Name()))
+			if err != nil || p.Expired() || !p.forMacOS() {
+				continue
+			}
+			score := p.matchScore(bundleID, teamID)
+			if score < 0 {
+				continue
+			}
+			if score > bestScore || score == bestScore && p.ExpirationDate.After(best.ExpirationDate) {
+				best, bestScore = p, score
+			}
+		}
+	}
+	if best == nil {
+		if teamID != "" {
+			return nil, fmt.Errorf("%w for %s (team %s)", ErrNoProfile, bundleID, teamID)
+		}
+		return nil, fmt.Errorf("%w for %s", ErrNoProfile, bundleID)
+	}
+	return best, nil
+}
+
+func isProfileFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".provisionprofile" || ext == ".mobileprovision"
+}
+
+// forMacOS reports whether the profile can be used for macOS apps.
+func (p *Profile) forMacOS() bool {
+	return len(p.Platforms) == 0 || slices.Contains(p.Platforms, "OSX")
+}
+
+// matchScore returns how specifically the profile's application
+// identifier matches bundleID for teamID, or -1 if it does not match.
+// Exact matches score above every wildcard.
+func (p *Profile) matchScore(bundleID, teamID string) int {
+	// The prefix is usually the team ID, but older App IDs have their own.
+	prefix, pattern, ok := strings.Cut(p.ApplicationIdentifier(), ".")
+	if !ok || teamID != "" && prefix != teamID && !slices.Contains(p.TeamIDs, teamID) {
+		return -1
+	}
+	if pattern == bundleID {
+		return len(bundleID) + 1
+	}
+	if stem, wild := strings.CutSuffix(pattern, "*"); wild && strings.HasPrefix(bundleID, stem) {
+		return len(stem)
+	}
+	return -1
+}
@@ -0,0 +1,161 @@
+package codesign
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/plist"
+	"github.com/tmc/macgo/internal/testcert"
+)
+
+// signedProfile returns a provisioning profile holding the property list
+// fields, signed by a throwaway certificate standing in for Apple's.
+func signedProfile(t *testing.T, fields map[string]any) []byte {
+	t.Helper()
+	content, err := plist.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key := testcert.CodeSigning(t, "Apple iPhone OS Provisioning Profile Signing", "")
+	data, err := cms.Sign(content, cert, key, cms.SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseProfile(t *testing.T) {
+	dev, _ := testcert.CodeSigning(t, "Developer ID Application: Example Corp (ABC123DEF4)", "ABC123DEF4")
+	created := time.Now().Add(-24 * time.Hour).UTC().Truncate(time.Second)
+	expires := created.Add(365 * 24 * time.Hour)
+	data := signedProfile(t, map[string]any{
+		"Name":                        "Example Developer ID",
+		"UUID":                        "0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0",
+		"TeamIdentifier":              []any{"ABC123DEF4"},
+		"TeamName":                    "Example Corp",
+		"ApplicationIdentifierPrefix": []any{"ABC123DEF4"},
+		"CreationDate":                created,
+		"ExpirationDate":              expires,
+		"ProvisionsAllDevices":        true,
+		"Platform":                    []any{"OSX"},
+		"Entitlements": map[string]any{
+			"com.apple.application-identifier":    "ABC123DEF4.com.example.app",
+			"com.apple.developer.team-identifier": "ABC123DEF4",
+			"keychain-access-groups":              []any{"ABC123DEF4.*"},
+		},
+		"DeveloperCertificates": []any{dev.Raw},
+	})
+	path := filepath.Join(t.TempDir(), "embedded.provisionprofile")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ReadProfile(path)
+	if err != nil {
+		t.Fatalf("ReadProfile: %v", err)
+	}
+	if p.Name != "Example Developer ID" || p.UUID != "0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0" || p.TeamName != "Example Corp" {
+		t.Errorf("profile = %+v", p)
+	}
+	if !slices.Equal(p.TeamIDs, []string{"ABC123DEF4"}) || !slices.Equal(p.AppIDPrefixes, []string{"ABC123DEF4"}) || !slices.Equal(p.Platforms, []string{"OSX"}) {
+		t.Errorf("TeamIDs = %v, AppIDPrefixes = %v, Platforms = %v", p.TeamIDs, p.AppIDPrefixes, p.Platforms)
+	}
+	if !p.CreationDate.Equal(created) || !p.ExpirationDate.Equal(expires) || p.Expired() {
+		t.Errorf("dates = %v, %v, expired = %v", p.CreationDate, p.ExpirationDate, p.Expired())
+	}
+	if !p.ProvisionsAllDevices || len(p.ProvisionedDevices) != 0 {
+		t.Errorf("ProvisionsAllDevices = %v, ProvisionedDevices = %v", p.ProvisionsAllDevices, p.ProvisionedDevices)
+	}
+	if got := p.ApplicationIdentifier(); got != "ABC123DEF4.com.example.app" {
+		t.Errorf("ApplicationIdentifier() = %q", got)
+	}
+	if groups, _ := p.Entitlements["keychain-access-groups"].([]any); len(groups) != 1 || groups[0] != "ABC123DEF4.*" {
+		t.Errorf("keychain-access-groups = %#v", p.Entitlements["keychain-access-groups"])
+	}
+	if len(p.DeveloperCertificates) != 1 || !p.DeveloperCertificates[0].Equal(dev) {
+		t.Errorf("DeveloperCertificates = %v", p.DeveloperCertificates)
+	}
+
+	expired := signedProfile(t, map[string]any{
+		"Name":           "Old",
+		"ExpirationDate": time.Now().Add(-time.Hour),
+	})
+	if p, err := ParseProfile(expired); err != nil || !p.Expired() {
+		t.Errorf("ParseProfile(expired) = %v, %v; want expired profile", p, err)
+	}
+}
+
+func TestParseProfileErrors(t *testing.T) {
+	data := signedProfile(t, map[string]any{"Name": "Tampered"})
+	i := strings.Index(string(data), "Tampered")
+	data[i] = 'X'
+	if _, err := ParseProfile(data); err == nil {
+		t.Error("ParseProfile accepted a profile whose content was modified")
+	}
+	if _, err := ParseProfile([]byte("<plist/>")); err == nil {
+		t.Error("ParseProfile accepted a profile without an envelope")
+	}
+	if _, err := ReadProfile(filepath.Join(t.TempDir(), "missing.provisionprofile")); err == nil {
+		t.Error("ReadProfile of a missing file succeeded")
+	}
+}
+
+func TestFindProfile(t *testing.T) {
+	mobileDevice, xcode := t.TempDir(), t.TempDir()
+	write := func(dir, name, appID string, expires time.Time, platform string) {
+		t.Helper()
+		team, _, _ := strings.Cut(appID, ".")
+		data := signedProfile(t, map[string]any{
+			"Name":           name,
+			"TeamIdentifier": []any{team},
+			"ExpirationDate": expires,
+			"Platform":       []any{platform},
+			"Entitlements":   map[string]any{"com.apple.application-identifier": appID},
+		})
+		if err := os.WriteFile(filepath.Join(dir, name+".provisionprofile"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	soon, later := time.Now().Add(24*time.Hour), time.Now().Add(48*time.Hour)
+	write(mobileDevice, "team-wildcard", "ABC123DEF4.*", later, "OSX")
+	write(mobileDevice, "example-wildcard", "ABC123DEF4.com.example.*", soon, "OSX")
+	write(xcode, "example-wildcard-newer", "ABC123DEF4.com.example.*", later, "OSX")
+	write(xcode, "exact-expired", "ABC123DEF4.com.example.app", time.Now().Add(-time.Hour), "OSX")
+	write(xcode, "exact-ios", "ABC123DEF4.com.example.app", later, "iOS")
+	write(xcode, "other-team", "XYZ789.com.example.other", later, "OSX")
+	if err := os.WriteFile(filepath.Join(xcode, "junk.provisionprofile"), []byte("junk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		bundleID, teamID string
+		want             string // profile name, or "" for no match
+	}{
+		{"com.example.app", "ABC123DEF4", "example-wildcard-newer"},
+		{"com.other.app", "ABC123DEF4", "team-wildcard"},
+		{"com.example.other", "XYZ789", "other-team"},
+		{"com.example.other", "", "other-team"},
+		{"com.example.app", "XYZ789", ""},
+	}
+	for _, tt := range tests {
+		p, err := FindProfile(tt.bundleID, tt.teamID, mobileDevice, xcode, filepath.Join(t.TempDir(), "missing"))
+		switch {
+		case tt.want == "" && !errors.Is(err, ErrNoProfile):
+			t.Errorf("FindProfile(%s, %s) = %v, %v; want ErrNoProfile", tt.bundleID, tt.teamID, p, err)
+		case tt.want != "" && (err != nil || p.Name != tt.want):
+			t.Errorf("FindProfile(%s, %s) = %v, %v; want %s", tt.bundleID, tt.teamID, p, err, tt.want)
+		}
+	}
+
+	write(mobileDevice, "exact", "ABC123DEF4.com.example.app", soon, "OSX")
+	p, err := FindProfile("com.example.app", "ABC123DEF4", mobileDevice, xcode)
+	if err != nil || p.Name != "exact" || p.Path != filepath.Join(mobileDevice, "exact.provisionprofile") {
+		t.Errorf("FindProfile with an exact match = %+v, %v", p, err)
+	}
+}
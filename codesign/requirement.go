@@ -0,0 +1,137 @@
+package codesign
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tmc/macgo/internal/codesig"
+	"github.com/tmc/macgo/internal/csreq"
+)
+
+// DesignatedRequirement returns the designated requirement of the signed
+// bundle or executable at path, in the code requirement language. TCC
+// and the keychain recognize a rebuilt app as the same app only while its
+// designated requirement still matches, so a change revokes the
+// permissions the user granted.
+//
+// The requirement is read in Go, as `codesign --display --requirements -`
+// prints it: the explicit requirement embedded in the signature, or else
+// the one codesign derives. Ad-hoc signatures have no certificate to
+// derive it from and pin their CDHash, which changes with every build.
+func DesignatedRequirement(path string) (string, error) {
+	exe := path
+	if fi, err := os.Stat(path); err != nil {
+		return "", err
+	} else if fi.IsDir() {
+		if exe, _, err = codesig.MainExecutable(path); err != nil {
+			return "", err
+		}
+	}
+	f, err := codesig.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	slice := hostSlice(f)
+	if slice.Signature == nil {
+		return "", fmt.Errorf("%s: %w", path, codesig.ErrNotSigned)
+	}
+	r, _, err := slice.Signature.DesignatedRequirement()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return r.String(), nil
+}
+
+// CompileRequirement compiles a requirement such as
+//
+//	identifier "com.example.app" and anchor apple generic
+//
+// to its binary form (magic 0xfade0c00), like `csreq -b`. Text holding
+// "type => requirement" entries compiles to a requirement set (magic
+// 0xfade0c01) instead.
+func CompileRequirement(text string) ([]byte, error) {
+	if strings.Contains(text, "=>") {
+		set, err := csreq.ParseSet(text)
+		if err != nil {
+			return nil, err
+		}
+		return set.Marshal()
+	}
+	r, err := csreq.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return r.Marshal()
+}
+
+// DecompileRequirement converts a binary requirement or requirement set
+// back to text. Sets are returned as "type => requirement" lines.
+func DecompileRequirement(blob []byte) (string, error) {
+	if len(blob) >= 4 && binary.BigEndian.Uint32(blob) == csreq.MagicRequirements {
+		set, err := csreq.UnmarshalSet(blob)
+		if err != nil {
+			return "", err
+		}
+		return set.String(), nil
+	}
+	r, err := csreq.Unmarshal(blob)
+	if err != nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// RequirementChange describes how a designated requirement changed
+// between two signatures.
+type RequirementChange struct {
+	Old, New string
+
+	// Removed and Added are the top-level "and" clauses found in only one
+	// of the requirements.
+	Removed, Added []string
+
+	// PinsCDHash reports that New pins a CDHash, as ad-hoc signatures do,
+	// so it will change again with the next build.
+	PinsCDHash bool
+}
+
+// String summarizes the change on one line per clause.
+func (c *RequirementChange) String() string {
+	var b strings.Builder
+	b.WriteString("designated requirement changed")
+	for _, r := range c.Removed {
+		b.WriteString("\n  - " + r)
+	}
+	for _, a := range c.Added {
+		b.WriteString("\n  + " + a)
+	}
+	return b.String()
+}
+
+// CompareRequirements compares two designated requirements in the code
+// requirement language, such as those returned by DesignatedRequirement
+// for a bundle before and after a rebuild. It returns nil when both
+// compile to the same requirement, however they are written.
+func CompareRequirements(old, new string) (*RequirementChange, error) {
+	oldReq, err := csreq.Parse(old)
+	if err != nil {
+		return nil, fmt.Errorf("old requirement: %w", err)
+	}
+	newReq, err := csreq.Parse(new)
+	if err != nil {
+		return nil, fmt.Errorf("new requirement: %w", err)
+	}
+	if oldReq.String() == newReq.String() {
+		return nil, nil
+	}
+	removed, added := csreq.Diff(oldReq, newReq)
+	return &RequirementChange{
+		Old:        oldReq.String(),
+		New:        newReq.String(),
+		Removed:    removed,
+		Added:      added,
+		PinsCDHash: newReq.Contains(csreq.OpCDHash),
+	}, nil
+}
@@ -0,0 +1,82 @@
+package codesign
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDesignatedRequirement(t *testing.T) {
+	exe := buildDarwin(t, t.TempDir(), "arm64")
+	dr, err := DesignatedRequirement(exe)
+	if err != nil {
+		t.Fatalf("DesignatedRequirement: %v", err)
+	}
+	info, err := GetSignatureInfo(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Go linker signs ad-hoc, so the requirement pins the CDHash.
+	if want := `cdhash H"` + info["CDHash"] + `"`; dr != want {
+		t.Errorf("DesignatedRequirement = %s, want %s", dr, want)
+	}
+	if _, err := DesignatedRequirement(t.TempDir()); err == nil {
+		t.Error("DesignatedRequirement of a directory without Info.plist succeeded")
+	}
+}
+
+func TestCompileRequirement(t *testing.T) {
+	for _, text := range []string{
+		`identifier "com.example.app" and anchor apple generic`,
+		"host => anchor apple\ndesignated => identifier \"com.example.app\" and certificate leaf[subject.OU] = ABCDE12345\n",
+	} {
+		blob, err := CompileRequirement(text)
+		if err != nil {
+			t.Fatalf("CompileRequirement(%q): %v", text, err)
+		}
+		got, err := DecompileRequirement(blob)
+		if err != nil {
+			t.Fatalf("DecompileRequirement: %v", err)
+		}
+		if got != text {
+			t.Errorf("DecompileRequirement(CompileRequirement(%q)) = %q", text, got)
+		}
+	}
+	if _, err := CompileRequirement("identifier"); err == nil {
+		t.Error("CompileRequirement of an incomplete requirement succeeded")
+	}
+	if _, err := DecompileRequirement([]byte{0xfa, 0xde}); err == nil {
+		t.Error("DecompileRequirement of a truncated blob succeeded")
+	}
+}
+
+func TestCompareRequirements(t *testing.T) {
+	const devID = `identifier "com.example.app" and anchor apple generic and certificate leaf[subject.OU] = ABCDE12345`
+
+	// Spelling differences are not changes.
+	change, err := CompareRequirements(devID, `identifier = com.example.app && anchor apple generic and cert leaf[subject.OU] = "ABCDE12345"`)
+	if err != nil || change != nil {
+		t.Errorf("CompareRequirements(equivalent) = %v, %v; want nil", change, err)
+	}
+
+	change, err = CompareRequirements(devID, strings.Replace(devID, "ABCDE12345", "FGHIJ67890", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(change.Removed, []string{"certificate leaf[subject.OU] = ABCDE12345"}) ||
+		!reflect.DeepEqual(change.Added, []string{"certificate leaf[subject.OU] = FGHIJ67890"}) || change.PinsCDHash {
+		t.Errorf("CompareRequirements(team change) = %+v", change)
+	}
+	if s := change.String(); !strings.Contains(s, "- certificate leaf[subject.OU] = ABCDE12345") || !strings.Contains(s, "+ certificate leaf[subject.OU] = FGHIJ67890") {
+		t.Errorf("String() = %q", s)
+	}
+
+	change, err = CompareRequirements(`cdhash H"0011"`, `cdhash H"2233"`)
+	if err != nil || change == nil || !change.PinsCDHash {
+		t.Errorf("CompareRequirements(ad-hoc rebuild) = %+v, %v; want a CDHash-pinning change", change, err)
+	}
+
+	if _, err := CompareRequirements("identifier", devID); err == nil {
+		t.Error("CompareRequirements with an invalid requirement succeeded")
+	}
+}
@@ -0,0 +1,57 @@
+package codesign
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tmc/macgo/internal/codesig"
+)
+
+// Mismatch is one difference between a signature and the code or
+// resources it covers, as found by VerifyOffline.
+type Mismatch = codesig.Mismatch
+
+// MismatchKind classifies a Mismatch.
+type MismatchKind = codesig.MismatchKind
+
+// Mismatch kinds reported by VerifyOffline.
+const (
+	MismatchPage      = codesig.MismatchPage
+	MismatchSlot      = codesig.MismatchSlot
+	MismatchSignature = codesig.MismatchSignature
+	MismatchModified  = codesig.MismatchModified
+	MismatchMissing   = codesig.MismatchMissing
+	MismatchAdded     = codesig.MismatchAdded
+)
+
+// VerifyOffline verifies the signature of a bundle or executable in Go,
+// without the codesign tool, so it works on any platform.
+//
+// It recomputes the CodeDirectory page hashes of every architecture,
+// checks the Info.plist, requirements, resource seal and entitlements
+// special slots, verifies a CMS signature over the CodeDirectory, and
+// re-hashes every file listed in _CodeSignature/CodeResources.
+//
+// An error is returned when the signature cannot be checked at all, for
+// example when the code is unsigned. Otherwise the result lists every
+// mismatch found; an empty list means the signature is intact. Unlike
+// VerifySignature, certificate trust is not evaluated.
+func VerifyOffline(path string) ([]Mismatch, error) {
+	return codesig.Verify(path)
+}
+
+// verifyOffline reports the result of VerifyOffline as an error.
+func verifyOffline(path string) error {
+	mismatches, err := VerifyOffline(path)
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	lines := make([]string, len(mismatches))
+	for i, m := range mismatches {
+		lines[i] = m.String()
+	}
+	return fmt.Errorf("signature verification failed:\n%s", strings.Join(lines, "\n"))
+}
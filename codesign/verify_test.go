@@ -0,0 +1,39 @@
+package codesign
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestVerifyOffline(t *testing.T) {
+	exe := buildDarwin(t, t.TempDir(), "arm64")
+	if ms, err := VerifyOffline(exe); err != nil || len(ms) != 0 {
+		t.Fatalf("VerifyOffline() = %v, %v; want no mismatches", ms, err)
+	}
+
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(exe, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := VerifyOffline(exe)
+	if err != nil {
+		t.Fatalf("VerifyOffline: %v", err)
+	}
+	if len(ms) != 1 || ms[0].Kind != MismatchPage {
+		t.Fatalf("VerifyOffline() = %v, want one page mismatch", ms)
+	}
+
+	if _, err := exec.LookPath("codesign"); err == nil {
+		t.Skip("codesign installed; VerifySignature does not use the offline verifier")
+	}
+	err = VerifySignature(exe)
+	if err == nil || !strings.Contains(err.Error(), ms[0].String()) {
+		t.Errorf("VerifySignature() = %v, want it to report %q", err, ms[0])
+	}
+}
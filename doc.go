@@ -121,9 +121,12 @@
 //
 //	MACGO_DEBUG               Enable debug logging to stderr (set to "1")
 //	MACGO_KEEP_BUNDLE         Preserve temporary bundle after execution (set to "1")
-//	MACGO_ICON                Path to .icns file for the app icon
+//	MACGO_BUNDLE_DIR          Directory to create app bundles in (default: $GOPATH/bin)
+//	MACGO_CACHE_DIR           Directory holding the bundle index used by "macgo bundles"
+//	MACGO_ICON                Path to .icns file, or PNG to render, for the app icon
 //	MACGO_PROVISIONING_PROFILE  Path to provisioning profile to embed
 //	MACGO_RESET_PERMISSIONS   Reset TCC permissions before requesting (set to "1")
+//	SOURCE_DATE_EPOCH         Unix time given to every bundle file, for reproducible builds
 //
 // Development:
 //
@@ -137,9 +140,9 @@
 //	MACGO_STDIN_PIPE          Path to stdin named pipe (child reads from parent)
 //	MACGO_STDOUT_PIPE         Path to stdout named pipe (child writes to parent)
 //	MACGO_STDERR_PIPE         Path to stderr named pipe (child writes to parent)
-//	MACGO_CONTROL_PIPE        Path to control FIFO (child writes PID for signal forwarding)
+//	MACGO_CONTROL_PIPE        Path to control FIFO (child writes PID, then reads open events)
 //	MACGO_CWD                 Original working directory to restore in child
-//	MACGO_BUNDLE_PATH         Path to the .app bundle
+//	MACGO_BUNDLE_PATH         Path to the .app bundle (unset by the child on startup)
 //	MACGO_ORIGINAL_EXECUTABLE Path to the original binary before bundle copy
 //	MACGO_SINGLE_PROCESS_ACTIVE  Sentinel: set to "1" after single-process re-exec
 //
@@ -155,6 +158,59 @@
 //	│   ├── Resources/
 //	│   └── _CodeSignature/
 //
+// Helpers, XPCServices and LaunchAgents add nested code, which macgo
+// signs inside out, before the app, with the app's identity:
+//
+//	cfg := macgo.NewConfig().
+//		WithHelpers(macgo.Helper{Path: "bin/agent"}).
+//		WithXPCServices(macgo.XPCService{Path: "bin/worker", Name: "Worker"}).
+//		WithLaunchAgents(macgo.LaunchAgent{Label: "com.example.agent", Program: "agent"})
+//
+// Resources copies files from an fs.FS, such as an embed.FS, into
+// Contents/Resources, where they are sealed by the signature. ResourcePath
+// finds them at run time:
+//
+//	//go:embed scripts
+//	var scripts embed.FS
+//
+//	cfg := macgo.NewConfig().WithResources(scripts)
+//	...
+//	path, err := macgo.ResourcePath("scripts/open.applescript")
+//
+// WithIconPNG and WithIconImage render the app icon, at every size from
+// 16x16 to 512x512@2x, into Contents/Resources/AppIcon.icns without
+// needing iconutil. "macgo inspect" lists the sizes a bundle's icon holds.
+//
+// Bundles are reproducible: the same executable and configuration give
+// the same files, with sorted property list keys and fixed modes, and
+// with SOURCE_DATE_EPOCH set, fixed modification times. Signatures made
+// with a certificate and a secure timestamp are the exception. macgo
+// records every file and its hash in a manifest next to the bundle, which
+// "macgo bundles verify" checks; "macgo bundles manifest" prints one for
+// comparing bundles across machines.
+//
+// # URLs and Documents
+//
+// URLTypes, DocumentTypes and ExportedTypes declare the links and files
+// that launch the app, and Events delivers them as they are opened:
+//
+//	cfg := macgo.NewConfig().
+//		WithURLSchemes("mytool").
+//		WithDocumentTypes(macgo.DocumentType{Name: "MyTool Document", ContentTypes: []string{"com.example.mytool"}}).
+//		WithExportedTypes(macgo.TypeDeclaration{Identifier: "com.example.mytool", Extensions: []string{"mytool"}})
+//	...
+//	for e := range macgo.Events() {
+//		if e.URL != "" {
+//			openURL(e.URL)
+//		} else {
+//			openFile(e.Path)
+//		}
+//	}
+//
+// When LaunchServices starts another instance of the bundle for a URL or
+// file while a relaunched child is running, that instance passes the
+// request to the child through the control pipe and exits.
+//
 // # Bundle ID Generation
 //
 // macgo generates bundle IDs from your Go module path:
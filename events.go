@@ -0,0 +1,63 @@
+package macgo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OpenEvent is a request from LaunchServices to open a URL or a file:
+// a link with one of the Config.URLTypes schemes was followed, or a file
+// of one of the Config.DocumentTypes was opened.
+type OpenEvent struct {
+	// URL is the URL to open, or "" for a file.
+	URL string
+
+	// Path is the file to open, or "" for a URL.
+	Path string
+}
+
+var (
+	eventsOnce sync.Once
+	events     = make(chan OpenEvent, 64)
+)
+
+// Events returns the channel on which open events are delivered. The
+// first call starts receiving them, including the URLs and files the app
+// was launched with, which LaunchServices holds until then.
+//
+// In the relaunched child, Events also receives the requests that reach
+// another instance of the bundle while the child runs: that instance
+// passes them on through the control pipe and exits.
+//
+// Open events are only delivered on macOS; elsewhere the channel never
+// receives.
+func Events() <-chan OpenEvent {
+	eventsOnce.Do(startEvents)
+	return events
+}
+
+// marshal returns e as a control pipe line.
+func (e OpenEvent) marshal() string {
+	if e.URL != "" {
+		return "url " + strconv.Quote(e.URL) + "\n"
+	}
+	return "file " + strconv.Quote(e.Path) + "\n"
+}
+
+// parseOpenEvent parses a control pipe line written by marshal.
+func parseOpenEvent(line string) (OpenEvent, error) {
+	kind, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	s, err := strconv.Unquote(arg)
+	if err != nil {
+		return OpenEvent{}, fmt.Errorf("macgo: invalid open event %q", line)
+	}
+	switch kind {
+	case "url":
+		return OpenEvent{URL: s}, nil
+	case "file":
+		return OpenEvent{Path: s}, nil
+	}
+	return OpenEvent{}, fmt.Errorf("macgo: invalid open event %q", line)
+}
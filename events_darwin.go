@@ -0,0 +1,143 @@
+package macgo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tmc/macgo/internal/appleevent"
+	"github.com/tmc/macgo/internal/launch"
+)
+
+// launchEventTimeout bounds how long a bundle instance waits for the
+// Apple event it was launched with.
+const launchEventTimeout = 2 * time.Second
+
+// handshakeDone is closed once writeChildPID is done with the control
+// pipe. Until then the pipe carries the child's PID to the parent, so
+// the child must not read it.
+var (
+	handshakeDone = make(chan struct{})
+	handshakeOnce sync.Once
+)
+
+// finishHandshake closes handshakeDone.
+func finishHandshake() {
+	handshakeOnce.Do(func() { close(handshakeDone) })
+}
+
+// launchEvent receives the kind of the first Apple event, after the
+// open events it carries have been delivered.
+var launchEvent = make(chan appleevent.Kind, 1)
+
+func startEvents() {
+	debug := os.Getenv("MACGO_DEBUG") == "1"
+	err := appleevent.Listen(func(e appleevent.Event) {
+		if e.URL != "" {
+			events <- OpenEvent{URL: e.URL}
+		}
+		for _, path := range e.Paths {
+			events <- OpenEvent{Path: path}
+		}
+		select {
+		case launchEvent <- e.Kind:
+		default:
+		}
+	})
+	if err != nil && debug {
+		fmt.Fprintf(os.Stderr, "macgo: receiving Apple events: %v\n", err)
+	}
+	if controlPipe := os.Getenv("MACGO_CONTROL_PIPE"); controlPipe != "" {
+		go readControlEvents(controlPipe, debug)
+	}
+}
+
+// readControlEvents delivers the open events other instances of the
+// bundle write to the control pipe once the PID handshake is done. Each
+// open blocks until a writer arrives; it fails once the parent has
+// removed the pipe.
+func readControlEvents(controlPipe string, debug bool) {
+	<-handshakeDone
+	for {
+		f, err := os.Open(controlPipe)
+		if err != nil {
+			return
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			e, err := parseOpenEvent(sc.Text())
+			if err != nil {
+				if debug {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+				}
+				continue
+			}
+			events <- e
+		}
+		f.Close()
+	}
+}
+
+// forwardOpenEvents passes the URLs and files this bundle instance was
+// launched to open to the child of a running macgo session of the same
+// bundle, and exits if it did. LaunchServices launches such an instance
+// when it does not see the child as the bundle's running application.
+// Without a session reading open events, or when the instance was
+// launched without documents, it returns and the instance runs normally.
+func forwardOpenEvents(cfg *Config) {
+	// Only LaunchServices, by way of launchd, delivers open events. An
+	// executable run directly from a shell has none to wait for.
+	if os.Getppid() != 1 {
+		return
+	}
+	bundlePath, err := currentBundle()
+	if err != nil {
+		return
+	}
+	// Opening for writing fails unless the child reads the control pipe.
+	f, err := os.OpenFile(launch.ControlLink(bundlePath), os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	eventsOnce.Do(startEvents)
+	select {
+	case kind := <-launchEvent:
+		if kind != appleevent.OpenDocuments && kind != appleevent.GetURL {
+			return
+		}
+	case <-time.After(launchEventTimeout):
+		return
+	}
+	var pending []OpenEvent
+	var lines strings.Builder
+drain:
+	for {
+		select {
+		case e := <-events:
+			pending = append(pending, e)
+			lines.WriteString(e.marshal())
+		default:
+			break drain
+		}
+	}
+	if _, err := f.WriteString(lines.String()); err != nil {
+		if cfg.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: forwarding open events: %v\n", err)
+		}
+		// Handle them here instead.
+		for _, e := range pending {
+			events <- e
+		}
+		return
+	}
+	if cfg.Debug {
+		fmt.Fprintf(os.Stderr, "macgo: forwarded %d open events to the running instance\n", len(pending))
+	}
+	os.Exit(0)
+}
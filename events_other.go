@@ -0,0 +1,5 @@
+//go:build !darwin
+
+package macgo
+
+func startEvents() {}
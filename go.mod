@@ -4,4 +4,4 @@ go 1.24.0
 
 require golang.org/x/sys v0.39.0
 
-require github.com/ebitengine/purego v0.9.1 // indirect
+require github.com/ebitengine/purego v0.9.1
@@ -0,0 +1,51 @@
+// Package appleevent receives the Apple events LaunchServices sends an
+// application when it is launched or asked to open URLs and documents.
+//
+// It services the process's Apple event Mach port on a dedicated thread,
+// so it works in programs that never run an AppKit event loop. Programs
+// that do run one receive these events through NSApplication instead.
+package appleevent
+
+// Kind identifies an Apple event.
+type Kind int
+
+const (
+	// OpenApplication is sent when the application is launched without
+	// documents ('aevt'/'oapp').
+	OpenApplication Kind = iota + 1
+
+	// ReopenApplication is sent when the running application is launched
+	// again, for example from the Dock ('aevt'/'rapp').
+	ReopenApplication
+
+	// OpenDocuments asks the application to open files ('aevt'/'odoc').
+	OpenDocuments
+
+	// GetURL asks the application to open a URL ('GURL'/'GURL').
+	GetURL
+)
+
+func (k Kind) String() string {
+	switch k {
+	case OpenApplication:
+		return "oapp"
+	case ReopenApplication:
+		return "rapp"
+	case OpenDocuments:
+		return "odoc"
+	case GetURL:
+		return "GURL"
+	}
+	return "unknown"
+}
+
+// Event is a received Apple event.
+type Event struct {
+	Kind Kind
+
+	// URL is the URL of a GetURL event.
+	URL string
+
+	// Paths are the files of an OpenDocuments event.
+	Paths []string
+}
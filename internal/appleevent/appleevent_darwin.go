@@ -0,0 +1,229 @@
+package appleevent
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// Mach message receive options and results (mach/message.h).
+const (
+	machRcvMsg      = 0x00000002
+	machRcvLarge    = 0x00000004
+	machRcvTooLarge = 0x10004004
+
+	// maxTrailerSize bounds the trailer the kernel appends to a
+	// received message.
+	maxTrailerSize = 68
+)
+
+// aeDesc is an AEDesc: a descriptor type and an opaque data handle.
+type aeDesc struct {
+	descriptorType uint32
+	dataHandle     uintptr
+}
+
+// Four-character codes of the handled events and their parameters.
+var (
+	classCore       = fourCC("aevt")
+	classInternet   = fourCC("GURL")
+	idOpenApp       = fourCC("oapp")
+	idReopenApp     = fourCC("rapp")
+	idOpenDocuments = fourCC("odoc")
+	idGetURL        = fourCC("GURL")
+
+	keyDirectObject   = fourCC("----")
+	keyEventClassAttr = fourCC("evcl")
+	keyEventIDAttr    = fourCC("evid")
+	typeType          = fourCC("type")
+	typeUTF8Text      = fourCC("utf8")
+	typeFileURL       = fourCC("furl")
+	typeAEList        = fourCC("list")
+)
+
+// CoreServices and libSystem functions, loaded by load.
+var (
+	fnAEInstallEventHandler   func(class, id uint32, handler, refcon uintptr, isSys bool) int16
+	fnAEGetRegisteredMachPort func() uint32
+	fnAEProcessMessage        func(msg *byte) int32
+	fnAEGetAttributePtr       func(evt uintptr, key, desiredType uint32, actualType *uint32, data *byte, max int64, actual *int64) int16
+	fnAEGetParamPtr           func(evt uintptr, key, desiredType uint32, actualType *uint32, data *byte, max int64, actual *int64) int16
+	fnAEGetParamDesc          func(evt uintptr, key, desiredType uint32, result *aeDesc) int16
+	fnAECountItems            func(list *aeDesc, count *int64) int16
+	fnAEGetNthPtr             func(list *aeDesc, index int64, desiredType uint32, keyword, typeCode *uint32, data *byte, max int64, actual *int64) int16
+	fnAEDisposeDesc           func(desc *aeDesc) int16
+	fnMachMsg                 func(msg *byte, option int32, sendSize, rcvSize, rcvName, timeout, notify uint32) int32
+)
+
+var (
+	loadOnce   sync.Once
+	loadErr    error
+	listenOnce sync.Once
+	listenErr  error
+	handler    func(Event)
+)
+
+// fourCC returns the four-character code s as a uint32, the encoding of
+// AEEventClass, AEEventID, AEKeyword and DescType values.
+func fourCC(s string) uint32 {
+	return uint32(s[0])<<24 | uint32(s[1])<<16 | uint32(s[2])<<8 | uint32(s[3])
+}
+
+func load() error {
+	loadOnce.Do(func() {
+		libCoreServices, err := purego.Dlopen("/System/Library/Frameworks/CoreServices.framework/CoreServices", purego.RTLD_LAZY|purego.RTLD_GLOBAL)
+		if err != nil {
+			loadErr = fmt.Errorf("load CoreServices: %w", err)
+			return
+		}
+		libSystem, err := purego.Dlopen("/usr/lib/libSystem.B.dylib", purego.RTLD_LAZY|purego.RTLD_GLOBAL)
+		if err != nil {
+			loadErr = fmt.Errorf("load libSystem: %w", err)
+			return
+		}
+		purego.RegisterLibFunc(&fnAEInstallEventHandler, libCoreServices, "AEInstallEventHandler")
+		purego.RegisterLibFunc(&fnAEGetRegisteredMachPort, libCoreServices, "AEGetRegisteredMachPort")
+		purego.RegisterLibFunc(&fnAEProcessMessage, libCoreServices, "AEProcessMessage")
+		purego.RegisterLibFunc(&fnAEGetAttributePtr, libCoreServices, "AEGetAttributePtr")
+		purego.RegisterLibFunc(&fnAEGetParamPtr, libCoreServices, "AEGetParamPtr")
+		purego.RegisterLibFunc(&fnAEGetParamDesc, libCoreServices, "AEGetParamDesc")
+		purego.RegisterLibFunc(&fnAECountItems, libCoreServices, "AECountItems")
+		purego.RegisterLibFunc(&fnAEGetNthPtr, libCoreServices, "AEGetNthPtr")
+		purego.RegisterLibFunc(&fnAEDisposeDesc, libCoreServices, "AEDisposeDesc")
+		purego.RegisterLibFunc(&fnMachMsg, libSystem, "mach_msg")
+	})
+	return loadErr
+}
+
+// Listen installs handlers for the open application, reopen, open
+// documents and get URL events and starts receiving Apple events. fn is
+// called for each event on the receiving thread, so it should hand the
+// event off rather than block. Only the first call installs fn; later
+// calls return the first call's result.
+func Listen(fn func(Event)) error {
+	listenOnce.Do(func() {
+		listenErr = listen(fn)
+	})
+	return listenErr
+}
+
+func listen(fn func(Event)) error {
+	if err := load(); err != nil {
+		return err
+	}
+	handler = fn
+	callback := purego.NewCallback(handleEvent)
+	for _, h := range []struct{ class, id uint32 }{
+		{classCore, idOpenApp},
+		{classCore, idReopenApp},
+		{classCore, idOpenDocuments},
+		{classInternet, idGetURL},
+	} {
+		if err := fnAEInstallEventHandler(h.class, h.id, callback, 0, false); err != 0 {
+			return fmt.Errorf("AEInstallEventHandler: OSErr %d", err)
+		}
+	}
+	port := fnAEGetRegisteredMachPort()
+	if port == 0 {
+		return fmt.Errorf("no Apple event port registered for this process")
+	}
+	go receive(port)
+	return nil
+}
+
+// receive dispatches the messages arriving on port to the installed
+// handlers. AEProcessMessage calls back on this thread.
+func receive(port uint32) {
+	runtime.LockOSThread()
+	buf := make([]byte, 4096)
+	for {
+		kr := fnMachMsg(&buf[0], machRcvMsg|machRcvLarge, 0, uint32(len(buf)), port, 0, 0)
+		if kr == machRcvTooLarge {
+			// The message stays queued; msgh_size reports its size.
+			size := *(*uint32)(unsafe.Pointer(&buf[4]))
+			buf = make([]byte, size+maxTrailerSize)
+			continue
+		}
+		if kr != 0 {
+			return
+		}
+		fnAEProcessMessage(&buf[0])
+	}
+}
+
+// handleEvent is the AEEventHandlerProcPtr for all installed events.
+func handleEvent(evt, reply, refcon uintptr) uintptr {
+	var class, id uint32
+	fnAEGetAttributePtr(evt, keyEventClassAttr, typeType, nil, (*byte)(unsafe.Pointer(&class)), 4, nil)
+	fnAEGetAttributePtr(evt, keyEventIDAttr, typeType, nil, (*byte)(unsafe.Pointer(&id)), 4, nil)
+
+	var e Event
+	switch {
+	case class == classCore && id == idOpenApp:
+		e.Kind = OpenApplication
+	case class == classCore && id == idReopenApp:
+		e.Kind = ReopenApplication
+	case class == classCore && id == idOpenDocuments:
+		e.Kind = OpenDocuments
+		e.Paths = documentPaths(evt)
+	case class == classInternet && id == idGetURL:
+		e.Kind = GetURL
+		e.URL = string(paramBytes(evt, keyDirectObject, typeUTF8Text))
+	default:
+		return 0
+	}
+	handler(e)
+	return 0
+}
+
+// paramBytes returns the parameter key of evt coerced to desiredType.
+func paramBytes(evt uintptr, key, desiredType uint32) []byte {
+	buf := make([]byte, 1024)
+	for {
+		var actual int64
+		if fnAEGetParamPtr(evt, key, desiredType, nil, &buf[0], int64(len(buf)), &actual) != 0 {
+			return nil
+		}
+		if actual <= int64(len(buf)) {
+			return buf[:actual]
+		}
+		buf = make([]byte, actual)
+	}
+}
+
+// documentPaths returns the files listed in the direct object of an open
+// documents event.
+func documentPaths(evt uintptr) []string {
+	var list aeDesc
+	if fnAEGetParamDesc(evt, keyDirectObject, typeAEList, &list) != 0 {
+		return nil
+	}
+	defer fnAEDisposeDesc(&list)
+	var n int64
+	if fnAECountItems(&list, &n) != 0 {
+		return nil
+	}
+	var paths []string
+	buf := make([]byte, 4096)
+	for i := int64(1); i <= n; i++ {
+		var actual int64
+		if fnAEGetNthPtr(&list, i, typeFileURL, nil, nil, &buf[0], int64(len(buf)), &actual) != 0 {
+			continue
+		}
+		if actual > int64(len(buf)) {
+			buf = make([]byte, actual)
+			i--
+			continue
+		}
+		u, err := url.Parse(string(buf[:actual]))
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		paths = append(paths, u.Path)
+	}
+	return paths
+}
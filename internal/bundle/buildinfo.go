@@ -0,0 +1,147 @@
+package bundle
+
+import (
+	"debug/buildinfo"
+	"maps"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tmc/macgo/internal/codesig"
+)
+
+// Info.plist keys recording the VCS state the executable was built from.
+const (
+	infoKeyVCSRevision = "GoVCSRevision"
+	infoKeyVCSTime     = "GoVCSTime"
+	infoKeyVCSModified = "GoVCSModified"
+)
+
+// buildMetadata is bundle metadata derived from the executable: its Go
+// build information, as debug.ReadBuildInfo reports it to the running
+// program, and its Mach-O load commands.
+type buildMetadata struct {
+	version     string // main module version, as "1.2.3"
+	revision    string // vcs.revision
+	time        time.Time
+	modified    bool
+	hasModified bool // vcs.modified is recorded
+	minOS       string
+}
+
+// versionRe matches the release part of a module version.
+var versionRe = regexp.MustCompile(`^v(\d+\.\d+\.\d+)(?:[-+]|$)`)
+
+// readBuildMetadata reads the metadata of the bundle executable built
+// from execPaths. Unreadable files contribute nothing.
+func readBuildMetadata(execPaths []string) buildMetadata {
+	var m buildMetadata
+	if info, err := buildinfo.ReadFile(execPaths[0]); err == nil {
+		// "(devel)" and other non-release versions are ignored. A
+		// pseudo-version such as v1.2.4-0.20240101120000-abcdef is
+		// reported as the release it precedes.
+		if sm := versionRe.FindStringSubmatch(info.Main.Version); sm != nil {
+			m.version = sm[1]
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				m.revision = s.Value
+			case "vcs.time":
+				m.time, _ = time.Parse(time.RFC3339, s.Value)
+			case "vcs.modified":
+				m.modified = s.Value == "true"
+				m.hasModified = true
+			}
+		}
+	}
+
+	// A universal executable runs on the oldest system any slice supports.
+	for _, path := range execPaths {
+		f, err := codesig.Open(path)
+		if err != nil {
+			continue
+		}
+		for _, s := range f.Slices {
+			if v := s.MinOS(); v != "" && (m.minOS == "" || compareVersions(v, m.minOS) < 0) {
+				m.minOS = v
+			}
+		}
+	}
+	return m
+}
+
+// compareVersions compares dotted numeric versions such as "10.15.7".
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(as), len(bs)) {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		// Compare numerically without parsing: longer is larger.
+		x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+		if len(x) != len(y) {
+			return len(x) - len(y)
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// buildNumber returns a CFBundleVersion derived from the commit time,
+// such as "20240501.123456", which increases with every commit.
+func (m buildMetadata) buildNumber() string {
+	if m.time.IsZero() {
+		return ""
+	}
+	return m.time.UTC().Format("20060102.150405")
+}
+
+// infoKeys returns the Info.plist keys derived from the metadata. The
+// CFBundleVersion build number is omitted when the version was set
+// explicitly, so Config.Version still sets both version keys.
+func (m buildMetadata) infoKeys(explicitVersion bool) map[string]any {
+	keys := map[string]any{}
+	if n := m.buildNumber(); n != "" && !explicitVersion {
+		keys["CFBundleVersion"] = n
+	}
+	if m.revision != "" {
+		keys[infoKeyVCSRevision] = m.revision
+	}
+	if !m.time.IsZero() {
+		keys[infoKeyVCSTime] = m.time.UTC().Format(time.RFC3339)
+	}
+	if m.hasModified {
+		keys[infoKeyVCSModified] = m.modified
+	}
+	if m.minOS != "" {
+		keys["LSMinimumSystemVersion"] = m.minOS
+	}
+	return keys
+}
+
+// withBuildInfo returns template extended with the keys derived from the
+// executable that it does not set itself. The derived keys thus rank
+// above macgo's defaults and below the template and Config.Info.
+func (b *Bundle) withBuildInfo(template map[string]any) map[string]any {
+	keys := b.buildMeta.infoKeys(b.Config.Version != "")
+	if len(keys) == 0 {
+		return template
+	}
+	merged := maps.Clone(template)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	for k, v := range keys {
+		if _, ok := merged[k]; !ok {
+			merged[k] = v
+		}
+	}
+	return merged
+}
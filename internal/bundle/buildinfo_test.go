@@ -0,0 +1,102 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmc/macgo/internal/plist"
+	"github.com/tmc/macgo/internal/testbuild"
+)
+
+func TestCreate_BuildInfo(t *testing.T) {
+	execPath := filepath.Join(t.TempDir(), "hello")
+	revision := testbuild.DarwinTagged(t, "arm64", execPath, "v1.2.3")
+	bundleDir := t.TempDir()
+
+	info := func(cfg *Config) map[string]any {
+		t.Helper()
+		cfg.BundleID = "com.example.hello"
+		cfg.BundleDir = bundleDir
+		b, err := New(execPath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Create(); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(b.Path, "Contents", "Info.plist"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var info map[string]any
+		if err := plist.Unmarshal(data, &info); err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	got := info(&Config{AppName: "BuildInfoApp"})
+	for key, want := range map[string]any{
+		"CFBundleShortVersionString": "1.2.3",
+		"CFBundleVersion":            "20240501.123456",
+		infoKeyVCSRevision:           revision,
+		infoKeyVCSTime:               "2024-05-01T12:34:56Z",
+		infoKeyVCSModified:           false,
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+	if v, _ := got["LSMinimumSystemVersion"].(string); v == "" {
+		t.Error("LSMinimumSystemVersion not set from the executable")
+	}
+
+	// Explicit values take precedence over derived ones.
+	got = info(&Config{
+		AppName: "ExplicitApp",
+		Version: "2.0",
+		Info:    map[string]any{"LSMinimumSystemVersion": "14.0"},
+	})
+	for key, want := range map[string]any{
+		"CFBundleShortVersionString": "2.0",
+		"CFBundleVersion":            "2.0",
+		"LSMinimumSystemVersion":     "14.0",
+		infoKeyVCSRevision:           revision,
+	} {
+		if got[key] != want {
+			t.Errorf("explicit config: %s = %v, want %v", key, got[key], want)
+		}
+	}
+}
+
+func TestReadBuildMetadataVersion(t *testing.T) {
+	for version, want := range map[string]string{
+		"v1.2.3":                               "1.2.3",
+		"v1.2.4-0.20240501123456-abcdefabcdef": "1.2.4",
+		"v2.0.0-rc.1":                          "2.0.0",
+		"v1.2.3+dirty":                         "1.2.3",
+		"(devel)":                              "",
+		"":                                     "",
+	} {
+		got := ""
+		if sm := versionRe.FindStringSubmatch(version); sm != nil {
+			got = sm[1]
+		}
+		if got != want {
+			t.Errorf("version of %q = %q, want %q", version, got, want)
+		}
+	}
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"10.15.7", "11.0", -1},
+		{"13.0", "13.0", 0},
+		{"12.10", "12.9", 1},
+	} {
+		if got := compareVersions(tc.a, tc.b); got < 0 != (tc.want < 0) || got > 0 != (tc.want > 0) {
+			t.Errorf("compareVersions(%s, %s) = %d, want sign %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -1,14 +1,40 @@
 // Package bundle provides macOS app bundle creation and management functionality.
 // This package handles the creation, configuration, and signing of macOS app bundles
 // for Go applications that need to access protected system resources.
+//
+// A bundle is created and then signed:
+//
+//	b, err := bundle.New(execPath, cfg)
+//	if err != nil {
+//		return err
+//	}
+//	if err := b.Create(); err != nil {
+//		return err
+//	}
+//	defer b.Discard()
+//	if err := b.Sign(); err != nil {
+//		return err
+//	}
+//
+// When cfg signs the bundle, Create leaves it staged and locked against
+// other creators until Sign or Discard. Discard does nothing after a
+// successful Sign, so deferring it is always safe. A staged bundle that
+// is dropped without either is discarded when garbage collected.
 package bundle
 
 import (
 	"fmt"
+	"image"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
+	"time"
 
+	"github.com/tmc/macgo/codesign"
 	"github.com/tmc/macgo/internal/plist"
 	"github.com/tmc/macgo/internal/system"
 )
@@ -30,6 +56,40 @@ const (
 	UIModeRegular UIMode = "regular"
 )
 
+// Signer selects the implementation used to code sign bundles.
+type Signer string
+
+const (
+	// SignerAuto uses Apple's codesign tool when it is installed and the
+	// built-in signer otherwise.
+	SignerAuto Signer = ""
+
+	// SignerCodesign always uses Apple's codesign tool.
+	SignerCodesign Signer = "codesign"
+
+	// SignerBuiltin uses macgo's pure-Go ad-hoc signer. It does not need
+	// Xcode or the command line tools, but supports only the "-" identity.
+	SignerBuiltin Signer = "builtin"
+)
+
+// TimestampPolicy controls whether certificate signatures carry a secure
+// timestamp from a time-stamping authority. Ad-hoc signatures never do.
+type TimestampPolicy string
+
+const (
+	// TimestampRequired fails signing when no timestamp can be obtained,
+	// as codesign --timestamp does. The empty policy means the same.
+	TimestampRequired TimestampPolicy = "required"
+
+	// TimestampOptional signs without a timestamp, with a warning, when
+	// the authority cannot be reached.
+	TimestampOptional TimestampPolicy = "optional"
+
+	// TimestampNone never requests a timestamp. Notarization rejects
+	// signatures without one.
+	TimestampNone TimestampPolicy = "none"
+)
+
 // Bundle represents a macOS app bundle with its configuration and management methods.
 type Bundle struct {
 	// Path is the full path to the .app bundle directory
@@ -50,8 +110,36 @@ type Bundle struct {
 	// version is the application version
 	version string
 
+	// buildMeta is the metadata derived from the executable
+	buildMeta buildMetadata
+
+	// modTime is the modification time given to every file of the
+	// bundle, from SOURCE_DATE_EPOCH, or zero to keep the write times
+	modTime time.Time
+
 	// reused indicates the bundle was reused from a previous run (no signing needed)
 	reused bool
+
+	// previousRequirement is the designated requirement of the bundle
+	// this one replaced, recorded by Create before removing it.
+	previousRequirement string
+
+	// requirementChange is how Sign changed the designated requirement
+	// from previousRequirement, or nil.
+	requirementChange *codesign.RequirementChange
+
+	// staging is the directory holding the bundle while it is built and
+	// signed, and target is where the bundle goes once done. staging is
+	// empty once the bundle is in place.
+	staging string
+	target  string
+
+	// lock holds the bundle's creation lock while it is staged.
+	lock *os.File
+
+	// cleanup discards the staged bundle if b is garbage collected
+	// before commit or Discard.
+	cleanup runtime.Cleanup
 }
 
 // Config holds configuration options for bundle creation and signing.
@@ -63,7 +151,9 @@ type Config struct {
 	// BundleID is the bundle identifier. Defaults to inferred from module path or environment.
 	BundleID string
 
-	// Version is the application version. Defaults to "1.0.0".
+	// Version is the application version. Defaults to the main module
+	// version recorded in the executable's Go build information, such
+	// as "1.2.3" for v1.2.3, or "1.0.0".
 	Version string
 
 	// Permissions are the requested macOS permissions.
@@ -99,9 +189,35 @@ type Config struct {
 	// CodeSigningIdentifier is the identifier to use for code signing.
 	CodeSigningIdentifier string
 
+	// Signer selects the code signing implementation. Defaults to SignerAuto.
+	Signer Signer
+
+	// IdentityProvider, when set, supplies the signing identity instead of
+	// the login keychain. CodeSignIdentity selects an identity from it by
+	// name or SHA-1 fingerprint; when empty, the strongest (or only)
+	// identity is used. Identities with a private key, such as those of a
+	// codesign.FileProvider, are signed by the built-in signer.
+	IdentityProvider codesign.IdentityProvider
+
+	// TimestampPolicy controls secure timestamps on certificate
+	// signatures. Defaults to TimestampRequired.
+	TimestampPolicy TimestampPolicy
+
+	// TimestampURL is the RFC 3161 time-stamping authority. Defaults to
+	// Apple's, which codesign also uses.
+	TimestampURL string
+
 	// Info allows specifying custom Info.plist keys.
 	Info map[string]interface{}
 
+	// InfoPlistTemplate is the path to an XML or binary Info.plist whose
+	// keys are deep-merged beneath the generated keys and Info.
+	InfoPlistTemplate string
+
+	// InfoPlistTemplateData is an in-memory Info.plist template. It is used
+	// instead of InfoPlistTemplate when both are set.
+	InfoPlistTemplateData []byte
+
 	// UIMode controls how the app appears in the UI.
 	// Default (empty or UIModeBackground): LSBackgroundOnly=true for CLI tools.
 	UIMode UIMode
@@ -114,14 +230,104 @@ type Config struct {
 	// ProvisioningProfile is the path to a provisioning profile to embed in the bundle.
 	ProvisioningProfile string
 
+	// AutoProvisioningProfile, when ProvisioningProfile is empty, embeds
+	// the best installed profile matching the bundle ID and signing team.
+	AutoProvisioningProfile bool
+
+	// ProfileDirs are searched for profiles by AutoProvisioningProfile,
+	// after the standard Xcode profile directories.
+	ProfileDirs []string
+
 	// IconPath is the path to an .icns file to use as the app icon.
 	IconPath string
 
+	// IconPNG is the path to a PNG image from which the app icon is
+	// rendered, at every size from 16x16 to 512x512@2x. It takes
+	// precedence over IconPath.
+	IconPNG string
+
+	// IconImage is an image from which the app icon is rendered, like
+	// IconPNG. It takes precedence over IconPNG and IconPath.
+	IconImage image.Image
+
+	// ExtraExecutables are builds of the program for other architectures.
+	// When set, the bundle executable is a universal binary combining the
+	// running executable with these (thin or universal) Mach-O files.
+	ExtraExecutables []string
+
+	// Architectures optionally lists the architectures of the universal
+	// bundle executable, in order ("arm64", "x86_64" or "amd64", ...).
+	// Each must be provided by the running executable or ExtraExecutables.
+	Architectures []string
+
+	// Helpers are executables copied into Contents/MacOS or
+	// Contents/Helpers and signed with the bundle.
+	Helpers []Helper
+
+	// XPCServices are XPC service bundles built in Contents/XPCServices
+	// and signed with the bundle.
+	XPCServices []XPCService
+
+	// LaunchAgents are launchd property lists written to
+	// Contents/Library/LaunchAgents.
+	LaunchAgents []LaunchAgent
+
+	// Resources holds files to copy into Contents/Resources.
+	Resources fs.FS
+
+	// ResourceMap maps files or directories in Resources to paths under
+	// Contents/Resources. Without it, all of Resources is copied.
+	ResourceMap map[string]string
+
+	// URLTypes are the URL schemes the app opens (CFBundleURLTypes).
+	URLTypes []URLType
+
+	// DocumentTypes are the kinds of file the app opens
+	// (CFBundleDocumentTypes).
+	DocumentTypes []DocumentType
+
+	// ExportedTypes are the uniform type identifiers the app declares
+	// (UTExportedTypeDeclarations).
+	ExportedTypes []TypeDeclaration
+
+	// BundleDir is the directory bundles are created in. Defaults to
+	// $GOPATH/bin, then ~/go/bin if it exists, then the temp dir.
+	BundleDir string
+
+	// PostCreateHook is called by Create with the path of the staged
+	// bundle once its contents are written, before it is signed and
+	// renamed into place. A bundle with a hook is rebuilt by every
+	// Create rather than reused, so the hook always sees a fresh bundle.
+	PostCreateHook func(bundlePath string) error
+
 	// ResolvedSigningIdentity is set during Sign() to the identity actually used.
 	// PostCreateHook users can read this to sign inner binaries with the same identity.
 	ResolvedSigningIdentity string
 }
 
+// bundleRoot returns the directory bundles are created in: BundleDir if
+// set, else $GOPATH/bin, else ~/go/bin if it exists, else the temp dir.
+func (c *Config) bundleRoot() string {
+	if c.BundleDir != "" {
+		return c.BundleDir
+	}
+	if goPath := os.Getenv("GOPATH"); goPath != "" {
+		return filepath.Join(goPath, "bin")
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		goBinDir := filepath.Join(homeDir, "go", "bin")
+		if _, err := os.Stat(goBinDir); err == nil {
+			return goBinDir
+		}
+	}
+	return os.TempDir()
+}
+
+// signs reports whether Sign will sign the bundle.
+func (c *Config) signs() bool {
+	return c.IdentityProvider != nil || c.CodeSignIdentity != "" || c.AdHocSign || c.AutoSign
+}
+
 // shouldCleanupBundle returns true if the bundle should be removed.
 // Defaults to false (bundle is kept for reuse).
 func (c *Config) shouldCleanupBundle() bool {
@@ -151,73 +357,108 @@ func New(execPath string, config *Config) (*Bundle, error) {
 		bundleID = system.InferBundleID(appName)
 	}
 
+	modTime, err := sourceDateEpoch()
+	if err != nil {
+		return nil, err
+	}
+
 	// Determine version
+	build := readBuildMetadata(append([]string{execPath}, config.ExtraExecutables...))
 	version := config.Version
+	if version == "" {
+		version = build.version
+	}
 	if version == "" {
 		version = "1.0.0"
 	}
 
 	return &Bundle{
-		Config:   config,
-		execPath: execPath,
-		appName:  appName,
-		bundleID: bundleID,
-		version:  version,
+		Config:    config,
+		execPath:  execPath,
+		appName:   appName,
+		bundleID:  bundleID,
+		version:   version,
+		buildMeta: build,
+		modTime:   modTime,
 	}, nil
 }
 
 // Create creates the app bundle with the configured settings.
 // This method implements the functionality from createSimpleBundle.
+//
+// The bundle is built in a staging directory next to its final location,
+// with Path pointing there, while holding an advisory lock that makes
+// concurrent creators of the same bundle wait; one that waited finds the
+// winner's bundle up to date and reuses it. If the configuration signs
+// the bundle, Create returns with the bundle still staged and the lock
+// held, and the caller must go on to call either Sign, which moves the
+// bundle into place, or Discard; other processes creating the bundle
+// wait until then. Otherwise Create moves the bundle into place and
+// releases the lock itself. An up-to-date bundle at the final path is
+// reused instead, unless the configuration has a PostCreateHook, which
+// Create runs on the staged bundle before either step.
 func (b *Bundle) Create() error {
-	// Determine bundle location - prefer ~/go/bin/ if it exists
-	bundleBaseDir := os.TempDir()
-	if goPath := os.Getenv("GOPATH"); goPath != "" {
-		bundleBaseDir = filepath.Join(goPath, "bin")
-	} else if homeDir, err := os.UserHomeDir(); err == nil {
-		goBinDir := filepath.Join(homeDir, "go", "bin")
-		if _, err := os.Stat(goBinDir); err == nil {
-			bundleBaseDir = goBinDir
-		}
+	root := b.Config.bundleRoot()
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
 	}
-
-	// Create bundle directory
-	bundleDir := filepath.Join(bundleBaseDir, b.appName+".app")
+	bundleDir := filepath.Join(root, b.appName+".app")
 	b.Path = bundleDir
 
-	// Check if bundle already exists and should be kept (not cleaned up)
-	if !b.Config.shouldCleanupBundle() {
-		if _, err := os.Stat(bundleDir); err == nil {
-			// Check if the original executable has changed by comparing SHA256
-			if b.isBundleUpToDate() {
-				if b.Config.Debug {
-					fmt.Fprintf(os.Stderr, "macgo: reusing existing bundle at %s (binary unchanged)\n", bundleDir)
-				}
-				b.reused = true
-				return nil
-			} else {
-				if b.Config.Debug {
-					fmt.Fprintf(os.Stderr, "macgo: binary changed, recreating bundle at %s\n", bundleDir)
-				}
-				// Remove the outdated bundle
-				if err := os.RemoveAll(bundleDir); err != nil && !os.IsNotExist(err) {
-					if os.IsPermission(err) {
-						fmt.Fprintf(os.Stderr, "macgo: warning: failed to remove outdated bundle at %s (permission denied), attempting to overwrite: %v\n", bundleDir, err)
-					} else {
-						return fmt.Errorf("failed to remove outdated bundle: %w", err)
-					}
-				}
+	lock, err := b.lockBundle(bundleDir)
+	if err != nil {
+		return err
+	}
+	b.lock = lock
+
+	if _, err := os.Stat(bundleDir); err == nil {
+		// Check if the original executable has changed by comparing SHA256
+		if !b.Config.shouldCleanupBundle() && b.Config.PostCreateHook == nil && b.isBundleUpToDate() {
+			if b.Config.Debug {
+				fmt.Fprintf(os.Stderr, "macgo: reusing existing bundle at %s (binary unchanged)\n", bundleDir)
 			}
+			b.unlock()
+			b.reused = true
+			b.recordUse()
+			return nil
 		}
-	} else {
-		// Remove old bundle if not keeping it
-		if err := os.RemoveAll(bundleDir); err != nil && !os.IsNotExist(err) {
-			if os.IsPermission(err) {
-				fmt.Fprintf(os.Stderr, "macgo: warning: failed to remove old bundle at %s (permission denied), attempting to overwrite: %v\n", bundleDir, err)
-			} else {
-				return fmt.Errorf("failed to remove old bundle: %w", err)
-			}
+		if b.Config.Debug && !b.Config.shouldCleanupBundle() {
+			fmt.Fprintf(os.Stderr, "macgo: binary changed, recreating bundle at %s\n", bundleDir)
+		}
+		b.recordRequirement(bundleDir)
+	}
+
+	if err := b.stage(bundleDir); err != nil {
+		b.unlock()
+		return err
+	}
+	if err := b.build(); err != nil {
+		b.Discard()
+		return err
+	}
+	if b.Config.PostCreateHook != nil {
+		if err := b.Config.PostCreateHook(b.Path); err != nil {
+			b.Discard()
+			return fmt.Errorf("post-create hook: %w", err)
 		}
 	}
+	if b.Config.signs() {
+		return nil
+	}
+	if err := b.commit(); err != nil {
+		return err
+	}
+	b.recordUse()
+	return nil
+}
+
+// build populates the bundle at b.Path.
+func (b *Bundle) build() error {
+	bundleDir := b.Path
+
+	if b.Config.ProvisioningProfile == "" && b.Config.AutoProvisioningProfile {
+		b.discoverProvisioningProfile()
+	}
 
 	// Create directory structure
 	contentsDir := filepath.Join(bundleDir, "Contents")
@@ -233,8 +474,8 @@ func (b *Bundle) Create() error {
 		// DevMode: Copy the binary and store the dev target path.
 		// At runtime, the bundled binary will exec the dev target.
 		// This preserves TCC permissions since the bundle signature stays stable.
-		if err := system.CopyFile(b.execPath, destExec); err != nil {
-			return fmt.Errorf("failed to copy executable: %w", err)
+		if err := b.writeExecutable(destExec); err != nil {
+			return err
 		}
 		if err := os.Chmod(destExec, 0755); err != nil {
 			return fmt.Errorf("failed to set executable permissions: %w", err)
@@ -247,9 +488,10 @@ func (b *Bundle) Create() error {
 			fmt.Fprintf(os.Stderr, "macgo: dev mode enabled - bundle will exec %s at runtime\n", b.execPath)
 		}
 	} else {
-		// Normal mode: Copy the executable directly
-		if err := system.CopyFile(b.execPath, destExec); err != nil {
-			return fmt.Errorf("failed to copy executable: %w", err)
+		// Normal mode: Copy the executable directly, or assemble a
+		// universal binary from the per-architecture builds.
+		if err := b.writeExecutable(destExec); err != nil {
+			return err
 		}
 		if err := os.Chmod(destExec, 0755); err != nil {
 			return fmt.Errorf("failed to set executable permissions: %w", err)
@@ -265,54 +507,42 @@ func (b *Bundle) Create() error {
 		}
 	}
 
+	if err := b.writeNested(contentsDir); err != nil {
+		return err
+	}
+	if err := b.writeResources(contentsDir); err != nil {
+		return err
+	}
+
 	// Create Info.plist path
 	plistPath := filepath.Join(contentsDir, "Info.plist")
-
-	// Prepare Info.plist config
-	infoCfg := plist.InfoPlistConfig{
-		AppName:    b.appName,
-		BundleID:   b.bundleID,
-		ExecName:   execName,
-		Version:    b.version,
-		CustomKeys: make(map[string]interface{}),
+	infoCfg, err := b.infoPlistConfig()
+	if err != nil {
+		return err
 	}
-
-	// Set UI mode based on config (default: background for CLI tools)
-	switch b.Config.UIMode {
-	case UIModeAccessory:
-		// LSUIElement=true: menu bar apps, no Dock icon but can show UI
-		infoCfg.CustomKeys["LSUIElement"] = true
-	case UIModeRegular:
-		// Normal app: appears in Dock, full UI
-		// Don't set LSBackgroundOnly or LSUIElement
-	default:
-		// UIModeBackground or empty: LSBackgroundOnly=true for CLI tools
-		// Prevents -1712 AppleEvent timeout for pure Go binaries
-		infoCfg.BackgroundOnly = true
+	info, conflicts, err := plist.MergeInfoPlist(infoCfg)
+	if err != nil {
+		return fmt.Errorf("failed to build Info.plist: %w", err)
 	}
-
-	// Set app icon if provided
-	if b.Config.IconPath != "" {
-		infoCfg.CustomKeys["CFBundleIconFile"] = filepath.Base(b.Config.IconPath)
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "macgo: warning: Info.plist %s\n", c)
 	}
-
-	// Copy custom Info keys
-	for k, v := range b.Config.Info {
-		infoCfg.CustomKeys[k] = v
+	// Check only a bundle ID the configuration supplies; an inferred one
+	// is macgo's own and has already been sanitized.
+	checked := info
+	if b.Config.BundleID == "" && info["CFBundleIdentifier"] == b.bundleID {
+		checked = maps.Clone(info)
+		delete(checked, "CFBundleIdentifier")
 	}
-
-	// Helper: Auto-inject Usage Descriptions for known TCC permissions if missing
-	for _, perm := range b.Config.Permissions {
-		if strings.Contains(strings.ToLower(perm), "accessibility") { // matches "accessibility"
-			const key = "NSAccessibilityUsageDescription"
-			if _, exists := infoCfg.CustomKeys[key]; !exists {
-				infoCfg.CustomKeys[key] = "This application requires accessibility permissions to function properly."
-				if b.Config.Debug {
-					fmt.Fprintf(os.Stderr, "macgo: auto-injected %s\n", key)
-				}
+	if err := plist.ValidateInfoPlist(checked); err != nil {
+		return fmt.Errorf("invalid Info.plist: %w", err)
+	}
+	if b.Config.Debug {
+		if _, ok := b.Config.Info[accessibilityUsageKey]; !ok {
+			if _, injected := infoCfg.CustomKeys[accessibilityUsageKey]; injected {
+				fmt.Fprintf(os.Stderr, "macgo: auto-injected %s\n", accessibilityUsageKey)
 			}
 		}
-		// Add others (Camera, Mic) as needed in future
 	}
 
 	if err := plist.WriteInfoPlist(plistPath, infoCfg); err != nil {
@@ -388,20 +618,8 @@ func (b *Bundle) Create() error {
 		}
 	}
 
-	// Copy icon file if specified
-	if b.Config.IconPath != "" {
-		resourcesDir := filepath.Join(contentsDir, "Resources")
-		if err := os.MkdirAll(resourcesDir, 0755); err != nil {
-			return fmt.Errorf("failed to create Resources directory: %w", err)
-		}
-		iconName := filepath.Base(b.Config.IconPath)
-		iconDest := filepath.Join(resourcesDir, iconName)
-		if err := system.CopyFile(b.Config.IconPath, iconDest); err != nil {
-			return fmt.Errorf("failed to copy icon: %w", err)
-		}
-		if b.Config.Debug {
-			fmt.Fprintf(os.Stderr, "macgo: copied icon %s to bundle\n", iconName)
-		}
+	if err := b.writeIcon(contentsDir); err != nil {
+		return err
 	}
 
 	// Recursively fix permissions if running under sudo
@@ -414,6 +632,87 @@ func (b *Bundle) Create() error {
 	return nil
 }
 
+// accessibilityUsageKey is the Info.plist key auto-injected for Accessibility.
+const accessibilityUsageKey = "NSAccessibilityUsageDescription"
+
+// infoPlistConfig returns the Info.plist configuration for the bundle.
+func (b *Bundle) infoPlistConfig() (plist.InfoPlistConfig, error) {
+	template, err := b.infoPlistTemplate()
+	if err != nil {
+		return plist.InfoPlistConfig{}, err
+	}
+	infoCfg := plist.InfoPlistConfig{
+		Template:   b.withBuildInfo(template),
+		AppName:    b.appName,
+		BundleID:   b.bundleID,
+		ExecName:   filepath.Base(b.appName),
+		Version:    b.version,
+		CustomKeys: make(map[string]interface{}),
+	}
+
+	// Set UI mode based on config (default: background for CLI tools)
+	switch b.Config.UIMode {
+	case UIModeAccessory:
+		// LSUIElement=true: menu bar apps, no Dock icon but can show UI
+		infoCfg.CustomKeys["LSUIElement"] = true
+	case UIModeRegular:
+		// Normal app: appears in Dock, full UI
+		// Don't set LSBackgroundOnly or LSUIElement
+	default:
+		// UIModeBackground or empty: LSBackgroundOnly=true for CLI tools
+		// Prevents -1712 AppleEvent timeout for pure Go binaries
+		infoCfg.BackgroundOnly = true
+	}
+
+	// Set app icon if provided
+	if icon := b.Config.iconFile(); icon != "" {
+		infoCfg.CustomKeys["CFBundleIconFile"] = icon
+	}
+
+	// URL schemes and document types, which Info keys may override
+	docKeys, err := b.documentTypeKeys()
+	if err != nil {
+		return plist.InfoPlistConfig{}, err
+	}
+	for k, v := range docKeys {
+		infoCfg.CustomKeys[k] = v
+	}
+
+	// Copy custom Info keys
+	for k, v := range b.Config.Info {
+		infoCfg.CustomKeys[k] = v
+	}
+
+	// Helper: Auto-inject Usage Descriptions for known TCC permissions if missing
+	for _, perm := range b.Config.Permissions {
+		if strings.Contains(strings.ToLower(perm), "accessibility") { // matches "accessibility"
+			_, inTemplate := template[accessibilityUsageKey]
+			if _, exists := infoCfg.CustomKeys[accessibilityUsageKey]; !exists && !inTemplate {
+				infoCfg.CustomKeys[accessibilityUsageKey] = "This application requires accessibility permissions to function properly."
+			}
+		}
+		// Add others (Camera, Mic) as needed in future
+	}
+
+	return infoCfg, nil
+}
+
+// infoPlistTemplate loads the configured Info.plist template, if any.
+func (b *Bundle) infoPlistTemplate() (map[string]any, error) {
+	data := b.Config.InfoPlistTemplateData
+	if data == nil && b.Config.InfoPlistTemplate != "" {
+		var err error
+		data, err = os.ReadFile(b.Config.InfoPlistTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("read Info.plist template: %w", err)
+		}
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return plist.ReadInfoPlistTemplate(data)
+}
+
 // fixOwner changes ownership of the bundle to the SUDO_USER if running as root.
 func (b *Bundle) fixOwner(path string) error {
 	// Only proceed if running as root
@@ -451,7 +750,12 @@ func (b *Bundle) fixOwner(path string) error {
 // Sign performs code signing on the bundle.
 // This method coordinates the signing process and delegates to signing.go.
 // If the bundle was reused (not recreated), signing is skipped since the
-// existing signature is still valid.
+// existing signature is still valid. With a provisioning profile, Sign
+// first checks that the profile allows the bundle's entitlements and
+// signing certificate, and fails with a *ProfileMismatchError if not.
+//
+// A bundle staged by Create is signed in the staging directory and then
+// moved into place; if signing fails, it is discarded.
 func (b *Bundle) Sign() error {
 	if b.Path == "" {
 		return fmt.Errorf("bundle not created - call Create() first")
@@ -465,8 +769,48 @@ func (b *Bundle) Sign() error {
 		return nil
 	}
 
+	inPlace := b.staging == "" && b.Config.signs()
+	if err := b.sign(); err != nil {
+		b.Discard()
+		return err
+	}
+	if inPlace {
+		// ForceResign re-signed a reused bundle where it is, so its
+		// manifest no longer matches.
+		manifest, err := BuildManifest(b.Path)
+		if err != nil {
+			return err
+		}
+		b.saveManifest(manifest)
+	}
+	if err := b.commit(); err != nil {
+		return err
+	}
+	b.recordUse()
+	return nil
+}
+
+func (b *Bundle) sign() error {
 	// Code sign the bundle if identity is provided, auto-detect, or ad-hoc
-	if b.Config.CodeSignIdentity != "" {
+	if b.Config.IdentityProvider != nil && b.Config.CodeSignIdentity != "-" {
+		id, err := codesign.FindIdentity(b.Config.IdentityProvider, b.Config.CodeSignIdentity)
+		if err != nil {
+			return fmt.Errorf("code signing failed: %w", err)
+		}
+		if err := b.checkProfile(id.Certificate); err != nil {
+			return fmt.Errorf("code signing failed: %w", err)
+		}
+		if err := signBundleWithIdentity(b.Path, id, b.Config); err != nil {
+			return fmt.Errorf("code signing failed: %w", err)
+		}
+		b.Config.CodeSignIdentity = id.Name
+		if b.Config.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: code signed with identity: %s (%s)\n", id.Name, id.SHA1())
+		}
+	} else if b.Config.CodeSignIdentity != "" {
+		if err := b.checkProfile(keychainCertificate(b.Config.CodeSignIdentity)); err != nil {
+			return fmt.Errorf("code signing failed: %w", err)
+		}
 		if err := codeSignBundle(b.Path, b.Config); err != nil {
 			return fmt.Errorf("code signing failed: %w", err)
 		}
@@ -475,6 +819,9 @@ func (b *Bundle) Sign() error {
 		}
 	} else if b.Config.AdHocSign {
 		b.Config.CodeSignIdentity = "-"
+		if err := b.checkProfile(nil); err != nil {
+			return fmt.Errorf("ad-hoc signing failed: %w", err)
+		}
 		if err := codeSignBundle(b.Path, b.Config); err != nil {
 			return fmt.Errorf("ad-hoc signing failed: %w", err)
 		}
@@ -484,6 +831,9 @@ func (b *Bundle) Sign() error {
 	} else if b.Config.AutoSign {
 		if identity := findBestIdentity(b.Config.Debug); identity != "" {
 			b.Config.CodeSignIdentity = identity
+			if err := b.checkProfile(keychainCertificate(identity)); err != nil {
+				return fmt.Errorf("code signing failed: %w", err)
+			}
 			if err := codeSignBundle(b.Path, b.Config); err != nil {
 				if b.Config.Debug {
 					fmt.Fprintf(os.Stderr, "macgo: auto-signing failed, falling back to ad-hoc: %v\n", err)
@@ -501,19 +851,27 @@ func (b *Bundle) Sign() error {
 				fmt.Fprintf(os.Stderr, "macgo: no signing identity found, using ad-hoc signing\n")
 			}
 			b.Config.CodeSignIdentity = "-"
+			if err := b.checkProfile(nil); err != nil {
+				return fmt.Errorf("ad-hoc signing fallback failed: %w", err)
+			}
 			if err := codeSignBundle(b.Path, b.Config); err != nil {
 				return fmt.Errorf("ad-hoc signing fallback failed: %w", err)
 			}
 		}
 	}
 
+	b.checkRequirement()
 	b.Config.ResolvedSigningIdentity = b.Config.CodeSignIdentity
 	return nil
 }
 
 // ForceResign clears the reused flag so the next Sign() call
 // performs code signing even if Create() determined the bundle was up-to-date.
-// Use this after modifying bundle contents via a post-create hook.
+// A reused bundle is signed in place, where launchers may see it half
+// signed.
+//
+// Deprecated: Set Config.PostCreateHook instead, which Create runs on the
+// staged bundle before it is signed and moved into place.
 func (b *Bundle) ForceResign() {
 	b.reused = false
 }
@@ -642,8 +1000,8 @@ func (b *Bundle) isBundleUpToDate() bool {
 	}
 	storedHash := strings.TrimSpace(string(storedHashBytes))
 
-	// Calculate hash of current source executable
-	currentHash, err := system.CalculateFileSHA256(b.execPath)
+	// Calculate hash of current source executable(s)
+	currentHash, err := b.sourceHash()
 	if err != nil {
 		if b.Config.Debug {
 			fmt.Fprintf(os.Stderr, "macgo: failed to calculate source binary hash: %v\n", err)
@@ -655,7 +1013,53 @@ func (b *Bundle) isBundleUpToDate() bool {
 		fmt.Fprintf(os.Stderr, "macgo: comparing hashes - stored=%s current=%s\n", storedHash[:16]+"...", currentHash[:16]+"...")
 	}
 
-	return storedHash == currentHash
+	if storedHash != currentHash {
+		return false
+	}
+
+	return b.isInfoPlistUpToDate()
+}
+
+// isInfoPlistUpToDate reports whether the bundle's Info.plist matches the
+// one the current configuration would generate. This catches configuration
+// changes (bundle ID, version, UI mode, custom keys) that do not change
+// the source binary.
+func (b *Bundle) isInfoPlistUpToDate() bool {
+	data, err := os.ReadFile(filepath.Join(b.Path, "Contents", "Info.plist"))
+	if err != nil {
+		if b.Config.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: cannot read existing Info.plist: %v\n", err)
+		}
+		return false
+	}
+	var existing map[string]any
+	if err := plist.Unmarshal(data, &existing); err != nil {
+		if b.Config.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: cannot parse existing Info.plist: %v\n", err)
+		}
+		return false
+	}
+
+	infoCfg, err := b.infoPlistConfig()
+	if err != nil {
+		return false
+	}
+	expectedData, err := plist.EncodeInfoPlist(infoCfg)
+	if err != nil {
+		return false
+	}
+	var expected map[string]any
+	if err := plist.Unmarshal(expectedData, &expected); err != nil {
+		return false
+	}
+
+	if !reflect.DeepEqual(existing, expected) {
+		if b.Config.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: Info.plist configuration changed\n")
+		}
+		return false
+	}
+	return true
 }
 
 // storeSourceHash saves the source binary's SHA256 hash to a metadata file.
@@ -664,7 +1068,7 @@ func (b *Bundle) isBundleUpToDate() bool {
 // block signing; files in Contents/Resources/ are sealed as bundle resources).
 // This must be called BEFORE code signing since signing modifies the binary.
 func (b *Bundle) storeSourceHash(contentsDir string) error {
-	hash, err := system.CalculateFileSHA256(b.execPath)
+	hash, err := b.sourceHash()
 	if err != nil {
 		return fmt.Errorf("calculate hash: %w", err)
 	}
@@ -3,6 +3,7 @@ package bundle
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -237,3 +238,26 @@ func TestConfig_shouldCleanupBundle(t *testing.T) {
 		})
 	}
 }
+
+func TestBundle_CreateDigitBundleID(t *testing.T) {
+	tempDir := t.TempDir()
+	execPath := filepath.Join(tempDir, "2fa")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\necho 2fa\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Apple allows bundle ID components that start with a digit, as in
+	// the ID inferred for a tool named 2fa.
+	for _, id := range []string{"", "com.github.tmc.2fa.2fa"} {
+		b, err := New(execPath, &Config{BundleID: id, BundleDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(b.bundleID, ".2fa") {
+			t.Fatalf("bundle ID = %q, want a final component 2fa", b.bundleID)
+		}
+		if err := b.Create(); err != nil {
+			t.Errorf("Create with bundle ID %q: %v", b.bundleID, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package bundle
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// URLType is a set of URL schemes the app opens, such as "mytool" for
+// mytool:// links. It becomes a CFBundleURLTypes entry.
+type URLType struct {
+	// Name is the CFBundleURLName, an identifier for the URL type.
+	// Defaults to the bundle ID.
+	Name string
+
+	// Schemes are the URL schemes, without "://".
+	Schemes []string
+
+	// Role is the CFBundleTypeRole: "Viewer" (the default), "Editor",
+	// "Shell" or "None".
+	Role string
+}
+
+// DocumentType is a kind of file the app opens, such as the .mytool
+// files it is launched for when they are double-clicked. It becomes a
+// CFBundleDocumentTypes entry.
+type DocumentType struct {
+	// Name is the CFBundleTypeName shown in Finder.
+	Name string
+
+	// ContentTypes are the uniform type identifiers of the documents,
+	// such as "public.plain-text" or a type declared in ExportedTypes.
+	ContentTypes []string
+
+	// Extensions are file name extensions, without the dot, for
+	// documents without a declared type. Prefer ContentTypes.
+	Extensions []string
+
+	// Role is the CFBundleTypeRole: "Viewer" (the default), "Editor",
+	// "Shell" or "None".
+	Role string
+
+	// Rank is the LSHandlerRank: "Owner", "Default", "Alternate" or
+	// "None". Defaults to "Owner" for types the app exports and
+	// "Alternate" for others.
+	Rank string
+}
+
+// TypeDeclaration declares a uniform type identifier owned by the app.
+// It becomes a UTExportedTypeDeclarations entry.
+type TypeDeclaration struct {
+	// Identifier is the type identifier, such as "com.example.mytool".
+	Identifier string
+
+	// Description is shown in Finder, for example "MyTool Document".
+	Description string
+
+	// ConformsTo lists the types the type conforms to. Defaults to
+	// "public.data" and "public.content".
+	ConformsTo []string
+
+	// Extensions are the file name extensions of the type, without the dot.
+	Extensions []string
+
+	// MIMETypes are the MIME types of the type.
+	MIMETypes []string
+}
+
+// schemeRe matches a URL scheme (RFC 3986, section 3.1).
+var schemeRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*$`)
+
+func checkRole(role string) error {
+	switch role {
+	case "", "Viewer", "Editor", "Shell", "None":
+		return nil
+	}
+	return fmt.Errorf("role %q is not Viewer, Editor, Shell or None", role)
+}
+
+func roleOrDefault(role string) string {
+	if role == "" {
+		return "Viewer"
+	}
+	return role
+}
+
+// plistStrings converts ss to a property list array.
+func plistStrings(ss []string) []any {
+	out := make([]any, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+// documentTypeKeys returns the CFBundleURLTypes, CFBundleDocumentTypes
+// and UTExportedTypeDeclarations keys for the configuration.
+func (b *Bundle) documentTypeKeys() (map[string]any, error) {
+	c := b.Config
+	keys := map[string]any{}
+
+	var urlTypes []any
+	for _, t := range c.URLTypes {
+		if len(t.Schemes) == 0 {
+			return nil, fmt.Errorf("URL type %q: no schemes", t.Name)
+		}
+		for _, s := range t.Schemes {
+			if !schemeRe.MatchString(s) {
+				return nil, fmt.Errorf("URL type %q: invalid scheme %q", t.Name, s)
+			}
+		}
+		if err := checkRole(t.Role); err != nil {
+			return nil, fmt.Errorf("URL type %q: %w", t.Name, err)
+		}
+		name := t.Name
+		if name == "" {
+			name = b.bundleID
+		}
+		urlTypes = append(urlTypes, map[string]any{
+			"CFBundleURLName":    name,
+			"CFBundleURLSchemes": plistStrings(t.Schemes),
+			"CFBundleTypeRole":   roleOrDefault(t.Role),
+		})
+	}
+	if len(urlTypes) > 0 {
+		keys["CFBundleURLTypes"] = urlTypes
+	}
+
+	exported := map[string]bool{}
+	var declarations []any
+	for _, t := range c.ExportedTypes {
+		if t.Identifier == "" {
+			return nil, fmt.Errorf("exported type %q: no identifier", t.Description)
+		}
+		if exported[t.Identifier] {
+			return nil, fmt.Errorf("exported type %s declared twice", t.Identifier)
+		}
+		exported[t.Identifier] = true
+		conforms := t.ConformsTo
+		if len(conforms) == 0 {
+			conforms = []string{"public.data", "public.content"}
+		}
+		tags := map[string]any{}
+		if len(t.Extensions) > 0 {
+			tags["public.filename-extension"] = plistStrings(t.Extensions)
+		}
+		if len(t.MIMETypes) > 0 {
+			tags["public.mime-type"] = plistStrings(t.MIMETypes)
+		}
+		decl := map[string]any{
+			"UTTypeIdentifier":       t.Identifier,
+			"UTTypeConformsTo":       plistStrings(conforms),
+			"UTTypeTagSpecification": tags,
+		}
+		if t.Description != "" {
+			decl["UTTypeDescription"] = t.Description
+		}
+		declarations = append(declarations, decl)
+	}
+	if len(declarations) > 0 {
+		keys["UTExportedTypeDeclarations"] = declarations
+	}
+
+	var docTypes []any
+	for _, t := range c.DocumentTypes {
+		if t.Name == "" {
+			return nil, fmt.Errorf("document type: no name")
+		}
+		if len(t.ContentTypes) == 0 && len(t.Extensions) == 0 {
+			return nil, fmt.Errorf("document type %q: no content types or extensions", t.Name)
+		}
+		if err := checkRole(t.Role); err != nil {
+			return nil, fmt.Errorf("document type %q: %w", t.Name, err)
+		}
+		rank := t.Rank
+		switch rank {
+		case "":
+			rank = "Alternate"
+			for _, ct := range t.ContentTypes {
+				if exported[ct] {
+					rank = "Owner"
+				}
+			}
+		case "Owner", "Default", "Alternate", "None":
+		default:
+			return nil, fmt.Errorf("document type %q: rank %q is not Owner, Default, Alternate or None", t.Name, t.Rank)
+		}
+		doc := map[string]any{
+			"CFBundleTypeName": t.Name,
+			"CFBundleTypeRole": roleOrDefault(t.Role),
+			"LSHandlerRank":    rank,
+		}
+		if len(t.ContentTypes) > 0 {
+			doc["LSItemContentTypes"] = plistStrings(t.ContentTypes)
+		}
+		if len(t.Extensions) > 0 {
+			doc["CFBundleTypeExtensions"] = plistStrings(t.Extensions)
+		}
+		docTypes = append(docTypes, doc)
+	}
+	if len(docTypes) > 0 {
+		keys["CFBundleDocumentTypes"] = docTypes
+	}
+	return keys, nil
+}
@@ -0,0 +1,96 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tmc/macgo/internal/plist"
+)
+
+func TestCreate_DocumentTypes(t *testing.T) {
+	tmpDir := t.TempDir()
+	execPath := filepath.Join(tmpDir, "doc-test")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\necho doc\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(execPath, &Config{
+		AppName:   "DocApp",
+		BundleID:  "com.example.mytool",
+		BundleDir: tmpDir,
+		URLTypes:  []URLType{{Schemes: []string{"mytool"}}},
+		DocumentTypes: []DocumentType{
+			{Name: "MyTool Document", ContentTypes: []string{"com.example.mytool.doc"}, Role: "Editor"},
+			{Name: "Text", ContentTypes: []string{"public.plain-text"}},
+		},
+		ExportedTypes: []TypeDeclaration{{
+			Identifier:  "com.example.mytool.doc",
+			Description: "MyTool Document",
+			Extensions:  []string{"mytool"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(b.Path, "Contents", "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info map[string]any
+	if err := plist.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"CFBundleURLTypes": []any{map[string]any{
+			"CFBundleURLName":    "com.example.mytool",
+			"CFBundleURLSchemes": []any{"mytool"},
+			"CFBundleTypeRole":   "Viewer",
+		}},
+		"CFBundleDocumentTypes": []any{
+			map[string]any{
+				"CFBundleTypeName":   "MyTool Document",
+				"CFBundleTypeRole":   "Editor",
+				"LSHandlerRank":      "Owner",
+				"LSItemContentTypes": []any{"com.example.mytool.doc"},
+			},
+			map[string]any{
+				"CFBundleTypeName":   "Text",
+				"CFBundleTypeRole":   "Viewer",
+				"LSHandlerRank":      "Alternate",
+				"LSItemContentTypes": []any{"public.plain-text"},
+			},
+		},
+		"UTExportedTypeDeclarations": []any{map[string]any{
+			"UTTypeIdentifier":       "com.example.mytool.doc",
+			"UTTypeDescription":      "MyTool Document",
+			"UTTypeConformsTo":       []any{"public.data", "public.content"},
+			"UTTypeTagSpecification": map[string]any{"public.filename-extension": []any{"mytool"}},
+		}},
+	}
+	for key, w := range want {
+		if !reflect.DeepEqual(info[key], w) {
+			t.Errorf("%s = %#v\nwant %#v", key, info[key], w)
+		}
+	}
+
+	for _, cfg := range []Config{
+		{URLTypes: []URLType{{Schemes: []string{"my tool"}}}},
+		{URLTypes: []URLType{{Name: "empty"}}},
+		{URLTypes: []URLType{{Schemes: []string{"x"}, Role: "Owner"}}},
+		{DocumentTypes: []DocumentType{{Name: "untyped"}}},
+		{DocumentTypes: []DocumentType{{Name: "ranked", Extensions: []string{"x"}, Rank: "First"}}},
+		{ExportedTypes: []TypeDeclaration{{Description: "anonymous"}}},
+	} {
+		cfg.AppName = "BadDocApp"
+		cfg.BundleDir = tmpDir
+		b, _ := New(execPath, &cfg)
+		if err := b.Create(); err == nil {
+			t.Errorf("Create with %+v succeeded", cfg)
+		}
+	}
+}
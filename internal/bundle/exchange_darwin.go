@@ -0,0 +1,8 @@
+package bundle
+
+import "golang.org/x/sys/unix"
+
+// exchangeDirs atomically swaps the directories at a and b.
+func exchangeDirs(a, b string) error {
+	return unix.RenamexNp(a, b, unix.RENAME_SWAP)
+}
@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package bundle
+
+import "errors"
+
+// exchangeDirs reports that directories cannot be swapped atomically.
+func exchangeDirs(a, b string) error {
+	return errors.ErrUnsupported
+}
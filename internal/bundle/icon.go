@@ -0,0 +1,130 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/tmc/macgo/internal/icns"
+	"github.com/tmc/macgo/internal/system"
+)
+
+// generatedIconFile is the name of the .icns file rendered from IconPNG
+// or IconImage.
+const generatedIconFile = "AppIcon.icns"
+
+// generatesIcon reports whether the app icon is rendered by macgo rather
+// than copied from IconPath.
+func (c *Config) generatesIcon() bool {
+	return c.IconImage != nil || c.IconPNG != ""
+}
+
+// iconFile returns the file name of the app icon in Contents/Resources,
+// or "" if the bundle has none.
+func (c *Config) iconFile() string {
+	switch {
+	case c.generatesIcon():
+		return generatedIconFile
+	case c.IconPath != "":
+		return filepath.Base(c.IconPath)
+	}
+	return ""
+}
+
+// iconImage returns IconImage, or IconPNG decoded.
+func (c *Config) iconImage() (image.Image, error) {
+	if c.IconImage != nil {
+		return c.IconImage, nil
+	}
+	data, err := os.ReadFile(c.IconPNG)
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.IconPNG, err)
+	}
+	return img, nil
+}
+
+// RenderIcon renders the configured IconImage or IconPNG as an .icns
+// file holding every app icon size.
+func (c *Config) RenderIcon() ([]byte, error) {
+	img, err := c.iconImage()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := icns.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeIcon puts the app icon in Contents/Resources, copying IconPath or
+// rendering IconPNG or IconImage.
+func (b *Bundle) writeIcon(contentsDir string) error {
+	name := b.Config.iconFile()
+	if name == "" {
+		return nil
+	}
+	resourcesDir := filepath.Join(contentsDir, "Resources")
+	if err := os.MkdirAll(resourcesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create Resources directory: %w", err)
+	}
+	dest := filepath.Join(resourcesDir, name)
+	if !b.Config.generatesIcon() {
+		if err := system.CopyFile(b.Config.IconPath, dest); err != nil {
+			return fmt.Errorf("failed to copy icon: %w", err)
+		}
+		if b.Config.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: copied icon %s to bundle\n", name)
+		}
+		return nil
+	}
+	data, err := b.Config.RenderIcon()
+	if err != nil {
+		return fmt.Errorf("failed to render icon: %w", err)
+	}
+	if err := os.WriteFile(dest, data, 0644); err != nil {
+		return fmt.Errorf("failed to write icon: %w", err)
+	}
+	if b.Config.Debug {
+		fmt.Fprintf(os.Stderr, "macgo: rendered icon %s\n", name)
+	}
+	return nil
+}
+
+// iconHash extends hash with the source of a rendered icon, so changing
+// the image invalidates the bundle.
+func (b *Bundle) iconHash(hash string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", hash)
+	if b.Config.IconImage == nil {
+		data, err := os.ReadFile(b.Config.IconPNG)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "icon png %x\n", sha256.Sum256(data))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	img := b.Config.IconImage
+	bounds := img.Bounds()
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(bounds)
+		draw.Draw(nrgba, bounds, img, bounds.Min, draw.Src)
+	}
+	fmt.Fprintf(h, "icon image %dx%d\n", bounds.Dx(), bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		i := nrgba.PixOffset(bounds.Min.X, y)
+		h.Write(nrgba.Pix[i : i+4*bounds.Dx()])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,96 @@
+package bundle
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmc/macgo/internal/icns"
+	"github.com/tmc/macgo/internal/plist"
+)
+
+func TestCreate_IconPNG(t *testing.T) {
+	tmpDir := t.TempDir()
+	execPath := filepath.Join(tmpDir, "icon-test")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\necho icon\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(tmpDir, "icon.png")
+	writePNG := func(c color.Color) {
+		t.Helper()
+		img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+		for y := range 64 {
+			for x := range 64 {
+				img.Set(x, y, c)
+			}
+		}
+		f, err := os.Create(pngPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create := func() *Bundle {
+		t.Helper()
+		b, err := New(execPath, &Config{
+			AppName:   "IconApp",
+			BundleID:  "com.example.icon",
+			BundleDir: tmpDir,
+			IconPNG:   pngPath,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Create(); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return b
+	}
+
+	writePNG(color.NRGBA{0, 0x80, 0xff, 0xff})
+	b := create()
+	data, err := os.ReadFile(filepath.Join(b.Path, "Contents", "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info map[string]any
+	if err := plist.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if got := info["CFBundleIconFile"]; got != generatedIconFile {
+		t.Errorf("CFBundleIconFile = %v, want %s", got, generatedIconFile)
+	}
+	data, err = os.ReadFile(filepath.Join(b.Path, "Contents", "Resources", generatedIconFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	icons, err := icns.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(icons) != 10 || icons[9].String() != "512x512@2x" || icons[9].Width != 1024 {
+		t.Errorf("icons = %v, want 16x16 through 512x512@2x", icons)
+	}
+
+	if b = create(); !b.reused {
+		t.Error("bundle with an unchanged icon was not reused")
+	}
+	writePNG(color.NRGBA{0xff, 0x80, 0, 0xff})
+	if b = create(); b.reused {
+		t.Error("bundle reused after the icon changed")
+	}
+
+	if err := os.WriteFile(pngPath, []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = New(execPath, &Config{AppName: "BadIconApp", BundleDir: tmpDir, IconPNG: pngPath})
+	if err := b.Create(); err == nil {
+		t.Error("Create with an invalid PNG icon succeeded")
+	}
+}
@@ -0,0 +1,245 @@
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// IndexEntry records a bundle created by macgo in the bundle index.
+type IndexEntry struct {
+	Path     string    `json:"path"`               // the .app directory
+	Source   string    `json:"source"`             // executable the bundle was built from
+	BundleID string    `json:"bundleID"`           // CFBundleIdentifier
+	Hash     string    `json:"hash,omitempty"`     // source hash, as in .source_hash
+	Identity string    `json:"identity,omitempty"` // signing identity, "-" for ad-hoc
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// indexFile is the name of the bundle index in the cache directory.
+const indexFile = "bundles.json"
+
+// lockIndex takes the lock that serializes updates of the bundle index,
+// waiting for any other process holding it. Closing the returned file
+// releases it.
+func lockIndex() (*os.File, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("lock bundle index: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, indexFile+".lock"), os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("lock bundle index: %w", err)
+	}
+	if err := flock(f, true); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock bundle index: %w", err)
+	}
+	return f, nil
+}
+
+// CacheDir returns the directory holding macgo's bundle index:
+// $MACGO_CACHE_DIR, or macgo in the user cache directory.
+func CacheDir() (string, error) {
+	if dir := os.Getenv("MACGO_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "macgo"), nil
+}
+
+// ReadIndex returns the entries of the bundle index, most recently used
+// first. A missing index has no entries.
+func ReadIndex() ([]IndexEntry, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read bundle index: %w", err)
+	}
+	var entries []IndexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("read bundle index: %w", err)
+	}
+	slices.SortFunc(entries, func(a, b IndexEntry) int { return b.LastUsed.Compare(a.LastUsed) })
+	return entries, nil
+}
+
+// writeIndex replaces the bundle index with entries. The file is replaced
+// atomically so that readers never see a partial index. Writers hold the
+// index lock from reading the entries to writing them, so that concurrent
+// updates do not drop each other's changes.
+func writeIndex(entries []IndexEntry) error {
+	dir, err := CacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("write bundle index: %w", err)
+	}
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, indexFile+".*")
+	if err != nil {
+		return fmt.Errorf("write bundle index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write bundle index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write bundle index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, indexFile)); err != nil {
+		return fmt.Errorf("write bundle index: %w", err)
+	}
+	return nil
+}
+
+// FindIndexEntry returns the index entry whose bundle path, bundle ID or
+// source executable is query. A query naming an existing file or a .app
+// directory is taken as a path, relative to the working directory.
+func FindIndexEntry(query string) (*IndexEntry, error) {
+	entries, err := ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	path := query
+	if _, err := os.Stat(query); err == nil || strings.HasSuffix(filepath.Clean(query), ".app") {
+		if abs, err := filepath.Abs(query); err == nil {
+			path = abs
+		}
+	}
+	for i, e := range entries {
+		if e.Path == path || e.Source == path || e.BundleID == query {
+			return &entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no bundle %q in the index", query)
+}
+
+// Prune removes bundles last used before cutoff, along with index entries
+// for bundles that no longer exist, and returns the removed entries. With
+// dryRun set, it only reports what it would remove. Bundles another
+// process is creating are skipped. The index is user-writable, so Prune
+// refuses to remove a directory that is not a .app bundle carrying
+// macgo's source hash; such entries are kept and reported in the
+// returned error.
+func Prune(cutoff time.Time, dryRun bool) ([]IndexEntry, error) {
+	lock, err := lockIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	entries, err := ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	var kept, removed []IndexEntry
+	var errs []error
+	for _, e := range entries {
+		_, statErr := os.Stat(e.Path)
+		if statErr == nil && !e.LastUsed.Before(cutoff) {
+			kept = append(kept, e)
+			continue
+		}
+		if !strings.HasSuffix(e.Path, ".app") || statErr == nil && !isMacgoBundle(e.Path) {
+			errs = append(errs, fmt.Errorf("refusing to remove %s: not a bundle created by macgo", e.Path))
+			kept = append(kept, e)
+			continue
+		}
+		if statErr == nil {
+			// Leave bundles alone while they are being created.
+			lock, err := tryLockBundle(e.Path)
+			if errors.Is(err, errLocked) {
+				kept = append(kept, e)
+				continue
+			} else if err != nil {
+				return removed, err
+			}
+			if !dryRun {
+				err = os.RemoveAll(e.Path)
+			}
+			lock.Close()
+			if err != nil {
+				return removed, fmt.Errorf("remove %s: %w", e.Path, err)
+			}
+		}
+		if !dryRun {
+			os.Remove(ManifestPath(e.Path))
+		}
+		removed = append(removed, e)
+	}
+	if !dryRun && len(removed) > 0 {
+		if err := writeIndex(kept); err != nil {
+			return removed, err
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// isMacgoBundle reports whether the directory at path has the source hash
+// file macgo writes into every bundle it creates.
+func isMacgoBundle(path string) bool {
+	fi, err := os.Stat(filepath.Join(path, "Contents", "Resources", sourceHashFile))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// recordUse adds the bundle to the index or refreshes its entry. Failures
+// only matter for bookkeeping, so they are reported in debug mode only.
+func (b *Bundle) recordUse() {
+	if b.Config.shouldCleanupBundle() {
+		return
+	}
+	if err := b.updateIndex(); err != nil && b.Config.Debug {
+		fmt.Fprintf(os.Stderr, "macgo: warning: bundle index: %v\n", err)
+	}
+}
+
+func (b *Bundle) updateIndex() error {
+	lock, err := lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	entries, err := ReadIndex()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	i := slices.IndexFunc(entries, func(e IndexEntry) bool { return e.Path == b.Path })
+	if i < 0 {
+		entries = append(entries, IndexEntry{Path: b.Path, Created: now})
+		i = len(entries) - 1
+	}
+	e := &entries[i]
+	e.Source = b.execPath
+	e.BundleID = b.bundleID
+	e.LastUsed = now
+	if hash, err := os.ReadFile(filepath.Join(b.Path, "Contents", "Resources", sourceHashFile)); err == nil {
+		e.Hash = strings.TrimSpace(string(hash))
+	}
+	if b.Config.ResolvedSigningIdentity != "" {
+		e.Identity = b.Config.ResolvedSigningIdentity
+	}
+	return writeIndex(entries)
+}
@@ -0,0 +1,186 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Keep bundles created by tests out of the user's bundle index.
+	dir, err := os.MkdirTemp("", "macgo-cache-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("MACGO_CACHE_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestBundleIndex(t *testing.T) {
+	t.Setenv("MACGO_CACHE_DIR", t.TempDir())
+	execPath := buildDarwinArm64(t, "index-test")
+	bundleDir := t.TempDir()
+
+	config := &Config{
+		AppName:   "IndexApp",
+		BundleID:  "com.example.index",
+		AdHocSign: true,
+		Signer:    SignerBuiltin,
+		BundleDir: bundleDir,
+	}
+	b, err := New(execPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := b.Sign(); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if want := filepath.Join(bundleDir, "IndexApp.app"); b.Path != want {
+		t.Errorf("Path = %q, want %q", b.Path, want)
+	}
+
+	entries, err := ReadIndex()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadIndex = %v, %v; want one entry", entries, err)
+	}
+	e := entries[0]
+	hash, _ := os.ReadFile(filepath.Join(b.Path, "Contents", "Resources", sourceHashFile))
+	if e.Path != b.Path || e.Source != execPath || e.BundleID != "com.example.index" || e.Identity != "-" || e.Hash == "" || e.Hash+"\n" != string(hash) {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Created.IsZero() || e.LastUsed.Before(e.Created) {
+		t.Errorf("Created = %v, LastUsed = %v", e.Created, e.LastUsed)
+	}
+	if found, err := FindIndexEntry("com.example.index"); err != nil || found.Path != b.Path {
+		t.Errorf("FindIndexEntry(bundle ID) = %v, %v", found, err)
+	}
+	t.Chdir(bundleDir)
+	relExec, _ := filepath.Rel(bundleDir, execPath)
+	for _, query := range []string{"./IndexApp.app/", relExec} {
+		if found, err := FindIndexEntry(query); err != nil || found.Path != b.Path {
+			t.Errorf("FindIndexEntry(%q) = %v, %v", query, found, err)
+		}
+	}
+	if _, err := FindIndexEntry("com.example.missing"); err == nil {
+		t.Error("FindIndexEntry of an unknown bundle succeeded")
+	}
+
+	// Reusing the bundle keeps a single entry.
+	b2, _ := New(execPath, &Config{AppName: "IndexApp", BundleID: "com.example.index", AdHocSign: true, Signer: SignerBuiltin, BundleDir: bundleDir})
+	if err := b2.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ReadIndex(); len(entries) != 1 || entries[0].Identity != "-" {
+		t.Errorf("after reuse: %+v", entries)
+	}
+
+	// A dry run removes nothing; a real prune removes the bundle.
+	future := time.Now().Add(time.Hour)
+	if removed, err := Prune(future, true); err != nil || len(removed) != 1 {
+		t.Fatalf("Prune(dry run) = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(b.Path); err != nil {
+		t.Fatalf("dry run removed the bundle: %v", err)
+	}
+	if removed, err := Prune(time.Now().Add(-time.Hour), false); err != nil || len(removed) != 0 {
+		t.Errorf("Prune of recent bundles = %v, %v", removed, err)
+	}
+	if removed, err := Prune(future, false); err != nil || len(removed) != 1 {
+		t.Fatalf("Prune = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(b.Path); !os.IsNotExist(err) {
+		t.Errorf("pruned bundle still exists: %v", err)
+	}
+	if entries, _ := ReadIndex(); len(entries) != 0 {
+		t.Errorf("index after prune = %+v", entries)
+	}
+}
+
+func TestPrune_RefusesForeignDirectories(t *testing.T) {
+	t.Setenv("MACGO_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "Documents")
+	foreign := filepath.Join(dir, "Other.app")
+	for _, d := range []string{plain, filepath.Join(foreign, "Contents")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := writeIndex([]IndexEntry{{Path: plain, LastUsed: old}, {Path: foreign, LastUsed: old}}); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := Prune(time.Now(), false)
+	if err == nil || len(removed) != 0 {
+		t.Errorf("Prune = %v, %v; want nothing removed and an error", removed, err)
+	}
+	for _, d := range []string{plain, foreign} {
+		if _, err := os.Stat(d); err != nil {
+			t.Errorf("Prune removed %s: %v", d, err)
+		}
+	}
+	if entries, _ := ReadIndex(); len(entries) != 2 {
+		t.Errorf("index after refused prune = %+v", entries)
+	}
+}
+
+func TestUpdateIndex_Concurrent(t *testing.T) {
+	t.Setenv("MACGO_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	const n = 8
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := &Bundle{Path: filepath.Join(dir, fmt.Sprintf("App%d.app", i)), Config: &Config{}}
+			if err := b.updateIndex(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if entries, err := ReadIndex(); err != nil || len(entries) != n {
+		t.Errorf("ReadIndex = %d entries, %v; want %d", len(entries), err, n)
+	}
+}
+
+func TestPrune_SkipsLockedBundles(t *testing.T) {
+	t.Setenv("MACGO_CACHE_DIR", t.TempDir())
+	execPath := filepath.Join(t.TempDir(), "locked")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(execPath, &Config{AppName: "LockedApp", BundleID: "com.example.locked", BundleDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another creator holds the bundle's lock.
+	lock, err := tryLockBundle(b.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if removed, err := Prune(future, false); err != nil || len(removed) != 0 {
+		t.Errorf("Prune of a locked bundle = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(b.Path); err != nil {
+		t.Fatalf("Prune removed a locked bundle: %v", err)
+	}
+	lock.Close()
+	if removed, err := Prune(future, false); err != nil || len(removed) != 1 {
+		t.Errorf("Prune after unlocking = %v, %v", removed, err)
+	}
+}
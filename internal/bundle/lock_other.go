@@ -0,0 +1,15 @@
+//go:build !unix
+
+package bundle
+
+import (
+	"errors"
+	"os"
+)
+
+var errLocked = errors.New("locked by another process")
+
+// flock is a no-op: bundles are only created on macOS.
+func flock(f *os.File, wait bool) error {
+	return nil
+}
@@ -0,0 +1,288 @@
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// manifestHeader is the first line of a manifest file.
+const manifestHeader = "# macgo bundle manifest v1"
+
+// ManifestEntry is a file in a bundle manifest.
+type ManifestEntry struct {
+	// Path is the file's slash-separated path relative to the bundle.
+	Path string
+
+	// Mode is the file's permission bits, or fs.ModeSymlink for a
+	// symbolic link.
+	Mode fs.FileMode
+
+	// SHA256 is the hex SHA-256 of the file's contents, or of the link
+	// target for a symbolic link.
+	SHA256 string
+}
+
+// Manifest lists the files of a bundle, sorted by path.
+type Manifest []ManifestEntry
+
+// ManifestPath returns the path of the manifest macgo writes for the
+// bundle at bundlePath, which lists every file and its hash so that
+// bundles can be checked and compared across machines. It lives next to
+// the bundle because a file added inside it after signing would break
+// the signature's seal.
+func ManifestPath(bundlePath string) string {
+	return filepath.Join(filepath.Dir(bundlePath), "."+filepath.Base(bundlePath)+".manifest")
+}
+
+// BuildManifest returns the manifest of the bundle at bundlePath.
+func BuildManifest(bundlePath string) (Manifest, error) {
+	var m Manifest
+	err := filepath.WalkDir(bundlePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(bundlePath, path)
+		if err != nil {
+			return err
+		}
+		e := ManifestEntry{Path: filepath.ToSlash(rel)}
+		if strings.ContainsAny(e.Path, "\n\r") {
+			return fmt.Errorf("file name %q cannot be recorded in a manifest", e.Path)
+		}
+		h := sha256.New()
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			e.Mode = fs.ModeSymlink
+			io.WriteString(h, target)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			e.Mode = info.Mode().Perm()
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unsupported file type %v", e.Path, d.Type())
+		}
+		e.SHA256 = hex.EncodeToString(h.Sum(nil))
+		m = append(m, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build manifest: %w", err)
+	}
+	slices.SortFunc(m, func(a, b ManifestEntry) int { return strings.Compare(a.Path, b.Path) })
+	return m, nil
+}
+
+// MarshalText encodes the manifest as a header line followed by one line
+// per file: its mode in octal, or "link", its SHA-256 and its path.
+func (m Manifest) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(manifestHeader + "\n")
+	for _, e := range m {
+		mode := fmt.Sprintf("%04o", uint32(e.Mode.Perm()))
+		if e.Mode&fs.ModeSymlink != 0 {
+			mode = "link"
+		}
+		fmt.Fprintf(&buf, "%s %s %s\n", mode, e.SHA256, e.Path)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText decodes a manifest encoded by MarshalText.
+func (m *Manifest) UnmarshalText(data []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() || sc.Text() != manifestHeader {
+		return fmt.Errorf("not a macgo bundle manifest")
+	}
+	var entries Manifest
+	for line := 2; sc.Scan(); line++ {
+		fields := strings.SplitN(sc.Text(), " ", 3)
+		if len(fields) != 3 || len(fields[1]) != sha256.Size*2 {
+			return fmt.Errorf("manifest line %d: malformed entry", line)
+		}
+		e := ManifestEntry{SHA256: fields[1], Path: fields[2]}
+		if fields[0] == "link" {
+			e.Mode = fs.ModeSymlink
+		} else {
+			mode, err := strconv.ParseUint(fields[0], 8, 32)
+			if err != nil || mode > 0o777 {
+				return fmt.Errorf("manifest line %d: bad mode %q", line, fields[0])
+			}
+			e.Mode = fs.FileMode(mode)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	*m = entries
+	return nil
+}
+
+// ReadManifest reads a manifest file.
+func ReadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := m.UnmarshalText(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// writeManifest writes m to path, replacing it atomically.
+func writeManifest(path string, m Manifest) error {
+	data, err := m.MarshalText()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Diff describes how the files of got differ from those of m, one line
+// per added, missing or changed file. It returns nil if they match.
+func (m Manifest) Diff(got Manifest) []string {
+	var diffs []string
+	i, j := 0, 0
+	for i < len(m) || j < len(got) {
+		switch {
+		case j == len(got) || i < len(m) && m[i].Path < got[j].Path:
+			diffs = append(diffs, "missing "+m[i].Path)
+			i++
+		case i == len(m) || got[j].Path < m[i].Path:
+			diffs = append(diffs, "unexpected "+got[j].Path)
+			j++
+		default:
+			w, g := m[i], got[j]
+			if w.SHA256 != g.SHA256 {
+				diffs = append(diffs, "modified "+w.Path)
+			} else if w.Mode != g.Mode {
+				diffs = append(diffs, fmt.Sprintf("mode of %s is %v, want %v", w.Path, g.Mode, w.Mode))
+			}
+			i++
+			j++
+		}
+	}
+	return diffs
+}
+
+// VerifyManifest checks the bundle at bundlePath against the manifest
+// at manifestPath, or against the manifest macgo wrote for it if
+// manifestPath is empty, and returns the differences.
+func VerifyManifest(bundlePath, manifestPath string) ([]string, error) {
+	if manifestPath == "" {
+		manifestPath = ManifestPath(bundlePath)
+	}
+	want, err := ReadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	got, err := BuildManifest(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	return want.Diff(got), nil
+}
+
+// sourceDateEpoch returns the time in $SOURCE_DATE_EPOCH, the
+// reproducible-builds convention for a fixed build time, or the zero
+// time if it is unset.
+func sourceDateEpoch() (time.Time, error) {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || sec < 0 {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: want seconds since 1970", s)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// normalizeFiles gives the files under root stable modes, 0755 for
+// directories and executables and 0644 for other files, so that the
+// umask does not show in the bundle. With a non-zero modTime, taken from
+// SOURCE_DATE_EPOCH, it also sets every file's modification time,
+// children before their directory. Symbolic links are left as they are.
+//
+// Together with property lists encoded with sorted keys, this makes two
+// builds from the same executables and configuration produce the same
+// files. Signatures made with a certificate and a secure timestamp still
+// differ between builds.
+func normalizeFiles(root string, modTime time.Time) error {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(0644)
+		if d.IsDir() || info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		if info.Mode().Perm() != mode {
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil || modTime.IsZero() {
+		return err
+	}
+	for _, path := range slices.Backward(paths) {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
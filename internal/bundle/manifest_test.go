@@ -0,0 +1,197 @@
+package bundle
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCreate_Reproducible(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	epoch := time.Unix(1700000000, 0)
+	tmpDir := t.TempDir()
+	execPath := filepath.Join(tmpDir, "repro")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\necho repro\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(dir string) *Bundle {
+		t.Helper()
+		b, err := New(execPath, &Config{
+			AppName:   "ReproApp",
+			BundleID:  "com.example.repro",
+			BundleDir: dir,
+			Info: map[string]any{
+				"ZKey": "z", "AKey": "a", "MKey": map[string]any{"b": 2, "a": 1, "c": 3},
+			},
+			URLTypes: []URLType{{Schemes: []string{"repro"}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Create(); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return b
+	}
+	b1 := create(filepath.Join(tmpDir, "one"))
+	b2 := create(filepath.Join(tmpDir, "two"))
+
+	m1, err := ReadManifest(ManifestPath(b1.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := ReadManifest(ManifestPath(b2.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m1, m2) {
+		t.Errorf("manifests differ:\n%v\n%v", m1, m2)
+	}
+	if !slices.ContainsFunc(m1, func(e ManifestEntry) bool { return e.Path == "Contents/MacOS/ReproApp" && e.Mode == 0755 }) {
+		t.Errorf("manifest lacks the executable with mode 0755: %v", m1)
+	}
+	info1, _ := os.ReadFile(filepath.Join(b1.Path, "Contents", "Info.plist"))
+	info2, _ := os.ReadFile(filepath.Join(b2.Path, "Contents", "Info.plist"))
+	if !bytes.Equal(info1, info2) {
+		t.Error("Info.plist differs between builds")
+	}
+	if a, z := bytes.Index(info1, []byte("<key>AKey</key>")), bytes.Index(info1, []byte("<key>ZKey</key>")); a < 0 || a > z {
+		t.Error("Info.plist keys are not sorted")
+	}
+	filepath.WalkDir(b1.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Equal(epoch) {
+			t.Errorf("%s: mtime %v, want %v", path, info.ModTime(), epoch)
+		}
+		return nil
+	})
+
+	if diffs, err := VerifyManifest(b1.Path, ""); err != nil || diffs != nil {
+		t.Fatalf("VerifyManifest of an intact bundle = %q, %v", diffs, err)
+	}
+	// The manifest of another build verifies this one too.
+	if diffs, err := VerifyManifest(b1.Path, ManifestPath(b2.Path)); err != nil || diffs != nil {
+		t.Errorf("VerifyManifest against the other build = %q, %v", diffs, err)
+	}
+
+	contents := filepath.Join(b1.Path, "Contents")
+	os.WriteFile(filepath.Join(contents, "Info.plist"), []byte("tampered"), 0644)
+	os.Remove(filepath.Join(contents, "Resources", sourceHashFile))
+	os.WriteFile(filepath.Join(contents, "Resources", "extra.txt"), nil, 0644)
+	os.Chmod(filepath.Join(contents, "MacOS", "ReproApp"), 0700)
+	diffs, err := VerifyManifest(b1.Path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"modified Contents/Info.plist",
+		"mode of Contents/MacOS/ReproApp is -rwx------, want -rwxr-xr-x",
+		"missing Contents/Resources/" + sourceHashFile,
+		"unexpected Contents/Resources/extra.txt",
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("VerifyManifest of a modified bundle =\n%q\nwant\n%q", diffs, want)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := New(execPath, &Config{}); err == nil {
+		t.Error("New accepted an invalid SOURCE_DATE_EPOCH")
+	}
+}
+
+func TestManifest_MatchesModifiedReusedBundle(t *testing.T) {
+	execPath := buildDarwinArm64(t, "manifest-hook-test")
+	bundleDir := t.TempDir()
+	create := func(hook func(string) error) *Bundle {
+		t.Helper()
+		b, err := New(execPath, &Config{
+			AppName:        "ManifestApp",
+			BundleID:       "com.example.manifest",
+			AdHocSign:      true,
+			Signer:         SignerBuiltin,
+			BundleDir:      bundleDir,
+			PostCreateHook: hook,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Create(); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	verify := func(what string, b *Bundle) {
+		t.Helper()
+		if err := b.Sign(); err != nil {
+			t.Fatal(err)
+		}
+		if diffs, err := VerifyManifest(b.Path, ""); err != nil || len(diffs) != 0 {
+			t.Errorf("%s: VerifyManifest = %v, %v", what, diffs, err)
+		}
+	}
+	verify("new bundle", create(nil))
+
+	// A hook replaces the otherwise reusable bundle.
+	verify("hooked bundle", create(func(path string) error {
+		return os.WriteFile(filepath.Join(path, "Contents", "Resources", "hook.txt"), []byte("hook\n"), 0644)
+	}))
+
+	// ForceResign re-signs the reused bundle in place.
+	b := create(nil)
+	if !b.reused {
+		t.Fatal("bundle not reused")
+	}
+	b.ForceResign()
+	b.Config.CodeSigningIdentifier = "com.example.manifest.resigned"
+	verify("re-signed bundle", b)
+}
+
+func TestNormalizeFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "private")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]fs.FileMode{
+		filepath.Join(dir, "data"):  0600,
+		filepath.Join(dir, "tool"):  0700,
+		filepath.Join(root, "open"): 0666,
+	}
+	for path, mode := range files {
+		if err := os.WriteFile(path, nil, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := normalizeFiles(root, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]fs.FileMode{
+		dir:                         0755,
+		filepath.Join(dir, "data"):  0644,
+		filepath.Join(dir, "tool"):  0755,
+		filepath.Join(root, "open"): 0644,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tmc/macgo/codesign"
+	"github.com/tmc/macgo/internal/plist"
+	"github.com/tmc/macgo/internal/system"
+)
+
+// Helper is an executable shipped inside the bundle and signed with it,
+// such as a command-line tool or the program run by a LaunchAgent.
+type Helper struct {
+	// Path is the executable to copy into the bundle.
+	Path string
+
+	// Name is the file name in the bundle. Defaults to the base name of Path.
+	Name string
+
+	// Dir is the directory under Contents holding the helper: "MacOS"
+	// (the default) or "Helpers".
+	Dir string
+
+	// Identifier is the code signing identifier. Defaults to the bundle
+	// ID followed by "." and Name.
+	Identifier string
+
+	// Entitlements are added to the entitlements macgo generates for the
+	// helper. In a sandboxed app, helpers inherit the app's sandbox and
+	// the sandbox kills a helper with entitlements of its own, so only
+	// com.apple.security.get-task-allow is accepted there; use an
+	// XPCService for code that needs different entitlements.
+	Entitlements map[string]any
+}
+
+// XPCService is an XPC service bundle in Contents/XPCServices, built
+// around an executable that calls xpc_main or NSXPCListener.service.
+type XPCService struct {
+	// Path is the service executable.
+	Path string
+
+	// Name is the bundle name, without the .xpc extension. Defaults to
+	// the base name of Path.
+	Name string
+
+	// BundleID is the service's bundle identifier, which clients connect
+	// to. Defaults to the app's bundle ID followed by "." and Name.
+	BundleID string
+
+	// ServiceType is the XPCService ServiceType: "Application" (the
+	// default), "User" or "System".
+	ServiceType string
+
+	// Info holds additional Info.plist keys.
+	Info map[string]any
+
+	// Entitlements are added to the entitlements macgo generates for the
+	// service. In a sandboxed app, the service gets its own sandbox.
+	Entitlements map[string]any
+}
+
+// LaunchAgent is a launchd job in Contents/Library/LaunchAgents, for
+// registration with SMAppService.agent(plistName:).
+type LaunchAgent struct {
+	// Label is the job label. The property list is named Label.plist.
+	Label string
+
+	// Program is the Name of a Helper, or a path relative to the bundle
+	// such as "Contents/MacOS/agent".
+	Program string
+
+	// Arguments are passed to the program.
+	Arguments []string
+
+	// RunAtLoad starts the job when it is loaded.
+	RunAtLoad bool
+
+	// KeepAlive restarts the job whenever it exits.
+	KeepAlive bool
+
+	// MachServices lists the Mach service names the job provides.
+	MachServices []string
+
+	// Plist holds additional launchd keys.
+	Plist map[string]any
+}
+
+// sandboxed reports whether the configuration enables the App Sandbox.
+func (c *Config) sandboxed() bool {
+	return slices.Contains(c.Permissions, "sandbox") || slices.Contains(c.Custom, "com.apple.security.app-sandbox")
+}
+
+// checkName reports an error if name cannot name a file directly inside
+// a bundle directory.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return fmt.Errorf("invalid name %q: want a file name without path separators", name)
+	}
+	return nil
+}
+
+// hasNested reports whether the configuration adds nested code or
+// LaunchAgents to the bundle.
+func (c *Config) hasNested() bool {
+	return len(c.Helpers) > 0 || len(c.XPCServices) > 0 || len(c.LaunchAgents) > 0
+}
+
+func (h Helper) name() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return filepath.Base(h.Path)
+}
+
+// rel returns the helper's path relative to Contents.
+func (h Helper) rel() string {
+	dir := h.Dir
+	if dir == "" {
+		dir = "MacOS"
+	}
+	return filepath.Join(dir, h.name())
+}
+
+func (s XPCService) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return filepath.Base(s.Path)
+}
+
+// rel returns the service's path relative to Contents.
+func (s XPCService) rel() string {
+	return filepath.Join("XPCServices", s.name()+".xpc")
+}
+
+// writeNested copies the configured helpers into the bundle, builds its
+// XPC service bundles and writes its LaunchAgent property lists.
+func (b *Bundle) writeNested(contentsDir string) error {
+	mainExec := filepath.Join("MacOS", filepath.Base(b.appName))
+	helpers := map[string]bool{}
+	for _, h := range b.Config.Helpers {
+		if h.Path == "" {
+			return fmt.Errorf("helper %q: no executable path", h.Name)
+		}
+		if err := checkName(h.name()); err != nil {
+			return fmt.Errorf("helper: %w", err)
+		}
+		if helpers[h.name()] {
+			return fmt.Errorf("helper %s: more than one helper has this name", h.name())
+		}
+		helpers[h.name()] = true
+		if h.Dir != "" && h.Dir != "MacOS" && h.Dir != "Helpers" {
+			return fmt.Errorf("helper %s: directory %q is not MacOS or Helpers", h.name(), h.Dir)
+		}
+		if h.rel() == mainExec {
+			return fmt.Errorf("helper %s: name clashes with the app executable", h.name())
+		}
+		if b.Config.sandboxed() {
+			for _, k := range slices.Sorted(maps.Keys(h.Entitlements)) {
+				if k != "com.apple.security.get-task-allow" {
+					return fmt.Errorf("helper %s: entitlement %s: a helper inherits the app's sandbox and is killed if it has entitlements of its own; use an XPC service instead", h.name(), k)
+				}
+			}
+		}
+		dest := filepath.Join(contentsDir, h.rel())
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("helper %s: %w", h.name(), err)
+		}
+		if err := system.CopyFile(h.Path, dest); err != nil {
+			return fmt.Errorf("helper %s: %w", h.name(), err)
+		}
+		if err := os.Chmod(dest, 0755); err != nil {
+			return fmt.Errorf("helper %s: %w", h.name(), err)
+		}
+	}
+
+	for _, s := range b.Config.XPCServices {
+		if err := checkName(s.name()); err != nil {
+			return fmt.Errorf("XPC service: %w", err)
+		}
+		if err := b.writeXPCService(contentsDir, s); err != nil {
+			return fmt.Errorf("XPC service %s: %w", s.name(), err)
+		}
+	}
+
+	for _, a := range b.Config.LaunchAgents {
+		if err := checkName(a.Label); err != nil {
+			return fmt.Errorf("LaunchAgent: %w", err)
+		}
+		if err := b.writeLaunchAgent(contentsDir, a); err != nil {
+			return fmt.Errorf("LaunchAgent %s: %w", a.Label, err)
+		}
+	}
+	return nil
+}
+
+// bundleID returns the service's bundle ID in the app with bundle ID app.
+func (s XPCService) bundleID(app string) string {
+	if s.BundleID != "" {
+		return s.BundleID
+	}
+	return app + "." + s.name()
+}
+
+func (b *Bundle) writeXPCService(contentsDir string, s XPCService) error {
+	if s.Path == "" {
+		return fmt.Errorf("no executable path")
+	}
+	serviceType := s.ServiceType
+	switch serviceType {
+	case "":
+		serviceType = "Application"
+	case "Application", "User", "System":
+	default:
+		return fmt.Errorf("unknown ServiceType %q", s.ServiceType)
+	}
+
+	xpcContents := filepath.Join(contentsDir, s.rel(), "Contents")
+	exec := filepath.Join(xpcContents, "MacOS", s.name())
+	if err := os.MkdirAll(filepath.Dir(exec), 0755); err != nil {
+		return err
+	}
+	if err := system.CopyFile(s.Path, exec); err != nil {
+		return err
+	}
+	if err := os.Chmod(exec, 0755); err != nil {
+		return err
+	}
+
+	info := map[string]any{
+		"CFBundleDevelopmentRegion":     "en",
+		"CFBundleExecutable":            s.name(),
+		"CFBundleIdentifier":            s.bundleID(b.bundleID),
+		"CFBundleInfoDictionaryVersion": "6.0",
+		"CFBundleName":                  s.name(),
+		"CFBundlePackageType":           "XPC!",
+		"CFBundleShortVersionString":    b.version,
+		"CFBundleVersion":               b.version,
+		"XPCService":                    map[string]any{"ServiceType": serviceType},
+	}
+	for k, v := range s.Info {
+		info[k] = v
+	}
+	data, err := plist.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(xpcContents, "Info.plist"), data, 0644)
+}
+
+func (b *Bundle) writeLaunchAgent(contentsDir string, a LaunchAgent) error {
+	program := a.Program
+	if i := slices.IndexFunc(b.Config.Helpers, func(h Helper) bool { return h.name() == a.Program }); i >= 0 {
+		program = filepath.ToSlash(filepath.Join("Contents", b.Config.Helpers[i].rel()))
+	} else if !strings.Contains(program, "/") {
+		return fmt.Errorf("no helper named %q", a.Program)
+	}
+
+	job := map[string]any{
+		"Label":                       a.Label,
+		"BundleProgram":               program,
+		"AssociatedBundleIdentifiers": []any{b.bundleID},
+	}
+	if len(a.Arguments) > 0 {
+		args := []any{program}
+		for _, arg := range a.Arguments {
+			args = append(args, arg)
+		}
+		job["ProgramArguments"] = args
+	}
+	if a.RunAtLoad {
+		job["RunAtLoad"] = true
+	}
+	if a.KeepAlive {
+		job["KeepAlive"] = true
+	}
+	if len(a.MachServices) > 0 {
+		services := map[string]any{}
+		for _, name := range a.MachServices {
+			services[name] = true
+		}
+		job["MachServices"] = services
+	}
+	for k, v := range a.Plist {
+		job[k] = v
+	}
+	data, err := plist.Marshal(job)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(contentsDir, "Library", "LaunchAgents")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, a.Label+".plist"), data, 0644)
+}
+
+// nestedHash extends the hash of the bundle executable with the nested
+// code and its configuration, so changing either invalidates the bundle.
+func (b *Bundle) nestedHash(execHash string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "executable %s\n", execHash)
+	var paths []string
+	for _, helper := range b.Config.Helpers {
+		paths = append(paths, helper.Path)
+	}
+	for _, s := range b.Config.XPCServices {
+		paths = append(paths, s.Path)
+	}
+	for _, path := range paths {
+		sum, err := system.CalculateFileSHA256(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "nested %s\n", sum)
+	}
+	config, err := json.Marshal([]any{b.Config.Helpers, b.Config.XPCServices, b.Config.LaunchAgents})
+	if err != nil {
+		return "", err
+	}
+	h.Write(config)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// nestedCode describes a nested item to sign.
+type nestedCode struct {
+	path         string // file or bundle directory
+	identifier   string
+	entitlements map[string]any
+}
+
+// nestedCodeIn lists the bundle's nested code in signing order: the
+// deepest items, XPC service bundles, come first.
+func nestedCodeIn(bundlePath string, cfg *Config) []nestedCode {
+	bundleID := system.GetBundleID(bundlePath)
+	sandboxed := cfg.sandboxed()
+	adhoc := cfg.CodeSignIdentity == "-" || cfg.CodeSignIdentity == "" && cfg.AdHocSign
+
+	entitlements := func(extra map[string]any, inherit bool) map[string]any {
+		ents := map[string]any{}
+		if sandboxed {
+			ents["com.apple.security.app-sandbox"] = true
+			if inherit {
+				ents["com.apple.security.inherit"] = true
+			}
+		}
+		if adhoc {
+			ents["com.apple.security.get-task-allow"] = true
+		}
+		for k, v := range extra {
+			ents[k] = v
+		}
+		return ents
+	}
+
+	contentsDir := filepath.Join(bundlePath, "Contents")
+	var code []nestedCode
+	for _, s := range cfg.XPCServices {
+		code = append(code, nestedCode{
+			path:         filepath.Join(contentsDir, s.rel()),
+			identifier:   s.bundleID(bundleID),
+			entitlements: entitlements(s.Entitlements, false),
+		})
+	}
+	for _, h := range cfg.Helpers {
+		id := h.Identifier
+		if id == "" {
+			id = bundleID + "." + h.name()
+		}
+		code = append(code, nestedCode{
+			path:         filepath.Join(contentsDir, h.rel()),
+			identifier:   id,
+			entitlements: entitlements(h.Entitlements, true),
+		})
+	}
+	return code
+}
+
+// signNested signs the bundle's helpers and XPC services, inside out,
+// with the identity used for the bundle itself. Entitlements files are
+// written to tmpDir.
+func signNested(bundlePath, tmpDir string, id *codesign.Identity, cfg *Config) error {
+	for i, c := range nestedCodeIn(bundlePath, cfg) {
+		entPath := filepath.Join(tmpDir, fmt.Sprintf("nested-%d.plist", i))
+		if len(c.entitlements) > 0 {
+			data, err := plist.Marshal(c.entitlements)
+			if err != nil {
+				return fmt.Errorf("%s: entitlements: %w", filepath.Base(c.path), err)
+			}
+			if err := os.WriteFile(entPath, data, 0644); err != nil {
+				return err
+			}
+		}
+		if err := signCode(c.path, c.identifier, entPath, id, cfg); err != nil {
+			return fmt.Errorf("signing %s: %w", filepath.Base(c.path), err)
+		}
+	}
+	return nil
+}
@@ -1,108 +1,47 @@
 package bundle
 
 import (
+	"crypto/x509"
 	"fmt"
+	"maps"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/tmc/macgo/codesign"
+	"github.com/tmc/macgo/internal/plist"
 )
 
 // ProfileEntitlements holds entitlement values extracted from a provisioning profile.
 type ProfileEntitlements struct {
-	ApplicationIdentifier string
-	TeamIdentifier        string
-}
-
-// decodeProvisioningProfile strips the PKCS7 envelope from a provisioning profile
-// using security cms and returns the raw XML plist.
-func decodeProvisioningProfile(path string) ([]byte, error) {
-	cmd := exec.Command("security", "cms", "-D", "-i", path)
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("security cms: %w", err)
-	}
-	return out, nil
+	ApplicationIdentifier string `plist:"com.apple.application-identifier"`
+	TeamIdentifier        string `plist:"com.apple.developer.team-identifier"`
 }
 
 // extractProfileEntitlements parses XML plist data from a decoded provisioning
 // profile and extracts com.apple.application-identifier and
 // com.apple.developer.team-identifier from the Entitlements dict.
-//
-// Uses a line-scan state machine following the pattern in system.GetBundleID.
+// Malformed input yields an empty result.
 func extractProfileEntitlements(xmlData []byte) ProfileEntitlements {
-	var pe ProfileEntitlements
-	lines := strings.Split(string(xmlData), "\n")
-
-	// State machine: find <key>Entitlements</key>, enter the dict,
-	// extract target string values, exit on </dict>.
-	const (
-		stateSearchEntitlements = iota
-		stateExpectDict
-		stateInDict
-		stateReadAppID
-		stateReadTeamID
-	)
-	state := stateSearchEntitlements
-	depth := 0
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		switch state {
-		case stateSearchEntitlements:
-			if trimmed == "<key>Entitlements</key>" {
-				state = stateExpectDict
-			}
-		case stateExpectDict:
-			if trimmed == "<dict>" {
-				state = stateInDict
-				depth = 1
-			}
-		case stateInDict:
-			if trimmed == "<dict>" {
-				depth++
-				continue
-			}
-			if trimmed == "</dict>" {
-				depth--
-				if depth == 0 {
-					return pe
-				}
-				continue
-			}
-			// Only match keys at the top level of the Entitlements dict.
-			if depth != 1 {
-				continue
-			}
-			if trimmed == "<key>com.apple.application-identifier</key>" {
-				state = stateReadAppID
-			} else if trimmed == "<key>com.apple.developer.team-identifier</key>" {
-				state = stateReadTeamID
-			}
-		case stateReadAppID:
-			if strings.HasPrefix(trimmed, "<string>") && strings.HasSuffix(trimmed, "</string>") {
-				pe.ApplicationIdentifier = strings.TrimSuffix(strings.TrimPrefix(trimmed, "<string>"), "</string>")
-			}
-			state = stateInDict
-		case stateReadTeamID:
-			if strings.HasPrefix(trimmed, "<string>") && strings.HasSuffix(trimmed, "</string>") {
-				pe.TeamIdentifier = strings.TrimSuffix(strings.TrimPrefix(trimmed, "<string>"), "</string>")
-			}
-			state = stateInDict
-		}
+	var profile struct {
+		Entitlements ProfileEntitlements
+	}
+	if err := plist.Unmarshal(xmlData, &profile); err != nil {
+		return ProfileEntitlements{}
 	}
-	return pe
+	return profile.Entitlements
 }
 
-// readProvisioningProfileEntitlements decodes a provisioning profile and
+// readProvisioningProfileEntitlements reads a provisioning profile and
 // extracts its entitlement values.
 func readProvisioningProfileEntitlements(path string) (ProfileEntitlements, error) {
-	data, err := decodeProvisioningProfile(path)
+	p, err := codesign.ReadProfile(path)
 	if err != nil {
 		return ProfileEntitlements{}, err
 	}
-	return extractProfileEntitlements(data), nil
+	return extractProfileEntitlements(p.Content), nil
 }
 
 // deriveStringEntitlements returns string-valued entitlements that can be
@@ -120,8 +59,12 @@ func (b *Bundle) deriveStringEntitlements() map[string]string {
 			return nil
 		}
 		m := make(map[string]string)
-		if pe.ApplicationIdentifier != "" {
-			m["com.apple.application-identifier"] = pe.ApplicationIdentifier
+		if appID := pe.ApplicationIdentifier; appID != "" {
+			// A wildcard profile grants a concrete identifier for this bundle.
+			if prefix, _, ok := strings.Cut(appID, "."); ok && strings.HasSuffix(appID, "*") {
+				appID = prefix + "." + b.bundleID
+			}
+			m["com.apple.application-identifier"] = appID
 		}
 		if pe.TeamIdentifier != "" {
 			m["com.apple.developer.team-identifier"] = pe.TeamIdentifier
@@ -132,21 +75,193 @@ func (b *Bundle) deriveStringEntitlements() map[string]string {
 	}
 
 	// Fall back: derive from signing identity.
+	teamID := b.signingTeamID()
+	if teamID == "" {
+		return nil
+	}
+	appID := teamID + "." + b.bundleID
+	return map[string]string{
+		"com.apple.application-identifier":    appID,
+		"com.apple.developer.team-identifier": teamID,
+	}
+}
+
+// signingTeamID returns the team ID of the identity the bundle will be
+// signed with, or "" for ad-hoc signing or when it cannot be determined.
+func (b *Bundle) signingTeamID() string {
 	identity := b.Config.CodeSignIdentity
-	if identity == "" && b.Config.AutoSign {
+	if identity == "" && b.Config.AutoSign && b.Config.IdentityProvider == nil {
 		identity = codesign.FindDeveloperID()
 	}
-	if identity == "" || identity == "-" {
-		return nil
+	if identity == "-" {
+		return ""
 	}
 
-	teamID := codesign.ExtractTeamIDFromCertificate(identity)
-	if teamID == "" {
+	switch {
+	case b.Config.IdentityProvider != nil:
+		id, err := codesign.FindIdentity(b.Config.IdentityProvider, identity)
+		if err != nil {
+			if b.Config.Debug {
+				fmt.Fprintf(os.Stderr, "macgo: warning: %v\n", err)
+			}
+			return ""
+		}
+		return id.TeamID()
+	case identity != "":
+		return codesign.ExtractTeamIDFromCertificate(identity)
+	}
+	return ""
+}
+
+// discoverProvisioningProfile sets Config.ProvisioningProfile to the best
+// installed profile for the bundle ID and signing team, searching the
+// standard profile directories and Config.ProfileDirs.
+func (b *Bundle) discoverProvisioningProfile() {
+	teamID := b.signingTeamID()
+	dirs := append(codesign.ProfileDirs(), b.Config.ProfileDirs...)
+	p, err := codesign.FindProfile(b.bundleID, teamID, dirs...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "macgo: warning: %v; signing without a provisioning profile\n", err)
+		return
+	}
+	b.Config.ProvisioningProfile = p.Path
+	if b.Config.Debug {
+		fmt.Fprintf(os.Stderr, "macgo: found provisioning profile %q (%s) at %s\n", p.Name, p.UUID, p.Path)
+	}
+}
+
+// ProfileMismatchError lists the ways a bundle's entitlements or signing
+// certificate fall outside what its provisioning profile allows. macOS
+// kills such apps at launch.
+type ProfileMismatchError struct {
+	Profile    string   // profile path
+	Violations []string // one entry per problem
+}
+
+func (e *ProfileMismatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "provisioning profile %s does not allow this signature:", e.Profile)
+	for _, v := range e.Violations {
+		b.WriteString("\n  - ")
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+// checkProfile compares the bundle's generated entitlements and, when it
+// is known, the signing certificate against the configured provisioning
+// profile. Every violation is reported in a single ProfileMismatchError.
+func (b *Bundle) checkProfile(cert *x509.Certificate) error {
+	if b.Config.ProvisioningProfile == "" {
 		return nil
 	}
-	appID := teamID + "." + b.bundleID
-	return map[string]string{
-		"com.apple.application-identifier":      appID,
-		"com.apple.developer.team-identifier": teamID,
+	profile, err := codesign.ReadProfile(b.Config.ProvisioningProfile)
+	if err != nil {
+		return err
+	}
+	var ents map[string]any
+	if data, err := os.ReadFile(filepath.Join(b.Path, "Contents", "entitlements.plist")); err == nil {
+		if err := plist.Unmarshal(data, &ents); err != nil {
+			return fmt.Errorf("read entitlements: %w", err)
+		}
+	}
+
+	var violations []string
+	for _, key := range slices.Sorted(maps.Keys(ents)) {
+		if v := checkProfileEntitlement(profile, key, ents[key]); v != "" {
+			violations = append(violations, v)
+		}
+	}
+	if cert != nil && !slices.ContainsFunc(profile.DeveloperCertificates, cert.Equal) {
+		violations = append(violations, fmt.Sprintf("certificate %q is not one of the profile's developer certificates", cert.Subject.CommonName))
+	}
+	if len(violations) > 0 {
+		return &ProfileMismatchError{Profile: b.Config.ProvisioningProfile, Violations: violations}
+	}
+	return nil
+}
+
+// checkProfileEntitlement returns a description of why the profile does
+// not allow entitlement key with value want, or "" if it does.
+func checkProfileEntitlement(profile *codesign.Profile, key string, want any) string {
+	have, ok := profile.Entitlements[key]
+	if !ok {
+		// Sandbox and hardened runtime entitlements need no profile, and
+		// neither do app groups prefixed with the team ID.
+		if strings.HasPrefix(key, "com.apple.security.") && key != "com.apple.security.application-groups" {
+			return ""
+		}
+		if key == "com.apple.security.application-groups" && teamPrefixed(want, profile.TeamIDs) {
+			return ""
+		}
+		return fmt.Sprintf("%s is not in the profile", key)
+	}
+	if !entitlementAllowed(want, have) {
+		return fmt.Sprintf("%s = %s, but the profile allows %s", key, formatEntitlement(want), formatEntitlement(have))
+	}
+	return ""
+}
+
+// entitlementAllowed reports whether a profile entitlement value allows
+// the requested value. Profile strings may end in a "*" wildcard, and a
+// profile array allows any subset of its elements.
+func entitlementAllowed(want, have any) bool {
+	switch have := have.(type) {
+	case []any:
+		wants, ok := want.([]any)
+		if !ok {
+			wants = []any{want}
+		}
+		for _, w := range wants {
+			if !slices.ContainsFunc(have, func(h any) bool { return entitlementAllowed(w, h) }) {
+				return false
+			}
+		}
+		return true
+	case string:
+		if wants, ok := want.([]any); ok {
+			for _, w := range wants {
+				if !entitlementAllowed(w, have) {
+					return false
+				}
+			}
+			return true
+		}
+		w, ok := want.(string)
+		if prefix, wild := strings.CutSuffix(have, "*"); wild {
+			return ok && strings.HasPrefix(w, prefix)
+		}
+		return ok && w == have
+	case bool:
+		w, ok := want.(bool)
+		return ok && (have || !w)
+	}
+	return reflect.DeepEqual(want, have)
+}
+
+// teamPrefixed reports whether v is a list of strings that all start with
+// one of the team IDs.
+func teamPrefixed(v any, teamIDs []string) bool {
+	list, ok := v.([]any)
+	if !ok {
+		return false
+	}
+	for _, e := range list {
+		s, _ := e.(string)
+		if !slices.ContainsFunc(teamIDs, func(id string) bool { return strings.HasPrefix(s, id+".") }) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatEntitlement(v any) string {
+	if list, ok := v.([]any); ok {
+		s := make([]string, len(list))
+		for i, e := range list {
+			s[i] = fmt.Sprint(e)
+		}
+		return "[" + strings.Join(s, ", ") + "]"
 	}
+	return fmt.Sprintf("%v", v)
 }
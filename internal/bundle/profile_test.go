@@ -1,6 +1,10 @@
 package bundle
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/tmc/macgo/codesign"
+)
 
 func TestExtractProfileEntitlements(t *testing.T) {
 	tests := []struct {
@@ -90,6 +94,12 @@ func TestExtractProfileEntitlements(t *testing.T) {
 			wantApp:  "XYZ789.com.test.nested",
 			wantTeam: "XYZ789",
 		},
+		{
+			name:     "single-line plist",
+			xml:      `<plist version="1.0"><dict><key>Entitlements</key><dict><key>com.apple.application-identifier</key><string>ONE.com.example.line</string><key>com.apple.developer.team-identifier</key><string>ONE</string></dict></dict></plist>`,
+			wantApp:  "ONE.com.example.line",
+			wantTeam: "ONE",
+		},
 		{
 			name:     "empty input",
 			xml:      "",
@@ -124,3 +134,50 @@ func TestExtractProfileEntitlements(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckProfileEntitlement(t *testing.T) {
+	profile := &codesign.Profile{
+		TeamIDs: []string{"ABC123DEF4"},
+		Entitlements: map[string]any{
+			"com.apple.application-identifier":         "ABC123DEF4.*",
+			"keychain-access-groups":                   []any{"ABC123DEF4.*", "com.apple.token"},
+			"com.apple.security.application-groups":    []any{"group.com.example.shared"},
+			"com.apple.developer.associated-domains":   "*",
+			"com.apple.developer.networking.wifi-info": true,
+			"com.apple.developer.aps-environment":      "production",
+			"com.apple.developer.team-identifier":      "ABC123DEF4",
+		},
+	}
+	tests := []struct {
+		key   string
+		value any
+		ok    bool
+	}{
+		{"com.apple.application-identifier", "ABC123DEF4.com.example.app", true},
+		{"com.apple.application-identifier", "XYZ789.com.example.app", false},
+		{"keychain-access-groups", []any{"ABC123DEF4.com.example.app", "com.apple.token"}, true},
+		{"keychain-access-groups", []any{"ABC123DEF4.shared", "XYZ789.shared"}, false},
+		{"com.apple.security.application-groups", []any{"group.com.example.shared"}, true},
+		{"com.apple.security.application-groups", []any{"group.com.example.other"}, false},
+		{"com.apple.developer.associated-domains", []any{"applinks:example.com"}, true},
+		{"com.apple.developer.networking.wifi-info", true, true},
+		{"com.apple.developer.aps-environment", "development", false},
+		{"com.apple.developer.team-identifier", "ABC123DEF4", true},
+		{"com.apple.developer.icloud-services", []any{"CloudKit"}, false},
+		{"com.apple.security.device.camera", true, true},
+	}
+	for _, tt := range tests {
+		if got := checkProfileEntitlement(profile, tt.key, tt.value); (got == "") != tt.ok {
+			t.Errorf("checkProfileEntitlement(%s, %v) = %q, want ok=%v", tt.key, tt.value, got, tt.ok)
+		}
+	}
+
+	// App groups prefixed with the team ID need no profile entry on macOS.
+	delete(profile.Entitlements, "com.apple.security.application-groups")
+	if got := checkProfileEntitlement(profile, "com.apple.security.application-groups", []any{"ABC123DEF4.shared"}); got != "" {
+		t.Errorf("team-prefixed app group: %q", got)
+	}
+	if got := checkProfileEntitlement(profile, "com.apple.security.application-groups", []any{"group.com.example.shared"}); got == "" {
+		t.Error("unlisted app group allowed")
+	}
+}
@@ -0,0 +1,120 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// resourceFile is a file from Config.Resources and its destination
+// relative to Contents/Resources.
+type resourceFile struct {
+	src, dest string
+}
+
+// resourceFiles lists the files Config.Resources contributes to the
+// bundle, sorted by destination. Each ResourceMap entry maps a file or
+// directory in Resources to a path under Contents/Resources; without a
+// map, the whole file system is copied.
+func (c *Config) resourceFiles() ([]resourceFile, error) {
+	if c.Resources == nil {
+		return nil, nil
+	}
+	mapping := c.ResourceMap
+	if len(mapping) == 0 {
+		mapping = map[string]string{".": "."}
+	}
+
+	var files []resourceFile
+	seen := map[string]string{}
+	for _, src := range slices.Sorted(maps.Keys(mapping)) {
+		dest := mapping[src]
+		if !fs.ValidPath(src) {
+			return nil, fmt.Errorf("resource %q: invalid path", src)
+		}
+		if !fs.ValidPath(dest) {
+			return nil, fmt.Errorf("resource %q: invalid destination %q", src, dest)
+		}
+		err := fs.WalkDir(c.Resources, src, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel := dest
+			switch {
+			case src == ".":
+				rel = path.Join(dest, p)
+			case p != src:
+				rel = path.Join(dest, strings.TrimPrefix(p, src+"/"))
+			}
+			switch rel {
+			case ".", sourceHashFile, devModeTargetFile:
+				return fmt.Errorf("resource %s: destination %q is reserved", p, rel)
+			case c.iconFile():
+				return fmt.Errorf("resource %s: destination %q is reserved for the app icon", p, rel)
+			}
+			if prev, ok := seen[rel]; ok {
+				return fmt.Errorf("resources %s and %s both map to %s", prev, p, rel)
+			}
+			seen[rel] = p
+			files = append(files, resourceFile{src: p, dest: rel})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.SortFunc(files, func(a, b resourceFile) int { return strings.Compare(a.dest, b.dest) })
+	return files, nil
+}
+
+// writeResources copies Config.Resources into Contents/Resources.
+func (b *Bundle) writeResources(contentsDir string) error {
+	files, err := b.Config.resourceFiles()
+	if err != nil {
+		return err
+	}
+	resourcesDir := filepath.Join(contentsDir, "Resources")
+	for _, f := range files {
+		data, err := fs.ReadFile(b.Config.Resources, f.src)
+		if err != nil {
+			return fmt.Errorf("resource %s: %w", f.src, err)
+		}
+		dest := filepath.Join(resourcesDir, filepath.FromSlash(f.dest))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return fmt.Errorf("resource %s: %w", f.src, err)
+		}
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			return fmt.Errorf("resource %s: %w", f.src, err)
+		}
+	}
+	if b.Config.Debug && len(files) > 0 {
+		fmt.Fprintf(os.Stderr, "macgo: copied %d resources to bundle\n", len(files))
+	}
+	return nil
+}
+
+// resourcesHash extends hash with the destination and contents of every
+// resource, so changing, adding or moving one invalidates the bundle.
+func (b *Bundle) resourcesHash(hash string) (string, error) {
+	files, err := b.Config.resourceFiles()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", hash)
+	for _, f := range files {
+		data, err := fs.ReadFile(b.Config.Resources, f.src)
+		if err != nil {
+			return "", fmt.Errorf("resource %s: %w", f.src, err)
+		}
+		fmt.Fprintf(h, "resource %q %x\n", f.dest, sha256.Sum256(data))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,149 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tmc/macgo/internal/codesig"
+	"github.com/tmc/macgo/internal/plist"
+)
+
+func TestCreate_Resources(t *testing.T) {
+	tmpDir := t.TempDir()
+	execPath := filepath.Join(tmpDir, "res-test")
+	if err := os.WriteFile(execPath, []byte("#!/bin/sh\necho res\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"applescripts/open.applescript":  {Data: []byte("tell application \"Finder\" to activate\n")},
+		"applescripts/close.applescript": {Data: []byte("tell application \"Finder\" to quit\n")},
+		"defaults.json":                  {Data: []byte(`{"interval": 5}`)},
+		"en.lproj/Localizable.strings":   {Data: []byte(`"hello" = "Hello";`)},
+	}
+	newBundle := func(mapping map[string]string) *Bundle {
+		t.Helper()
+		b, err := New(execPath, &Config{
+			AppName:     "ResourceApp",
+			BundleID:    "com.example.resources",
+			BundleDir:   tmpDir,
+			Resources:   fsys,
+			ResourceMap: mapping,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Create(); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return b
+	}
+	read := func(b *Bundle, rel string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(b.Path, "Contents", "Resources", filepath.FromSlash(rel)))
+		if err != nil {
+			t.Errorf("resource %s: %v", rel, err)
+		}
+		return string(data)
+	}
+
+	// Without a map, the whole file system is copied.
+	b := newBundle(nil)
+	if got := read(b, "applescripts/open.applescript"); !strings.Contains(got, "activate") {
+		t.Errorf("open.applescript = %q", got)
+	}
+	read(b, "en.lproj/Localizable.strings")
+
+	mapping := map[string]string{
+		"applescripts":  "Scripts",
+		"defaults.json": "config/defaults.json",
+	}
+	b = newBundle(mapping)
+	if b.reused {
+		t.Error("bundle reused after the resource map changed")
+	}
+	read(b, "Scripts/close.applescript")
+	if got := read(b, "config/defaults.json"); got != `{"interval": 5}` {
+		t.Errorf("defaults.json = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(b.Path, "Contents", "Resources", "en.lproj")); !os.IsNotExist(err) {
+		t.Errorf("unmapped resource copied: %v", err)
+	}
+
+	if b = newBundle(mapping); !b.reused {
+		t.Error("bundle with unchanged resources was not reused")
+	}
+	fsys["defaults.json"] = &fstest.MapFile{Data: []byte(`{"interval": 10}`)}
+	if b = newBundle(mapping); b.reused {
+		t.Error("bundle reused after a resource changed")
+	}
+
+	for _, bad := range []map[string]string{
+		{"defaults.json": "../escape.json"},
+		{"defaults.json": sourceHashFile},
+		{"applescripts": ".", "defaults.json": "open.applescript", "en.lproj/Localizable.strings": "close.applescript"},
+		{"missing": "x"},
+	} {
+		b, _ := New(execPath, &Config{AppName: "BadResourceApp", BundleDir: tmpDir, Resources: fsys, ResourceMap: bad})
+		if err := b.Create(); err == nil {
+			t.Errorf("Create with resource map %v succeeded", bad)
+		}
+	}
+
+	// The app icon's name is reserved only in bundles that have one.
+	iconMap := map[string]string{"defaults.json": generatedIconFile}
+	if _, err := (&Config{Resources: fsys, ResourceMap: iconMap}).resourceFiles(); err != nil {
+		t.Errorf("resource named like the icon of a bundle without one: %v", err)
+	}
+	for _, cfg := range []*Config{
+		{Resources: fsys, ResourceMap: iconMap, IconPNG: "icon.png"},
+		{Resources: fsys, ResourceMap: map[string]string{"defaults.json": "app.icns"}, IconPath: "/icons/app.icns"},
+	} {
+		if _, err := cfg.resourceFiles(); err == nil {
+			t.Errorf("resource replacing icon %s was accepted", cfg.iconFile())
+		}
+	}
+}
+
+func TestSign_ResourcesSealed(t *testing.T) {
+	execPath := buildDarwinArm64(t, "sealed-res-test")
+	b, err := New(execPath, &Config{
+		AppName:   "SealedResourceApp",
+		BundleID:  "com.example.sealed",
+		AdHocSign: true,
+		Signer:    SignerBuiltin,
+		Resources: fstest.MapFS{"script.applescript": {Data: []byte("beep\n")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(b.Path, "Contents", filepath.FromSlash(codesig.CodeResourcesPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seal struct {
+		Files2 map[string]any `plist:"files2"`
+	}
+	if err := plist.Unmarshal(data, &seal); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := seal.Files2["Resources/script.applescript"]; !ok {
+		t.Error("resource not sealed in CodeResources")
+	}
+
+	script := filepath.Join(b.Path, "Contents", "Resources", "script.applescript")
+	if err := os.WriteFile(script, []byte("tampered\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := codesig.Verify(b.Path); err != nil || len(ms) != 1 || ms[0].Path != "Resources/script.applescript" {
+		t.Errorf("Verify after modifying a resource = %v, %v", ms, err)
+	}
+}
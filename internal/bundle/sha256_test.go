@@ -3,8 +3,10 @@ package bundle
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/tmc/macgo/internal/plist"
 	"github.com/tmc/macgo/internal/system"
 )
 
@@ -221,3 +223,120 @@ func TestSHA256_Comparison(t *testing.T) {
 		t.Errorf("Different files have identical hashes: %q", hash1)
 	}
 }
+
+func TestBundle_isBundleUpToDate_InfoPlistChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("GOPATH", tmpDir)
+
+	testExecPath := filepath.Join(tmpDir, "info-test")
+	if err := os.WriteFile(testExecPath, []byte("#!/bin/sh\necho info\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test executable: %v", err)
+	}
+
+	config := &Config{
+		AppName:  "InfoTestApp",
+		BundleID: "com.example.infotest",
+		Info:     map[string]interface{}{"LSMinimumSystemVersion": "12.0"},
+	}
+	b, err := New(testExecPath, config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !b.isBundleUpToDate() {
+		t.Fatal("Expected freshly created bundle to be up to date")
+	}
+
+	// Reformatting the Info.plist onto a single line must not matter.
+	plistPath := filepath.Join(b.Path, "Contents", "Info.plist")
+	data, err := os.ReadFile(plistPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := strings.NewReplacer("\n", "", "\t", "").Replace(string(data))
+	if err := os.WriteFile(plistPath, []byte(compact), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !b.isBundleUpToDate() {
+		t.Error("Expected reformatted Info.plist to be considered up to date")
+	}
+
+	config.Info["LSMinimumSystemVersion"] = "13.0"
+	if b.isBundleUpToDate() {
+		t.Error("Expected Info.plist change to invalidate the bundle")
+	}
+
+	config.Info["LSMinimumSystemVersion"] = "12.0"
+	config.UIMode = UIModeRegular
+	if b.isBundleUpToDate() {
+		t.Error("Expected UI mode change to invalidate the bundle")
+	}
+}
+
+func TestBundle_InfoPlistTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("GOPATH", tmpDir)
+
+	testExecPath := filepath.Join(tmpDir, "template-test")
+	if err := os.WriteFile(testExecPath, []byte("#!/bin/sh\necho template\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test executable: %v", err)
+	}
+	templatePath := filepath.Join(tmpDir, "Info.template.plist")
+	template := `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>wrong</string>
+	<key>LSMinimumSystemVersion</key>
+	<string>11.0</string>
+	<key>NSHumanReadableCopyright</key>
+	<string>Copyright Example</string>
+</dict>
+</plist>
+`
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		AppName:           "TemplateApp",
+		BundleID:          "com.example.template",
+		Info:              map[string]interface{}{"LSMinimumSystemVersion": "12.0"},
+		InfoPlistTemplate: templatePath,
+	}
+	b, err := New(testExecPath, config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.Path, "Contents", "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info map[string]any
+	if err := plist.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"CFBundleExecutable":       "TemplateApp",
+		"LSMinimumSystemVersion":   "12.0",
+		"NSHumanReadableCopyright": "Copyright Example",
+	} {
+		if info[key] != want {
+			t.Errorf("%s = %v, want %v", key, info[key], want)
+		}
+	}
+	if !b.isBundleUpToDate() {
+		t.Error("Expected bundle built from template to be up to date")
+	}
+
+	config.InfoPlistTemplateData = []byte("not a plist")
+	if _, err := b.infoPlistConfig(); err == nil {
+		t.Error("Expected invalid template data to be rejected")
+	}
+}
@@ -1,14 +1,20 @@
 package bundle
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/tmc/macgo/codesign"
+	"github.com/tmc/macgo/internal/codesig"
 	"github.com/tmc/macgo/internal/system"
+	"github.com/tmc/macgo/internal/tsp"
 )
 
 // codeSignBundle signs the app bundle with the configured identity and options.
@@ -23,6 +29,14 @@ import (
 // as a standard bundle resource, so it survives signing and enables bundle
 // reuse detection on subsequent launches.
 func codeSignBundle(bundlePath string, cfg *Config) error {
+	return signBundleWithIdentity(bundlePath, nil, cfg)
+}
+
+// signBundleWithIdentity signs the bundle like codeSignBundle, with id in
+// place of cfg.CodeSignIdentity when it is non-nil. Identities carrying a
+// private key are signed by the built-in signer; keychain identities are
+// passed to codesign by SHA-1 fingerprint.
+func signBundleWithIdentity(bundlePath string, id *codesign.Identity, cfg *Config) error {
 	contentsDir := filepath.Join(bundlePath, "Contents")
 
 	// Move entitlements.plist out of Contents/ before signing.
@@ -42,16 +56,6 @@ func codeSignBundle(bundlePath string, cfg *Config) error {
 		}
 	}
 
-	args := []string{
-		"--sign", cfg.CodeSignIdentity,
-		"--force",
-	}
-
-	if cfg.CodeSignIdentity != "-" {
-		args = append(args, "--timestamp")
-		args = append(args, "--options", "runtime")
-	}
-
 	// Always read bundle ID from Info.plist and use it as the identifier
 	bundleID := system.GetBundleID(bundlePath)
 	if bundleID == "" {
@@ -73,15 +77,56 @@ func codeSignBundle(bundlePath string, cfg *Config) error {
 		fmt.Printf("macgo: codesign will use identifier: %q\n", identifier)
 	}
 
+	// Nested code is signed first: the bundle's seal records its CDHashes.
+	if err := signNested(bundlePath, tmpDir, id, cfg); err != nil {
+		return err
+	}
+	return signCode(bundlePath, identifier, entTmp, id, cfg)
+}
+
+// signCode signs the bundle or executable at path with identifier and
+// the entitlements in entitlementsPath, which may not exist, using id in
+// place of cfg.CodeSignIdentity when it is non-nil.
+func signCode(path, identifier, entitlementsPath string, id *codesign.Identity, cfg *Config) error {
+	if id != nil && id.Key != nil {
+		return builtinSign(path, identifier, entitlementsPath, id, cfg)
+	}
+	builtin, err := codesig.UseBuiltin(string(cfg.Signer), path)
+	if errors.Is(err, codesig.ErrNotMachO) && cfg.Signer == SignerAuto {
+		// Without codesign there is nothing that can sign it.
+		fmt.Fprintf(os.Stderr, "macgo: warning: not signing %s: codesign is not installed and the built-in signer signs only Mach-O executables\n", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("built-in signer: %w", err)
+	}
+	if builtin {
+		return builtinSign(path, identifier, entitlementsPath, id, cfg)
+	}
+
+	sign := cfg.CodeSignIdentity
+	if id != nil {
+		sign = id.SHA1()
+	}
+	args := []string{
+		"--sign", sign,
+		"--force",
+	}
+
+	if sign != "-" {
+		args = append(args, timestampFlag(cfg))
+		args = append(args, "--options", "runtime")
+	}
+
 	// Always add the identifier flag
 	args = append(args, "--identifier", identifier)
 
 	// Reference entitlements from temp path (outside the bundle)
-	if _, err := os.Stat(entTmp); err == nil {
-		args = append(args, "--entitlements", entTmp)
+	if _, err := os.Stat(entitlementsPath); err == nil {
+		args = append(args, "--entitlements", entitlementsPath)
 	}
 
-	args = append(args, bundlePath)
+	args = append(args, path)
 
 	cmd := exec.Command("codesign", args...)
 	if cfg.Debug {
@@ -89,6 +134,11 @@ func codeSignBundle(bundlePath string, cfg *Config) error {
 	}
 
 	output, err := cmd.CombinedOutput()
+	if err != nil && cfg.TimestampPolicy == TimestampOptional && sign != "-" && strings.Contains(string(output), "timestamp") {
+		fmt.Fprintf(os.Stderr, "macgo: warning: signing without a secure timestamp: %s", output)
+		args[slices.Index(args, timestampFlag(cfg))] = "--timestamp=none"
+		output, err = exec.Command("codesign", args...).CombinedOutput()
+	}
 	if err != nil {
 		return fmt.Errorf("codesign failed: %w\nOutput: %s", err, string(output))
 	}
@@ -100,6 +150,149 @@ func codeSignBundle(bundlePath string, cfg *Config) error {
 	return nil
 }
 
+// timestampFlag returns the codesign --timestamp option for cfg's
+// timestamp policy and authority.
+func timestampFlag(cfg *Config) string {
+	switch {
+	case cfg.TimestampPolicy == TimestampNone:
+		return "--timestamp=none"
+	case cfg.TimestampURL != "":
+		return "--timestamp=" + cfg.TimestampURL
+	}
+	return "--timestamp"
+}
+
+// timestamper returns the function that time-stamps built-in signatures
+// according to cfg's timestamp policy, or nil when none are wanted.
+// Under TimestampOptional a failure is reported once and later signatures
+// go without a timestamp rather than waiting on the authority again.
+func timestamper(cfg *Config) func([]byte) ([]byte, error) {
+	if cfg.TimestampPolicy == TimestampNone {
+		return nil
+	}
+	client := &tsp.Client{URL: cfg.TimestampURL}
+	var failed bool
+	return func(signature []byte) ([]byte, error) {
+		if failed {
+			return nil, nil
+		}
+		tok, err := client.Timestamp(context.Background(), signature)
+		if err == nil {
+			return tok.Raw, nil
+		}
+		if cfg.TimestampPolicy == TimestampOptional {
+			failed = true
+			fmt.Fprintf(os.Stderr, "macgo: warning: signing without a secure timestamp: %v\n", err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w (set MACGO_TIMESTAMP_POLICY=optional to sign without one)", err)
+	}
+}
+
+// builtinSign signs the bundle or executable at path with the pure-Go
+// signer, using id's private key or, when id is nil, an ad-hoc signature.
+// Like codesign, it enables the hardened runtime for certificate
+// signatures. entitlementsPath may name a file that does not exist.
+func builtinSign(path, identifier, entitlementsPath string, id *codesign.Identity, cfg *Config) error {
+	opts := codesig.SignOptions{Identifier: identifier}
+	switch {
+	case id != nil && id.Key != nil:
+		opts.Key, opts.Certificate, opts.Chain = id.Key, id.Certificate, id.Chain
+		opts.TeamID = id.TeamID()
+		opts.Flags = codesig.FlagRuntime
+		opts.Timestamp = timestamper(cfg)
+	case id != nil:
+		return fmt.Errorf("built-in signer supports only ad-hoc signing and identities with a private key, not keychain identity %q", id.Name)
+	case cfg.CodeSignIdentity != "-":
+		return fmt.Errorf("built-in signer supports only ad-hoc signing and identities with a private key, not identity %q", cfg.CodeSignIdentity)
+	}
+	ents, err := os.ReadFile(entitlementsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read entitlements: %w", err)
+	}
+	opts.Entitlements = ents
+
+	if cfg.Debug {
+		if opts.Key != nil {
+			fmt.Fprintf(os.Stderr, "macgo: signing %s as %q with built-in signer\n", path, id.Name)
+		} else {
+			fmt.Fprintf(os.Stderr, "macgo: ad-hoc signing %s with built-in signer\n", path)
+		}
+	}
+	sign := codesig.SignFile
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		sign = codesig.SignBundle
+	}
+	if err := sign(path, opts); err != nil {
+		return fmt.Errorf("built-in signer: %w", err)
+	}
+	return nil
+}
+
+// recordRequirement remembers the designated requirement of the signed
+// bundle at path before Create replaces it. Unsigned or missing bundles
+// are ignored.
+func (b *Bundle) recordRequirement(path string) {
+	if dr, err := codesign.DesignatedRequirement(path); err == nil {
+		b.previousRequirement = dr
+	}
+}
+
+// checkRequirement warns when the new signature's designated requirement
+// differs from the one recorded for the replaced bundle. TCC ties
+// permission grants to the designated requirement, so a change makes
+// macOS treat the rebuilt app as a different app.
+func (b *Bundle) checkRequirement() {
+	b.requirementChange = nil
+	if b.previousRequirement == "" {
+		return
+	}
+	dr, err := codesign.DesignatedRequirement(b.Path)
+	if err != nil {
+		if b.Config.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: cannot read designated requirement: %v\n", err)
+		}
+		return
+	}
+	change, err := codesign.CompareRequirements(b.previousRequirement, dr)
+	if err != nil || change == nil {
+		return
+	}
+	b.requirementChange = change
+	fmt.Fprintf(os.Stderr, "macgo: warning: the designated requirement of %s changed; "+
+		"TCC permissions granted to the previous build no longer apply\n", filepath.Base(b.Path))
+	for _, r := range change.Removed {
+		fmt.Fprintf(os.Stderr, "macgo:   - %s\n", r)
+	}
+	for _, a := range change.Added {
+		fmt.Fprintf(os.Stderr, "macgo:   + %s\n", a)
+	}
+	if change.PinsCDHash {
+		fmt.Fprintf(os.Stderr, "macgo: ad-hoc signatures change with every build; "+
+			"sign with a certificate or use dev mode (MACGO_DEV_MODE=1) to keep permissions\n")
+	}
+}
+
+// RequirementChange reports how the last Sign changed the designated
+// requirement from that of the bundle Create replaced, or nil if it is
+// unchanged or there was no previous signed bundle.
+func (b *Bundle) RequirementChange() *codesign.RequirementChange {
+	return b.requirementChange
+}
+
+// keychainCertificate returns the certificate of the named keychain
+// identity, or nil for ad-hoc signing or if it cannot be found or exported.
+func keychainCertificate(name string) *x509.Certificate {
+	if name == "-" {
+		return nil
+	}
+	id, err := codesign.FindIdentity(codesign.KeychainProvider{}, name)
+	if err != nil {
+		return nil
+	}
+	return id.Certificate
+}
+
 // findDeveloperID attempts to find a Developer ID Application certificate
 // by querying the system keychain for available code signing identities.
 func findDeveloperID(debug bool) string {
@@ -1,12 +1,25 @@
 package bundle
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/tmc/macgo/codesign"
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/codesig"
+	"github.com/tmc/macgo/internal/plist"
 	"github.com/tmc/macgo/internal/system"
+	"github.com/tmc/macgo/internal/testbuild"
+	"github.com/tmc/macgo/internal/testcert"
+	"github.com/tmc/macgo/internal/tsp"
 )
 
 func TestValidateCodeSignIdentity(t *testing.T) {
@@ -339,3 +352,529 @@ func TestCodeSignBundle_Config(t *testing.T) {
 		})
 	}
 }
+
+// buildDarwinArm64 cross-compiles an empty program for darwin/arm64 into
+// dir, with GOPATH pointed at dir so bundles are created there too.
+func buildDarwinArm64(t *testing.T, name string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GOPATH", dir)
+	return testbuild.Darwin(t, "arm64", filepath.Join(dir, name))
+}
+
+func TestCodeSignBundle_Builtin(t *testing.T) {
+	execPath := buildDarwinArm64(t, "builtin-test")
+
+	config := &Config{
+		AppName:     "BuiltinApp",
+		BundleID:    "com.example.builtin",
+		Permissions: []string{"camera"},
+		AdHocSign:   true,
+		Signer:      SignerBuiltin,
+	}
+	b, err := New(execPath, config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := b.Sign(); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	info, err := GetSignatureInfo(b.Path)
+	if err != nil {
+		t.Fatalf("GetSignatureInfo failed: %v", err)
+	}
+	if info["Identifier"] != "com.example.builtin" {
+		t.Errorf("Identifier = %q, want com.example.builtin", info["Identifier"])
+	}
+	if info["Signature"] != "adhoc" {
+		t.Errorf("Signature = %q, want adhoc", info["Signature"])
+	}
+	if !strings.HasPrefix(info["Sealed Resources version"], "2") {
+		t.Errorf("Sealed Resources = %q, want version 2 seal", info["Sealed Resources version"])
+	}
+
+	// The entitlements are embedded in the main executable's signature.
+	exe := filepath.Join(b.Path, "Contents", "MacOS", "BuiltinApp")
+	f, err := codesig.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(f.Slices[0].Signature.Entitlements), "com.apple.security.device.camera") {
+		t.Errorf("entitlements = %s", f.Slices[0].Signature.Entitlements)
+	}
+
+	// The built-in signer cannot use certificate identities.
+	config.CodeSignIdentity = "Developer ID Application: Example"
+	if err := codeSignBundle(b.Path, config); err == nil || !strings.Contains(err.Error(), "ad-hoc") {
+		t.Errorf("codeSignBundle with identity = %v, want ad-hoc only error", err)
+	}
+}
+
+func TestSign_RequirementChange(t *testing.T) {
+	execPath := buildDarwinArm64(t, "requirement-test")
+
+	sign := func() *Bundle {
+		t.Helper()
+		b, err := New(execPath, &Config{
+			AppName:   "RequirementApp",
+			BundleID:  "com.example.requirement",
+			AdHocSign: true,
+			Signer:    SignerBuiltin,
+		})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if err := b.Create(); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := b.Sign(); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		return b
+	}
+
+	first := sign()
+	if c := first.RequirementChange(); c != nil {
+		t.Errorf("first build: RequirementChange() = %v, want nil", c)
+	}
+	before, err := codesign.DesignatedRequirement(first.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rebuilding with a different binary changes the ad-hoc CDHash.
+	data, err := os.ReadFile(execPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(execPath, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	second := sign()
+	c := second.RequirementChange()
+	if c == nil {
+		t.Fatal("rebuild: RequirementChange() = nil, want a change")
+	}
+	if c.Old != before || !c.PinsCDHash || !strings.HasPrefix(c.New, "cdhash ") {
+		t.Errorf("rebuild: RequirementChange() = %+v", c)
+	}
+}
+
+// testIdentityFile writes a self-signed Developer ID identity to a PEM
+// file and returns its path and certificate.
+func testIdentityFile(t *testing.T) (string, *x509.Certificate) {
+	t.Helper()
+	cert, key := testcert.CodeSigning(t, "Developer ID Application: Example Corp (ABCDE12345)", "ABCDE12345")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemPath := filepath.Join(t.TempDir(), "identity.pem")
+	pemData := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	if err := os.WriteFile(pemPath, pemData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pemPath, cert
+}
+
+// testTSA starts a local time-stamping authority.
+func testTSA(t *testing.T) *httptest.Server {
+	t.Helper()
+	r, err := tsp.NewResponder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// signerTimestamp returns the time-stamp token of the first signer of
+// the executable's signature, or nil.
+func signerTimestamp(t *testing.T, execPath string) []byte {
+	t.Helper()
+	f, err := codesig.Open(execPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := cms.Parse(f.Slices[0].Signature.CMS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := sd.Signers[0].Attribute(cms.OIDTimeStampToken)
+	if !ok {
+		return nil
+	}
+	if _, err := tsp.Verify(v.FullBytes, sd.Signers[0].Signature); err != nil {
+		t.Errorf("timestamp: %v", err)
+	}
+	return v.FullBytes
+}
+
+func TestSign_FileIdentity(t *testing.T) {
+	execPath := buildDarwinArm64(t, "identity-test")
+	pemPath, cert := testIdentityFile(t)
+
+	config := &Config{
+		AppName:          "IdentityApp",
+		BundleID:         "com.example.identity",
+		IdentityProvider: codesign.FileProvider{Path: pemPath},
+		TimestampURL:     testTSA(t).URL,
+	}
+	b, err := New(execPath, config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := b.Sign(); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if config.ResolvedSigningIdentity != cert.Subject.CommonName {
+		t.Errorf("ResolvedSigningIdentity = %q", config.ResolvedSigningIdentity)
+	}
+
+	f, err := codesig.Open(filepath.Join(b.Path, "Contents", "MacOS", "IdentityApp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := f.Slices[0].Signature
+	cd := sig.CodeDirectory()
+	if cd.Flags&codesig.FlagAdhoc != 0 || cd.Flags&codesig.FlagRuntime == 0 {
+		t.Errorf("flags = %v, want hardened runtime without adhoc", cd.Flags)
+	}
+	if cd.TeamID != "ABCDE12345" {
+		t.Errorf("team ID = %q, want ABCDE12345", cd.TeamID)
+	}
+	if len(sig.CMS) == 0 {
+		t.Error("signature has no CMS blob")
+	}
+	if signerTimestamp(t, b.ExecutablePath()) == nil {
+		t.Error("signature has no timestamp")
+	}
+	if ms, err := codesig.Verify(b.Path); err != nil || len(ms) != 0 {
+		t.Errorf("Verify = %v, %v", ms, err)
+	}
+}
+
+func TestSign_TimestampPolicy(t *testing.T) {
+	execPath := buildDarwinArm64(t, "timestamp-test")
+	pemPath, _ := testIdentityFile(t)
+
+	// A closed server refuses connections.
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	tests := []struct {
+		name    string
+		policy  TimestampPolicy
+		url     string
+		wantErr bool
+		wantTok bool
+	}{
+		{"default unreachable", "", down.URL, true, false},
+		{"optional unreachable", TimestampOptional, down.URL, false, false},
+		{"optional", TimestampOptional, testTSA(t).URL, false, true},
+		{"none", TimestampNone, testTSA(t).URL, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				AppName:          "TimestampApp",
+				BundleID:         "com.example.timestamp",
+				IdentityProvider: codesign.FileProvider{Path: pemPath},
+				TimestampPolicy:  tt.policy,
+				TimestampURL:     tt.url,
+				BundleDir:        t.TempDir(),
+			}
+			b, err := New(execPath, config)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			if err := b.Create(); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			err = b.Sign()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "MACGO_TIMESTAMP_POLICY") {
+					t.Errorf("Sign = %v, want timestamp error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+			if tok := signerTimestamp(t, b.ExecutablePath()); (tok != nil) != tt.wantTok {
+				t.Errorf("has timestamp = %v, want %v", tok != nil, tt.wantTok)
+			}
+		})
+	}
+}
+
+// writeTestProfile writes a provisioning profile for team ABCDE12345 that
+// allows ents and the given developer certificates.
+func writeTestProfile(t *testing.T, ents map[string]any, certs ...*x509.Certificate) string {
+	t.Helper()
+	var ders []any
+	for _, c := range certs {
+		ders = append(ders, c.Raw)
+	}
+	content, err := plist.Marshal(map[string]any{
+		"Name":                  "Test Profile",
+		"TeamIdentifier":        []any{"ABCDE12345"},
+		"ExpirationDate":        time.Now().Add(24 * time.Hour),
+		"Entitlements":          ents,
+		"DeveloperCertificates": ders,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, key := testcert.New(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Profile Signing"}}, nil, nil)
+	data, err := cms.Sign(content, signer, key, cms.SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.provisionprofile")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSign_ProfileMismatch(t *testing.T) {
+	execPath := buildDarwinArm64(t, "profile-test")
+	pemPath, cert := testIdentityFile(t)
+	_, other := testIdentityFile(t)
+	ents := map[string]any{
+		"com.apple.application-identifier":    "ABCDE12345.com.example.profile",
+		"com.apple.developer.team-identifier": "ABCDE12345",
+		"keychain-access-groups":              []any{"ABCDE12345.*"},
+	}
+
+	sign := func(name, profile string, config *Config) error {
+		t.Helper()
+		config.AppName = name
+		config.BundleID = "com.example.profile"
+		config.ProvisioningProfile = profile
+		config.TimestampPolicy = TimestampNone
+		b, err := New(execPath, config)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if err := b.Create(); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return b.Sign()
+	}
+
+	allowed := writeTestProfile(t, ents, cert)
+	err := sign("ProfileApp", allowed, &Config{
+		IdentityProvider: codesign.FileProvider{Path: pemPath},
+		Permissions:      []string{"camera"},
+		CustomArrays:     map[string][]string{"keychain-access-groups": {"ABCDE12345.com.example.profile"}},
+	})
+	if err != nil {
+		t.Fatalf("Sign with allowed entitlements: %v", err)
+	}
+
+	// Every violation is reported, not just the first.
+	otherCertProfile := writeTestProfile(t, ents, other)
+	err = sign("MismatchApp", otherCertProfile, &Config{
+		IdentityProvider: codesign.FileProvider{Path: pemPath},
+		Custom:           []string{"com.apple.developer.icloud-services"},
+		CustomArrays:     map[string][]string{"keychain-access-groups": {"XYZ789.shared"}},
+	})
+	var pe *ProfileMismatchError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Sign = %v, want *ProfileMismatchError", err)
+	}
+	want := []string{"com.apple.developer.icloud-services", "keychain-access-groups", "certificate"}
+	if len(pe.Violations) != len(want) {
+		t.Fatalf("violations = %q, want %d", pe.Violations, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(pe.Violations[i], w) {
+			t.Errorf("violation %d = %q, want mention of %s", i, pe.Violations[i], w)
+		}
+	}
+}
+
+func TestCreate_AutoProvisioningProfile(t *testing.T) {
+	execPath := buildDarwinArm64(t, "autoprofile-test")
+	pemPath, cert := testIdentityFile(t)
+	profile := writeTestProfile(t, map[string]any{
+		"com.apple.application-identifier":    "ABCDE12345.com.example.*",
+		"com.apple.developer.team-identifier": "ABCDE12345",
+	}, cert)
+
+	config := &Config{
+		AppName:                 "AutoProfileApp",
+		BundleID:                "com.example.autoprofile",
+		IdentityProvider:        codesign.FileProvider{Path: pemPath},
+		TimestampPolicy:         TimestampNone,
+		AutoProvisioningProfile: true,
+		ProfileDirs:             []string{filepath.Dir(profile)},
+	}
+	b, err := New(execPath, config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if config.ProvisioningProfile != profile {
+		t.Errorf("ProvisioningProfile = %q, want %q", config.ProvisioningProfile, profile)
+	}
+	if _, err := os.Stat(filepath.Join(b.Path, "Contents", "embedded.provisionprofile")); err != nil {
+		t.Errorf("profile not embedded: %v", err)
+	}
+	if got := config.CustomStrings["com.apple.application-identifier"]; got != "ABCDE12345.com.example.autoprofile" {
+		t.Errorf("derived application-identifier = %q", got)
+	}
+	if err := b.Sign(); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+}
+
+func TestSign_NestedCode(t *testing.T) {
+	execPath := buildDarwinArm64(t, "nested-test")
+	newConfig := func() *Config {
+		return &Config{
+			AppName:     "NestedApp",
+			BundleID:    "com.example.nested",
+			Permissions: []string{"sandbox"},
+			AdHocSign:   true,
+			Signer:      SignerBuiltin,
+			Helpers: []Helper{
+				{Path: execPath, Name: "agent"},
+				{Path: execPath, Name: "tool", Dir: "Helpers", Identifier: "com.example.tool"},
+			},
+			XPCServices: []XPCService{{Path: execPath, Name: "Worker",
+				Entitlements: map[string]any{"com.apple.security.network.client": true}}},
+			LaunchAgents: []LaunchAgent{{
+				Label:        "com.example.nested.agent",
+				Program:      "agent",
+				Arguments:    []string{"-serve"},
+				MachServices: []string{"com.example.nested.agent"},
+			}},
+		}
+	}
+	b, err := New(execPath, newConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := b.Sign(); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	contents := filepath.Join(b.Path, "Contents")
+
+	signature := func(rel string) (string, map[string]any) {
+		t.Helper()
+		f, err := codesig.Open(filepath.Join(contents, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := f.Slices[0].Signature
+		var ents map[string]any
+		if err := plist.Unmarshal(sig.Entitlements, &ents); err != nil {
+			t.Fatalf("%s entitlements: %v", rel, err)
+		}
+		return sig.CodeDirectory().Identifier, ents
+	}
+	tests := []struct {
+		rel, identifier string
+		inherit         bool
+		extra           string
+	}{
+		{"MacOS/agent", "com.example.nested.agent", true, ""},
+		{"Helpers/tool", "com.example.tool", true, ""},
+		{"XPCServices/Worker.xpc/Contents/MacOS/Worker", "com.example.nested.Worker", false, "com.apple.security.network.client"},
+	}
+	for _, tt := range tests {
+		id, ents := signature(tt.rel)
+		if id != tt.identifier {
+			t.Errorf("%s: identifier = %q, want %q", tt.rel, id, tt.identifier)
+		}
+		if ents["com.apple.security.app-sandbox"] != true || (ents["com.apple.security.inherit"] == true) != tt.inherit {
+			t.Errorf("%s: entitlements = %v, want sandbox with inherit=%v", tt.rel, ents, tt.inherit)
+		}
+		if tt.extra != "" && ents[tt.extra] != true {
+			t.Errorf("%s: entitlements = %v, want %s", tt.rel, ents, tt.extra)
+		}
+	}
+
+	var xpcInfo map[string]any
+	data, _ := os.ReadFile(filepath.Join(contents, "XPCServices", "Worker.xpc", "Contents", "Info.plist"))
+	if err := plist.Unmarshal(data, &xpcInfo); err != nil {
+		t.Fatal(err)
+	}
+	if xpcInfo["CFBundlePackageType"] != "XPC!" || xpcInfo["CFBundleIdentifier"] != "com.example.nested.Worker" {
+		t.Errorf("XPC Info.plist = %v", xpcInfo)
+	}
+
+	var job map[string]any
+	data, _ = os.ReadFile(filepath.Join(contents, "Library", "LaunchAgents", "com.example.nested.agent.plist"))
+	if err := plist.Unmarshal(data, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job["BundleProgram"] != "Contents/MacOS/agent" || len(job["ProgramArguments"].([]any)) != 2 {
+		t.Errorf("LaunchAgent plist = %v", job)
+	}
+
+	if ms, err := codesig.Verify(b.Path); err != nil || len(ms) != 0 {
+		t.Errorf("Verify = %v, %v; want no mismatches", ms, err)
+	}
+
+	// Changing a LaunchAgent invalidates the bundle.
+	cfg := newConfig()
+	cfg.LaunchAgents[0].RunAtLoad = true
+	b2, _ := New(execPath, cfg)
+	if err := b2.Create(); err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Discard()
+	if b2.reused {
+		t.Error("bundle reused after its LaunchAgent changed")
+	}
+
+	// A LaunchAgent must name a helper or a bundle path.
+	cfg = newConfig()
+	cfg.AppName = "BadAgentApp"
+	cfg.LaunchAgents[0].Program = "missing"
+	b3, _ := New(execPath, cfg)
+	if err := b3.Create(); err == nil || !strings.Contains(err.Error(), `no helper named "missing"`) {
+		t.Errorf("Create with unknown LaunchAgent program = %v", err)
+	}
+
+	// Nested names must stay inside the bundle, helpers must differ, and
+	// helpers inheriting the sandbox take no entitlements of their own.
+	for name, edit := range map[string]func(*Config){
+		"helper path":         func(c *Config) { c.Helpers[0].Name = "../../escape" },
+		"XPC service path":    func(c *Config) { c.XPCServices[0].Name = "../Worker" },
+		"LaunchAgent path":    func(c *Config) { c.LaunchAgents[0].Label = "../../../agent" },
+		"duplicate helper":    func(c *Config) { c.Helpers[1].Name = "agent" },
+		"dot-dot helper name": func(c *Config) { c.Helpers[0].Name = ".." },
+		"inheriting helper entitlement": func(c *Config) {
+			c.Helpers[0].Entitlements = map[string]any{"com.apple.security.network.client": true}
+		},
+	} {
+		cfg := newConfig()
+		cfg.AppName = "BadNameApp"
+		edit(cfg)
+		b, _ := New(execPath, cfg)
+		if err := b.Create(); err == nil {
+			b.Discard()
+			t.Errorf("Create with a bad %s succeeded", name)
+		}
+	}
+}
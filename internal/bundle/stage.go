@@ -0,0 +1,167 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// lockBundle takes the creation lock for the bundle at path, waiting for
+// any other process holding it. Closing the returned file releases it.
+func (b *Bundle) lockBundle(path string) (*os.File, error) {
+	f, err := openBundleLock(path)
+	if err != nil {
+		return nil, err
+	}
+	err = flock(f, false)
+	if errors.Is(err, errLocked) {
+		if b.Config.Debug {
+			fmt.Fprintf(os.Stderr, "macgo: waiting for another process creating %s\n", path)
+		}
+		err = flock(f, true)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("bundle lock: %w", err)
+	}
+	return f, nil
+}
+
+// tryLockBundle takes the creation lock for the bundle at path if no other
+// process holds it, and returns errLocked otherwise.
+func tryLockBundle(path string) (*os.File, error) {
+	f, err := openBundleLock(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(f, false); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// openBundleLock opens the lock file of the bundle at path.
+func openBundleLock(path string) (*os.File, error) {
+	lockPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+	// Read-only, so that a lock file created under sudo stays usable.
+	f, err := os.OpenFile(lockPath, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("bundle lock: %w", err)
+	}
+	return f, nil
+}
+
+// unlock releases the creation lock, if held.
+func (b *Bundle) unlock() {
+	if b.lock != nil {
+		b.lock.Close()
+		b.lock = nil
+	}
+}
+
+// stage points b.Path at a fresh staging directory for the bundle at
+// path. The caller must hold the bundle lock.
+func (b *Bundle) stage(path string) error {
+	root, name := filepath.Dir(path), filepath.Base(path)
+	// Staging directories left by crashed creators are safe to remove:
+	// a live creator would still hold the lock.
+	stale, _ := filepath.Glob(filepath.Join(root, "."+name+".staging-*"))
+	for _, dir := range stale {
+		os.RemoveAll(dir)
+	}
+	dir, err := os.MkdirTemp(root, "."+name+".staging-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	b.staging = dir
+	b.target = path
+	b.Path = filepath.Join(dir, name)
+	b.cleanup = runtime.AddCleanup(b, discardStaging, staged{dir, b.lock})
+	return nil
+}
+
+// staged is a staging directory and the bundle lock held for it.
+type staged struct {
+	dir  string
+	lock *os.File
+}
+
+// discardStaging removes a staging directory abandoned by a Bundle that
+// was never committed or discarded and releases its lock, so that other
+// creators do not wait forever.
+func discardStaging(s staged) {
+	os.RemoveAll(s.dir)
+	s.lock.Close()
+}
+
+// commit moves the staged bundle to its final path, replacing any
+// previous bundle there, and releases the bundle lock. The bundle is
+// renamed into place only once complete and signed, so launchers never
+// see a partial one. commit first gives the files stable modes and times
+// and then records them in the bundle's manifest.
+func (b *Bundle) commit() error {
+	if b.staging == "" {
+		return nil
+	}
+	b.cleanup.Stop()
+	defer b.unlock()
+	defer os.RemoveAll(b.staging)
+
+	staged := b.Path
+	if err := normalizeFiles(staged, b.modTime); err != nil {
+		return fmt.Errorf("failed to normalize bundle files: %w", err)
+	}
+	manifest, err := BuildManifest(staged)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(b.target); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(staged, b.target); err != nil {
+			return fmt.Errorf("failed to move bundle into place: %w", err)
+		}
+	} else if err := exchangeDirs(staged, b.target); err != nil {
+		// Without an atomic exchange, move the old bundle aside first.
+		// Launchers may briefly find no bundle, but never a partial one.
+		old := filepath.Join(b.staging, "previous.app")
+		if err := os.Rename(b.target, old); err != nil {
+			return fmt.Errorf("failed to replace bundle at %s: %w", b.target, err)
+		}
+		if err := os.Rename(staged, b.target); err != nil {
+			os.Rename(old, b.target)
+			return fmt.Errorf("failed to move bundle into place: %w", err)
+		}
+	}
+	b.Path = b.target
+	b.staging = ""
+	b.saveManifest(manifest)
+	return nil
+}
+
+// saveManifest writes manifest next to the bundle at b.Path.
+func (b *Bundle) saveManifest(manifest Manifest) {
+	// Temporary bundles are not kept, so neither are their manifests.
+	if b.Config.shouldCleanupBundle() {
+		return
+	}
+	if err := writeManifest(ManifestPath(b.Path), manifest); err != nil && b.Config.Debug {
+		fmt.Fprintf(os.Stderr, "macgo: warning: failed to write bundle manifest: %v\n", err)
+	}
+}
+
+// Discard removes a bundle staged by Create that will not be signed and
+// releases its lock. Sign calls it when signing fails. Discard does
+// nothing if no bundle is staged, so callers that may return between
+// Create and Sign can defer it right after Create.
+func (b *Bundle) Discard() {
+	if b.staging == "" {
+		return
+	}
+	b.cleanup.Stop()
+	os.RemoveAll(b.staging)
+	b.Path = b.target
+	b.staging = ""
+	b.unlock()
+}
@@ -0,0 +1,246 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmc/macgo/internal/plist"
+)
+
+func TestCreate_Concurrent(t *testing.T) {
+	execPath := buildDarwinArm64(t, "concurrent-test")
+	bundleDir := t.TempDir()
+
+	// Each creator opens the lock file itself, so goroutines contend for
+	// the lock just as separate processes do.
+	create := func(version string) (fresh int) {
+		t.Helper()
+		const creators = 16
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			paths = map[string]bool{}
+		)
+		for range creators {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b, err := New(execPath, &Config{
+					AppName:   "ConcurrentApp",
+					BundleID:  "com.example.concurrent",
+					Version:   version,
+					AdHocSign: true,
+					Signer:    SignerBuiltin,
+					BundleDir: bundleDir,
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if err := b.Create(); err != nil {
+					t.Errorf("Create: %v", err)
+					return
+				}
+				reused := b.reused
+				if err := b.Sign(); err != nil {
+					t.Errorf("Sign: %v", err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				paths[b.Path] = true
+				if !reused {
+					fresh++
+				}
+			}()
+		}
+		wg.Wait()
+		if want := filepath.Join(bundleDir, "ConcurrentApp.app"); len(paths) != 1 || !paths[want] {
+			t.Errorf("bundle paths = %v, want only %s", paths, want)
+		}
+		return fresh
+	}
+
+	check := func(version string) {
+		t.Helper()
+		path := filepath.Join(bundleDir, "ConcurrentApp.app")
+		data, err := os.ReadFile(filepath.Join(path, "Contents", "Info.plist"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var info map[string]any
+		if err := plist.Unmarshal(data, &info); err != nil || info["CFBundleShortVersionString"] != version {
+			t.Errorf("bundle version = %v, want %q (%v)", info["CFBundleShortVersionString"], version, err)
+		}
+		sig, err := GetSignatureInfo(path)
+		if err != nil || sig["Identifier"] != "com.example.concurrent" {
+			t.Errorf("signature = %v, %v", sig, err)
+		}
+		entries, err := os.ReadDir(bundleDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if strings.Contains(e.Name(), ".staging-") {
+				t.Errorf("staging directory %s left behind", e.Name())
+			}
+		}
+	}
+
+	if fresh := create("1.0"); fresh != 1 {
+		t.Errorf("%d creators built the bundle, want 1", fresh)
+	}
+	check("1.0")
+
+	// A configuration change replaces the bundle exactly once.
+	if fresh := create("2.0"); fresh != 1 {
+		t.Errorf("%d creators rebuilt the bundle, want 1", fresh)
+	}
+	check("2.0")
+}
+
+func TestSign_FailureDiscardsStagedBundle(t *testing.T) {
+	execPath := buildDarwinArm64(t, "discard-test")
+	bundleDir := t.TempDir()
+	config := func() *Config {
+		return &Config{
+			AppName:          "DiscardApp",
+			BundleID:         "com.example.discard",
+			CodeSignIdentity: "no such identity",
+			Signer:           SignerBuiltin,
+			BundleDir:        bundleDir,
+		}
+	}
+
+	b, _ := New(execPath, config())
+	if err := b.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.Path, ".staging-") {
+		t.Errorf("signed bundle created at %s, want a staging directory", b.Path)
+	}
+	if err := b.Sign(); err == nil {
+		t.Fatal("Sign with a missing identity succeeded")
+	}
+	if entries, _ := os.ReadDir(bundleDir); len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".lock") {
+		t.Errorf("bundle directory after failed Sign = %v, want only the lock file", entries)
+	}
+
+	// The lock was released, so a second creator does not block.
+	b2, _ := New(execPath, config())
+	if err := b2.Create(); err != nil {
+		t.Fatal(err)
+	}
+	b2.Discard()
+}
+
+func TestCreate_PostCreateHookStaged(t *testing.T) {
+	execPath := buildDarwinArm64(t, "hook-test")
+	for _, sign := range []bool{false, true} {
+		bundleDir := t.TempDir()
+		final := filepath.Join(bundleDir, "HookApp.app")
+		config := func(hook func(string) error) *Config {
+			return &Config{
+				AppName:        "HookApp",
+				BundleID:       "com.example.hook",
+				AdHocSign:      sign,
+				Signer:         SignerBuiltin,
+				BundleDir:      bundleDir,
+				PostCreateHook: hook,
+			}
+		}
+		create := func(cfg *Config) *Bundle {
+			t.Helper()
+			b, err := New(execPath, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Create(); err != nil {
+				t.Fatalf("Create (signed %v): %v", sign, err)
+			}
+			if err := b.Sign(); err != nil {
+				t.Fatalf("Sign (signed %v): %v", sign, err)
+			}
+			return b
+		}
+
+		// An up-to-date bundle is in place, so without the hook Create
+		// would reuse it.
+		create(config(nil))
+		hooked := 0
+		b := create(config(func(path string) error {
+			hooked++
+			if path == final || !strings.Contains(path, ".staging-") {
+				t.Errorf("hook ran on %s, want a staging directory", path)
+			}
+			if _, err := os.Stat(filepath.Join(final, "Contents", "Resources", "hook.txt")); err == nil {
+				t.Error("final bundle changed before the hook returned")
+			}
+			return os.WriteFile(filepath.Join(path, "Contents", "Resources", "hook.txt"), []byte("hook\n"), 0644)
+		}))
+		if hooked != 1 || b.reused || b.Path != final {
+			t.Errorf("signed %v: hook ran %d times, reused = %v, Path = %s", sign, hooked, b.reused, b.Path)
+		}
+		if _, err := os.Stat(filepath.Join(final, "Contents", "Resources", "hook.txt")); err != nil {
+			t.Errorf("signed %v: hook output missing from the final bundle: %v", sign, err)
+		}
+	}
+}
+
+func TestCreate_AbandonedStagingReleasesLock(t *testing.T) {
+	execPath := buildDarwinArm64(t, "abandon-test")
+	bundleDir := t.TempDir()
+	config := func() *Config {
+		return &Config{
+			AppName:   "AbandonApp",
+			BundleID:  "com.example.abandon",
+			AdHocSign: true,
+			Signer:    SignerBuiltin,
+			BundleDir: bundleDir,
+		}
+	}
+
+	// Create stages the bundle and holds its lock, and the caller drops
+	// it without calling Sign or Discard.
+	func() {
+		b, _ := New(execPath, config())
+		if err := b.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		runtime.GC()
+		staging, _ := filepath.Glob(filepath.Join(bundleDir, ".AbandonApp.app.staging-*"))
+		if len(staging) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("abandoned staging directory was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		b, _ := New(execPath, config())
+		err := b.Create()
+		if err == nil {
+			err = b.Sign()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("second creator still waiting for an abandoned bundle's lock")
+	}
+}
@@ -0,0 +1,146 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/tmc/macgo/internal/codesig"
+	"github.com/tmc/macgo/internal/system"
+)
+
+// normalizeArch maps Go architecture names to their Mach-O equivalents,
+// so "amd64" and "x86_64" select the same slice.
+func normalizeArch(arch string) string {
+	switch arch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i386"
+	}
+	return arch
+}
+
+// isUniversal reports whether the bundle executable is assembled from
+// several per-architecture binaries rather than copied.
+func (c *Config) isUniversal() bool {
+	return len(c.ExtraExecutables) > 0 || len(c.Architectures) > 0
+}
+
+// universalSlices collects the slices of the running executable and
+// Config.ExtraExecutables. Each architecture may be supplied only once.
+// When Config.Architectures is set, exactly those architectures are
+// returned, in that order.
+func (b *Bundle) universalSlices() ([]codesig.FatArch, error) {
+	var (
+		slices []codesig.FatArch
+		source = map[string]string{} // arch -> providing file
+	)
+	for _, path := range append([]string{b.execPath}, b.Config.ExtraExecutables...) {
+		f, err := codesig.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("read executable %s: %w", path, err)
+		}
+		for _, s := range f.Slices {
+			arch := s.Arch()
+			if prev, ok := source[arch]; ok {
+				return nil, fmt.Errorf("architecture %s provided by both %s and %s", arch, prev, path)
+			}
+			source[arch] = path
+			slices = append(slices, codesig.FatArch{Cpu: s.Cpu, SubCpu: s.SubCpu, Data: s.Data})
+		}
+	}
+	if len(b.Config.Architectures) == 0 {
+		return slices, nil
+	}
+
+	byArch := make(map[string]codesig.FatArch, len(slices))
+	for _, s := range slices {
+		byArch[codesig.ArchName(s.Cpu, s.SubCpu)] = s
+	}
+	selected := make([]codesig.FatArch, 0, len(b.Config.Architectures))
+	for _, arch := range b.Config.Architectures {
+		s, ok := byArch[normalizeArch(arch)]
+		if !ok {
+			return nil, fmt.Errorf("no executable provided for architecture %s", arch)
+		}
+		delete(byArch, normalizeArch(arch))
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+// writeExecutable writes the bundle executable to dest: a copy of the
+// running executable, or a universal binary when extra architectures
+// are configured.
+func (b *Bundle) writeExecutable(dest string) error {
+	if !b.Config.isUniversal() {
+		if err := system.CopyFile(b.execPath, dest); err != nil {
+			return fmt.Errorf("failed to copy executable: %w", err)
+		}
+		return nil
+	}
+	slices, err := b.universalSlices()
+	if err != nil {
+		return fmt.Errorf("failed to assemble universal executable: %w", err)
+	}
+	fat, err := codesig.BuildFat(slices)
+	if err != nil {
+		return fmt.Errorf("failed to assemble universal executable: %w", err)
+	}
+	if err := os.WriteFile(dest, fat, 0755); err != nil {
+		return fmt.Errorf("failed to write executable: %w", err)
+	}
+	if b.Config.Debug {
+		archs := make([]string, len(slices))
+		for i, s := range slices {
+			archs[i] = codesig.ArchName(s.Cpu, s.SubCpu)
+		}
+		fmt.Fprintf(os.Stderr, "macgo: wrote universal executable with %v\n", archs)
+	}
+	return nil
+}
+
+// sourceHash returns the hash recorded in .source_hash. For a copied
+// executable it is the SHA256 of the file. For a universal executable it
+// covers the architecture and contents of every slice, so rebuilding any
+// one of the inputs invalidates the bundle. Nested code, resources and
+// the source of a rendered icon are covered too.
+func (b *Bundle) sourceHash() (string, error) {
+	hash, err := b.executableHash()
+	if err != nil {
+		return "", err
+	}
+	if b.Config.hasNested() {
+		if hash, err = b.nestedHash(hash); err != nil {
+			return "", err
+		}
+	}
+	if b.Config.Resources != nil {
+		if hash, err = b.resourcesHash(hash); err != nil {
+			return "", err
+		}
+	}
+	if b.Config.generatesIcon() {
+		return b.iconHash(hash)
+	}
+	return hash, nil
+}
+
+// executableHash returns the hash of the bundle executable's inputs.
+func (b *Bundle) executableHash() (string, error) {
+	if !b.Config.isUniversal() {
+		return system.CalculateFileSHA256(b.execPath)
+	}
+	slices, err := b.universalSlices()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, s := range slices {
+		sum := sha256.Sum256(s.Data)
+		fmt.Fprintf(h, "%s %x\n", codesig.ArchName(s.Cpu, s.SubCpu), sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
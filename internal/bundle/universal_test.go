@@ -0,0 +1,157 @@
+package bundle
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/codesig"
+)
+
+// writeThinMachO writes a minimal 64-bit Mach-O executable for cpu.
+func writeThinMachO(t *testing.T, path string, cpu macho.Cpu, payload string) {
+	t.Helper()
+	le := binary.LittleEndian
+	b := le.AppendUint32(nil, macho.Magic64)
+	b = le.AppendUint32(b, uint32(cpu))
+	b = le.AppendUint32(b, 0) // cpusubtype
+	b = le.AppendUint32(b, uint32(macho.TypeExec))
+	b = le.AppendUint32(b, 0) // ncmds
+	b = le.AppendUint32(b, 0) // sizeofcmds
+	b = le.AppendUint32(b, 0) // flags
+	b = le.AppendUint32(b, 0) // reserved
+	b = append(b, payload...)
+	if err := os.WriteFile(path, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBundle_UniversalExecutable(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("GOPATH", tmpDir)
+
+	arm64 := filepath.Join(tmpDir, "app-arm64")
+	amd64 := filepath.Join(tmpDir, "app-amd64")
+	writeThinMachO(t, arm64, macho.CpuArm64, "arm64 build")
+	writeThinMachO(t, amd64, macho.CpuAmd64, "amd64 build")
+
+	config := &Config{
+		AppName:          "UniversalApp",
+		BundleID:         "com.example.universal",
+		ExtraExecutables: []string{amd64},
+	}
+	b, err := New(arm64, config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := b.Create(); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	exe := filepath.Join(b.Path, "Contents", "MacOS", "UniversalApp")
+	f, err := codesig.Open(exe)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !f.Fat {
+		t.Fatal("bundle executable is not universal")
+	}
+	if got, want := f.Archs(), []string{"arm64", "x86_64"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("archs = %v, want %v", got, want)
+	}
+	src, err := os.ReadFile(amd64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Slice("x86_64").Data; string(got) != string(src) {
+		t.Error("x86_64 slice differs from its source")
+	}
+
+	// An unchanged set of inputs reuses the bundle.
+	b2, _ := New(arm64, config)
+	if err := b2.Create(); err != nil {
+		t.Fatalf("second Create failed: %v", err)
+	}
+	if !b2.reused {
+		t.Error("bundle with unchanged slices was not reused")
+	}
+
+	// Rebuilding only the extra architecture invalidates it.
+	writeThinMachO(t, amd64, macho.CpuAmd64, "amd64 rebuild")
+	b3, _ := New(arm64, config)
+	if b3.Path = b.Path; b3.isBundleUpToDate() {
+		t.Error("bundle considered up to date after an extra slice changed")
+	}
+
+	// Architectures selects and orders the slices.
+	config.Architectures = []string{"amd64", "arm64"}
+	b4, _ := New(arm64, config)
+	if err := b4.Create(); err != nil {
+		t.Fatalf("Create with Architectures failed: %v", err)
+	}
+	if b4.reused {
+		t.Error("bundle reused after Architectures changed")
+	}
+	f, err = codesig.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.Archs(), []string{"x86_64", "arm64"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("archs = %v, want %v", got, want)
+	}
+}
+
+func TestBundle_UniversalExecutableErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("GOPATH", tmpDir)
+
+	arm64 := filepath.Join(tmpDir, "app-arm64")
+	other := filepath.Join(tmpDir, "other-arm64")
+	writeThinMachO(t, arm64, macho.CpuArm64, "a")
+	writeThinMachO(t, other, macho.CpuArm64, "b")
+	script := filepath.Join(tmpDir, "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr string
+	}{
+		{
+			name:    "duplicate architecture",
+			config:  &Config{ExtraExecutables: []string{other}},
+			wantErr: "provided by both",
+		},
+		{
+			name:    "missing architecture",
+			config:  &Config{Architectures: []string{"arm64", "amd64"}},
+			wantErr: "no executable provided for architecture amd64",
+		},
+		{
+			name:    "not Mach-O",
+			config:  &Config{ExtraExecutables: []string{script}},
+			wantErr: script,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.AppName = "BadUniversal"
+			tt.config.BundleID = "com.example.baduniversal"
+			tt.config.CleanupBundle = true
+			b, err := New(arm64, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = b.Create()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Create() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
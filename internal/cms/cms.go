@@ -0,0 +1,230 @@
+// Package cms parses the subset of Cryptographic Message Syntax (RFC 5652)
+// SignedData used by Apple code signatures.
+package cms
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// OIDData is the id-data content type.
+	OIDData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	// OIDSignedData is the id-signedData content type.
+	OIDSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// Attribute is a CMS signed or unsigned attribute.
+type Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// SignedData is a parsed CMS SignedData message.
+type SignedData struct {
+	// ContentType is the type of the signed content, usually OIDData.
+	ContentType asn1.ObjectIdentifier
+
+	// Content is the encapsulated content, or nil for a detached signature.
+	Content []byte
+
+	// Certificates holds the certificates bundled with the message.
+	Certificates []*x509.Certificate
+
+	// Signers holds one entry per SignerInfo.
+	Signers []*Signer
+}
+
+// Signer is a parsed CMS SignerInfo.
+type Signer struct {
+	// Certificate is the signer's certificate from the message, or nil if
+	// it was not included.
+	Certificate *x509.Certificate
+
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+
+	// SignedAttrs and UnsignedAttrs are the signer's attributes.
+	SignedAttrs   []Attribute
+	UnsignedAttrs []Attribute
+
+	// RawSignedAttrs is the DER encoding of the signed attributes as a SET,
+	// which is what the signature covers.
+	RawSignedAttrs []byte
+}
+
+// Parse parses a DER-encoded CMS ContentInfo holding SignedData.
+func Parse(der []byte) (*SignedData, error) {
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(der, &ci)
+	if err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+	if len(bytes.TrimRight(rest, "\x00")) != 0 {
+		return nil, fmt.Errorf("cms: trailing data after ContentInfo")
+	}
+	if !ci.ContentType.Equal(OIDSignedData) {
+		return nil, fmt.Errorf("cms: content type %v is not signedData", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("cms: signedData: %w", err)
+	}
+
+	out := &SignedData{ContentType: sd.EncapContentInfo.ContentType}
+	if len(sd.EncapContentInfo.Content.Bytes) > 0 {
+		var content []byte
+		if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content.Bytes, &content); err != nil {
+			return nil, fmt.Errorf("cms: content: %w", err)
+		}
+		out.Content = content
+	}
+	if len(sd.Certificates.Bytes) > 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cms: certificates: %w", err)
+		}
+		out.Certificates = certs
+	}
+
+	for _, si := range sd.SignerInfos {
+		s := &Signer{
+			DigestAlgorithm:    si.DigestAlgorithm,
+			SignatureAlgorithm: si.SignatureAlgorithm,
+			Signature:          si.Signature,
+		}
+		if len(si.SignedAttrs.FullBytes) > 0 {
+			s.RawSignedAttrs = retagSet(si.SignedAttrs.FullBytes)
+			if s.SignedAttrs, err = parseAttributes(si.SignedAttrs.Bytes); err != nil {
+				return nil, fmt.Errorf("cms: signed attributes: %w", err)
+			}
+		}
+		if len(si.UnsignedAttrs.FullBytes) > 0 {
+			if s.UnsignedAttrs, err = parseAttributes(si.UnsignedAttrs.Bytes); err != nil {
+				return nil, fmt.Errorf("cms: unsigned attributes: %w", err)
+			}
+		}
+		s.Certificate = findCertificate(out.Certificates, si.SID)
+		out.Signers = append(out.Signers, s)
+	}
+	return out, nil
+}
+
+// parseAttributes parses the contents of a SET OF Attribute.
+func parseAttributes(data []byte) ([]Attribute, error) {
+	var attrs []Attribute
+	for len(data) > 0 {
+		var a Attribute
+		var err error
+		if data, err = asn1.Unmarshal(data, &a); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs, nil
+}
+
+// retagSet replaces the [0] IMPLICIT tag of an encoded attribute set with
+// the universal SET tag, as required when verifying its signature.
+func retagSet(raw []byte) []byte {
+	out := append([]byte(nil), raw...)
+	out[0] = 0x31
+	return out
+}
+
+// findCertificate returns the certificate identified by a SignerIdentifier.
+func findCertificate(certs []*x509.Certificate, sid asn1.RawValue) *x509.Certificate {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c
+			}
+		}
+		return nil
+	}
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil
+	}
+	for _, c := range certs {
+		if c.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Attribute returns the first value of the attribute with the given type.
+func (s *Signer) Attribute(oid asn1.ObjectIdentifier) (asn1.RawValue, bool) {
+	for _, attrs := range [][]Attribute{s.SignedAttrs, s.UnsignedAttrs} {
+		for _, a := range attrs {
+			if a.Type.Equal(oid) && len(a.Values) > 0 {
+				return a.Values[0], true
+			}
+		}
+	}
+	return asn1.RawValue{}, false
+}
+
+// Chain returns the signer's certificate chain, leaf first, built by
+// following issuers through the message's certificates. It stops at a
+// self-signed certificate or when the issuer is not included, and is nil
+// when the signer's certificate is missing.
+func (sd *SignedData) Chain(s *Signer) []*x509.Certificate {
+	var chain []*x509.Certificate
+	for cert := s.Certificate; cert != nil && len(chain) <= len(sd.Certificates); {
+		chain = append(chain, cert)
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			break
+		}
+		var next *x509.Certificate
+		for _, c := range sd.Certificates {
+			if bytes.Equal(c.RawSubject, cert.RawIssuer) && c != cert {
+				next = c
+				break
+			}
+		}
+		cert = next
+	}
+	return chain
+}
@@ -0,0 +1,310 @@
+package cms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/macgo/internal/testcert"
+)
+
+var (
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+)
+
+func mustMarshal(t *testing.T, v any, params ...string) []byte {
+	t.Helper()
+	var b []byte
+	var err error
+	if len(params) > 0 {
+		b, err = asn1.MarshalWithParams(v, params[0])
+	} else {
+		b, err = asn1.Marshal(v)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func attribute(t *testing.T, oid asn1.ObjectIdentifier, v any) Attribute {
+	return Attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: mustMarshal(t, v)}}}
+}
+
+// detachedSignature builds a detached SignedData over content, signed by
+// cert with signed attributes, as codesign produces.
+func detachedSignature(t *testing.T, cert *x509.Certificate, key *ecdsa.PrivateKey, content []byte, signingTime time.Time) []byte {
+	t.Helper()
+	digest := sha256.Sum256(content)
+	attrs := []Attribute{
+		attribute(t, oidContentType, OIDData),
+		attribute(t, oidSigningTime, signingTime),
+		attribute(t, oidMessageDigest, digest[:]),
+	}
+	attrSet := mustMarshal(t, attrs, "set")
+	attrHash := sha256.Sum256(attrSet)
+	sigBytes, err := key.Sign(rand.Reader, attrHash[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedAttrs := append([]byte(nil), attrSet...)
+	signedAttrs[0] = 0xa0 // [0] IMPLICIT
+	si := signerInfo{
+		Version: 1,
+		SID: asn1.RawValue{FullBytes: mustMarshal(t, issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		})},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{FullBytes: signedAttrs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+		Signature:          sigBytes,
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapsulatedContentInfo{ContentType: OIDData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos:      []signerInfo{si},
+	}
+	return mustMarshal(t, contentInfo{
+		ContentType: OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: mustMarshal(t, sd)},
+	})
+}
+
+func TestParse(t *testing.T) {
+	cert, key := testcert.CodeSigning(t, "Test Signer", "ABCDE12345")
+	content := []byte("code directory")
+	signingTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	der := detachedSignature(t, cert, key, content, signingTime)
+
+	sd, err := Parse(append(der, 0, 0, 0)) // codesign pads the blob with zeros
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if sd.Content != nil {
+		t.Errorf("Content = %q, want detached", sd.Content)
+	}
+	if len(sd.Certificates) != 1 || len(sd.Signers) != 1 {
+		t.Fatalf("got %d certificates, %d signers", len(sd.Certificates), len(sd.Signers))
+	}
+	s := sd.Signers[0]
+	if s.Certificate == nil || s.Certificate.Subject.CommonName != "Test Signer" {
+		t.Fatalf("signer certificate = %v", s.Certificate)
+	}
+
+	v, ok := s.Attribute(oidSigningTime)
+	if !ok {
+		t.Fatal("missing signing time")
+	}
+	var got time.Time
+	if _, err := asn1.Unmarshal(v.FullBytes, &got); err != nil || !got.Equal(signingTime) {
+		t.Errorf("signing time = %v, %v", got, err)
+	}
+	v, _ = s.Attribute(oidMessageDigest)
+	var digest []byte
+	asn1.Unmarshal(v.FullBytes, &digest)
+	if want := sha256.Sum256(content); string(digest) != string(want[:]) {
+		t.Error("message digest mismatch")
+	}
+
+	if err := s.Certificate.CheckSignature(x509.ECDSAWithSHA256, s.RawSignedAttrs, s.Signature); err != nil {
+		t.Errorf("signature over RawSignedAttrs does not verify: %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cert, key := testcert.CodeSigning(t, "Test Signer", "ABCDE12345")
+	valid := detachedSignature(t, cert, key, []byte("x"), time.Now())
+	tests := []struct {
+		name string
+		der  []byte
+		want string
+	}{
+		{"garbage", []byte{1, 2, 3}, "cms:"},
+		{"trailing data", append(append([]byte(nil), valid...), 1), "trailing data"},
+		{"not signedData", mustMarshal(t, contentInfo{ContentType: OIDData}), "not signedData"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.der)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Parse() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignerVerify(t *testing.T) {
+	cert, key := testcert.CodeSigning(t, "Test Signer", "ABCDE12345")
+	content := []byte("code directory")
+	sd, err := Parse(detachedSignature(t, cert, key, content, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sd.Signers[0]
+	if err := s.Verify(content); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := s.Verify([]byte("tampered")); err == nil || !strings.Contains(err.Error(), "digest") {
+		t.Errorf("Verify(tampered) = %v, want digest mismatch", err)
+	}
+
+	other, _ := testcert.CodeSigning(t, "Test Signer", "ABCDE12345")
+	forged := *s
+	forged.Certificate = other
+	if err := forged.Verify(content); err == nil {
+		t.Error("Verify with the wrong certificate succeeded")
+	}
+	forged.Certificate = nil
+	if err := forged.Verify(content); err == nil {
+		t.Error("Verify without a certificate succeeded")
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	cert, ecKey := testcert.CodeSigning(t, "Test Signer", "ABCDE12345")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "RSA Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	rsaDER, err := x509.CreateCertificate(rand.Reader, rsaTmpl, rsaTmpl, &rsaKey.PublicKey, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaCert, err := x509.ParseCertificate(rsaDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oidCustom := asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 1}
+	custom, err := NewAttribute(oidCustom, []byte("cdhashes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	content := []byte("code directory")
+
+	for _, tt := range []struct {
+		name string
+		cert *x509.Certificate
+		key  crypto.Signer
+	}{
+		{"ecdsa", cert, ecKey},
+		{"rsa", rsaCert, rsaKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			der, err := SignDetached(content, tt.cert, tt.key, SignOptions{
+				Time:        signingTime,
+				Chain:       []*x509.Certificate{cert},
+				SignedAttrs: []Attribute{custom},
+			})
+			if err != nil {
+				t.Fatalf("SignDetached: %v", err)
+			}
+			sd, err := Parse(der)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if sd.Content != nil || len(sd.Certificates) != 2 || len(sd.Signers) != 1 {
+				t.Fatalf("got content %q, %d certificates, %d signers", sd.Content, len(sd.Certificates), len(sd.Signers))
+			}
+			s := sd.Signers[0]
+			if s.Certificate == nil || !s.Certificate.Equal(tt.cert) {
+				t.Fatalf("signer certificate = %v", s.Certificate)
+			}
+			if err := s.Verify(content); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+			v, ok := s.Attribute(OIDSigningTime)
+			var got time.Time
+			if !ok {
+				t.Error("missing signing time")
+			} else if _, err := asn1.Unmarshal(v.FullBytes, &got); err != nil || !got.Equal(signingTime) {
+				t.Errorf("signing time = %v, %v", got, err)
+			}
+			if _, ok := s.Attribute(oidCustom); !ok {
+				t.Error("missing custom signed attribute")
+			}
+		})
+	}
+}
+
+func TestSignEncapsulatedWithTimestamp(t *testing.T) {
+	cert, key := testcert.CodeSigning(t, "Test Signer", "ABCDE12345")
+	oidTSTInfo := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	content := []byte("tst info")
+	token := mustMarshal(t, contentInfo{ContentType: OIDData})
+
+	var stamped []byte
+	der, err := Sign(content, cert, key, SignOptions{
+		ContentType: oidTSTInfo,
+		Timestamp: func(signature []byte) ([]byte, error) {
+			stamped = signature
+			return token, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	sd, err := Parse(der)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !sd.ContentType.Equal(oidTSTInfo) || string(sd.Content) != string(content) {
+		t.Errorf("content = %v %q, want %v %q", sd.ContentType, sd.Content, oidTSTInfo, content)
+	}
+	s := sd.Signers[0]
+	if err := s.Verify(sd.Content); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if string(stamped) != string(s.Signature) {
+		t.Error("Timestamp was not called with the signature value")
+	}
+	if v, ok := s.Attribute(OIDTimeStampToken); !ok || string(v.FullBytes) != string(token) {
+		t.Errorf("timestamp token attribute = %x, %v", v.FullBytes, ok)
+	}
+	if len(s.UnsignedAttrs) != 1 {
+		t.Errorf("unsigned attributes = %d, want 1", len(s.UnsignedAttrs))
+	}
+
+	// A nil token leaves the signature untimestamped.
+	der, err = SignDetached(content, cert, key, SignOptions{Timestamp: func([]byte) ([]byte, error) { return nil, nil }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd, err = Parse(der); err != nil || len(sd.Signers[0].UnsignedAttrs) != 0 {
+		t.Errorf("Parse = %v; unsigned attributes present without a token", err)
+	}
+}
+
+func TestSignDetachedUnsupportedKey(t *testing.T) {
+	cert, _ := testcert.CodeSigning(t, "Test Signer", "ABCDE12345")
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignDetached([]byte("x"), cert, key, SignOptions{}); err == nil || !strings.Contains(err.Error(), "unsupported key") {
+		t.Errorf("SignDetached(ed25519) = %v, want unsupported key error", err)
+	}
+}
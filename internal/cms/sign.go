@@ -0,0 +1,213 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	// OIDContentType is the contentType signed attribute.
+	OIDContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	// OIDSigningTime is the signingTime signed attribute.
+	OIDSigningTime = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	// OIDTimeStampToken is the unsigned attribute carrying an RFC 3161
+	// time-stamp token over the signature value.
+	OIDTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+)
+
+// SignOptions configures SignDetached.
+type SignOptions struct {
+	// Time is the signing time. Defaults to the current time.
+	Time time.Time
+
+	// Chain holds intermediate certificates to include after the signer's.
+	Chain []*x509.Certificate
+
+	// SignedAttrs are additional signed attributes, such as Apple's
+	// CDHashes attributes.
+	SignedAttrs []Attribute
+
+	// ContentType is the type of the signed content. Defaults to OIDData.
+	ContentType asn1.ObjectIdentifier
+
+	// Timestamp, if set, is called with the signature value and returns
+	// an RFC 3161 time-stamp token over it, which is added as an unsigned
+	// attribute. A nil token adds nothing.
+	Timestamp func(signature []byte) ([]byte, error)
+}
+
+// NewAttribute returns an attribute with a single DER-encoded value.
+func NewAttribute(oid asn1.ObjectIdentifier, value any) (Attribute, error) {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return Attribute{}, fmt.Errorf("cms: attribute %v: %w", oid, err)
+	}
+	return Attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: der}}}, nil
+}
+
+// SignDetached returns a DER-encoded CMS SignedData with a detached
+// signature over content by cert and key, as embedded in Apple code
+// signatures. Content is digested with SHA-256. RSA and ECDSA keys are
+// supported.
+func SignDetached(content []byte, cert *x509.Certificate, key crypto.Signer, opts SignOptions) ([]byte, error) {
+	return sign(content, cert, key, opts, true)
+}
+
+// Sign is like SignDetached but encapsulates content in the message, as
+// RFC 3161 time-stamp tokens do.
+func Sign(content []byte, cert *x509.Certificate, key crypto.Signer, opts SignOptions) ([]byte, error) {
+	return sign(content, cert, key, opts, false)
+}
+
+func sign(content []byte, cert *x509.Certificate, key crypto.Signer, opts SignOptions, detached bool) ([]byte, error) {
+	contentType := opts.ContentType
+	if contentType == nil {
+		contentType = OIDData
+	}
+	sigAlg, err := keySignatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	signingTime := opts.Time
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+	digest := sha256.Sum256(content)
+
+	attrs := make([]Attribute, 0, 3+len(opts.SignedAttrs))
+	for _, a := range []struct {
+		oid asn1.ObjectIdentifier
+		v   any
+	}{
+		{OIDContentType, contentType},
+		{OIDSigningTime, signingTime.UTC()},
+		{OIDMessageDigest, digest[:]},
+	} {
+		attr, err := NewAttribute(a.oid, a.v)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	attrs = append(attrs, opts.SignedAttrs...)
+	attrSet, err := marshalAttributeSet(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	attrDigest := sha256.Sum256(attrSet)
+	signature, err := key.Sign(rand.Reader, attrDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("cms: sign: %w", err)
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cms: signer identifier: %w", err)
+	}
+	signedAttrs := append([]byte(nil), attrSet...)
+	signedAttrs[0] = 0xa0 // [0] IMPLICIT
+	si := signerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+		SignedAttrs:        asn1.RawValue{FullBytes: signedAttrs},
+		SignatureAlgorithm: sigAlg,
+		Signature:          signature,
+	}
+	if opts.Timestamp != nil {
+		token, err := opts.Timestamp(signature)
+		if err != nil {
+			return nil, fmt.Errorf("cms: timestamp: %w", err)
+		}
+		if token != nil {
+			unsigned, err := marshalAttributeSet([]Attribute{{Type: OIDTimeStampToken, Values: []asn1.RawValue{{FullBytes: token}}}})
+			if err != nil {
+				return nil, err
+			}
+			unsigned[0] = 0xa1 // [1] IMPLICIT
+			si.UnsignedAttrs = asn1.RawValue{FullBytes: unsigned}
+		}
+	}
+
+	var certs []byte
+	certs = append(certs, cert.Raw...)
+	for _, c := range opts.Chain {
+		certs = append(certs, c.Raw...)
+	}
+	eci := encapsulatedContentInfo{ContentType: contentType}
+	if !detached {
+		octets, err := asn1.Marshal(content)
+		if err != nil {
+			return nil, fmt.Errorf("cms: %w", err)
+		}
+		eci.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets}
+	}
+	version := 1
+	if !contentType.Equal(OIDData) {
+		version = 3 // RFC 5652, section 5.1
+	}
+	sd := signedData{
+		Version:          version,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{si.DigestAlgorithm},
+		EncapContentInfo: eci,
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []signerInfo{si},
+	}
+	sdDER, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+	der, err := asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdDER},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+	return der, nil
+}
+
+// keySignatureAlgorithm returns the SignerInfo signature algorithm for key.
+// RSA uses rsaEncryption with the digest algorithm implied, as codesign does.
+func keySignatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	}
+	return pkix.AlgorithmIdentifier{}, fmt.Errorf("cms: unsupported key type %T", key.Public())
+}
+
+// marshalAttributeSet encodes attributes as a DER SET OF, whose elements
+// must appear in ascending order of their encodings.
+func marshalAttributeSet(attrs []Attribute) ([]byte, error) {
+	encoded := make([][]byte, len(attrs))
+	for i, a := range attrs {
+		der, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("cms: attribute %v: %w", a.Type, err)
+		}
+		encoded[i] = der
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	set, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+	if err != nil {
+		return nil, fmt.Errorf("cms: %w", err)
+	}
+	return set, nil
+}
@@ -0,0 +1,133 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	// OIDMessageDigest is the messageDigest signed attribute.
+	OIDMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// digestHash returns the hash function for a digest algorithm OID.
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, true
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// signatureAlgorithm maps a SignerInfo's signature and digest algorithms
+// to the x509 signature algorithm that verifies it. CMS allows the bare
+// key algorithm (rsaEncryption, id-ecPublicKey), in which case the digest
+// algorithm selects the hash.
+func signatureAlgorithm(sig asn1.ObjectIdentifier, h crypto.Hash) x509.SignatureAlgorithm {
+	switch {
+	case sig.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA
+	case sig.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA
+	case sig.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA
+	case sig.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA
+	case sig.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1
+	case sig.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256
+	case sig.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384
+	case sig.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512
+	case sig.Equal(oidRSAEncryption):
+		switch h {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA
+		case crypto.SHA256:
+			return x509.SHA256WithRSA
+		case crypto.SHA384:
+			return x509.SHA384WithRSA
+		case crypto.SHA512:
+			return x509.SHA512WithRSA
+		}
+	case sig.Equal(oidECPublicKey):
+		switch h {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// Verify checks that the signer signed content: the messageDigest signed
+// attribute must match the digest of content, and the signature over the
+// signed attributes must verify with the signer's certificate. It does not
+// check the certificate chain.
+func (s *Signer) Verify(content []byte) error {
+	if s.Certificate == nil {
+		return fmt.Errorf("cms: signer certificate not included")
+	}
+	if len(s.RawSignedAttrs) == 0 {
+		return fmt.Errorf("cms: signer has no signed attributes")
+	}
+	h, ok := digestHash(s.DigestAlgorithm.Algorithm)
+	if !ok || !h.Available() {
+		return fmt.Errorf("cms: unsupported digest algorithm %v", s.DigestAlgorithm.Algorithm)
+	}
+
+	raw, ok := s.Attribute(OIDMessageDigest)
+	if !ok {
+		return fmt.Errorf("cms: missing messageDigest attribute")
+	}
+	var digest []byte
+	if _, err := asn1.Unmarshal(raw.FullBytes, &digest); err != nil {
+		return fmt.Errorf("cms: messageDigest: %w", err)
+	}
+	d := h.New()
+	d.Write(content)
+	if !bytes.Equal(d.Sum(nil), digest) {
+		return fmt.Errorf("cms: message digest does not match content")
+	}
+
+	algo := signatureAlgorithm(s.SignatureAlgorithm.Algorithm, h)
+	if algo == x509.UnknownSignatureAlgorithm {
+		return fmt.Errorf("cms: unsupported signature algorithm %v", s.SignatureAlgorithm.Algorithm)
+	}
+	if err := s.Certificate.CheckSignature(algo, s.RawSignedAttrs, s.Signature); err != nil {
+		return fmt.Errorf("cms: %w", err)
+	}
+	return nil
+}
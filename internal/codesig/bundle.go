@@ -0,0 +1,27 @@
+package codesig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tmc/macgo/internal/plist"
+)
+
+// MainExecutable returns the path of the executable named by a bundle's
+// CFBundleExecutable, together with the bundle's decoded Info.plist.
+func MainExecutable(bundlePath string) (string, map[string]any, error) {
+	data, err := os.ReadFile(filepath.Join(bundlePath, "Contents", "Info.plist"))
+	if err != nil {
+		return "", nil, fmt.Errorf("codesig: read Info.plist: %w", err)
+	}
+	var info map[string]any
+	if err := plist.Unmarshal(data, &info); err != nil {
+		return "", nil, fmt.Errorf("codesig: parse Info.plist: %w", err)
+	}
+	exe, _ := info["CFBundleExecutable"].(string)
+	if exe == "" {
+		return "", nil, fmt.Errorf("codesig: Info.plist has no CFBundleExecutable")
+	}
+	return filepath.Join(bundlePath, "Contents", "MacOS", exe), info, nil
+}
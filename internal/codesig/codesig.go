@@ -0,0 +1,440 @@
+// Package codesig reads Apple code signatures embedded in Mach-O files.
+//
+// A code signature is a SuperBlob referenced by the LC_CODE_SIGNATURE load
+// command. It indexes a set of blobs: one or more CodeDirectories holding
+// page and special-slot hashes, the internal requirements, the embedded
+// entitlements (XML and DER) and a CMS signature over the CodeDirectory.
+// All structures are big-endian regardless of the Mach-O byte order.
+package codesig
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Blob magic numbers.
+const (
+	MagicRequirement             = 0xfade0c00
+	MagicRequirements            = 0xfade0c01
+	MagicCodeDirectory           = 0xfade0c02
+	MagicEmbeddedSignature       = 0xfade0cc0
+	MagicEmbeddedEntitlements    = 0xfade7171
+	MagicEmbeddedDEREntitlements = 0xfade7172
+	MagicBlobWrapper             = 0xfade0b01
+)
+
+// Slot types in the SuperBlob index. Negative indices into a
+// CodeDirectory's special slots use the same numbering.
+const (
+	SlotCodeDirectory          = 0
+	SlotInfo                   = 1
+	SlotRequirements           = 2
+	SlotResourceDir            = 3
+	SlotApplication            = 4
+	SlotEntitlements           = 5
+	SlotDEREntitlements        = 7
+	SlotAlternateCodeDirectory = 0x1000
+	SlotSignature              = 0x10000
+)
+
+// alternateCodeDirectoryLimit is the number of alternate CodeDirectory slots.
+const alternateCodeDirectoryLimit = 5
+
+// HashType identifies the hash algorithm of a CodeDirectory.
+type HashType uint8
+
+const (
+	HashSHA1            HashType = 1
+	HashSHA256          HashType = 2
+	HashSHA256Truncated HashType = 3
+	HashSHA384          HashType = 4
+)
+
+// String returns the name codesign uses for the hash type.
+func (h HashType) String() string {
+	switch h {
+	case HashSHA1:
+		return "sha1"
+	case HashSHA256:
+		return "sha256"
+	case HashSHA256Truncated:
+		return "sha256-truncated"
+	case HashSHA384:
+		return "sha384"
+	default:
+		return fmt.Sprintf("HashType(%d)", uint8(h))
+	}
+}
+
+// New returns a new hash.Hash for h, or nil if h is unknown.
+// Truncated hashes must be cut to the CodeDirectory's hash size by the caller.
+func (h HashType) New() hash.Hash {
+	switch h {
+	case HashSHA1:
+		return sha1.New()
+	case HashSHA256, HashSHA256Truncated:
+		return sha256.New()
+	case HashSHA384:
+		return sha512.New384()
+	default:
+		return nil
+	}
+}
+
+// Flags are the code signing flags recorded in a CodeDirectory.
+type Flags uint32
+
+const (
+	FlagHost              Flags = 0x00001
+	FlagAdhoc             Flags = 0x00002
+	FlagForceHard         Flags = 0x00100
+	FlagForceKill         Flags = 0x00200
+	FlagForceExpiration   Flags = 0x00400
+	FlagRestrict          Flags = 0x00800
+	FlagEnforcement       Flags = 0x01000
+	FlagLibraryValidation Flags = 0x02000
+	FlagRuntime           Flags = 0x10000
+	FlagLinkerSigned      Flags = 0x20000
+)
+
+var flagNames = []struct {
+	flag Flags
+	name string
+}{
+	{FlagHost, "host"},
+	{FlagAdhoc, "adhoc"},
+	{FlagForceHard, "hard"},
+	{FlagForceKill, "kill"},
+	{FlagForceExpiration, "expires"},
+	{FlagRestrict, "restrict"},
+	{FlagEnforcement, "enforcement"},
+	{FlagLibraryValidation, "library-validation"},
+	{FlagRuntime, "runtime"},
+	{FlagLinkerSigned, "linker-signed"},
+}
+
+// String returns the flags as codesign prints them, e.g. "0x10002(adhoc,runtime)".
+func (f Flags) String() string {
+	var names []string
+	for _, n := range flagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%#x(none)", uint32(f))
+	}
+	return fmt.Sprintf("%#x(%s)", uint32(f), strings.Join(names, ","))
+}
+
+// Signature is a parsed embedded code signature SuperBlob.
+type Signature struct {
+	// CodeDirectories holds the primary CodeDirectory followed by any
+	// alternates, in slot order.
+	CodeDirectories []*CodeDirectory
+
+	// Requirements is the raw internal requirements blob, including its header.
+	Requirements []byte
+
+	// Entitlements is the XML entitlements payload, without the blob header.
+	Entitlements []byte
+
+	// EntitlementsDER is the DER entitlements payload, without the blob header.
+	EntitlementsDER []byte
+
+	// CMS is the detached CMS signature, without the blob header. It is
+	// empty for ad-hoc signatures.
+	CMS []byte
+
+	// Raw is the SuperBlob as stored in the file.
+	Raw []byte
+}
+
+// CodeDirectory returns the CodeDirectory with the strongest hash type,
+// which is the one codesign reports and uses for the CDHash.
+func (s *Signature) CodeDirectory() *CodeDirectory {
+	var best *CodeDirectory
+	for _, cd := range s.CodeDirectories {
+		if best == nil || hashRank(cd.HashType) > hashRank(best.HashType) {
+			best = cd
+		}
+	}
+	return best
+}
+
+func hashRank(h HashType) int {
+	switch h {
+	case HashSHA1:
+		return 1
+	case HashSHA256Truncated:
+		return 2
+	case HashSHA256:
+		return 3
+	case HashSHA384:
+		return 4
+	}
+	return 0
+}
+
+// RequirementCount returns the number of requirements in the internal
+// requirements blob.
+func (s *Signature) RequirementCount() int {
+	if len(s.Requirements) < 12 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(s.Requirements[8:]))
+}
+
+// CodeDirectory is a parsed CodeDirectory blob.
+type CodeDirectory struct {
+	Version      uint32
+	Flags        Flags
+	Identifier   string
+	TeamID       string
+	HashType     HashType
+	HashSize     int
+	Platform     uint8
+	PageSize     int // 0 means the whole file is hashed as one page
+	CodeLimit    uint64
+	ExecSegBase  uint64
+	ExecSegLimit uint64
+	ExecSegFlags uint64
+	Runtime      uint32 // hardened runtime version, encoded as major<<16|minor<<8|patch
+
+	// SpecialHashes[i] is the hash in special slot -(i+1); see the Slot
+	// constants. Empty (all-zero) slots are present but zero.
+	SpecialHashes [][]byte
+
+	// CodeHashes holds one hash per page of the signed code.
+	CodeHashes [][]byte
+
+	// Raw is the complete CodeDirectory blob, whose hash is the CDHash.
+	Raw []byte
+}
+
+// CDHash returns the hash of the CodeDirectory using its own hash type.
+// codesign displays the first 20 bytes.
+func (cd *CodeDirectory) CDHash() []byte {
+	h := cd.HashType.New()
+	if h == nil {
+		return nil
+	}
+	h.Write(cd.Raw)
+	return h.Sum(nil)
+}
+
+// SpecialHash returns the hash in the given special slot, or nil if the
+// CodeDirectory does not cover that slot.
+func (cd *CodeDirectory) SpecialHash(slot int) []byte {
+	if slot < 1 || slot > len(cd.SpecialHashes) {
+		return nil
+	}
+	return cd.SpecialHashes[slot-1]
+}
+
+// Parse parses an embedded signature SuperBlob.
+func Parse(data []byte) (*Signature, error) {
+	magic, length, err := blobHeader(data)
+	if err != nil {
+		return nil, fmt.Errorf("codesig: SuperBlob: %w", err)
+	}
+	if magic != MagicEmbeddedSignature {
+		return nil, fmt.Errorf("codesig: bad SuperBlob magic %#x", magic)
+	}
+	if length < 12 {
+		return nil, fmt.Errorf("codesig: SuperBlob too short")
+	}
+	data = data[:length]
+	count := binary.BigEndian.Uint32(data[8:])
+	if uint64(count)*8 > uint64(length-12) {
+		return nil, fmt.Errorf("codesig: SuperBlob index count %d out of range", count)
+	}
+
+	sig := &Signature{Raw: data}
+	for i := uint32(0); i < count; i++ {
+		entry := data[12+8*i:]
+		slot := binary.BigEndian.Uint32(entry)
+		offset := binary.BigEndian.Uint32(entry[4:])
+		if offset >= length {
+			return nil, fmt.Errorf("codesig: slot %#x offset %d out of range", slot, offset)
+		}
+		blob := data[offset:]
+		magic, blen, err := blobHeader(blob)
+		if err != nil {
+			return nil, fmt.Errorf("codesig: slot %#x: %w", slot, err)
+		}
+		blob = blob[:blen]
+
+		switch {
+		case slot == SlotCodeDirectory || (slot >= SlotAlternateCodeDirectory && slot < SlotAlternateCodeDirectory+alternateCodeDirectoryLimit):
+			if magic != MagicCodeDirectory {
+				return nil, fmt.Errorf("codesig: slot %#x: bad CodeDirectory magic %#x", slot, magic)
+			}
+			cd, err := ParseCodeDirectory(blob)
+			if err != nil {
+				return nil, err
+			}
+			sig.CodeDirectories = append(sig.CodeDirectories, cd)
+		case slot == SlotRequirements:
+			sig.Requirements = blob
+		case slot == SlotEntitlements:
+			if magic != MagicEmbeddedEntitlements {
+				return nil, fmt.Errorf("codesig: bad entitlements magic %#x", magic)
+			}
+			sig.Entitlements = blob[8:]
+		case slot == SlotDEREntitlements:
+			if magic != MagicEmbeddedDEREntitlements {
+				return nil, fmt.Errorf("codesig: bad DER entitlements magic %#x", magic)
+			}
+			sig.EntitlementsDER = blob[8:]
+		case slot == SlotSignature:
+			if magic != MagicBlobWrapper {
+				return nil, fmt.Errorf("codesig: bad CMS wrapper magic %#x", magic)
+			}
+			sig.CMS = blob[8:]
+		}
+	}
+	if len(sig.CodeDirectories) == 0 {
+		return nil, fmt.Errorf("codesig: no CodeDirectory")
+	}
+	return sig, nil
+}
+
+// blobHeader returns the magic and length of the blob at the start of data,
+// checking that the length is in range.
+func blobHeader(data []byte) (magic, length uint32, err error) {
+	if len(data) < 8 {
+		return 0, 0, fmt.Errorf("truncated blob header")
+	}
+	magic = binary.BigEndian.Uint32(data)
+	length = binary.BigEndian.Uint32(data[4:])
+	if length < 8 || uint64(length) > uint64(len(data)) {
+		return 0, 0, fmt.Errorf("blob length %d out of range", length)
+	}
+	return magic, length, nil
+}
+
+// CodeDirectory field offsets and the versions that introduced them.
+const (
+	cdVersionScatter   = 0x20100
+	cdVersionTeamID    = 0x20200
+	cdVersionCodeLimit = 0x20300
+	cdVersionExecSeg   = 0x20400
+	cdVersionRuntime   = 0x20500
+
+	cdHeaderSize = 44
+)
+
+// ParseCodeDirectory parses a CodeDirectory blob.
+func ParseCodeDirectory(data []byte) (*CodeDirectory, error) {
+	magic, length, err := blobHeader(data)
+	if err != nil {
+		return nil, fmt.Errorf("codesig: CodeDirectory: %w", err)
+	}
+	if magic != MagicCodeDirectory {
+		return nil, fmt.Errorf("codesig: bad CodeDirectory magic %#x", magic)
+	}
+	if length < cdHeaderSize {
+		return nil, fmt.Errorf("codesig: CodeDirectory too short")
+	}
+	data = data[:length]
+	be := binary.BigEndian
+
+	cd := &CodeDirectory{
+		Version:   be.Uint32(data[8:]),
+		Flags:     Flags(be.Uint32(data[12:])),
+		CodeLimit: uint64(be.Uint32(data[32:])),
+		HashSize:  int(data[36]),
+		HashType:  HashType(data[37]),
+		Platform:  data[38],
+		Raw:       data,
+	}
+	if data[39] != 0 {
+		if data[39] >= 32 {
+			return nil, fmt.Errorf("codesig: page size 2^%d out of range", data[39])
+		}
+		cd.PageSize = 1 << data[39]
+	}
+	hashOffset := be.Uint32(data[16:])
+	identOffset := be.Uint32(data[20:])
+	nSpecial := be.Uint32(data[24:])
+	nCode := be.Uint32(data[28:])
+
+	field32 := func(off int) uint32 {
+		if off+4 > len(data) {
+			return 0
+		}
+		return be.Uint32(data[off:])
+	}
+	field64 := func(off int) uint64 {
+		if off+8 > len(data) {
+			return 0
+		}
+		return be.Uint64(data[off:])
+	}
+	var teamOffset uint32
+	if cd.Version >= cdVersionTeamID {
+		teamOffset = field32(48)
+	}
+	if cd.Version >= cdVersionCodeLimit {
+		if limit := field64(56); limit != 0 {
+			cd.CodeLimit = limit
+		}
+	}
+	if cd.Version >= cdVersionExecSeg {
+		cd.ExecSegBase = field64(64)
+		cd.ExecSegLimit = field64(72)
+		cd.ExecSegFlags = field64(80)
+	}
+	if cd.Version >= cdVersionRuntime {
+		cd.Runtime = field32(88)
+	}
+
+	if cd.Identifier, err = cString(data, identOffset); err != nil {
+		return nil, fmt.Errorf("codesig: identifier: %w", err)
+	}
+	if teamOffset != 0 {
+		if cd.TeamID, err = cString(data, teamOffset); err != nil {
+			return nil, fmt.Errorf("codesig: team ID: %w", err)
+		}
+	}
+
+	if cd.HashSize == 0 {
+		return nil, fmt.Errorf("codesig: zero hash size")
+	}
+	size := uint64(cd.HashSize)
+	end := uint64(hashOffset) + uint64(nCode)*size
+	if uint64(hashOffset) < uint64(nSpecial)*size || end > uint64(length) {
+		return nil, fmt.Errorf("codesig: hash slots out of range")
+	}
+	cd.SpecialHashes = make([][]byte, nSpecial)
+	for i := range cd.SpecialHashes {
+		off := uint64(hashOffset) - uint64(i+1)*size
+		cd.SpecialHashes[i] = data[off : off+size]
+	}
+	cd.CodeHashes = make([][]byte, nCode)
+	for i := range cd.CodeHashes {
+		off := uint64(hashOffset) + uint64(i)*size
+		cd.CodeHashes[i] = data[off : off+size]
+	}
+	return cd, nil
+}
+
+// cString returns the NUL-terminated string at off in data.
+func cString(data []byte, off uint32) (string, error) {
+	if uint64(off) >= uint64(len(data)) {
+		return "", fmt.Errorf("offset %d out of range", off)
+	}
+	b := data[off:]
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i]), nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
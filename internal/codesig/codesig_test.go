@@ -0,0 +1,345 @@
+package codesig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/hex"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/testbuild"
+)
+
+// superBlob assembles an embedded signature from slot/blob pairs.
+func superBlob(slots []uint32, blobs [][]byte) []byte {
+	header := 12 + 8*len(slots)
+	var index, body []byte
+	for i, slot := range slots {
+		index = binary.BigEndian.AppendUint32(index, slot)
+		index = binary.BigEndian.AppendUint32(index, uint32(header+len(body)))
+		body = append(body, blobs[i]...)
+	}
+	b := binary.BigEndian.AppendUint32(nil, MagicEmbeddedSignature)
+	b = binary.BigEndian.AppendUint32(b, uint32(header+len(body)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(slots)))
+	b = append(b, index...)
+	return append(b, body...)
+}
+
+// codeDirectory builds a version 0x20400 CodeDirectory over code.
+func codeDirectory(ident, team string, flags Flags, special [][]byte, code []byte) []byte {
+	const pageSize = 4096
+	const headerLen = 88
+	var hashes [][]byte
+	for off := 0; off < len(code); off += pageSize {
+		sum := sha256.Sum256(code[off:min(off+pageSize, len(code))])
+		hashes = append(hashes, sum[:])
+	}
+
+	identOff := headerLen
+	teamOff := identOff + len(ident) + 1
+	hashOff := teamOff + len(team) + 1 + 32*len(special)
+
+	be := binary.BigEndian
+	var h []byte
+	h = be.AppendUint32(h, MagicCodeDirectory)
+	h = be.AppendUint32(h, 0) // length, patched below
+	h = be.AppendUint32(h, 0x20400)
+	h = be.AppendUint32(h, uint32(flags))
+	h = be.AppendUint32(h, uint32(hashOff))
+	h = be.AppendUint32(h, uint32(identOff))
+	h = be.AppendUint32(h, uint32(len(special)))
+	h = be.AppendUint32(h, uint32(len(hashes)))
+	h = be.AppendUint32(h, uint32(len(code)))
+	h = append(h, 32, byte(HashSHA256), 0, 12)
+	h = be.AppendUint32(h, 0)                 // spare2
+	h = be.AppendUint32(h, 0)                 // scatterOffset
+	h = be.AppendUint32(h, uint32(teamOff))   // teamOffset
+	h = be.AppendUint32(h, 0)                 // spare3
+	h = be.AppendUint64(h, 0)                 // codeLimit64
+	h = be.AppendUint64(h, 0)                 // execSegBase
+	h = be.AppendUint64(h, uint64(len(code))) // execSegLimit
+	h = be.AppendUint64(h, 1)                 // execSegFlags
+	h = append(h, ident...)
+	h = append(h, 0)
+	h = append(h, team...)
+	h = append(h, 0)
+	for i := len(special) - 1; i >= 0; i-- {
+		h = append(h, special[i]...)
+	}
+	for _, hash := range hashes {
+		h = append(h, hash...)
+	}
+	be.PutUint32(h[4:], uint32(len(h)))
+	return h
+}
+
+// thinMachO builds a minimal 64-bit Mach-O whose only load command is
+// LC_CODE_SIGNATURE pointing at sig, placed after 4 KiB of code. A nil sig
+// produces an unsigned file with no load commands.
+func thinMachO(cpu macho.Cpu, sig []byte) []byte {
+	le := binary.LittleEndian
+	ncmds, sizeofcmds := 1, 16
+	if sig == nil {
+		ncmds, sizeofcmds = 0, 0
+	}
+	var b []byte
+	b = le.AppendUint32(b, macho.Magic64)
+	b = le.AppendUint32(b, uint32(cpu))
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint32(b, uint32(macho.TypeExec))
+	b = le.AppendUint32(b, uint32(ncmds))
+	b = le.AppendUint32(b, uint32(sizeofcmds))
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint32(b, 0)
+	if sig != nil {
+		b = le.AppendUint32(b, uint32(loadCmdCodeSignature))
+		b = le.AppendUint32(b, 16)
+		b = le.AppendUint32(b, 4096)
+		b = le.AppendUint32(b, uint32(len(sig)))
+	}
+	b = append(b, make([]byte, 4096-len(b))...)
+	return append(b, sig...)
+}
+
+// fatMachO combines thin slices into a universal binary.
+func fatMachO(slices ...[]byte) []byte {
+	const align = 1 << 12
+	be := binary.BigEndian
+	b := be.AppendUint32(nil, macho.MagicFat)
+	b = be.AppendUint32(b, uint32(len(slices)))
+	offset := align
+	var body []byte
+	for _, s := range slices {
+		mf, err := macho.NewFile(bytes.NewReader(s))
+		if err != nil {
+			panic(err)
+		}
+		b = be.AppendUint32(b, uint32(mf.Cpu))
+		b = be.AppendUint32(b, mf.SubCpu)
+		b = be.AppendUint32(b, uint32(offset))
+		b = be.AppendUint32(b, uint32(len(s)))
+		b = be.AppendUint32(b, 12)
+		body = append(body, s...)
+		pad := (align - len(s)%align) % align
+		body = append(body, make([]byte, pad)...)
+		offset += len(s) + pad
+	}
+	b = append(b, make([]byte, align-len(b))...)
+	return append(b, body...)
+}
+
+const testEntitlements = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>com.apple.security.app-sandbox</key><true/></dict></plist>
+`
+
+func testSignature(t *testing.T, code []byte) []byte {
+	t.Helper()
+	ents := blob(MagicEmbeddedEntitlements, []byte(testEntitlements))
+	entHash := sha256.Sum256(ents)
+	reqs := blob(MagicRequirements, binary.BigEndian.AppendUint32(nil, 0))
+	reqHash := sha256.Sum256(reqs)
+	der := blob(MagicEmbeddedDEREntitlements, []byte{0x70, 0x00})
+	special := make([][]byte, SlotDEREntitlements)
+	for i := range special {
+		special[i] = make([]byte, 32)
+	}
+	special[SlotRequirements-1] = reqHash[:]
+	special[SlotEntitlements-1] = entHash[:]
+	cd := codeDirectory("com.example.app", "ABCDE12345", FlagAdhoc|FlagRuntime, special, code)
+	return superBlob(
+		[]uint32{SlotCodeDirectory, SlotRequirements, SlotEntitlements, SlotDEREntitlements, SlotSignature},
+		[][]byte{cd, reqs, ents, der, blob(MagicBlobWrapper, nil)},
+	)
+}
+
+func TestParse(t *testing.T) {
+	code := bytes.Repeat([]byte("code"), 2500) // 10000 bytes: three pages
+	sig, err := Parse(testSignature(t, code))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	cd := sig.CodeDirectory()
+	if cd.Identifier != "com.example.app" || cd.TeamID != "ABCDE12345" {
+		t.Errorf("identifier/team = %q/%q", cd.Identifier, cd.TeamID)
+	}
+	if cd.HashType != HashSHA256 || cd.HashSize != 32 || cd.PageSize != 4096 {
+		t.Errorf("hash type/size/page = %v/%d/%d", cd.HashType, cd.HashSize, cd.PageSize)
+	}
+	if got := cd.Flags.String(); got != "0x10002(adhoc,runtime)" {
+		t.Errorf("flags = %s", got)
+	}
+	if cd.CodeLimit != uint64(len(code)) || cd.ExecSegLimit != uint64(len(code)) || cd.ExecSegFlags != 1 {
+		t.Errorf("code limit/exec seg = %d/%d/%d", cd.CodeLimit, cd.ExecSegLimit, cd.ExecSegFlags)
+	}
+	if len(cd.CodeHashes) != 3 || len(cd.SpecialHashes) != SlotDEREntitlements {
+		t.Fatalf("hashes = %d+%d", len(cd.CodeHashes), len(cd.SpecialHashes))
+	}
+	last := sha256.Sum256(code[8192:])
+	if !bytes.Equal(cd.CodeHashes[2], last[:]) {
+		t.Error("last page hash mismatch")
+	}
+	entHash := sha256.Sum256(blob(MagicEmbeddedEntitlements, []byte(testEntitlements)))
+	if !bytes.Equal(cd.SpecialHash(SlotEntitlements), entHash[:]) {
+		t.Error("entitlements special slot mismatch")
+	}
+	if cd.SpecialHash(0) != nil || cd.SpecialHash(SlotDEREntitlements+1) != nil {
+		t.Error("SpecialHash should return nil outside the special slots")
+	}
+	cdhash := sha256.Sum256(cd.Raw)
+	if !bytes.Equal(cd.CDHash(), cdhash[:]) {
+		t.Error("CDHash mismatch")
+	}
+
+	if string(sig.Entitlements) != testEntitlements {
+		t.Errorf("entitlements = %q", sig.Entitlements)
+	}
+	if !bytes.Equal(sig.EntitlementsDER, []byte{0x70, 0x00}) {
+		t.Errorf("DER entitlements = %x", sig.EntitlementsDER)
+	}
+	if sig.RequirementCount() != 0 || len(sig.Requirements) != 12 {
+		t.Errorf("requirements = %x", sig.Requirements)
+	}
+	if len(sig.CMS) != 0 {
+		t.Errorf("CMS = %x, want empty ad-hoc wrapper", sig.CMS)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := testSignature(t, []byte("code"))
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "truncated"},
+		{"bad magic", corrupt(func(b []byte) []byte { b[0] = 0; return b }), "bad SuperBlob magic"},
+		{"length past end", corrupt(func(b []byte) []byte { return b[:len(b)-1] }), "out of range"},
+		{"huge count", corrupt(func(b []byte) []byte { binary.BigEndian.PutUint32(b[8:], 1<<30); return b }), "count"},
+		{"offset past end", corrupt(func(b []byte) []byte { binary.BigEndian.PutUint32(b[16:], 1<<20); return b }), "offset"},
+		{"no code directory", superBlob([]uint32{SlotRequirements}, [][]byte{blob(MagicRequirements, make([]byte, 4))}), "no CodeDirectory"},
+		{"wrong CodeDirectory magic", superBlob([]uint32{SlotCodeDirectory}, [][]byte{blob(MagicRequirements, make([]byte, 4))}), "bad CodeDirectory magic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Parse() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFileThinAndFat(t *testing.T) {
+	signed := thinMachO(macho.CpuArm64, testSignature(t, []byte("arm64 code")))
+	unsigned := thinMachO(macho.CpuAmd64, nil)
+
+	f, err := NewFile(signed)
+	if err != nil {
+		t.Fatalf("NewFile(thin): %v", err)
+	}
+	if f.Fat || len(f.Slices) != 1 || f.Slices[0].Arch() != "arm64" {
+		t.Fatalf("thin file = %+v", f)
+	}
+	if s := f.Slices[0]; s.Signature == nil || s.SignatureOffset != 4096 {
+		t.Fatalf("thin signature = %+v", s)
+	}
+
+	f, err = NewFile(fatMachO(unsigned, signed))
+	if err != nil {
+		t.Fatalf("NewFile(fat): %v", err)
+	}
+	if !f.Fat || strings.Join(f.Archs(), " ") != "x86_64 arm64" {
+		t.Fatalf("fat archs = %v", f.Archs())
+	}
+	if f.Slice("x86_64").Signature != nil {
+		t.Error("x86_64 slice should be unsigned")
+	}
+	s := f.Slice("arm64")
+	if s.Signature == nil || s.Signature.CodeDirectory().Identifier != "com.example.app" {
+		t.Fatalf("arm64 slice signature = %+v", s.Signature)
+	}
+	if s.Offset != 8192 {
+		t.Errorf("arm64 slice offset = %d, want 8192", s.Offset)
+	}
+	if f.Slice("ppc") != nil {
+		t.Error("Slice(ppc) should be nil")
+	}
+}
+
+func TestNewFileSignatureOutOfRange(t *testing.T) {
+	data := thinMachO(macho.CpuArm64, testSignature(t, []byte("code")))
+	_, err := NewFile(data[:len(data)-10])
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("NewFile() = %v, want out of range error", err)
+	}
+}
+
+// buildDarwin cross-compiles an empty program for darwin/goarch.
+func buildDarwin(t *testing.T, goarch string) string {
+	t.Helper()
+	return testbuild.Darwin(t, goarch, filepath.Join(t.TempDir(), "hello"))
+}
+
+// TestGoLinkerSignature reads the ad-hoc signature the Go linker embeds
+// in darwin/arm64 executables.
+func TestGoLinkerSignature(t *testing.T) {
+	exe := buildDarwin(t, "arm64")
+
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s := f.Slices[0]
+	if s.Signature == nil {
+		t.Fatal("Go linker output should be signed")
+	}
+	cd := s.Signature.CodeDirectory()
+	if cd.Flags&(FlagAdhoc|FlagLinkerSigned) != FlagAdhoc|FlagLinkerSigned {
+		t.Errorf("flags = %v, want adhoc,linker-signed", cd.Flags)
+	}
+	if cd.CodeLimit != uint64(s.SignatureOffset) {
+		t.Errorf("code limit = %d, want signature offset %d", cd.CodeLimit, s.SignatureOffset)
+	}
+	for i, want := range cd.CodeHashes {
+		start := i * cd.PageSize
+		end := min(start+cd.PageSize, int(cd.CodeLimit))
+		got := sha256.Sum256(s.Data[start:end])
+		if !bytes.Equal(got[:], want) {
+			t.Fatalf("page %d hash = %s, want %s", i, hex.EncodeToString(got[:]), hex.EncodeToString(want))
+		}
+	}
+}
+
+func TestMinOS(t *testing.T) {
+	for _, goarch := range []string{"arm64", "amd64"} {
+		f, err := Open(buildDarwin(t, goarch))
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		// The Go linker records the oldest macOS the toolchain supports.
+		if got := f.Slices[0].MinOS(); !regexp.MustCompile(`^1\d\.\d+$`).MatchString(got) {
+			t.Errorf("%s MinOS = %q, want a version like 13.0", goarch, got)
+		}
+	}
+	f, err := NewFile(thinMachO(macho.CpuArm64, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Slices[0].MinOS(); got != "" {
+		t.Errorf("MinOS without a version load command = %q, want \"\"", got)
+	}
+	for v, want := range map[uint32]string{0x000b0000: "11.0", 0x000a0f07: "10.15.7", 0x000d0300: "13.3"} {
+		if got := formatVersion(v); got != want {
+			t.Errorf("formatVersion(%#x) = %q, want %q", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package codesig
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tmc/macgo/internal/plist"
+)
+
+// DER tags used by the entitlements encoding.
+const (
+	derBoolean     = 0x01
+	derInteger     = 0x02
+	derUTF8String  = 0x0c
+	derSequence    = 0x30
+	derDictionary  = 0xb0 // [CONTEXT 16] constructed
+	derEntitlement = 0x70 // [APPLICATION 16] constructed
+)
+
+// EntitlementsDER converts an XML entitlements plist into the DER form
+// macOS 12 and later require alongside the XML blob. Dictionaries are
+// written with their keys in sorted order.
+func EntitlementsDER(xml []byte) ([]byte, error) {
+	var ents map[string]any
+	if err := plist.Unmarshal(xml, &ents); err != nil {
+		return nil, fmt.Errorf("codesig: entitlements: %w", err)
+	}
+	dict, err := derValue(ents)
+	if err != nil {
+		return nil, fmt.Errorf("codesig: entitlements: %w", err)
+	}
+	version := derTLV(derInteger, []byte{1})
+	return derTLV(derEntitlement, append(version, dict...)), nil
+}
+
+func derValue(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return derTLV(derBoolean, []byte{0xff}), nil
+		}
+		return derTLV(derBoolean, []byte{0x00}), nil
+	case string:
+		return derTLV(derUTF8String, []byte(v)), nil
+	case int64:
+		n := minIntLen(v)
+		b := make([]byte, n)
+		for i := range b {
+			b[n-1-i] = byte(v >> (8 * i))
+		}
+		return derTLV(derInteger, b), nil
+	case uint64:
+		return derValue(int64(v))
+	case []any:
+		var body []byte
+		for _, elem := range v {
+			b, err := derValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			body = append(body, b...)
+		}
+		return derTLV(derSequence, body), nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var body []byte
+		for _, k := range keys {
+			val, err := derValue(v[k])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			body = append(body, derTLV(derSequence, append(derTLV(derUTF8String, []byte(k)), val...))...)
+		}
+		return derTLV(derDictionary, body), nil
+	default:
+		return nil, fmt.Errorf("unsupported entitlement value type %T", v)
+	}
+}
+
+// minIntLen returns the number of bytes in the minimal two's-complement
+// encoding of v.
+func minIntLen(v int64) int {
+	n := 1
+	for v > 127 || v < -128 {
+		v >>= 8
+		n++
+	}
+	return n
+}
+
+// derTLV encodes a tag, definite length and value.
+func derTLV(tag byte, value []byte) []byte {
+	b := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	case n <= 0xffffff:
+		b = append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, value...)
+}
@@ -0,0 +1,76 @@
+package codesig
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+)
+
+// fatHeaderSize and fatArchSize are the sizes of fat_header and fat_arch.
+const (
+	fatHeaderSize = 8
+	fatArchSize   = 20
+)
+
+// FatArch is one architecture of a universal binary being assembled.
+type FatArch struct {
+	Cpu    macho.Cpu
+	SubCpu uint32
+
+	// Align is the slice alignment as a power of two. Zero selects the
+	// conventional alignment for Cpu.
+	Align uint32
+
+	// Data is the thin Mach-O image.
+	Data []byte
+}
+
+// BuildFat assembles thin Mach-O images into a universal binary, in the
+// order given.
+func BuildFat(arches []FatArch) ([]byte, error) {
+	if len(arches) == 0 {
+		return nil, fmt.Errorf("codesig: no architectures")
+	}
+	be := binary.BigEndian
+	header := be.AppendUint32(nil, macho.MagicFat)
+	header = be.AppendUint32(header, uint32(len(arches)))
+
+	offset := uint64(fatHeaderSize + fatArchSize*len(arches))
+	offsets := make([]uint64, len(arches))
+	for i, a := range arches {
+		align := a.Align
+		if align == 0 {
+			align = defaultFatAlign(a.Cpu)
+		}
+		if align > 30 {
+			return nil, fmt.Errorf("codesig: %s: alignment 2^%d out of range", ArchName(a.Cpu, a.SubCpu), align)
+		}
+		mask := uint64(1)<<align - 1
+		offset = (offset + mask) &^ mask
+		offsets[i] = offset
+		if offset+uint64(len(a.Data)) > 1<<32-1 {
+			return nil, fmt.Errorf("codesig: universal binary exceeds 4 GiB")
+		}
+		header = be.AppendUint32(header, uint32(a.Cpu))
+		header = be.AppendUint32(header, a.SubCpu)
+		header = be.AppendUint32(header, uint32(offset))
+		header = be.AppendUint32(header, uint32(len(a.Data)))
+		header = be.AppendUint32(header, align)
+		offset += uint64(len(a.Data))
+	}
+
+	out := make([]byte, offset)
+	copy(out, header)
+	for i, a := range arches {
+		copy(out[offsets[i]:], a.Data)
+	}
+	return out, nil
+}
+
+// defaultFatAlign returns the alignment lipo uses for a CPU type.
+func defaultFatAlign(cpu macho.Cpu) uint32 {
+	if cpu == macho.CpuArm64 {
+		return 14
+	}
+	return 12
+}
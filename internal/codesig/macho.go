@@ -0,0 +1,210 @@
+package codesig
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// loadCmdCodeSignature is LC_CODE_SIGNATURE, which debug/macho does not name.
+const loadCmdCodeSignature macho.LoadCmd = 0x1d
+
+// Load commands recording the minimum OS version, which debug/macho does
+// not name either.
+const (
+	loadCmdVersionMinMacOSX macho.LoadCmd = 0x24
+	loadCmdBuildVersion     macho.LoadCmd = 0x32
+)
+
+// platformMacOS is the LC_BUILD_VERSION platform of macOS binaries.
+const platformMacOS = 1
+
+// cpuSubtypeMask strips the capability bits from a CPU subtype.
+const cpuSubtypeMask = 0x00ffffff
+
+// cpuSubtypeARM64E is the arm64e CPU subtype.
+const cpuSubtypeARM64E = 2
+
+// File is a thin or universal Mach-O file.
+type File struct {
+	// Fat reports whether the file is a universal binary.
+	Fat bool
+
+	// Slices holds one entry per architecture; a thin file has one.
+	Slices []*Slice
+}
+
+// Slice is a single-architecture Mach-O image within a File.
+type Slice struct {
+	Cpu    macho.Cpu
+	SubCpu uint32
+
+	// Offset is the position of the slice within the file. Data holds the
+	// slice contents.
+	Offset int64
+	Data   []byte
+
+	// File is the parsed Mach-O header and load commands of the slice.
+	File *macho.File
+
+	// SignatureOffset and SignatureSize are the LC_CODE_SIGNATURE data
+	// range, relative to the start of the slice. Both are zero if the
+	// slice has no code signature load command.
+	SignatureOffset uint32
+	SignatureSize   uint32
+
+	// Signature is the parsed code signature, or nil if unsigned.
+	Signature *Signature
+}
+
+// Arch returns the architecture name used by codesign and lipo.
+func (s *Slice) Arch() string {
+	return ArchName(s.Cpu, s.SubCpu)
+}
+
+// ArchName returns the conventional name for a CPU type and subtype.
+func ArchName(cpu macho.Cpu, subCpu uint32) string {
+	switch cpu {
+	case macho.CpuArm64:
+		if subCpu&cpuSubtypeMask == cpuSubtypeARM64E {
+			return "arm64e"
+		}
+		return "arm64"
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.Cpu386:
+		return "i386"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuPpc:
+		return "ppc"
+	case macho.CpuPpc64:
+		return "ppc64"
+	default:
+		return cpu.String()
+	}
+}
+
+// MinOS returns the minimum macOS version the slice was built for, such
+// as "11.0", from its LC_BUILD_VERSION or LC_VERSION_MIN_MACOSX load
+// command. It returns "" if the slice records none.
+func (s *Slice) MinOS() string {
+	bo := s.File.ByteOrder
+	for _, l := range s.File.Loads {
+		raw := l.Raw()
+		if len(raw) < 16 {
+			continue
+		}
+		switch macho.LoadCmd(bo.Uint32(raw)) {
+		case loadCmdBuildVersion:
+			if bo.Uint32(raw[8:]) == platformMacOS {
+				return formatVersion(bo.Uint32(raw[12:]))
+			}
+		case loadCmdVersionMinMacOSX:
+			return formatVersion(bo.Uint32(raw[8:]))
+		}
+	}
+	return ""
+}
+
+// formatVersion formats a version encoded as xxxx.yy.zz in nibbles,
+// omitting a zero patch version.
+func formatVersion(v uint32) string {
+	if v&0xff != 0 {
+		return fmt.Sprintf("%d.%d.%d", v>>16, v>>8&0xff, v&0xff)
+	}
+	return fmt.Sprintf("%d.%d", v>>16, v>>8&0xff)
+}
+
+// Slice returns the slice for the named architecture, or nil.
+func (f *File) Slice(arch string) *Slice {
+	for _, s := range f.Slices {
+		if s.Arch() == arch {
+			return s
+		}
+	}
+	return nil
+}
+
+// Archs returns the architecture names of the slices in file order.
+func (f *File) Archs() []string {
+	archs := make([]string, len(f.Slices))
+	for i, s := range f.Slices {
+		archs[i] = s.Arch()
+	}
+	return archs
+}
+
+// Open reads and parses the Mach-O file at path.
+func Open(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFile(data)
+}
+
+// NewFile parses a thin or universal Mach-O image held in data.
+// Slices share memory with data.
+func NewFile(data []byte) (*File, error) {
+	if len(data) >= 4 && binary.BigEndian.Uint32(data) == macho.MagicFat {
+		fat, err := macho.NewFatFile(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("codesig: %w", err)
+		}
+		f := &File{Fat: true}
+		for _, arch := range fat.Arches {
+			end := uint64(arch.Offset) + uint64(arch.Size)
+			if end > uint64(len(data)) {
+				return nil, fmt.Errorf("codesig: %s slice out of range", ArchName(arch.Cpu, arch.SubCpu))
+			}
+			s, err := newSlice(data[arch.Offset:end], int64(arch.Offset))
+			if err != nil {
+				return nil, err
+			}
+			f.Slices = append(f.Slices, s)
+		}
+		return f, nil
+	}
+
+	s, err := newSlice(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Slices: []*Slice{s}}, nil
+}
+
+func newSlice(data []byte, offset int64) (*Slice, error) {
+	mf, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("codesig: %w", err)
+	}
+	s := &Slice{
+		Cpu:    mf.Cpu,
+		SubCpu: mf.SubCpu,
+		Offset: offset,
+		Data:   data,
+		File:   mf,
+	}
+	for _, l := range mf.Loads {
+		raw := l.Raw()
+		if len(raw) < 16 || macho.LoadCmd(mf.ByteOrder.Uint32(raw)) != loadCmdCodeSignature {
+			continue
+		}
+		s.SignatureOffset = mf.ByteOrder.Uint32(raw[8:])
+		s.SignatureSize = mf.ByteOrder.Uint32(raw[12:])
+		end := uint64(s.SignatureOffset) + uint64(s.SignatureSize)
+		if end > uint64(len(data)) {
+			return nil, fmt.Errorf("codesig: %s: code signature out of range", s.Arch())
+		}
+		sig, err := Parse(data[s.SignatureOffset:end])
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, s.Arch())
+		}
+		s.Signature = sig
+		break
+	}
+	return s, nil
+}
@@ -0,0 +1,47 @@
+package codesig
+
+import (
+	"fmt"
+
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/csreq"
+)
+
+// RequirementSet parses the internal requirements blob. It is empty when
+// the signature has none.
+func (s *Signature) RequirementSet() (csreq.Set, error) {
+	if len(s.Requirements) == 0 {
+		return csreq.Set{}, nil
+	}
+	return csreq.UnmarshalSet(s.Requirements)
+}
+
+// DesignatedRequirement returns the signature's designated requirement.
+// This is the explicit one from the internal requirements when present;
+// otherwise it is the implicit requirement codesign derives, which pins
+// the CDHash for ad-hoc signatures and the certificate chain for others.
+// explicit reports which.
+func (s *Signature) DesignatedRequirement() (r *csreq.Requirement, explicit bool, err error) {
+	set, err := s.RequirementSet()
+	if err != nil {
+		return nil, false, err
+	}
+	if r := set[csreq.DesignatedRequirement]; r != nil {
+		return r, true, nil
+	}
+	cd := s.CodeDirectory()
+	if cd == nil {
+		return nil, false, fmt.Errorf("codesig: signature has no CodeDirectory")
+	}
+	if len(s.CMS) == 0 {
+		return csreq.AdHoc(cd.CDHash()), false, nil
+	}
+	sd, err := cms.Parse(s.CMS)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(sd.Signers) == 0 {
+		return nil, false, fmt.Errorf("codesig: CMS signature has no signers")
+	}
+	return csreq.Designated(cd.Identifier, sd.Chain(sd.Signers[0])), false, nil
+}
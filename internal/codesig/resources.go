@@ -0,0 +1,286 @@
+package codesig
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tmc/macgo/internal/plist"
+)
+
+// CodeResourcesPath is the location of the resource seal within a bundle's
+// Contents directory.
+const CodeResourcesPath = "_CodeSignature/CodeResources"
+
+// TicketPath is where a stapled notarization ticket is written within a
+// bundle's Contents directory. It is added after signing, so it is never
+// sealed.
+const TicketPath = "CodeResources"
+
+// rule is a resource rule from CodeResources. A plain rule is written as
+// <true/>; anything else as a dictionary.
+type rule struct {
+	pattern  string
+	weight   int
+	omit     bool
+	optional bool
+	nested   bool
+	re       *regexp.Regexp
+}
+
+func (r rule) plist() any {
+	if r.weight == 0 && !r.omit && !r.optional && !r.nested {
+		return true
+	}
+	d := map[string]any{}
+	if r.weight != 0 {
+		d["weight"] = float64(r.weight)
+	}
+	if r.omit {
+		d["omit"] = true
+	}
+	if r.optional {
+		d["optional"] = true
+	}
+	if r.nested {
+		d["nested"] = true
+	}
+	return d
+}
+
+// Default resource rules written by codesign for application bundles.
+var (
+	rulesV1 = compileRules([]rule{
+		{pattern: `^Resources/`},
+		{pattern: `^Resources/.*\.lproj/`, optional: true, weight: 1000},
+		{pattern: `^Resources/.*\.lproj/locversion.plist$`, omit: true, weight: 1100},
+		{pattern: `^Resources/Base\.lproj/`, weight: 1010},
+		{pattern: `^version.plist$`},
+	})
+	rulesV2 = compileRules([]rule{
+		{pattern: `.*\.dSYM($|/)`, weight: 11},
+		{pattern: `^(.*/)?\.DS_Store$`, omit: true, weight: 2000},
+		{pattern: `^(Frameworks|SharedFrameworks|PlugIns|Plug-ins|XPCServices|Helpers|MacOS|Library/(Automator|Spotlight|LoginItems))/`, nested: true, weight: 10},
+		{pattern: `^.*`},
+		{pattern: `^Info\.plist$`, omit: true, weight: 20},
+		{pattern: `^PkgInfo$`, omit: true, weight: 20},
+		{pattern: `^Resources/`, weight: 20},
+		{pattern: `^Resources/.*\.lproj/`, optional: true, weight: 1000},
+		{pattern: `^Resources/.*\.lproj/locversion.plist$`, omit: true, weight: 1100},
+		{pattern: `^Resources/Base\.lproj/`, weight: 1010},
+		{pattern: `^[^/]+$`, nested: true, weight: 10},
+		{pattern: `^embedded\.provisionprofile$`, weight: 20},
+		{pattern: `^version\.plist$`, weight: 20},
+	})
+)
+
+func compileRules(rules []rule) []rule {
+	for i := range rules {
+		rules[i].re = regexp.MustCompile(rules[i].pattern)
+	}
+	return rules
+}
+
+// match returns the highest-weight rule matching path, if any. Rules
+// without an explicit weight have weight 1.
+func match(rules []rule, path string) (rule, bool) {
+	var best rule
+	found := false
+	for _, r := range rules {
+		if !r.re.MatchString(path) {
+			continue
+		}
+		if !found || max(r.weight, 1) > max(best.weight, 1) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+func rulesPlist(rules []rule) map[string]any {
+	d := make(map[string]any, len(rules))
+	for _, r := range rules {
+		d[r.pattern] = r.plist()
+	}
+	return d
+}
+
+// SealResources returns the CodeResources plist sealing the files in a
+// bundle's Contents directory. The main executable (given relative to
+// Contents) is excluded, as it carries the signature itself.
+//
+// Nested code locations such as Contents/MacOS must contain only signed
+// Mach-O files or signed bundles, such as XPC services; they are recorded
+// by CDHash rather than file hash.
+func SealResources(contentsDir, mainExecutable string) ([]byte, error) {
+	files := map[string]any{}
+	files2 := map[string]any{}
+
+	err := filepath.WalkDir(contentsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contentsDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == "_CodeSignature" {
+				return filepath.SkipDir
+			}
+			if isNestedBundle(contentsDir, rel) {
+				exe, _, err := MainExecutable(path)
+				if err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				data, err := os.ReadFile(exe)
+				if err != nil {
+					return err
+				}
+				entry, err := nestedEntry(rel, data)
+				if err != nil {
+					return err
+				}
+				files2[rel] = entry
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel == mainExecutable || rel == TicketPath {
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if r, ok := match(rulesV2, rel); ok && !r.omit {
+				files2[rel] = map[string]any{"symlink": target}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s: unsupported file type %v", rel, d.Type())
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum1 := sha1.Sum(data)
+		sum256 := sha256.Sum256(data)
+
+		if r, ok := match(rulesV1, rel); ok && !r.omit {
+			if r.optional {
+				files[rel] = map[string]any{"hash": sum1[:], "optional": true}
+			} else {
+				files[rel] = sum1[:]
+			}
+		}
+
+		r, ok := match(rulesV2, rel)
+		if !ok || r.omit {
+			return nil
+		}
+		if r.nested {
+			entry, err := nestedEntry(rel, data)
+			if err != nil {
+				return err
+			}
+			files2[rel] = entry
+			return nil
+		}
+		entry := map[string]any{"hash": sum1[:], "hash2": sum256[:]}
+		if r.optional {
+			entry["optional"] = true
+		}
+		files2[rel] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("codesig: seal resources: %w", err)
+	}
+
+	return plist.Marshal(map[string]any{
+		"files":  files,
+		"files2": files2,
+		"rules":  rulesPlist(rulesV1),
+		"rules2": rulesPlist(rulesV2),
+	})
+}
+
+// isNestedBundle reports whether the directory rel, relative to
+// contentsDir, is a bundle in a nested code location, such as
+// XPCServices/Service.xpc. Such bundles are sealed as a unit.
+func isNestedBundle(contentsDir, rel string) bool {
+	if r, ok := match(rulesV2, rel); !ok || !r.nested || !strings.Contains(rel, "/") {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(contentsDir, filepath.FromSlash(rel), "Contents", "Info.plist"))
+	return err == nil
+}
+
+// nestedEntry returns the files2 entry for signed code at rel.
+func nestedEntry(rel string, data []byte) (map[string]any, error) {
+	f, err := NewFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: nested code is not Mach-O: %w", rel, ErrNotSigned)
+	}
+	var cdhash []byte
+	for _, s := range f.Slices {
+		if s.Signature == nil {
+			return nil, fmt.Errorf("%s (%s): %w", rel, s.Arch(), ErrNotSigned)
+		}
+		if cdhash == nil {
+			cdhash = s.Signature.CodeDirectory().CDHash()[:20]
+		}
+	}
+	return map[string]any{
+		"cdhash":      cdhash,
+		"requirement": fmt.Sprintf("cdhash H\"%s\"", hex.EncodeToString(cdhash)),
+	}, nil
+}
+
+// SignBundle signs an application bundle: it seals the bundle's
+// resources into Contents/_CodeSignature/CodeResources and signs the main
+// executable, binding Info.plist and the resource seal into its signature.
+// Nested code must already be signed.
+func SignBundle(bundlePath string, opts SignOptions) error {
+	exe, _, err := MainExecutable(bundlePath)
+	if err != nil {
+		return err
+	}
+	contentsDir := filepath.Join(bundlePath, "Contents")
+	mainRel, err := filepath.Rel(contentsDir, exe)
+	if err != nil {
+		return err
+	}
+
+	resources, err := SealResources(contentsDir, filepath.ToSlash(mainRel))
+	if err != nil {
+		return err
+	}
+	sealPath := filepath.Join(contentsDir, filepath.FromSlash(CodeResourcesPath))
+	if err := os.MkdirAll(filepath.Dir(sealPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(sealPath, resources, 0644); err != nil {
+		return err
+	}
+
+	info, err := os.ReadFile(filepath.Join(contentsDir, "Info.plist"))
+	if err != nil {
+		return err
+	}
+	opts.InfoPlist = info
+	opts.CodeResources = resources
+	return SignFile(exe, opts)
+}
@@ -0,0 +1,68 @@
+package codesig
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// ErrNotMachO is returned by UseBuiltin when the built-in signer is
+// selected for code that is not a Mach-O executable.
+var ErrNotMachO = errors.New("codesig: not a Mach-O executable")
+
+// UseBuiltin reports whether the bundle or executable at path is signed
+// by this package rather than by Apple's codesign tool. signer is the
+// selection: "builtin" always chooses this package, "codesign" never
+// does, and "" chooses it when codesign is not installed. This package
+// signs only Mach-O code, so when it is chosen and the executable is not
+// Mach-O, UseBuiltin returns an error wrapping ErrNotMachO.
+func UseBuiltin(signer, path string) (bool, error) {
+	switch signer {
+	case "builtin":
+	case "":
+		if _, err := exec.LookPath("codesign"); err == nil {
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+	exe := path
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		if exe, _, err = MainExecutable(path); err != nil {
+			return false, err
+		}
+	}
+	ok, err := isMachO(exe)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("%s: %w", exe, ErrNotMachO)
+	}
+	return true, nil
+}
+
+// isMachO reports whether the file at path starts with a thin or
+// universal Mach-O magic number.
+func isMachO(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	switch binary.LittleEndian.Uint32(magic[:]) {
+	case 0xfeedface, 0xfeedfacf, 0xbebafeca:
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,526 @@
+package codesig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"debug/macho"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/csreq"
+	"github.com/tmc/macgo/internal/plist"
+)
+
+// PageSize is the code page size hashed by the signer.
+const PageSize = 4096
+
+const (
+	pageSizeLog2 = 12
+
+	// cdVersion is the CodeDirectory version written by the signer. It
+	// carries the team ID, 64-bit code limit and executable segment fields.
+	cdVersion = cdVersionExecSeg
+
+	// cdHeaderSizeExecSeg is the fixed header size of a version 0x20400
+	// CodeDirectory.
+	cdHeaderSizeExecSeg = 88
+
+	// execSegMainBinary marks the executable segment of a main executable.
+	execSegMainBinary = 0x1
+	// execSegAllowUnsigned is set for binaries with get-task-allow.
+	execSegAllowUnsigned = 0x10
+)
+
+// SignOptions configures a signature.
+type SignOptions struct {
+	// Identifier is the signing identifier, usually the bundle ID.
+	Identifier string
+
+	// TeamID is recorded in the CodeDirectory when set.
+	TeamID string
+
+	// Flags are additional CodeDirectory flags such as FlagRuntime.
+	// FlagAdhoc is set for ad-hoc signatures.
+	Flags Flags
+
+	// Entitlements is an XML entitlements plist. Both the XML and the DER
+	// entitlements blobs are embedded when it is non-empty.
+	Entitlements []byte
+
+	// InfoPlist and CodeResources are the bundle's Info.plist and
+	// _CodeSignature/CodeResources contents, bound into special slots.
+	// Both are nil when signing a bare executable.
+	InfoPlist     []byte
+	CodeResources []byte
+
+	// Requirements is a compiled internal requirements blob. When nil,
+	// signatures made with Key embed the designated requirement codesign
+	// would derive for Certificate and Chain, and ad-hoc signatures get an
+	// empty requirement set.
+	Requirements []byte
+
+	// Key signs the CodeDirectory with a CMS signature for Certificate,
+	// which is embedded together with Chain. The signature is ad-hoc when
+	// Key is nil.
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+
+	// SigningTime is the CMS signing time. Defaults to the current time.
+	SigningTime time.Time
+
+	// Timestamp, if set, is called with each CMS signature value and
+	// returns an RFC 3161 time-stamp token over it, which is embedded as
+	// an unsigned attribute. It may return a nil token to sign without
+	// one. See the tsp package.
+	Timestamp func(signature []byte) ([]byte, error)
+}
+
+// timestampReserve is the space reserved for a time-stamp token, which
+// carries the authority's certificates.
+const timestampReserve = 16 << 10
+
+// adhoc reports whether opts describe an ad-hoc signature.
+func (opts SignOptions) adhoc() bool { return opts.Key == nil }
+
+// cdFlags returns the CodeDirectory flags for opts.
+func (opts SignOptions) cdFlags() Flags {
+	if opts.adhoc() {
+		return opts.Flags | FlagAdhoc
+	}
+	return opts.Flags &^ FlagAdhoc
+}
+
+// cmsReserve returns the space reserved for the CMS signature. The
+// signature's size is only known once the CodeDirectory it covers has been
+// hashed, and the CodeDirectory records the size of the signature, so the
+// signer reserves room for the certificates plus a generous allowance for
+// the signer info and padding.
+func (opts SignOptions) cmsReserve() int {
+	if opts.adhoc() {
+		return 0
+	}
+	n := 2048 + len(opts.Certificate.Raw) + len(opts.Certificate.RawIssuer)
+	for _, c := range opts.Chain {
+		n += len(c.Raw)
+	}
+	if opts.Timestamp != nil {
+		n += timestampReserve
+	}
+	return n
+}
+
+// Sign returns a copy of the thin or universal Mach-O image in data with
+// a signature built from opts: ad-hoc, or CMS-signed when opts.Key is set.
+// Any existing signature is replaced.
+func Sign(data []byte, opts SignOptions) ([]byte, error) {
+	if opts.Identifier == "" {
+		return nil, fmt.Errorf("codesig: signing identifier is required")
+	}
+	if opts.Key != nil && opts.Certificate == nil {
+		return nil, fmt.Errorf("codesig: signing key given without a certificate")
+	}
+	if opts.Key != nil && opts.SigningTime.IsZero() {
+		// All slices of a universal binary share one signing time.
+		opts.SigningTime = time.Now()
+	}
+	f, err := NewFile(data)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := opts.blobs()
+	if err != nil {
+		return nil, err
+	}
+
+	signed := make([][]byte, len(f.Slices))
+	for i, s := range f.Slices {
+		if signed[i], err = signSlice(s, opts, blobs); err != nil {
+			return nil, fmt.Errorf("codesig: %s: %w", s.Arch(), err)
+		}
+	}
+	if !f.Fat {
+		return signed[0], nil
+	}
+
+	fat, err := macho.NewFatFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("codesig: %w", err)
+	}
+	arches := make([]FatArch, len(signed))
+	for i, a := range fat.Arches {
+		arches[i] = FatArch{Cpu: a.Cpu, SubCpu: a.SubCpu, Align: a.Align, Data: signed[i]}
+	}
+	return BuildFat(arches)
+}
+
+// SignFile signs the Mach-O file at path in place. The signed file is
+// written next to the original and renamed over it, so a running copy of
+// the old executable is not disturbed.
+func SignFile(path string, opts SignOptions) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	signed, err := Sign(data, opts)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".sign-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(signed); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// signatureBlobs holds the architecture-independent parts of a signature.
+type signatureBlobs struct {
+	requirements    []byte
+	entitlements    []byte
+	entitlementsDER []byte
+	special         [][]byte // special slot hashes, index i is slot -(i+1)
+	allowUnsigned   bool
+}
+
+func (opts SignOptions) blobs() (*signatureBlobs, error) {
+	b := &signatureBlobs{requirements: opts.Requirements}
+	if b.requirements == nil {
+		set := csreq.Set{}
+		if !opts.adhoc() {
+			chain := append([]*x509.Certificate{opts.Certificate}, opts.Chain...)
+			set[csreq.DesignatedRequirement] = csreq.Designated(opts.Identifier, chain)
+		}
+		var err error
+		if b.requirements, err = set.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.Entitlements) > 0 {
+		der, err := EntitlementsDER(opts.Entitlements)
+		if err != nil {
+			return nil, err
+		}
+		b.entitlements = blob(MagicEmbeddedEntitlements, opts.Entitlements)
+		b.entitlementsDER = blob(MagicEmbeddedDEREntitlements, der)
+
+		var ents map[string]any
+		if err := plist.Unmarshal(opts.Entitlements, &ents); err == nil {
+			b.allowUnsigned, _ = ents["com.apple.security.get-task-allow"].(bool)
+		}
+	}
+
+	hashes := map[int][]byte{
+		SlotInfo:            opts.InfoPlist,
+		SlotRequirements:    b.requirements,
+		SlotResourceDir:     opts.CodeResources,
+		SlotEntitlements:    b.entitlements,
+		SlotDEREntitlements: b.entitlementsDER,
+	}
+	n := 0
+	for slot, data := range hashes {
+		if data != nil && slot > n {
+			n = slot
+		}
+	}
+	b.special = make([][]byte, n)
+	for i := range b.special {
+		if data := hashes[i+1]; data != nil {
+			sum := sha256.Sum256(data)
+			b.special[i] = sum[:]
+		} else {
+			b.special[i] = make([]byte, sha256.Size)
+		}
+	}
+	return b, nil
+}
+
+// blob returns a blob with the given magic and payload.
+func blob(magic uint32, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, magic)
+	b = binary.BigEndian.AppendUint32(b, uint32(8+len(payload)))
+	return append(b, payload...)
+}
+
+// loadCommand locates a load command within the Mach-O header.
+type loadCommand struct {
+	offset int // offset of the command within the slice
+	raw    []byte
+}
+
+// signSlice returns a signed copy of a single-architecture image.
+func signSlice(s *Slice, opts SignOptions, b *signatureBlobs) ([]byte, error) {
+	mf := s.File
+	bo := mf.ByteOrder
+	is64 := mf.Magic == macho.Magic64
+	headerSize := 28
+	if is64 {
+		headerSize = 32
+	}
+
+	var sigCmd, linkedit *loadCommand
+	var text *macho.Segment
+	firstData := uint64(len(s.Data))
+	offset := headerSize
+	for _, l := range mf.Loads {
+		raw := l.Raw()
+		lc := &loadCommand{offset: offset, raw: raw}
+		switch cmd := macho.LoadCmd(bo.Uint32(raw)); {
+		case cmd == loadCmdCodeSignature:
+			sigCmd = lc
+		case cmd == macho.LoadCmdSegment || cmd == macho.LoadCmdSegment64:
+			seg := l.(*macho.Segment)
+			if seg.Name == "__LINKEDIT" {
+				linkedit = lc
+			}
+			if seg.Name == "__TEXT" {
+				text = seg
+			}
+		}
+		offset += len(raw)
+	}
+	for _, sec := range mf.Sections {
+		if sec.Offset != 0 && uint64(sec.Offset) < firstData {
+			firstData = uint64(sec.Offset)
+		}
+	}
+	if linkedit == nil {
+		return nil, fmt.Errorf("no __LINKEDIT segment")
+	}
+	linkSeg := mf.Segment("__LINKEDIT")
+
+	// The signature goes at the end of __LINKEDIT, replacing any existing one.
+	codeLimit := linkSeg.Offset + linkSeg.Filesz
+	if sigCmd != nil {
+		codeLimit = uint64(s.SignatureOffset)
+	}
+	codeLimit = (codeLimit + 15) &^ 15
+	if codeLimit < linkSeg.Offset || codeLimit > uint64(len(s.Data))+15 {
+		return nil, fmt.Errorf("__LINKEDIT out of range")
+	}
+	if codeLimit > 1<<32-1 {
+		return nil, fmt.Errorf("image too large to sign")
+	}
+
+	out := make([]byte, codeLimit)
+	copy(out, s.Data)
+
+	// Add LC_CODE_SIGNATURE if needed, in the padding after the load commands.
+	if sigCmd == nil {
+		ncmds := bo.Uint32(out[16:])
+		sizeofcmds := bo.Uint32(out[20:])
+		end := uint64(headerSize) + uint64(sizeofcmds)
+		if end+16 > firstData {
+			return nil, fmt.Errorf("no room for LC_CODE_SIGNATURE load command")
+		}
+		bo.PutUint32(out[end:], uint32(loadCmdCodeSignature))
+		bo.PutUint32(out[end+4:], 16)
+		bo.PutUint32(out[16:], ncmds+1)
+		bo.PutUint32(out[20:], sizeofcmds+16)
+		sigCmd = &loadCommand{offset: int(end)}
+	}
+
+	nCode := (int(codeLimit) + PageSize - 1) / PageSize
+	var execSegBase, execSegLimit, execSegFlags uint64
+	if text != nil {
+		execSegBase, execSegLimit = text.Offset, text.Filesz
+	}
+	if mf.Type == macho.TypeExec {
+		execSegFlags |= execSegMainBinary
+	}
+	if b.allowUnsigned {
+		execSegFlags |= execSegAllowUnsigned
+	}
+	cdSize := cdHeaderSizeExecSeg + len(opts.Identifier) + 1 + (len(b.special)+nCode)*sha256.Size
+	if opts.TeamID != "" {
+		cdSize += len(opts.TeamID) + 1
+	}
+
+	type slotBlob struct {
+		slot uint32
+		size int
+	}
+	slots := []slotBlob{{SlotCodeDirectory, cdSize}, {SlotRequirements, len(b.requirements)}}
+	if b.entitlements != nil {
+		slots = append(slots, slotBlob{SlotEntitlements, len(b.entitlements)}, slotBlob{SlotDEREntitlements, len(b.entitlementsDER)})
+	}
+	slots = append(slots, slotBlob{SlotSignature, 8 + opts.cmsReserve()})
+	sigSize := 12 + 8*len(slots)
+	for _, sb := range slots {
+		sigSize += sb.size
+	}
+	dataSize := (sigSize + 15) &^ 15
+
+	// Point LC_CODE_SIGNATURE at the new signature and grow __LINKEDIT to
+	// cover it. Both are hashed into the first page, so this happens first.
+	bo.PutUint32(out[sigCmd.offset+8:], uint32(codeLimit))
+	bo.PutUint32(out[sigCmd.offset+12:], uint32(dataSize))
+	fileSize := codeLimit + uint64(dataSize) - linkSeg.Offset
+	vmSize := (fileSize + segmentAlign(mf.Cpu) - 1) &^ (segmentAlign(mf.Cpu) - 1)
+	if is64 {
+		bo.PutUint64(out[linkedit.offset+32:], vmSize)
+		bo.PutUint64(out[linkedit.offset+48:], fileSize)
+	} else {
+		bo.PutUint32(out[linkedit.offset+28:], uint32(vmSize))
+		bo.PutUint32(out[linkedit.offset+36:], uint32(fileSize))
+	}
+
+	cd := buildCodeDirectory(out, opts, b.special, execSegBase, execSegLimit, execSegFlags)
+	if len(cd) != cdSize {
+		return nil, fmt.Errorf("internal error: CodeDirectory size %d, want %d", len(cd), cdSize)
+	}
+
+	var signature []byte
+	if !opts.adhoc() {
+		var err error
+		if signature, err = signCodeDirectory(cd, opts); err != nil {
+			return nil, err
+		}
+		if len(signature) > opts.cmsReserve() {
+			return nil, fmt.Errorf("internal error: CMS signature is %d bytes, reserved %d", len(signature), opts.cmsReserve())
+		}
+		// The rest of the reservation stays as zero padding after the
+		// SuperBlob.
+		sigSize += len(signature) - opts.cmsReserve()
+		slots[len(slots)-1].size = 8 + len(signature)
+	}
+	blobs := map[uint32][]byte{
+		SlotCodeDirectory:   cd,
+		SlotRequirements:    b.requirements,
+		SlotEntitlements:    b.entitlements,
+		SlotDEREntitlements: b.entitlementsDER,
+		SlotSignature:       blob(MagicBlobWrapper, signature),
+	}
+	sig := binary.BigEndian.AppendUint32(nil, MagicEmbeddedSignature)
+	sig = binary.BigEndian.AppendUint32(sig, uint32(sigSize))
+	sig = binary.BigEndian.AppendUint32(sig, uint32(len(slots)))
+	blobOffset := 12 + 8*len(slots)
+	for _, sb := range slots {
+		sig = binary.BigEndian.AppendUint32(sig, sb.slot)
+		sig = binary.BigEndian.AppendUint32(sig, uint32(blobOffset))
+		blobOffset += sb.size
+	}
+	for _, sb := range slots {
+		sig = append(sig, blobs[sb.slot]...)
+	}
+	sig = append(sig, make([]byte, dataSize-sigSize)...)
+	return append(out, sig...), nil
+}
+
+// buildCodeDirectory hashes code and returns a CodeDirectory blob.
+func buildCodeDirectory(code []byte, opts SignOptions, special [][]byte, execSegBase, execSegLimit, execSegFlags uint64) []byte {
+	identOffset := cdHeaderSizeExecSeg
+	teamOffset := 0
+	hashOffset := identOffset + len(opts.Identifier) + 1
+	if opts.TeamID != "" {
+		teamOffset = hashOffset
+		hashOffset += len(opts.TeamID) + 1
+	}
+	hashOffset += len(special) * sha256.Size
+	nCode := (len(code) + PageSize - 1) / PageSize
+
+	be := binary.BigEndian
+	cd := make([]byte, 0, hashOffset+nCode*sha256.Size)
+	cd = be.AppendUint32(cd, MagicCodeDirectory)
+	cd = be.AppendUint32(cd, uint32(hashOffset+nCode*sha256.Size))
+	cd = be.AppendUint32(cd, cdVersion)
+	cd = be.AppendUint32(cd, uint32(opts.cdFlags()))
+	cd = be.AppendUint32(cd, uint32(hashOffset))
+	cd = be.AppendUint32(cd, uint32(identOffset))
+	cd = be.AppendUint32(cd, uint32(len(special)))
+	cd = be.AppendUint32(cd, uint32(nCode))
+	cd = be.AppendUint32(cd, uint32(len(code))) // codeLimit
+	cd = append(cd, sha256.Size, byte(HashSHA256), 0, pageSizeLog2)
+	cd = be.AppendUint32(cd, 0) // spare2
+	cd = be.AppendUint32(cd, 0) // scatterOffset
+	cd = be.AppendUint32(cd, uint32(teamOffset))
+	cd = be.AppendUint32(cd, 0) // spare3
+	cd = be.AppendUint64(cd, 0) // codeLimit64, unused below 4 GiB
+	cd = be.AppendUint64(cd, execSegBase)
+	cd = be.AppendUint64(cd, execSegLimit)
+	cd = be.AppendUint64(cd, execSegFlags)
+
+	cd = append(cd, opts.Identifier...)
+	cd = append(cd, 0)
+	if opts.TeamID != "" {
+		cd = append(cd, opts.TeamID...)
+		cd = append(cd, 0)
+	}
+	for i := len(special) - 1; i >= 0; i-- {
+		cd = append(cd, special[i]...)
+	}
+	for off := 0; off < len(code); off += PageSize {
+		sum := sha256.Sum256(code[off:min(off+PageSize, len(code))])
+		cd = append(cd, sum[:]...)
+	}
+	return cd
+}
+
+// Signed attributes Apple adds to code signatures, listing the CDHashes of
+// the signed CodeDirectories.
+var (
+	oidCDHashesPlist = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 1}
+	oidCDHashes2     = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 2}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// signCodeDirectory returns a detached CMS signature over a CodeDirectory,
+// carrying its CDHash in both of the forms codesign writes.
+func signCodeDirectory(cd []byte, opts SignOptions) ([]byte, error) {
+	sum := sha256.Sum256(cd)
+	hashes, err := plist.Marshal(map[string]any{"cdhashes": [][]byte{sum[:20]}})
+	if err != nil {
+		return nil, fmt.Errorf("codesig: %w", err)
+	}
+	plistAttr, err := cms.NewAttribute(oidCDHashesPlist, hashes)
+	if err != nil {
+		return nil, err
+	}
+	hashes2, err := cms.NewAttribute(oidCDHashes2, struct {
+		Algorithm asn1.ObjectIdentifier
+		Digest    []byte
+	}{oidSHA256, sum[:]})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := cms.SignDetached(cd, opts.Certificate, opts.Key, cms.SignOptions{
+		Time:        opts.SigningTime,
+		Chain:       opts.Chain,
+		SignedAttrs: []cms.Attribute{plistAttr, hashes2},
+		Timestamp:   opts.Timestamp,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("codesig: %w", err)
+	}
+	return sig, nil
+}
+
+// segmentAlign returns the VM page size segments are rounded to.
+func segmentAlign(cpu macho.Cpu) uint64 {
+	if cpu == macho.CpuArm64 {
+		return 0x4000
+	}
+	return 0x1000
+}
@@ -0,0 +1,578 @@
+package codesig
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/plist"
+	"github.com/tmc/macgo/internal/testcert"
+	"github.com/tmc/macgo/internal/tsp"
+)
+
+const testEntitlementsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>com.apple.security.get-task-allow</key>
+	<true/>
+	<key>com.apple.security.device.camera</key>
+	<true/>
+</dict>
+</plist>
+`
+
+// checkSignature verifies the page hashes and special slots of a slice
+// signed with opts.
+func checkSignature(t *testing.T, s *Slice, opts SignOptions) {
+	t.Helper()
+	if s.Signature == nil {
+		t.Fatalf("%s: not signed", s.Arch())
+	}
+	cd := s.Signature.CodeDirectory()
+	if cd.Identifier != opts.Identifier {
+		t.Errorf("%s: identifier = %q, want %q", s.Arch(), cd.Identifier, opts.Identifier)
+	}
+	if cd.Flags&FlagAdhoc == 0 || cd.Flags&FlagLinkerSigned != 0 {
+		t.Errorf("%s: flags = %v, want adhoc without linker-signed", s.Arch(), cd.Flags)
+	}
+	if cd.HashType != HashSHA256 || cd.PageSize != PageSize {
+		t.Errorf("%s: hash type %v page size %d", s.Arch(), cd.HashType, cd.PageSize)
+	}
+	if cd.CodeLimit != uint64(s.SignatureOffset) {
+		t.Errorf("%s: code limit = %d, want signature offset %d", s.Arch(), cd.CodeLimit, s.SignatureOffset)
+	}
+	if want := (int(cd.CodeLimit) + PageSize - 1) / PageSize; len(cd.CodeHashes) != want {
+		t.Fatalf("%s: %d code hashes, want %d", s.Arch(), len(cd.CodeHashes), want)
+	}
+	for i, want := range cd.CodeHashes {
+		start := i * PageSize
+		end := min(start+PageSize, int(cd.CodeLimit))
+		got := sha256.Sum256(s.Data[start:end])
+		if !bytes.Equal(got[:], want) {
+			t.Fatalf("%s: page %d hash = %x, want %x", s.Arch(), i, got, want)
+		}
+	}
+
+	slots := map[int][]byte{
+		SlotInfo:         opts.InfoPlist,
+		SlotRequirements: s.Signature.Requirements,
+		SlotResourceDir:  opts.CodeResources,
+	}
+	if len(opts.Entitlements) > 0 {
+		slots[SlotEntitlements] = blob(MagicEmbeddedEntitlements, s.Signature.Entitlements)
+		slots[SlotDEREntitlements] = blob(MagicEmbeddedDEREntitlements, s.Signature.EntitlementsDER)
+	}
+	for slot, data := range slots {
+		got := cd.SpecialHash(slot)
+		if data == nil {
+			if got != nil && !bytes.Equal(got, make([]byte, len(got))) {
+				t.Errorf("%s: slot %d = %x, want empty", s.Arch(), slot, got)
+			}
+			continue
+		}
+		want := sha256.Sum256(data)
+		if !bytes.Equal(got, want[:]) {
+			t.Errorf("%s: slot %d = %x, want %x", s.Arch(), slot, got, want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	opts := SignOptions{
+		Identifier:   "com.example.hello",
+		Entitlements: []byte(testEntitlementsXML),
+	}
+	for _, goarch := range []string{"arm64", "amd64"} {
+		t.Run(goarch, func(t *testing.T) {
+			data, err := os.ReadFile(buildDarwin(t, goarch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := Sign(data, opts)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			f, err := NewFile(signed)
+			if err != nil {
+				t.Fatalf("NewFile: %v", err)
+			}
+			s := f.Slices[0]
+			checkSignature(t, s, opts)
+			if string(s.Signature.Entitlements) != testEntitlementsXML {
+				t.Errorf("entitlements = %q", s.Signature.Entitlements)
+			}
+			if s.Signature.RequirementCount() != 0 {
+				t.Errorf("requirement count = %d, want 0", s.Signature.RequirementCount())
+			}
+			cd := s.Signature.CodeDirectory()
+			dr, explicit, err := s.Signature.DesignatedRequirement()
+			if want := fmt.Sprintf(`cdhash H"%x"`, cd.CDHash()[:20]); err != nil || explicit || dr.String() != want {
+				t.Errorf("designated requirement = %v, %v, %v; want implicit %s", dr, explicit, err, want)
+			}
+			if cd.ExecSegFlags&(execSegMainBinary|execSegAllowUnsigned) != execSegMainBinary|execSegAllowUnsigned {
+				t.Errorf("exec segment flags = %#x", cd.ExecSegFlags)
+			}
+
+			// __LINKEDIT must end at the end of the signature.
+			linkedit := s.File.Segment("__LINKEDIT")
+			if end := linkedit.Offset + linkedit.Filesz; end != uint64(len(signed)) {
+				t.Errorf("__LINKEDIT ends at %d, file is %d bytes", end, len(signed))
+			}
+
+			// Re-signing the output is stable.
+			again, err := Sign(signed, opts)
+			if err != nil {
+				t.Fatalf("re-Sign: %v", err)
+			}
+			if !bytes.Equal(again, signed) {
+				t.Error("re-signing changed the output")
+			}
+		})
+	}
+}
+
+func TestSignFat(t *testing.T) {
+	var arches []FatArch
+	for _, goarch := range []string{"arm64", "amd64"} {
+		data, err := os.ReadFile(buildDarwin(t, goarch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arches = append(arches, FatArch{Cpu: f.Slices[0].Cpu, SubCpu: f.Slices[0].SubCpu, Data: data})
+	}
+	fat, err := BuildFat(arches)
+	if err != nil {
+		t.Fatalf("BuildFat: %v", err)
+	}
+
+	opts := SignOptions{Identifier: "com.example.hello"}
+	signed, err := Sign(fat, opts)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	f, err := NewFile(signed)
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	if !f.Fat || len(f.Slices) != 2 {
+		t.Fatalf("got fat=%v with %d slices", f.Fat, len(f.Slices))
+	}
+	for _, s := range f.Slices {
+		checkSignature(t, s, opts)
+		if s.Offset%(1<<defaultFatAlign(s.Cpu)) != 0 {
+			t.Errorf("%s: offset %#x is not aligned", s.Arch(), s.Offset)
+		}
+	}
+	if f.Slice("arm64") == nil || f.Slice("x86_64") == nil {
+		t.Errorf("archs = %v", f.Archs())
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	if _, err := Sign(thinMachO(macho.CpuArm64, nil), SignOptions{}); err == nil {
+		t.Error("Sign without identifier succeeded")
+	}
+	if _, err := Sign([]byte("not a binary"), SignOptions{Identifier: "x"}); err == nil {
+		t.Error("Sign of non-Mach-O data succeeded")
+	}
+}
+
+func TestUseBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(bin, thinMachO(macho.CpuArm64, nil), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := UseBuiltin("builtin", bin); !ok || err != nil {
+		t.Errorf("UseBuiltin(builtin, Mach-O) = %v, %v; want true", ok, err)
+	}
+	if _, err := UseBuiltin("builtin", script); !errors.Is(err, ErrNotMachO) {
+		t.Errorf("UseBuiltin(builtin, script) error = %v, want ErrNotMachO", err)
+	}
+	if ok, err := UseBuiltin("codesign", script); ok || err != nil {
+		t.Errorf("UseBuiltin(codesign, script) = %v, %v; want false", ok, err)
+	}
+}
+
+func TestEntitlementsDER(t *testing.T) {
+	xml := []byte(`<plist version="1.0"><dict>
+		<key>b</key><integer>-2</integer>
+		<key>a</key><array><string>x</string><true/></array>
+	</dict></plist>`)
+	got, err := EntitlementsDER(xml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hex.DecodeString("" +
+		"701a" + "020101" + "b015" +
+		"300b" + "0c0161" + "3006" + "0c0178" + "0101ff" +
+		"3006" + "0c0162" + "0201fe")
+	if !bytes.Equal(got, want) {
+		t.Errorf("EntitlementsDER = %x, want %x", got, want)
+	}
+
+	if _, err := EntitlementsDER([]byte(`<plist version="1.0"><dict><key>d</key><real>1.5</real></dict></plist>`)); err == nil {
+		t.Error("EntitlementsDER accepted a real value")
+	}
+}
+
+// testBundle lays out Hello.app around a darwin/arm64 executable.
+func testBundle(t *testing.T) string {
+	t.Helper()
+	exe := buildDarwin(t, "arm64")
+	app := filepath.Join(t.TempDir(), "Hello.app")
+	files := map[string]string{
+		"Contents/Info.plist": `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>hello</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.hello</string>
+</dict>
+</plist>
+`,
+		"Contents/PkgInfo":                          "APPL????",
+		"Contents/Resources/data.txt":               "hello\n",
+		"Contents/Resources/en.lproj/Local.strings": "\"a\" = \"b\";\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(app, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(app, "Contents", "MacOS"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(app, "Contents", "MacOS", "hello"), data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestSignBundle(t *testing.T) {
+	app := testBundle(t)
+	contents := filepath.Join(app, "Contents")
+	// A signed helper in MacOS is sealed by CDHash.
+	helper, err := os.ReadFile(buildDarwin(t, "arm64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(contents, "MacOS", "helper"), helper, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SignBundle(app, SignOptions{Identifier: "com.example.hello"}); err != nil {
+		t.Fatalf("SignBundle: %v", err)
+	}
+
+	resources, err := os.ReadFile(filepath.Join(contents, filepath.FromSlash(CodeResourcesPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.ReadFile(filepath.Join(contents, "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(filepath.Join(contents, "MacOS", "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSignature(t, f.Slices[0], SignOptions{
+		Identifier:    "com.example.hello",
+		InfoPlist:     info,
+		CodeResources: resources,
+	})
+
+	var seal struct {
+		Files  map[string]any            `plist:"files"`
+		Files2 map[string]map[string]any `plist:"files2"`
+		Rules  map[string]any            `plist:"rules"`
+		Rules2 map[string]any            `plist:"rules2"`
+	}
+	if err := plist.Unmarshal(resources, &seal); err != nil {
+		t.Fatalf("CodeResources: %v", err)
+	}
+	if len(seal.Rules) == 0 || len(seal.Rules2) == 0 {
+		t.Error("CodeResources has no rules")
+	}
+
+	data := []byte("hello\n")
+	sum1, sum256 := sha1.Sum(data), sha256.Sum256(data)
+	if got, _ := seal.Files["Resources/data.txt"].([]byte); !bytes.Equal(got, sum1[:]) {
+		t.Errorf("files[Resources/data.txt] = %v", seal.Files["Resources/data.txt"])
+	}
+	entry := seal.Files2["Resources/data.txt"]
+	if got, _ := entry["hash2"].([]byte); !bytes.Equal(got, sum256[:]) {
+		t.Errorf("files2[Resources/data.txt] = %v", entry)
+	}
+	if entry := seal.Files2["Resources/en.lproj/Local.strings"]; entry["optional"] != true {
+		t.Errorf("files2[Resources/en.lproj/Local.strings] = %v, want optional", entry)
+	}
+
+	hf, err := NewFile(helper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCDHash := hf.Slices[0].Signature.CodeDirectory().CDHash()[:20]
+	if got, _ := seal.Files2["MacOS/helper"]["cdhash"].([]byte); !bytes.Equal(got, wantCDHash) {
+		t.Errorf("files2[MacOS/helper] = %v", seal.Files2["MacOS/helper"])
+	}
+
+	for _, name := range []string{"Info.plist", "PkgInfo", "MacOS/hello", CodeResourcesPath} {
+		if _, ok := seal.Files2[name]; ok {
+			t.Errorf("files2 should not contain %s", name)
+		}
+	}
+}
+
+func TestSignBundleNestedBundle(t *testing.T) {
+	app := testBundle(t)
+	xpc := filepath.Join(app, "Contents", "XPCServices", "Service.xpc")
+	if err := os.MkdirAll(filepath.Dir(xpc), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(testBundle(t), xpc); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SignBundle(xpc, SignOptions{Identifier: "com.example.hello.service"}); err != nil {
+		t.Fatalf("SignBundle(xpc): %v", err)
+	}
+	if err := SignBundle(app, SignOptions{Identifier: "com.example.hello"}); err != nil {
+		t.Fatalf("SignBundle: %v", err)
+	}
+
+	resources, err := os.ReadFile(filepath.Join(app, "Contents", filepath.FromSlash(CodeResourcesPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seal struct {
+		Files2 map[string]map[string]any `plist:"files2"`
+	}
+	if err := plist.Unmarshal(resources, &seal); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(filepath.Join(xpc, "Contents", "MacOS", "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := f.Slices[0].Signature.CodeDirectory().CDHash()[:20]
+	if got, _ := seal.Files2["XPCServices/Service.xpc"]["cdhash"].([]byte); !bytes.Equal(got, want) {
+		t.Errorf("files2[XPCServices/Service.xpc] = %v", seal.Files2["XPCServices/Service.xpc"])
+	}
+	for rel := range seal.Files2 {
+		if strings.HasPrefix(rel, "XPCServices/Service.xpc/") {
+			t.Errorf("files2 contains %s inside the nested bundle", rel)
+		}
+	}
+	if ms, err := Verify(app); err != nil || len(ms) != 0 {
+		t.Fatalf("Verify = %v, %v; want no mismatches", ms, err)
+	}
+
+	// Re-signing the service changes its CDHash and breaks the app's seal.
+	if err := SignBundle(xpc, SignOptions{Identifier: "com.example.other"}); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := Verify(app)
+	if err != nil || len(ms) != 1 || ms[0].Kind != MismatchModified || ms[0].Path != "XPCServices/Service.xpc" {
+		t.Errorf("Verify after re-signing the service = %v, %v", ms, err)
+	}
+}
+
+func TestSignBundleUnsignedNested(t *testing.T) {
+	app := testBundle(t)
+	if err := os.WriteFile(filepath.Join(app, "Contents", "MacOS", "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := SignBundle(app, SignOptions{Identifier: "com.example.hello"})
+	if !errors.Is(err, ErrNotSigned) {
+		t.Fatalf("SignBundle() = %v, want unsigned nested code error", err)
+	}
+}
+
+func TestSignWithIdentity(t *testing.T) {
+	cert, key := testcert.CodeSigning(t, "Developer ID Application: Example Corp (ABCDE12345)", "ABCDE12345")
+	opts := SignOptions{
+		Identifier:  "com.example.hello",
+		TeamID:      "ABCDE12345",
+		Flags:       FlagRuntime,
+		Key:         key,
+		Certificate: cert,
+	}
+	exe := buildDarwin(t, "arm64")
+	if err := SignFile(exe, opts); err != nil {
+		t.Fatalf("SignFile: %v", err)
+	}
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.Slices[0]
+	cd := s.Signature.CodeDirectory()
+	if cd.Flags&FlagAdhoc != 0 || cd.Flags&FlagRuntime == 0 {
+		t.Errorf("flags = %v, want runtime without adhoc", cd.Flags)
+	}
+	if cd.TeamID != "ABCDE12345" {
+		t.Errorf("team ID = %q", cd.TeamID)
+	}
+
+	sd, err := cms.Parse(s.Signature.CMS)
+	if err != nil {
+		t.Fatalf("cms.Parse: %v", err)
+	}
+	if len(sd.Signers) != 1 || !sd.Signers[0].Certificate.Equal(cert) {
+		t.Fatalf("signers = %v", sd.Signers)
+	}
+	signer := sd.Signers[0]
+	if err := signer.Verify(cd.Raw); err != nil {
+		t.Errorf("CMS signature does not verify: %v", err)
+	}
+	v, ok := signer.Attribute(oidCDHashes2)
+	var h2 struct {
+		Algorithm asn1.ObjectIdentifier
+		Digest    []byte
+	}
+	if !ok {
+		t.Error("missing CDHashes2 attribute")
+	} else if _, err := asn1.Unmarshal(v.FullBytes, &h2); err != nil || !bytes.Equal(h2.Digest, cd.CDHash()) {
+		t.Errorf("CDHashes2 = %x, %v; want %x", h2.Digest, err, cd.CDHash())
+	}
+	v, ok = signer.Attribute(oidCDHashesPlist)
+	var hashesPlist []byte
+	var hashes struct {
+		CDHashes [][]byte `plist:"cdhashes"`
+	}
+	if !ok {
+		t.Error("missing CDHashes plist attribute")
+	} else if _, err := asn1.Unmarshal(v.FullBytes, &hashesPlist); err != nil {
+		t.Error(err)
+	} else if err := plist.Unmarshal(hashesPlist, &hashes); err != nil || len(hashes.CDHashes) != 1 || !bytes.Equal(hashes.CDHashes[0], cd.CDHash()[:20]) {
+		t.Errorf("CDHashes plist = %q, %v", hashesPlist, err)
+	}
+
+	if ms, err := Verify(exe); err != nil || len(ms) != 0 {
+		t.Errorf("Verify = %v, %v", ms, err)
+	}
+
+	// The designated requirement is embedded and pins the certificate.
+	dr, explicit, err := s.Signature.DesignatedRequirement()
+	sum := sha1.Sum(cert.Raw)
+	if want := fmt.Sprintf(`identifier "com.example.hello" and certificate leaf = H"%x"`, sum); err != nil || !explicit || dr.String() != want {
+		t.Errorf("designated requirement = %v, %v, %v; want explicit %s", dr, explicit, err, want)
+	}
+
+	// Tampering with the signed CodeDirectory invalidates the CMS signature.
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := bytes.Index(data, []byte("com.example.hello"))
+	data[idx] = 'C'
+	if err := os.WriteFile(exe, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := Verify(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) == 0 || ms[len(ms)-1].Kind != MismatchSignature {
+		t.Errorf("Verify(tampered) = %v, want a signature mismatch", ms)
+	}
+}
+
+func TestSignWithTimestamp(t *testing.T) {
+	cert, key := testcert.CodeSigning(t, "Developer ID Application: Example Corp (ABCDE12345)", "ABCDE12345")
+	tsa, err := tsp.NewResponder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+	client := &tsp.Client{URL: srv.URL}
+
+	exe := buildDarwin(t, "arm64")
+	err = SignFile(exe, SignOptions{
+		Identifier:  "com.example.hello",
+		Key:         key,
+		Certificate: cert,
+		Timestamp: func(signature []byte) ([]byte, error) {
+			tok, err := client.Timestamp(context.Background(), signature)
+			if err != nil {
+				return nil, err
+			}
+			return tok.Raw, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("SignFile: %v", err)
+	}
+	f, err := Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := f.Slices[0].Signature
+	sd, err := cms.Parse(sig.CMS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := sd.Signers[0]
+	if err := signer.Verify(sig.CodeDirectory().Raw); err != nil {
+		t.Errorf("CMS signature does not verify: %v", err)
+	}
+	v, ok := signer.Attribute(cms.OIDTimeStampToken)
+	if !ok {
+		t.Fatal("missing time-stamp token")
+	}
+	if _, err := tsp.Verify(v.FullBytes, signer.Signature); err != nil {
+		t.Errorf("time-stamp token: %v", err)
+	}
+	if ms, err := Verify(exe); err != nil || len(ms) != 0 {
+		t.Errorf("Verify = %v, %v", ms, err)
+	}
+
+	// A failing authority fails the signature.
+	err = SignFile(exe, SignOptions{
+		Identifier: "com.example.hello", Key: key, Certificate: cert,
+		Timestamp: func([]byte) ([]byte, error) { return nil, errors.New("no network") },
+	})
+	if err == nil || !strings.Contains(err.Error(), "no network") {
+		t.Errorf("Sign with failing timestamp = %v", err)
+	}
+}
+
+func TestSignKeyWithoutCertificate(t *testing.T) {
+	_, key := testcert.CodeSigning(t, "Developer ID Application: Example Corp (ABCDE12345)", "ABCDE12345")
+	if _, err := Sign(thinMachO(macho.CpuArm64, nil), SignOptions{Identifier: "x", Key: key}); err == nil {
+		t.Error("Sign with a key but no certificate succeeded")
+	}
+}
@@ -0,0 +1,504 @@
+package codesig
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/plist"
+	"github.com/tmc/macgo/internal/tsp"
+)
+
+// ErrNotSigned reports code that carries no embedded signature.
+var ErrNotSigned = errors.New("code object is not signed at all")
+
+// MismatchKind classifies a verification failure.
+type MismatchKind string
+
+const (
+	// MismatchPage is a code page whose hash differs from the CodeDirectory.
+	MismatchPage MismatchKind = "page"
+
+	// MismatchSlot is a special slot (Info.plist, requirements, resource
+	// seal, entitlements) whose hash differs or that is not bound.
+	MismatchSlot MismatchKind = "slot"
+
+	// MismatchSignature is a CMS signature that does not verify against
+	// the CodeDirectory.
+	MismatchSignature MismatchKind = "signature"
+
+	// MismatchModified is a sealed resource whose contents changed.
+	MismatchModified MismatchKind = "modified"
+
+	// MismatchMissing is a sealed resource that no longer exists.
+	MismatchMissing MismatchKind = "missing"
+
+	// MismatchAdded is a file the resource rules would seal but that is
+	// not in the seal.
+	MismatchAdded MismatchKind = "added"
+)
+
+// Mismatch is one difference between a signature and the code or
+// resources it covers.
+type Mismatch struct {
+	Kind MismatchKind
+
+	// Arch is the architecture of the slice, for page, slot and signature
+	// mismatches.
+	Arch string
+
+	// Path is the file concerned, relative to the bundle's Contents
+	// directory. For slot mismatches it names the bound file, if any.
+	Path string
+
+	// Slot is the special slot of a MismatchSlot.
+	Slot int
+
+	// Page is the code page index of a MismatchPage.
+	Page int
+
+	// Detail describes the failure further, when there is more to say.
+	Detail string
+}
+
+func (m Mismatch) String() string {
+	var subject string
+	switch m.Kind {
+	case MismatchPage:
+		subject = fmt.Sprintf("%s: code page %d", m.Arch, m.Page)
+	case MismatchSlot:
+		subject = fmt.Sprintf("%s: %s (slot %d)", m.Arch, slotName(m.Slot), m.Slot)
+	case MismatchSignature:
+		subject = fmt.Sprintf("%s: CMS signature", m.Arch)
+	default:
+		return fmt.Sprintf("%s: %s", m.Path, m.Kind) + detailSuffix(m.Detail)
+	}
+	if m.Detail != "" {
+		return subject + ": " + m.Detail
+	}
+	if m.Kind == MismatchSignature {
+		return subject + " invalid"
+	}
+	return subject + " modified"
+}
+
+func detailSuffix(detail string) string {
+	if detail == "" {
+		return ""
+	}
+	return " (" + detail + ")"
+}
+
+// slotName describes the contents of a special slot.
+func slotName(slot int) string {
+	switch slot {
+	case SlotInfo:
+		return "Info.plist"
+	case SlotRequirements:
+		return "internal requirements"
+	case SlotResourceDir:
+		return CodeResourcesPath
+	case SlotApplication:
+		return "application specific"
+	case SlotEntitlements:
+		return "entitlements"
+	case SlotDEREntitlements:
+		return "DER entitlements"
+	}
+	return "special slot"
+}
+
+// Verify checks the signature of an app bundle or bare Mach-O executable
+// without calling out to codesign. For every slice it recomputes the code
+// page hashes, checks the special slots against Info.plist, the internal
+// requirements, the resource seal and the entitlements, and verifies any
+// CMS signature over the CodeDirectory and any time-stamp token over that
+// signature. For bundles it then re-hashes every file listed in
+// _CodeSignature/CodeResources and looks for files added since signing.
+//
+// Verify returns an error only when the signature cannot be checked at
+// all, for example because the code is unsigned; differences are returned
+// as mismatches. Certificate trust is not evaluated.
+func Verify(path string) ([]Mismatch, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	exe := path
+	var (
+		contentsDir, mainRel string
+		bound                = map[int][]byte{}
+	)
+	if fi.IsDir() {
+		if exe, _, err = MainExecutable(path); err != nil {
+			return nil, err
+		}
+		contentsDir = filepath.Join(path, "Contents")
+		if mainRel, err = filepath.Rel(contentsDir, exe); err != nil {
+			return nil, err
+		}
+		mainRel = filepath.ToSlash(mainRel)
+		for slot, name := range map[int]string{SlotInfo: "Info.plist", SlotResourceDir: CodeResourcesPath} {
+			data, err := os.ReadFile(filepath.Join(contentsDir, filepath.FromSlash(name)))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			bound[slot] = data
+		}
+	}
+
+	f, err := Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	var mismatches []Mismatch
+	seen := map[Mismatch]bool{}
+	add := func(m Mismatch) {
+		if !seen[m] {
+			seen[m] = true
+			mismatches = append(mismatches, m)
+		}
+	}
+	for _, s := range f.Slices {
+		if s.Signature == nil {
+			return nil, fmt.Errorf("codesig: %s (%s): %w", exe, s.Arch(), ErrNotSigned)
+		}
+		if err := verifySlice(s, contentsDir != "", bound, add); err != nil {
+			return nil, fmt.Errorf("codesig: %s (%s): %w", exe, s.Arch(), err)
+		}
+	}
+
+	if contentsDir != "" && bound[SlotResourceDir] != nil {
+		ms, err := verifyResources(contentsDir, mainRel, bound[SlotResourceDir])
+		if err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, ms...)
+	}
+	return mismatches, nil
+}
+
+// verifySlice checks one slice's CodeDirectories and CMS signature.
+// bound holds the bundle files bound to special slots; inBundle reports
+// whether they were available.
+func verifySlice(s *Slice, inBundle bool, bound map[int][]byte, add func(Mismatch)) error {
+	sig := s.Signature
+	arch := s.Arch()
+
+	// The expected contents of each special slot; nil when the blob is
+	// absent. Info.plist and the resource seal are only known for bundles.
+	slots := map[int][]byte{
+		SlotRequirements:    sig.Requirements,
+		SlotEntitlements:    nil,
+		SlotDEREntitlements: nil,
+	}
+	if sig.Entitlements != nil {
+		slots[SlotEntitlements] = blob(MagicEmbeddedEntitlements, sig.Entitlements)
+	}
+	if sig.EntitlementsDER != nil {
+		slots[SlotDEREntitlements] = blob(MagicEmbeddedDEREntitlements, sig.EntitlementsDER)
+	}
+	if inBundle {
+		slots[SlotInfo] = bound[SlotInfo]
+		slots[SlotResourceDir] = bound[SlotResourceDir]
+	}
+
+	for _, cd := range sig.CodeDirectories {
+		if cd.HashType.New() == nil {
+			return fmt.Errorf("unsupported hash type %v", cd.HashType)
+		}
+		limit := int(cd.CodeLimit)
+		if uint64(limit) != cd.CodeLimit || limit > len(s.Data) {
+			add(Mismatch{Kind: MismatchPage, Arch: arch, Page: len(s.Data) / max(cd.PageSize, 1), Detail: "file truncated"})
+			continue
+		}
+		pageSize := cd.PageSize
+		if pageSize == 0 {
+			pageSize = max(limit, 1)
+		}
+		if want := (limit + pageSize - 1) / pageSize; len(cd.CodeHashes) != want {
+			add(Mismatch{Kind: MismatchPage, Arch: arch, Page: min(want, len(cd.CodeHashes)),
+				Detail: fmt.Sprintf("signature covers %d pages, code has %d", len(cd.CodeHashes), want)})
+		}
+		for i, want := range cd.CodeHashes {
+			start := i * pageSize
+			if start >= limit {
+				break
+			}
+			if !bytes.Equal(hashPrefix(cd, s.Data[start:min(start+pageSize, limit)]), want) {
+				add(Mismatch{Kind: MismatchPage, Arch: arch, Page: i})
+			}
+		}
+
+		for _, slot := range []int{SlotInfo, SlotRequirements, SlotResourceDir, SlotEntitlements, SlotDEREntitlements} {
+			data, ok := slots[slot]
+			if !ok {
+				continue
+			}
+			got := cd.SpecialHash(slot)
+			switch {
+			case isZero(got) && data == nil:
+			case isZero(got) && (slot == SlotInfo || slot == SlotResourceDir):
+				add(Mismatch{Kind: MismatchSlot, Arch: arch, Slot: slot, Path: slotPath(slot), Detail: "not bound to the signature"})
+			case isZero(got):
+				// Blobs the signer chose not to bind (old signatures
+				// without a DER entitlements slot) are not a mismatch.
+			case data == nil:
+				add(Mismatch{Kind: MismatchSlot, Arch: arch, Slot: slot, Path: slotPath(slot), Detail: "missing"})
+			case !bytes.Equal(hashPrefix(cd, data), got):
+				add(Mismatch{Kind: MismatchSlot, Arch: arch, Slot: slot, Path: slotPath(slot)})
+			}
+		}
+	}
+
+	if len(sig.CMS) == 0 {
+		return nil
+	}
+	sd, err := cms.Parse(sig.CMS)
+	if err != nil {
+		add(Mismatch{Kind: MismatchSignature, Arch: arch, Detail: err.Error()})
+		return nil
+	}
+	// The CMS signature covers the primary CodeDirectory, in slot 0.
+	// A time-stamp token, if any, covers the signature value.
+	for _, signer := range sd.Signers {
+		if err := signer.Verify(sig.CodeDirectories[0].Raw); err != nil {
+			add(Mismatch{Kind: MismatchSignature, Arch: arch, Detail: err.Error()})
+		}
+		if v, ok := signer.Attribute(cms.OIDTimeStampToken); ok {
+			if _, err := tsp.Verify(v.FullBytes, signer.Signature); err != nil {
+				add(Mismatch{Kind: MismatchSignature, Arch: arch, Detail: err.Error()})
+			}
+		}
+	}
+	return nil
+}
+
+// slotPath returns the bundle file bound to a special slot, if any.
+func slotPath(slot int) string {
+	switch slot {
+	case SlotInfo:
+		return "Info.plist"
+	case SlotResourceDir:
+		return CodeResourcesPath
+	}
+	return ""
+}
+
+// hashPrefix hashes data with the CodeDirectory's hash type, truncated to
+// its hash size.
+func hashPrefix(cd *CodeDirectory, data []byte) []byte {
+	h := cd.HashType.New()
+	h.Write(data)
+	sum := h.Sum(nil)
+	if cd.HashSize > 0 && cd.HashSize < len(sum) {
+		sum = sum[:cd.HashSize]
+	}
+	return sum
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyResources re-hashes the files sealed in a CodeResources plist and
+// reports files the seal's rules would include that it does not list.
+func verifyResources(contentsDir, mainExecutable string, seal []byte) ([]Mismatch, error) {
+	var res struct {
+		Files  map[string]any `plist:"files"`
+		Files2 map[string]any `plist:"files2"`
+		Rules  map[string]any `plist:"rules"`
+		Rules2 map[string]any `plist:"rules2"`
+	}
+	if err := plist.Unmarshal(seal, &res); err != nil {
+		return nil, fmt.Errorf("codesig: %s: %w", CodeResourcesPath, err)
+	}
+	files, rawRules := res.Files2, res.Rules2
+	if files == nil {
+		files, rawRules = res.Files, res.Rules
+	}
+	rules, err := parseRules(rawRules)
+	if err != nil {
+		return nil, fmt.Errorf("codesig: %s: %w", CodeResourcesPath, err)
+	}
+
+	var mismatches []Mismatch
+	for rel, entry := range files {
+		if m, ok := verifyResource(contentsDir, rel, entry); !ok {
+			mismatches = append(mismatches, m)
+		}
+	}
+
+	err = filepath.WalkDir(contentsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contentsDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if _, sealed := files[rel]; sealed || rel == "_CodeSignature" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel == mainExecutable || rel == TicketPath {
+			return nil
+		}
+		if _, ok := files[rel]; ok {
+			return nil
+		}
+		if r, ok := match(rules, rel); ok && !r.omit {
+			mismatches = append(mismatches, Mismatch{Kind: MismatchAdded, Path: rel})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("codesig: verify resources: %w", err)
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Path < mismatches[j].Path })
+	return mismatches, nil
+}
+
+// verifyResource checks one sealed file. The entry is a SHA-1 digest (in
+// the version 1 files dictionary) or a dictionary with hash, hash2,
+// symlink or cdhash keys.
+func verifyResource(contentsDir, rel string, entry any) (Mismatch, bool) {
+	var (
+		hash, hash2, cdhash []byte
+		symlink             string
+		optional            bool
+	)
+	switch e := entry.(type) {
+	case []byte:
+		hash = e
+	case map[string]any:
+		hash, _ = e["hash"].([]byte)
+		hash2, _ = e["hash2"].([]byte)
+		cdhash, _ = e["cdhash"].([]byte)
+		symlink, _ = e["symlink"].(string)
+		optional, _ = e["optional"].(bool)
+	}
+
+	modified := Mismatch{Kind: MismatchModified, Path: rel}
+	path := filepath.Join(contentsDir, filepath.FromSlash(rel))
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if optional {
+			return Mismatch{}, true
+		}
+		return Mismatch{Kind: MismatchMissing, Path: rel}, false
+	}
+	if err != nil {
+		modified.Detail = err.Error()
+		return modified, false
+	}
+
+	if symlink != "" {
+		target, err := os.Readlink(path)
+		if err != nil || target != symlink {
+			modified.Detail = "symbolic link target changed"
+			return modified, false
+		}
+		return Mismatch{}, true
+	}
+	if fi.IsDir() && cdhash != nil {
+		// A nested bundle is sealed by its main executable's CDHash.
+		exe, _, err := MainExecutable(path)
+		if err != nil {
+			modified.Detail = "nested bundle has no main executable"
+			return modified, false
+		}
+		path = exe
+	} else if !fi.Mode().IsRegular() {
+		modified.Detail = "not a regular file"
+		return modified, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		modified.Detail = err.Error()
+		return modified, false
+	}
+
+	switch {
+	case cdhash != nil:
+		f, err := NewFile(data)
+		if err != nil {
+			modified.Detail = "nested code is not Mach-O"
+			return modified, false
+		}
+		for _, s := range f.Slices {
+			if s.Signature == nil {
+				modified.Detail = ErrNotSigned.Error()
+				return modified, false
+			}
+			for _, cd := range s.Signature.CodeDirectories {
+				if sum := cd.CDHash(); len(sum) >= len(cdhash) && bytes.Equal(sum[:len(cdhash)], cdhash) {
+					return Mismatch{}, true
+				}
+			}
+		}
+		modified.Detail = "nested code signature changed"
+		return modified, false
+	case hash2 != nil:
+		sum := sha256.Sum256(data)
+		if !bytes.Equal(sum[:], hash2) {
+			return modified, false
+		}
+	case hash != nil:
+		sum := sha1.Sum(data)
+		if !bytes.Equal(sum[:], hash) {
+			return modified, false
+		}
+	default:
+		modified.Detail = "unrecognized seal entry"
+		return modified, false
+	}
+	return Mismatch{}, true
+}
+
+// parseRules parses a CodeResources rules dictionary.
+func parseRules(raw map[string]any) ([]rule, error) {
+	rules := make([]rule, 0, len(raw))
+	for pattern, v := range raw {
+		r := rule{pattern: pattern}
+		if d, ok := v.(map[string]any); ok {
+			switch w := d["weight"].(type) {
+			case float64:
+				r.weight = int(w)
+			case int64:
+				r.weight = int(w)
+			case uint64:
+				r.weight = int(w)
+			}
+			r.omit, _ = d["omit"].(bool)
+			r.optional, _ = d["optional"].(bool)
+			r.nested, _ = d["nested"].(bool)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", pattern, err)
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	// Sort for a deterministic choice between rules of equal weight.
+	sort.Slice(rules, func(i, j int) bool { return rules[i].pattern < rules[j].pattern })
+	return rules, nil
+}
@@ -0,0 +1,150 @@
+package codesig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyBundle(t *testing.T) {
+	app := testBundle(t)
+	contents := filepath.Join(app, "Contents")
+	opts := SignOptions{Identifier: "com.example.hello", Entitlements: []byte(testEntitlementsXML)}
+	if err := SignBundle(app, opts); err != nil {
+		t.Fatalf("SignBundle: %v", err)
+	}
+	if ms, err := Verify(app); err != nil || len(ms) != 0 {
+		t.Fatalf("Verify(signed) = %v, %v; want no mismatches", ms, err)
+	}
+
+	write := func(rel, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(contents, filepath.FromSlash(rel)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Resources/data.txt", "tampered\n")
+	write("Resources/extra.txt", "new\n")
+	write("Resources/.DS_Store", "omitted\n")
+	write(TicketPath, "stapled ticket") // added by stapling, never sealed
+	if err := os.Remove(filepath.Join(contents, "PkgInfo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(contents, "Resources", "en.lproj", "Local.strings")); err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := Verify(app)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	want := []Mismatch{
+		{Kind: MismatchModified, Path: "Resources/data.txt"},
+		{Kind: MismatchAdded, Path: "Resources/extra.txt"},
+	}
+	if !reflect.DeepEqual(ms, want) {
+		t.Errorf("Verify() = %v, want %v", ms, want)
+	}
+
+	// Removing a sealed, non-optional file is reported.
+	write("Resources/data.txt", "hello\n")
+	if err := os.Remove(filepath.Join(contents, "Resources", "extra.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(contents, "Resources", "data.txt")); err != nil {
+		t.Fatal(err)
+	}
+	ms, _ = Verify(app)
+	if want := []Mismatch{{Kind: MismatchMissing, Path: "Resources/data.txt"}}; !reflect.DeepEqual(ms, want) {
+		t.Errorf("Verify() = %v, want %v", ms, want)
+	}
+	write("Resources/data.txt", "hello\n")
+
+	// Editing Info.plist breaks its special slot.
+	info, err := os.ReadFile(filepath.Join(contents, "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("Info.plist", string(info)+"\n")
+	ms, _ = Verify(app)
+	if want := []Mismatch{{Kind: MismatchSlot, Arch: "arm64", Path: "Info.plist", Slot: SlotInfo}}; !reflect.DeepEqual(ms, want) {
+		t.Errorf("Verify() = %v, want %v", ms, want)
+	}
+	write("Info.plist", string(info))
+
+	// Patching the executable breaks the page that changed.
+	exe := filepath.Join(contents, "MacOS", "hello")
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[2*PageSize+10] ^= 0xff
+	if err := os.WriteFile(exe, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ms, _ = Verify(app)
+	if want := []Mismatch{{Kind: MismatchPage, Arch: "arm64", Page: 2}}; !reflect.DeepEqual(ms, want) {
+		t.Errorf("Verify() = %v, want %v", ms, want)
+	}
+}
+
+func TestVerifyExecutable(t *testing.T) {
+	// The Go linker's signature binds nothing but the code.
+	exe := buildDarwin(t, "arm64")
+	if ms, err := Verify(exe); err != nil || len(ms) != 0 {
+		t.Fatalf("Verify(linker-signed) = %v, %v", ms, err)
+	}
+
+	opts := SignOptions{Identifier: "hello", Entitlements: []byte(testEntitlementsXML)}
+	if err := SignFile(exe, opts); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := Verify(exe); err != nil || len(ms) != 0 {
+		t.Fatalf("Verify(signed) = %v, %v", ms, err)
+	}
+
+	unsigned := buildDarwin(t, "amd64")
+	if _, err := Verify(unsigned); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("Verify(unsigned) = %v, want ErrNotSigned", err)
+	}
+}
+
+func TestVerifyUnsealedBundle(t *testing.T) {
+	// A bundle around a linker-signed executable has neither Info.plist
+	// nor resources bound to its signature.
+	app := testBundle(t)
+	ms, err := Verify(app)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	want := []Mismatch{
+		{Kind: MismatchSlot, Arch: "arm64", Path: "Info.plist", Slot: SlotInfo, Detail: "not bound to the signature"},
+	}
+	if !reflect.DeepEqual(ms, want) {
+		t.Errorf("Verify() = %v, want %v", ms, want)
+	}
+}
+
+func TestMismatchString(t *testing.T) {
+	tests := []struct {
+		m    Mismatch
+		want string
+	}{
+		{Mismatch{Kind: MismatchPage, Arch: "arm64", Page: 3}, "arm64: code page 3 modified"},
+		{Mismatch{Kind: MismatchSlot, Arch: "x86_64", Slot: SlotInfo}, "x86_64: Info.plist (slot 1) modified"},
+		{Mismatch{Kind: MismatchSlot, Arch: "arm64", Slot: SlotResourceDir, Detail: "not bound to the signature"},
+			"arm64: _CodeSignature/CodeResources (slot 3): not bound to the signature"},
+		{Mismatch{Kind: MismatchSignature, Arch: "arm64"}, "arm64: CMS signature invalid"},
+		{Mismatch{Kind: MismatchModified, Path: "Resources/a.txt"}, "Resources/a.txt: modified"},
+		{Mismatch{Kind: MismatchModified, Path: "MacOS/helper", Detail: "nested code signature changed"},
+			"MacOS/helper: modified (nested code signature changed)"},
+		{Mismatch{Kind: MismatchAdded, Path: "Resources/b.txt"}, "Resources/b.txt: added"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package csreq implements Apple's code requirement language.
+//
+// A code requirement is a boolean expression over a signature's
+// identifier, certificate chain, Info.plist, entitlements and CDHash, for
+// example
+//
+//	identifier "com.example.app" and anchor apple generic
+//
+// Parse compiles the text form and Requirement.String decompiles it, in
+// the same syntax `codesign --display --requirements -` prints. Marshal
+// and Unmarshal convert a requirement to and from the binary blob (magic
+// 0xfade0c00) stored in a code signature. Requirement sets, which hold
+// the designated requirement among others, are handled by ParseSet,
+// UnmarshalSet and Set.Marshal.
+package csreq
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Blob magic numbers.
+const (
+	MagicRequirement  = 0xfade0c00
+	MagicRequirements = 0xfade0c01
+)
+
+// exprForm is the only requirement kind: an expression in opcode form.
+const exprForm = 1
+
+// Op is an expression opcode.
+type Op uint32
+
+const (
+	OpFalse              Op = 0  // never
+	OpTrue               Op = 1  // always
+	OpIdent              Op = 2  // identifier "x"
+	OpAppleAnchor        Op = 3  // anchor apple
+	OpAnchorHash         Op = 4  // certificate slot = H"..."
+	OpInfoKeyValue       Op = 5  // info[key] = value (legacy form)
+	OpAnd                Op = 6  // x and y
+	OpOr                 Op = 7  // x or y
+	OpCDHash             Op = 8  // cdhash H"..."
+	OpNot                Op = 9  // ! x
+	OpInfoKeyField       Op = 10 // info[key] match
+	OpCertField          Op = 11 // certificate slot[subject.CN] match
+	OpTrustedCert        Op = 12 // certificate slot trusted
+	OpTrustedCerts       Op = 13 // anchor trusted
+	OpCertGeneric        Op = 14 // certificate slot[field.oid] match
+	OpAppleGenericAnchor Op = 15 // anchor apple generic
+	OpEntitlementField   Op = 16 // entitlement[key] match
+	OpCertPolicy         Op = 17 // certificate slot[policy.oid] match
+	OpNamedAnchor        Op = 18 // anchor apple name
+	OpNamedCode          Op = 19 // (name)
+	OpPlatform           Op = 20 // platform = n
+	OpNotarized          Op = 21 // notarized
+	OpCertFieldDate      Op = 22 // certificate slot[timestamp.oid] match
+	OpLegacyDevID        Op = 23 // legacy
+)
+
+// opFlagMask covers the flag bits in the top byte of an opcode.
+const opFlagMask = 0xff000000
+
+// MatchOp is the comparison of a Match.
+type MatchOp uint32
+
+const (
+	MatchExists       MatchOp = 0
+	MatchEqual        MatchOp = 1
+	MatchContains     MatchOp = 2
+	MatchBeginsWith   MatchOp = 3
+	MatchEndsWith     MatchOp = 4
+	MatchLessThan     MatchOp = 5
+	MatchGreaterThan  MatchOp = 6
+	MatchLessEqual    MatchOp = 7
+	MatchGreaterEqual MatchOp = 8
+	MatchOn           MatchOp = 9
+	MatchBefore       MatchOp = 10
+	MatchAfter        MatchOp = 11
+	MatchOnOrBefore   MatchOp = 12
+	MatchOnOrAfter    MatchOp = 13
+	MatchAbsent       MatchOp = 14
+)
+
+// isDate reports whether the match compares timestamps.
+func (m MatchOp) isDate() bool { return m >= MatchOn && m <= MatchOnOrAfter }
+
+// hasValue reports whether the match compares against a string value.
+func (m MatchOp) hasValue() bool { return m >= MatchEqual && m <= MatchGreaterEqual }
+
+// Certificate slots. Other non-negative slots count from the leaf toward
+// the anchor.
+const (
+	SlotLeaf   = 0
+	SlotAnchor = -1
+)
+
+// Match is a test applied to a certificate field, Info.plist key or
+// entitlement.
+type Match struct {
+	Op MatchOp
+
+	// Value is the operand of string comparisons. It may hold binary data.
+	Value string
+
+	// Time is the operand of date comparisons.
+	Time time.Time
+}
+
+// Requirement is a code requirement expression, or one node of it. The
+// fields used depend on Op.
+type Requirement struct {
+	Op Op
+
+	// X and Y are the operands of OpAnd and OpOr. X is the operand of
+	// OpNot.
+	X, Y *Requirement
+
+	// Slot is the certificate for certificate operations.
+	Slot int32
+
+	// Name is the identifier of OpIdent, the key of Info.plist and
+	// entitlement tests, the field of OpCertField such as "subject.OU",
+	// the dotted OID of OpCertGeneric, OpCertPolicy and OpCertFieldDate,
+	// or the name of OpNamedAnchor and OpNamedCode.
+	Name string
+
+	// Hash is the hash of OpCDHash and OpAnchorHash.
+	Hash []byte
+
+	// Platform is the platform of OpPlatform.
+	Platform int32
+
+	// Match is the test of field operations. For OpInfoKeyValue it holds
+	// the compared value.
+	Match Match
+}
+
+// And returns the conjunction of rs, left-associated as codesign builds
+// it. It returns nil if rs is empty.
+func And(rs ...*Requirement) *Requirement {
+	if len(rs) == 0 {
+		return nil
+	}
+	r := rs[0]
+	for _, y := range rs[1:] {
+		r = &Requirement{Op: OpAnd, X: r, Y: y}
+	}
+	return r
+}
+
+// Clauses returns the text of the top-level operands of a conjunction,
+// or of r itself when it is not one.
+func (r *Requirement) Clauses() []string {
+	if r.Op != OpAnd {
+		return []string{r.String()}
+	}
+	return append(r.X.Clauses(), r.Y.Clauses()...)
+}
+
+// Contains reports whether r uses the opcode op anywhere.
+func (r *Requirement) Contains(op Op) bool {
+	if r == nil {
+		return false
+	}
+	return r.Op == op || r.X.Contains(op) || r.Y.Contains(op)
+}
+
+// Type is the type of a requirement in a requirement set.
+type Type uint32
+
+const (
+	HostRequirement       Type = 1
+	GuestRequirement      Type = 2
+	DesignatedRequirement Type = 3
+	LibraryRequirement    Type = 4
+	PluginRequirement     Type = 5
+)
+
+var typeNames = map[Type]string{
+	HostRequirement:       "host",
+	GuestRequirement:      "guest",
+	DesignatedRequirement: "designated",
+	LibraryRequirement:    "library",
+	PluginRequirement:     "plugin",
+}
+
+// String returns the name used for the type in requirement set text.
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "Type(" + strconv.FormatUint(uint64(t), 10) + ")"
+}
+
+// Set is a requirement set, such as a code signature's internal
+// requirements, keyed by type.
+type Set map[Type]*Requirement
+
+// types returns the set's types in ascending order.
+func (s Set) types() []Type {
+	types := make([]Type, 0, len(s))
+	for t := range s {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// String returns the set as "type => requirement" lines.
+func (s Set) String() string {
+	var b strings.Builder
+	for _, t := range s.types() {
+		b.WriteString(t.String())
+		b.WriteString(" => ")
+		b.WriteString(s[t].String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
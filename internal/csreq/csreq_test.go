@@ -0,0 +1,288 @@
+package csreq
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/testcert"
+)
+
+const devID = `identifier "com.example.app" and anchor apple generic and ` +
+	`certificate 1[field.1.2.840.113635.100.6.2.6] /* exists */ and ` +
+	`certificate leaf[field.1.2.840.113635.100.6.1.13] /* exists */ and ` +
+	`certificate leaf[subject.OU] = ABCDE12345`
+
+// canonical requirements decompile to exactly their own text.
+var canonical = []string{
+	devID,
+	`cdhash H"0123456789abcdef0123456789abcdef01234567"`,
+	`identifier "com.example" and certificate root = H"00112233445566778899aabbccddeeff00112233"`,
+	`identifier "com.example" and certificate leaf[subject.CN] = "Apple Development: dev@example.com (FGHIJ67890)" and certificate 1[field.1.2.840.113635.100.6.2.1] /* exists */`,
+	`anchor apple generic and (identifier a or identifier b)`,
+	`identifier a and anchor apple or never`,
+	`! (identifier a or always)`,
+	`! identifier a and anchor trusted`,
+	`info[CFBundleShortVersionString] >= "1.0" and info[CFBundleIdentifier] = com*`,
+	`info[CFBundleName] = *Example and info[Key] = 0x00ff and info[Other] absent`,
+	`entitlement["com.apple.security.app-sandbox"] /* exists */`,
+	`certificate leaf[timestamp.1.2.840.113635.100.6.1.33] < timestamp "2025-01-02 03:04:05 +0000"`,
+	`certificate 2[policy.1.2.3] ~ "two words" and certificate 1 trusted`,
+	`platform = 1 and notarized and legacy`,
+	`anchor apple Example or ("com.example.code")`,
+	`identifier ""`,
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, text := range canonical {
+		r, err := Parse(text)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", text, err)
+			continue
+		}
+		if got := r.String(); got != text {
+			t.Errorf("Parse(%q).String() =\n\t%s", text, got)
+		}
+		blob, err := r.Marshal()
+		if err != nil {
+			t.Errorf("Marshal(%q): %v", text, err)
+			continue
+		}
+		back, err := Unmarshal(blob)
+		if err != nil {
+			t.Errorf("Unmarshal(Marshal(%q)): %v", text, err)
+			continue
+		}
+		if !reflect.DeepEqual(back, r) {
+			t.Errorf("Unmarshal(Marshal(%q)) = %s", text, back)
+		}
+	}
+}
+
+func TestParseSyntax(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{`identifier = com.example`, `identifier "com.example"`},
+		{`anchor = H"00112233445566778899aabbccddeeff00112233"`, `certificate root = H"00112233445566778899aabbccddeeff00112233"`},
+		{`anchor H"0011"`, `certificate root = H"0011"`},
+		{`cert leaf[subject.OU] = "ABCDE12345" // team`, `certificate leaf[subject.OU] = ABCDE12345`},
+		{`certificate anchor[subject.O] = "Example"`, `certificate root[subject.O] = Example`},
+		{`anchor[subject.O] = Example`, `certificate root[subject.O] = Example`},
+		{`certificate -1 = 0x0011`, `certificate root = H"0011"`},
+		{`info[CFBundleName] = *Example*`, `info[CFBundleName] ~ Example`},
+		{`info[CFBundleName] = "Ex"*`, `info[CFBundleName] = Ex*`},
+		{`certificate leaf[field.1.2.3] exists`, `certificate leaf[field.1.2.3] /* exists */`},
+		{`certificate leaf[field.1.2.3] and true`, `certificate leaf[field.1.2.3] /* exists */ and always`},
+		{`identifier a && anchor apple || !false`, `identifier a and anchor apple or ! never`},
+		{`not identifier a`, `! identifier a`},
+		{`(identifier a and anchor apple) or never`, `identifier a and anchor apple or never`},
+		{"# implicit\nidentifier x /* note */\n", `identifier x`},
+		{`identifier "a \"quoted\" \\ name"`, `identifier "a \"quoted\" \\ name"`},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		``,
+		`identifier`,
+		`identifier a and`,
+		`identifier a anchor apple`,
+		`(identifier a`,
+		`cdhash "abc"`,
+		`cdhash H"xyz"`,
+		`certificate leaf[subject.OU] = `,
+		`certificate leaf[field.x.y] exists`,
+		`certificate banana = H"00"`,
+		`platform = x`,
+		`frobnicate`,
+		`identifier "unterminated`,
+		`identifier a /* unterminated`,
+		`identifier a $`,
+		`info[Key] < timestamp "yesterday"`,
+	} {
+		if r, err := Parse(text); err == nil {
+			t.Errorf("Parse(%q) = %s, want error", text, r)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	// identifier "com.example" and anchor apple, encoded by hand.
+	want, _ := hex.DecodeString("fade0c00" + "00000028" + "00000001" +
+		"00000006" + "00000002" + "0000000b" + "636f6d2e6578616d706c6500" + "00000003")
+	r, err := Parse(`identifier "com.example" and anchor apple`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Marshal = %x\nwant      %x", got, want)
+	}
+
+	// Opcode flag bits are ignored when decoding.
+	flagged := bytes.Clone(want)
+	flagged[16] |= 0x80
+	if r, err := Unmarshal(flagged); err != nil || r.String() != `identifier "com.example" and anchor apple` {
+		t.Errorf("Unmarshal(flagged) = %v, %v", r, err)
+	}
+
+	for _, bad := range [][]byte{
+		want[:10],
+		want[:len(want)-4],
+		append([]byte{0xfa, 0xde, 0x0c, 0x01}, want[4:]...),
+		append(bytes.Clone(want[:8]), 0, 0, 0, 2),
+		append(bytes.Clone(want[:12]), 0, 0, 0, 99),
+	} {
+		if r, err := Unmarshal(bad); err == nil {
+			t.Errorf("Unmarshal(%x) = %s, want error", bad, r)
+		}
+	}
+
+	deep := &Requirement{Op: OpTrue}
+	for range maxDepth + 1 {
+		deep = &Requirement{Op: OpNot, X: deep}
+	}
+	blob, err := deep.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unmarshal(blob); err == nil {
+		t.Error("Unmarshal of a deeply nested requirement succeeded")
+	}
+}
+
+func TestSet(t *testing.T) {
+	s, err := ParseSet("designated => identifier x and anchor apple\n# comment\nhost => anchor apple\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "host => anchor apple\ndesignated => identifier x and anchor apple\n"
+	if got := s.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	blob, err := s.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := UnmarshalSet(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.String(); got != want {
+		t.Errorf("UnmarshalSet(Marshal()).String() = %q, want %q", got, want)
+	}
+
+	empty, err := Set{}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(empty); got != "fade0c010000000c00000000" {
+		t.Errorf("empty set = %s", got)
+	}
+
+	for _, text := range []string{"designated identifier x", "designated => identifier x designated => anchor apple", "anchor apple"} {
+		if _, err := ParseSet(text); err == nil {
+			t.Errorf("ParseSet(%q) succeeded", text)
+		}
+	}
+	if _, err := UnmarshalSet(blob[:20]); err == nil {
+		t.Error("UnmarshalSet of a truncated blob succeeded")
+	}
+}
+
+func newCertificate(t *testing.T, subject pkix.Name, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, exts ...asn1.ObjectIdentifier) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		Subject:               subject,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, oid := range exts {
+		tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, pkix.Extension{Id: oid, Value: []byte{0x05, 0x00}})
+	}
+	return testcert.New(t, tmpl, parent, parentKey)
+}
+
+func TestDesignated(t *testing.T) {
+	apple := pkix.Name{CommonName: "Apple Root CA", Organization: []string{"Apple Inc."}}
+	root, rootKey := newCertificate(t, apple, nil, nil)
+
+	devIDCA, devIDKey := newCertificate(t, pkix.Name{CommonName: "Developer ID Certification Authority"}, root, rootKey, oidDeveloperIDCA)
+	devIDLeaf, _ := newCertificate(t, pkix.Name{
+		CommonName:         "Developer ID Application: Example Corp (ABCDE12345)",
+		OrganizationalUnit: []string{"ABCDE12345"},
+	}, devIDCA, devIDKey, oidDeveloperIDLeaf)
+	if got := Designated("com.example.app", []*x509.Certificate{devIDLeaf, devIDCA}).String(); got != devID {
+		t.Errorf("Developer ID:\n\tgot  %s\n\twant %s", got, devID)
+	}
+
+	wwdr, wwdrKey := newCertificate(t, pkix.Name{CommonName: "Apple Worldwide Developer Relations Certification Authority"}, root, rootKey, oidWWDRCA)
+	devLeaf, _ := newCertificate(t, pkix.Name{CommonName: "Apple Development: dev@example.com (FGHIJ67890)"}, wwdr, wwdrKey)
+	want := `identifier "com.example.app" and anchor apple generic and certificate leaf[subject.CN] = "Apple Development: dev@example.com (FGHIJ67890)" and certificate 1[field.1.2.840.113635.100.6.2.1] /* exists */`
+	if got := Designated("com.example.app", []*x509.Certificate{devLeaf, wwdr, root}).String(); got != want {
+		t.Errorf("Apple Development:\n\tgot  %s\n\twant %s", got, want)
+	}
+
+	// Not issued by Apple: pin the highest certificate sharing the leaf's
+	// organization, or the leaf when it has none.
+	orgRoot, orgRootKey := newCertificate(t, pkix.Name{CommonName: "Example Root", Organization: []string{"Example"}}, nil, nil)
+	orgLeaf, _ := newCertificate(t, pkix.Name{CommonName: "Example Signer", Organization: []string{"Example"}}, orgRoot, orgRootKey)
+	otherLeaf, _ := newCertificate(t, pkix.Name{CommonName: "Other Signer", Organization: []string{"Other"}}, orgRoot, orgRootKey)
+	bare, _ := newCertificate(t, pkix.Name{CommonName: "Self Signed"}, nil, nil)
+	for _, tt := range []struct {
+		chain []*x509.Certificate
+		slot  string
+		pin   *x509.Certificate
+	}{
+		{[]*x509.Certificate{orgLeaf, orgRoot}, "root", orgRoot},
+		{[]*x509.Certificate{otherLeaf, orgRoot}, "leaf", otherLeaf},
+		{[]*x509.Certificate{bare}, "leaf", bare},
+	} {
+		sum := sha1.Sum(tt.pin.Raw)
+		want := fmt.Sprintf(`identifier x and certificate %s = H"%x"`, tt.slot, sum)
+		if got := Designated("x", tt.chain).String(); got != want {
+			t.Errorf("%s:\n\tgot  %s\n\twant %s", tt.chain[0].Subject.CommonName, got, want)
+		}
+	}
+
+	cdhash := bytes.Repeat([]byte{0xab}, 32)
+	if got, want := AdHoc(cdhash).String(), `cdhash H"`+strings.Repeat("ab", 20)+`"`; got != want {
+		t.Errorf("AdHoc = %s, want %s", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, _ := Parse(devID)
+	new, _ := Parse(strings.Replace(devID, "ABCDE12345", "FGHIJ67890", 1))
+	removed, added := Diff(old, new)
+	if !reflect.DeepEqual(removed, []string{"certificate leaf[subject.OU] = ABCDE12345"}) ||
+		!reflect.DeepEqual(added, []string{"certificate leaf[subject.OU] = FGHIJ67890"}) {
+		t.Errorf("Diff = %q, %q", removed, added)
+	}
+	if removed, added := Diff(old, old); removed != nil || added != nil {
+		t.Errorf("Diff(same) = %q, %q", removed, added)
+	}
+	if !new.Contains(OpAppleGenericAnchor) || new.Contains(OpCDHash) {
+		t.Error("Contains reports the wrong opcodes")
+	}
+}
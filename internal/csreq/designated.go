@@ -0,0 +1,130 @@
+package csreq
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"slices"
+	"strings"
+)
+
+// Apple certificate extensions that designated requirements test for.
+var (
+	// oidDeveloperIDCA marks the Developer ID Certification Authority.
+	oidDeveloperIDCA = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 6}
+	// oidDeveloperIDLeaf marks Developer ID Application certificates.
+	oidDeveloperIDLeaf = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 1, 13}
+	// oidWWDRCA marks the Apple Worldwide Developer Relations CA, which
+	// issues Apple Development and Mac App Store certificates.
+	oidWWDRCA = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+// AdHoc returns the implicit designated requirement of an ad-hoc
+// signature, which pins its CDHash:
+//
+//	cdhash H"..."
+//
+// Only the first 20 bytes of cdhash are used, as codesign does.
+func AdHoc(cdhash []byte) *Requirement {
+	if len(cdhash) > 20 {
+		cdhash = cdhash[:20]
+	}
+	return &Requirement{Op: OpCDHash, Hash: cdhash}
+}
+
+// Designated returns the designated requirement codesign derives for code
+// with the given signing identifier whose signature carries chain, leaf
+// first. For a Developer ID certificate it is
+//
+//	identifier "x" and anchor apple generic and
+//	certificate 1[field.1.2.840.113635.100.6.2.6] /* exists */ and
+//	certificate leaf[field.1.2.840.113635.100.6.1.13] /* exists */ and
+//	certificate leaf[subject.OU] = TEAMID
+//
+// Apple Development certificates are pinned by common name instead, and
+// certificates not issued by Apple by the SHA-1 hash of the highest
+// certificate in the chain that shares the leaf's organization.
+func Designated(identifier string, chain []*x509.Certificate) *Requirement {
+	ident := &Requirement{Op: OpIdent, Name: identifier}
+	if len(chain) == 0 {
+		return ident
+	}
+	leaf := chain[0]
+	if !appleAnchored(chain) {
+		return And(ident, nonAppleAnchor(chain))
+	}
+
+	generic := &Requirement{Op: OpAppleGenericAnchor}
+	exists := func(slot int32, oid asn1.ObjectIdentifier) *Requirement {
+		return &Requirement{Op: OpCertGeneric, Slot: slot, Name: oid.String(), Match: Match{Op: MatchExists}}
+	}
+	field := func(name, value string) *Requirement {
+		return &Requirement{Op: OpCertField, Slot: SlotLeaf, Name: name, Match: Match{Op: MatchEqual, Value: value}}
+	}
+	switch {
+	case len(chain) > 1 && hasExtension(chain[1], oidDeveloperIDCA) && hasExtension(leaf, oidDeveloperIDLeaf) && len(leaf.Subject.OrganizationalUnit) > 0:
+		return And(ident, generic,
+			exists(1, oidDeveloperIDCA),
+			exists(SlotLeaf, oidDeveloperIDLeaf),
+			field("subject.OU", leaf.Subject.OrganizationalUnit[0]))
+	case len(chain) > 1 && hasExtension(chain[1], oidWWDRCA):
+		return And(ident, generic,
+			field("subject.CN", leaf.Subject.CommonName),
+			exists(1, oidWWDRCA))
+	}
+	return And(ident, &Requirement{Op: OpAppleAnchor})
+}
+
+// appleAnchored reports whether chain ends at an Apple root certificate.
+func appleAnchored(chain []*x509.Certificate) bool {
+	root := chain[len(chain)-1].Issuer
+	return strings.HasPrefix(root.CommonName, "Apple Root CA") && slices.Contains(root.Organization, "Apple Inc.")
+}
+
+// nonAppleAnchor pins the highest certificate in chain whose organization
+// matches the leaf's, walking up from the leaf as codesign does; if that
+// is the last certificate, it is named as the anchor.
+func nonAppleAnchor(chain []*x509.Certificate) *Requirement {
+	slot := SlotLeaf
+	if org := strings.Join(chain[0].Subject.Organization, ","); org != "" {
+		for slot+1 < len(chain) && strings.Join(chain[slot+1].Subject.Organization, ",") == org {
+			slot++
+		}
+		if slot == len(chain)-1 {
+			slot = SlotAnchor
+		}
+	}
+	cert := chain[len(chain)-1]
+	if slot != SlotAnchor {
+		cert = chain[slot]
+	}
+	sum := sha1.Sum(cert.Raw)
+	return &Requirement{Op: OpAnchorHash, Slot: int32(slot), Hash: sum[:]}
+}
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff compares two requirements clause by clause, splitting each at its
+// top-level "and" operators. It returns the clauses only old has and
+// those only new has; both are empty when the requirements are the same.
+func Diff(old, new *Requirement) (removed, added []string) {
+	oldClauses, newClauses := old.Clauses(), new.Clauses()
+	for _, c := range oldClauses {
+		if !slices.Contains(newClauses, c) {
+			removed = append(removed, c)
+		}
+	}
+	for _, c := range newClauses {
+		if !slices.Contains(oldClauses, c) {
+			added = append(added, c)
+		}
+	}
+	return removed, added
+}
@@ -0,0 +1,224 @@
+package csreq
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// timestampLayout is the layout of timestamp "..." literals.
+const timestampLayout = "2006-01-02 15:04:05 -0700"
+
+// Syntax levels, from tightest to loosest binding, used to decide where
+// a decompiled expression needs parentheses.
+const (
+	levelPrimary = iota
+	levelAnd
+	levelOr
+)
+
+// String decompiles the requirement to the code requirement language, in
+// the form codesign prints.
+func (r *Requirement) String() string {
+	var b strings.Builder
+	r.format(&b, levelOr)
+	return b.String()
+}
+
+func (r *Requirement) format(b *strings.Builder, level int) {
+	switch r.Op {
+	case OpFalse:
+		b.WriteString("never")
+	case OpTrue:
+		b.WriteString("always")
+	case OpIdent:
+		b.WriteString("identifier ")
+		writeData(b, r.Name, false)
+	case OpAppleAnchor:
+		b.WriteString("anchor apple")
+	case OpAppleGenericAnchor:
+		b.WriteString("anchor apple generic")
+	case OpNamedAnchor:
+		b.WriteString("anchor apple ")
+		writeData(b, r.Name, false)
+	case OpTrustedCerts:
+		b.WriteString("anchor trusted")
+	case OpAnchorHash:
+		b.WriteString("certificate ")
+		writeSlot(b, r.Slot)
+		b.WriteString(" = ")
+		writeHash(b, r.Hash)
+	case OpTrustedCert:
+		b.WriteString("certificate ")
+		writeSlot(b, r.Slot)
+		b.WriteString(" trusted")
+	case OpCDHash:
+		b.WriteString("cdhash ")
+		writeHash(b, r.Hash)
+	case OpInfoKeyValue:
+		b.WriteString("info[")
+		writeData(b, r.Name, true)
+		b.WriteString("] = ")
+		writeData(b, r.Match.Value, false)
+	case OpInfoKeyField:
+		b.WriteString("info[")
+		writeData(b, r.Name, true)
+		b.WriteString("]")
+		r.Match.format(b)
+	case OpEntitlementField:
+		b.WriteString("entitlement[")
+		writeData(b, r.Name, true)
+		b.WriteString("]")
+		r.Match.format(b)
+	case OpCertField, OpCertGeneric, OpCertPolicy, OpCertFieldDate:
+		b.WriteString("certificate ")
+		writeSlot(b, r.Slot)
+		b.WriteString("[")
+		switch r.Op {
+		case OpCertField:
+			writeData(b, r.Name, true)
+		case OpCertGeneric:
+			b.WriteString("field." + r.Name)
+		case OpCertPolicy:
+			b.WriteString("policy." + r.Name)
+		case OpCertFieldDate:
+			b.WriteString("timestamp." + r.Name)
+		}
+		b.WriteString("]")
+		r.Match.format(b)
+	case OpNamedCode:
+		b.WriteString("(")
+		writeData(b, r.Name, false)
+		b.WriteString(")")
+	case OpPlatform:
+		b.WriteString("platform = " + strconv.Itoa(int(r.Platform)))
+	case OpNotarized:
+		b.WriteString("notarized")
+	case OpLegacyDevID:
+		b.WriteString("legacy")
+	case OpNot:
+		b.WriteString("! ")
+		r.X.format(b, levelPrimary)
+	case OpAnd, OpOr:
+		opLevel, word := levelAnd, " and "
+		if r.Op == OpOr {
+			opLevel, word = levelOr, " or "
+		}
+		if level < opLevel {
+			b.WriteString("(")
+		}
+		r.X.format(b, opLevel)
+		b.WriteString(word)
+		r.Y.format(b, opLevel)
+		if level < opLevel {
+			b.WriteString(")")
+		}
+	default:
+		b.WriteString("/* unknown opcode " + strconv.Itoa(int(r.Op)) + " */")
+	}
+}
+
+func (m Match) format(b *strings.Builder) {
+	switch m.Op {
+	case MatchExists:
+		b.WriteString(" /* exists */")
+	case MatchAbsent:
+		b.WriteString(" absent")
+	case MatchEqual:
+		b.WriteString(" = ")
+		writeData(b, m.Value, false)
+	case MatchContains:
+		b.WriteString(" ~ ")
+		writeData(b, m.Value, false)
+	case MatchBeginsWith:
+		b.WriteString(" = ")
+		writeData(b, m.Value, false)
+		b.WriteString("*")
+	case MatchEndsWith:
+		b.WriteString(" = *")
+		writeData(b, m.Value, false)
+	case MatchLessThan, MatchGreaterThan, MatchLessEqual, MatchGreaterEqual:
+		b.WriteString(" " + compareOps[m.Op-MatchLessThan] + " ")
+		writeData(b, m.Value, false)
+	case MatchOn, MatchBefore, MatchAfter, MatchOnOrBefore, MatchOnOrAfter:
+		op := "="
+		if m.Op != MatchOn {
+			op = compareOps[m.Op-MatchBefore]
+		}
+		b.WriteString(" " + op + " timestamp ")
+		b.WriteString(strconv.Quote(m.Time.UTC().Format(timestampLayout)))
+	}
+}
+
+// compareOps are the operators of the less/greater matches, in opcode
+// order for both the string and the date forms.
+var compareOps = []string{"<", ">", "<=", ">="}
+
+func writeSlot(b *strings.Builder, slot int32) {
+	switch slot {
+	case SlotLeaf:
+		b.WriteString("leaf")
+	case SlotAnchor:
+		b.WriteString("root")
+	default:
+		b.WriteString(strconv.Itoa(int(slot)))
+	}
+}
+
+func writeHash(b *strings.Builder, h []byte) {
+	b.WriteString(`H"`)
+	b.WriteString(hex.EncodeToString(h))
+	b.WriteString(`"`)
+}
+
+// writeData writes s bare when it is a simple word, quoted when it is
+// printable, and as 0x hex otherwise. Dots are allowed in bare words only
+// where the grammar expects dotted names.
+func writeData(b *strings.Builder, s string, dotOK bool) {
+	const (
+		simple = iota
+		printable
+		binary
+	)
+	mode := simple
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isAlnum(c) || (c == '.' && dotOK):
+			if i == 0 && isDigit(c) {
+				mode = printable
+			}
+		case c >= 0x20 && c < 0x7f:
+			mode = printable
+		default:
+			mode = binary
+		}
+		if mode == binary {
+			break
+		}
+	}
+	if s == "" {
+		mode = printable
+	}
+	switch mode {
+	case simple:
+		b.WriteString(s)
+	case printable:
+		b.WriteByte('"')
+		for i := 0; i < len(s); i++ {
+			if s[i] == '"' || s[i] == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(s[i])
+		}
+		b.WriteByte('"')
+	default:
+		b.WriteString("0x" + hex.EncodeToString([]byte(s)))
+	}
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,374 @@
+package csreq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appleEpoch is the reference date of CFAbsoluteTime, in which date
+// matches are encoded.
+var appleEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// maxDepth bounds expression nesting when decoding untrusted blobs.
+const maxDepth = 256
+
+var errTruncated = errors.New("csreq: truncated requirement")
+
+// Marshal returns the requirement as a binary requirement blob.
+func (r *Requirement) Marshal() ([]byte, error) {
+	body := binary.BigEndian.AppendUint32(nil, exprForm)
+	body, err := r.appendExpr(body)
+	if err != nil {
+		return nil, err
+	}
+	b := binary.BigEndian.AppendUint32(nil, MagicRequirement)
+	b = binary.BigEndian.AppendUint32(b, uint32(8+len(body)))
+	return append(b, body...), nil
+}
+
+func (r *Requirement) appendExpr(b []byte) ([]byte, error) {
+	if r == nil {
+		return nil, errors.New("csreq: missing operand")
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(r.Op))
+	var err error
+	switch r.Op {
+	case OpFalse, OpTrue, OpAppleAnchor, OpTrustedCerts, OpAppleGenericAnchor, OpNotarized, OpLegacyDevID:
+	case OpIdent, OpNamedAnchor, OpNamedCode:
+		b = appendData(b, []byte(r.Name))
+	case OpAnchorHash:
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Slot))
+		b = appendData(b, r.Hash)
+	case OpCDHash:
+		b = appendData(b, r.Hash)
+	case OpInfoKeyValue:
+		b = appendData(b, []byte(r.Name))
+		b = appendData(b, []byte(r.Match.Value))
+	case OpAnd, OpOr:
+		if b, err = r.X.appendExpr(b); err != nil {
+			return nil, err
+		}
+		return r.Y.appendExpr(b)
+	case OpNot:
+		return r.X.appendExpr(b)
+	case OpInfoKeyField, OpEntitlementField:
+		b = appendData(b, []byte(r.Name))
+		b = r.Match.append(b)
+	case OpCertField:
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Slot))
+		b = appendData(b, []byte(r.Name))
+		b = r.Match.append(b)
+	case OpTrustedCert:
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Slot))
+	case OpCertGeneric, OpCertPolicy, OpCertFieldDate:
+		oid, err := encodeOID(r.Name)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Slot))
+		b = appendData(b, oid)
+		b = r.Match.append(b)
+	case OpPlatform:
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Platform))
+	default:
+		return nil, fmt.Errorf("csreq: unknown opcode %d", r.Op)
+	}
+	return b, nil
+}
+
+func (m Match) append(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(m.Op))
+	switch {
+	case m.Op.hasValue():
+		b = appendData(b, []byte(m.Value))
+	case m.Op.isDate():
+		b = binary.BigEndian.AppendUint64(b, uint64(m.Time.Unix()-appleEpoch.Unix()))
+	}
+	return b
+}
+
+// appendData appends a length-prefixed value padded to 4 bytes.
+func appendData(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	for n := len(data); n%4 != 0; n++ {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// Unmarshal parses a binary requirement blob.
+func Unmarshal(blob []byte) (*Requirement, error) {
+	if len(blob) < 12 {
+		return nil, errTruncated
+	}
+	if magic := binary.BigEndian.Uint32(blob); magic != MagicRequirement {
+		return nil, fmt.Errorf("csreq: bad requirement magic %#x", magic)
+	}
+	length := binary.BigEndian.Uint32(blob[4:])
+	if length < 12 || int(length) > len(blob) {
+		return nil, errTruncated
+	}
+	if kind := binary.BigEndian.Uint32(blob[8:]); kind != exprForm {
+		return nil, fmt.Errorf("csreq: unsupported requirement kind %d", kind)
+	}
+	d := &decoder{data: blob[12:length]}
+	r, err := d.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// decoder reads an expression in opcode form.
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	if len(d.data) < 4 {
+		return 0, errTruncated
+	}
+	v := binary.BigEndian.Uint32(d.data)
+	d.data = d.data[4:]
+	return v, nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	padded := (uint64(n) + 3) &^ 3
+	if uint64(len(d.data)) < padded {
+		return nil, errTruncated
+	}
+	v := d.data[:n:n]
+	d.data = d.data[padded:]
+	return v, nil
+}
+
+func (d *decoder) expr(depth int) (*Requirement, error) {
+	if depth > maxDepth {
+		return nil, errors.New("csreq: requirement nested too deeply")
+	}
+	op, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	r := &Requirement{Op: Op(op &^ opFlagMask)}
+	var data []byte
+	switch r.Op {
+	case OpFalse, OpTrue, OpAppleAnchor, OpTrustedCerts, OpAppleGenericAnchor, OpNotarized, OpLegacyDevID:
+	case OpIdent, OpNamedAnchor, OpNamedCode:
+		data, err = d.bytes()
+		r.Name = string(data)
+	case OpAnchorHash:
+		if r.Slot, err = d.slot(); err == nil {
+			r.Hash, err = d.bytes()
+		}
+	case OpCDHash:
+		r.Hash, err = d.bytes()
+	case OpInfoKeyValue:
+		if data, err = d.bytes(); err == nil {
+			r.Name = string(data)
+			data, err = d.bytes()
+			r.Match = Match{Op: MatchEqual, Value: string(data)}
+		}
+	case OpAnd, OpOr:
+		if r.X, err = d.expr(depth + 1); err == nil {
+			r.Y, err = d.expr(depth + 1)
+		}
+	case OpNot:
+		r.X, err = d.expr(depth + 1)
+	case OpInfoKeyField, OpEntitlementField:
+		if data, err = d.bytes(); err == nil {
+			r.Name = string(data)
+			r.Match, err = d.match()
+		}
+	case OpCertField:
+		if r.Slot, err = d.slot(); err == nil {
+			if data, err = d.bytes(); err == nil {
+				r.Name = string(data)
+				r.Match, err = d.match()
+			}
+		}
+	case OpTrustedCert:
+		r.Slot, err = d.slot()
+	case OpCertGeneric, OpCertPolicy, OpCertFieldDate:
+		if r.Slot, err = d.slot(); err == nil {
+			if data, err = d.bytes(); err == nil {
+				if r.Name, err = decodeOID(data); err == nil {
+					r.Match, err = d.match()
+				}
+			}
+		}
+	case OpPlatform:
+		var v uint32
+		v, err = d.uint32()
+		r.Platform = int32(v)
+	default:
+		return nil, fmt.Errorf("csreq: unknown opcode %d", r.Op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (d *decoder) slot() (int32, error) {
+	v, err := d.uint32()
+	return int32(v), err
+}
+
+func (d *decoder) match() (Match, error) {
+	op, err := d.uint32()
+	if err != nil {
+		return Match{}, err
+	}
+	m := Match{Op: MatchOp(op)}
+	switch {
+	case m.Op == MatchExists || m.Op == MatchAbsent:
+	case m.Op.hasValue():
+		data, err := d.bytes()
+		if err != nil {
+			return Match{}, err
+		}
+		m.Value = string(data)
+	case m.Op.isDate():
+		if len(d.data) < 8 {
+			return Match{}, errTruncated
+		}
+		secs := int64(binary.BigEndian.Uint64(d.data))
+		d.data = d.data[8:]
+		m.Time = time.Unix(appleEpoch.Unix()+secs, 0).UTC()
+	default:
+		return Match{}, fmt.Errorf("csreq: unknown match operation %d", m.Op)
+	}
+	return m, nil
+}
+
+// Marshal returns the set as a binary requirements blob (magic
+// 0xfade0c01), with the requirements in ascending type order.
+func (s Set) Marshal() ([]byte, error) {
+	types := s.types()
+	header := 12 + 8*len(types)
+	var index, body []byte
+	for _, t := range types {
+		blob, err := s[t].Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("%s requirement: %w", t, err)
+		}
+		index = binary.BigEndian.AppendUint32(index, uint32(t))
+		index = binary.BigEndian.AppendUint32(index, uint32(header+len(body)))
+		body = append(body, blob...)
+	}
+	b := binary.BigEndian.AppendUint32(nil, MagicRequirements)
+	b = binary.BigEndian.AppendUint32(b, uint32(header+len(body)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(types)))
+	b = append(b, index...)
+	return append(b, body...), nil
+}
+
+// UnmarshalSet parses a binary requirements blob.
+func UnmarshalSet(blob []byte) (Set, error) {
+	if len(blob) < 12 {
+		return nil, errTruncated
+	}
+	if magic := binary.BigEndian.Uint32(blob); magic != MagicRequirements {
+		return nil, fmt.Errorf("csreq: bad requirements magic %#x", magic)
+	}
+	length := binary.BigEndian.Uint32(blob[4:])
+	count := binary.BigEndian.Uint32(blob[8:])
+	if length < 12 || int(length) > len(blob) || uint64(count)*8 > uint64(length)-12 {
+		return nil, errTruncated
+	}
+	blob = blob[:length]
+	s := make(Set, count)
+	for i := range count {
+		entry := blob[12+8*i:]
+		t := Type(binary.BigEndian.Uint32(entry))
+		off := binary.BigEndian.Uint32(entry[4:])
+		if off >= length {
+			return nil, errTruncated
+		}
+		r, err := Unmarshal(blob[off:])
+		if err != nil {
+			return nil, fmt.Errorf("%s requirement: %w", t, err)
+		}
+		s[t] = r
+	}
+	return s, nil
+}
+
+// encodeOID returns the DER contents of a dotted object identifier.
+func encodeOID(dotted string) ([]byte, error) {
+	parts := strings.Split(dotted, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("csreq: invalid OID %q", dotted)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("csreq: invalid OID %q", dotted)
+		}
+		arcs[i] = v
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] >= 40) {
+		return nil, fmt.Errorf("csreq: invalid OID %q", dotted)
+	}
+	b := appendBase128(nil, arcs[0]*40+arcs[1])
+	for _, arc := range arcs[2:] {
+		b = appendBase128(b, arc)
+	}
+	return b, nil
+}
+
+func appendBase128(b []byte, v uint64) []byte {
+	n := 1
+	for t := v >> 7; t != 0; t >>= 7 {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := byte(v>>(7*i)) & 0x7f
+		if i != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// decodeOID returns the dotted form of DER object identifier contents.
+func decodeOID(der []byte) (string, error) {
+	var arcs []string
+	var v uint64
+	for i, c := range der {
+		if v > 1<<56 {
+			return "", errors.New("csreq: OID arc too large")
+		}
+		v = v<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			if i == len(der)-1 {
+				return "", errors.New("csreq: truncated OID")
+			}
+			continue
+		}
+		if arcs == nil {
+			first := min(v/40, 2)
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(v-40*first, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(v, 10))
+		}
+		v = 0
+	}
+	if arcs == nil {
+		return "", errors.New("csreq: empty OID")
+	}
+	return strings.Join(arcs, "."), nil
+}
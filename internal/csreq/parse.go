@@ -0,0 +1,591 @@
+package csreq
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse compiles a requirement in the code requirement language, such as
+//
+//	identifier "com.example.app" and anchor apple generic and
+//	certificate leaf[subject.OU] = ABCDE12345
+//
+// Comments in C, C++ and shell style are ignored, so the output of
+// `codesign --display --requirements -` for a single requirement can be
+// passed back in once its "designated =>" prefix is removed.
+func Parse(text string) (*Requirement, error) {
+	p, err := newParser(text)
+	if err != nil {
+		return nil, err
+	}
+	r, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return r, nil
+}
+
+// ParseSet compiles a requirement set written as "type => requirement"
+// entries, for example
+//
+//	designated => identifier "com.example.app" and anchor apple generic
+//	host => anchor apple
+func ParseSet(text string) (Set, error) {
+	p, err := newParser(text)
+	if err != nil {
+		return nil, err
+	}
+	s := make(Set)
+	for p.tok.kind != tokEOF {
+		typ, ok := p.requirementType()
+		if !ok {
+			return nil, p.errorf("expected requirement type, found %s", p.tok)
+		}
+		if _, dup := s[typ]; dup {
+			return nil, p.errorf("duplicate %s requirement", typ)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("=>"); err != nil {
+			return nil, err
+		}
+		if s[typ], err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokWord             // bare word or number
+	tokString           // quoted string
+	tokHash             // H"hex"
+	tokHex              // 0xhex
+	tokPunct            // operator or bracket
+)
+
+type token struct {
+	kind tokenKind
+	text string // word, punctuation or decoded string
+	data []byte // decoded hash or hex bytes
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of requirement"
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokHash:
+		return `H"` + hex.EncodeToString(t.data) + `"`
+	case tokHex:
+		return "0x" + hex.EncodeToString(t.data)
+	}
+	return strconv.Quote(t.text)
+}
+
+// is reports whether t is the given word or punctuation.
+func (t token) is(s string) bool {
+	return (t.kind == tokWord || t.kind == tokPunct) && t.text == s
+}
+
+type parser struct {
+	src string
+	off int
+	tok token
+}
+
+func newParser(text string) (*parser, error) {
+	p := &parser{src: text}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("csreq: offset %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func isWordByte(c byte) bool {
+	return isAlnum(c) || c == '.' || c == '_' || c == '-'
+}
+
+// next advances to the next token.
+func (p *parser) next() error {
+	src := p.src
+	for p.off < len(src) {
+		switch c := src[p.off]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.off++
+		case c == '#' || strings.HasPrefix(src[p.off:], "//"):
+			if i := strings.IndexByte(src[p.off:], '\n'); i >= 0 {
+				p.off += i + 1
+			} else {
+				p.off = len(src)
+			}
+		case strings.HasPrefix(src[p.off:], "/*"):
+			i := strings.Index(src[p.off+2:], "*/")
+			if i < 0 {
+				p.tok = token{pos: p.off}
+				return p.errorf("unterminated comment")
+			}
+			p.off += i + 4
+		default:
+			goto scan
+		}
+	}
+	p.tok = token{kind: tokEOF, pos: p.off}
+	return nil
+
+scan:
+	start := p.off
+	p.tok = token{pos: start}
+	c := src[start]
+	switch {
+	case c == '"':
+		s, err := p.quoted()
+		if err != nil {
+			return err
+		}
+		p.tok.kind, p.tok.text = tokString, s
+	case c == 'H' && start+1 < len(src) && src[start+1] == '"':
+		p.off++
+		s, err := p.quoted()
+		if err != nil {
+			return err
+		}
+		data, err := hex.DecodeString(s)
+		if err != nil {
+			return p.errorf("invalid hash %q", s)
+		}
+		p.tok.kind, p.tok.data = tokHash, data
+	case isWordByte(c):
+		for p.off < len(src) && isWordByte(src[p.off]) {
+			p.off++
+		}
+		word := src[start:p.off]
+		if strings.HasPrefix(word, "0x") {
+			data, err := hex.DecodeString(word[2:])
+			if err != nil {
+				return p.errorf("invalid hex constant %q", word)
+			}
+			p.tok.kind, p.tok.data = tokHex, data
+			break
+		}
+		p.tok.kind, p.tok.text = tokWord, word
+	default:
+		p.tok.kind = tokPunct
+		for _, op := range []string{"=>", "<=", ">=", "&&", "||"} {
+			if strings.HasPrefix(src[start:], op) {
+				p.tok.text = op
+				p.off += len(op)
+				return nil
+			}
+		}
+		if !strings.ContainsRune("()[]!=<>~*", rune(c)) {
+			return p.errorf("unexpected character %q", c)
+		}
+		p.tok.text = string(c)
+		p.off++
+	}
+	return nil
+}
+
+// quoted scans a double-quoted string starting at p.off.
+func (p *parser) quoted() (string, error) {
+	var b strings.Builder
+	for i := p.off + 1; i < len(p.src); i++ {
+		switch c := p.src[i]; c {
+		case '"':
+			p.off = i + 1
+			return b.String(), nil
+		case '\\':
+			if i+1 < len(p.src) {
+				i++
+				c = p.src[i]
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) expect(s string) error {
+	if !p.tok.is(s) {
+		return p.errorf("expected %q, found %s", s, p.tok)
+	}
+	return p.next()
+}
+
+// accept consumes the token if it is s.
+func (p *parser) accept(s string) (bool, error) {
+	if !p.tok.is(s) {
+		return false, nil
+	}
+	return true, p.next()
+}
+
+// requirementType reports whether the current token names a requirement
+// type.
+func (p *parser) requirementType() (Type, bool) {
+	if p.tok.kind != tokWord {
+		return 0, false
+	}
+	for t, name := range typeNames {
+		if p.tok.text == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// expr parses a disjunction, the loosest-binding form.
+func (p *parser) expr() (*Requirement, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("or") || p.tok.is("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = &Requirement{Op: OpOr, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (*Requirement, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.is("and") || p.tok.is("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = &Requirement{Op: OpAnd, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) unary() (*Requirement, error) {
+	if p.tok.is("!") || p.tok.is("not") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Requirement{Op: OpNot, X: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (*Requirement, error) {
+	tok := p.tok
+	if tok.is("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		var r *Requirement
+		var err error
+		if p.tok.kind == tokString {
+			// (name) is a named code requirement.
+			r = &Requirement{Op: OpNamedCode, Name: p.tok.text}
+			err = p.next()
+		} else {
+			r, err = p.expr()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r, p.expect(")")
+	}
+	if tok.kind != tokWord {
+		return nil, p.errorf("expected requirement, found %s", tok)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	switch tok.text {
+	case "always", "true":
+		return &Requirement{Op: OpTrue}, nil
+	case "never", "false":
+		return &Requirement{Op: OpFalse}, nil
+	case "notarized":
+		return &Requirement{Op: OpNotarized}, nil
+	case "legacy":
+		return &Requirement{Op: OpLegacyDevID}, nil
+	case "identifier":
+		if _, err := p.accept("="); err != nil {
+			return nil, err
+		}
+		name, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return &Requirement{Op: OpIdent, Name: name}, nil
+	case "cdhash":
+		if _, err := p.accept("="); err != nil {
+			return nil, err
+		}
+		h, err := p.hash()
+		if err != nil {
+			return nil, err
+		}
+		return &Requirement{Op: OpCDHash, Hash: h}, nil
+	case "platform":
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		n, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		return &Requirement{Op: OpPlatform, Platform: n}, nil
+	case "info", "entitlement":
+		key, err := p.bracketed()
+		if err != nil {
+			return nil, err
+		}
+		m, err := p.match()
+		if err != nil {
+			return nil, err
+		}
+		op := OpInfoKeyField
+		if tok.text == "entitlement" {
+			op = OpEntitlementField
+		}
+		return &Requirement{Op: op, Name: key, Match: m}, nil
+	case "anchor":
+		return p.anchor()
+	case "certificate", "cert":
+		slot := int32(SlotLeaf)
+		if !p.tok.is("[") && !p.tok.is("=") && !p.tok.is("trusted") {
+			var err error
+			if slot, err = p.slot(); err != nil {
+				return nil, err
+			}
+		}
+		return p.certificate(slot)
+	}
+	return nil, fmt.Errorf("csreq: offset %d: unknown requirement %q", tok.pos, tok.text)
+}
+
+// anchor parses the rest of an "anchor ..." requirement.
+func (p *parser) anchor() (*Requirement, error) {
+	switch {
+	case p.tok.is("apple"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.accept("generic"); ok || err != nil {
+			return &Requirement{Op: OpAppleGenericAnchor}, err
+		}
+		if p.tok.kind == tokString || (p.tok.kind == tokWord && !p.isKeyword()) {
+			name := p.tok.text
+			return &Requirement{Op: OpNamedAnchor, Name: name}, p.next()
+		}
+		return &Requirement{Op: OpAppleAnchor}, nil
+	case p.tok.is("trusted"):
+		return &Requirement{Op: OpTrustedCerts}, p.next()
+	}
+	return p.certificate(SlotAnchor)
+}
+
+// isKeyword reports whether the current word continues an expression
+// rather than naming an anchor.
+func (p *parser) isKeyword() bool {
+	if _, ok := p.requirementType(); ok {
+		return true
+	}
+	return p.tok.is("and") || p.tok.is("or")
+}
+
+// certificate parses what follows the slot of a certificate requirement.
+func (p *parser) certificate(slot int32) (*Requirement, error) {
+	switch {
+	case p.tok.is("trusted"):
+		return &Requirement{Op: OpTrustedCert, Slot: slot}, p.next()
+	case p.tok.is("["):
+		field, err := p.bracketed()
+		if err != nil {
+			return nil, err
+		}
+		m, err := p.match()
+		if err != nil {
+			return nil, err
+		}
+		r := &Requirement{Op: OpCertField, Slot: slot, Name: field, Match: m}
+		for prefix, op := range map[string]Op{"field.": OpCertGeneric, "policy.": OpCertPolicy, "timestamp.": OpCertFieldDate} {
+			if oid, ok := strings.CutPrefix(field, prefix); ok {
+				if _, err := encodeOID(oid); err != nil {
+					return nil, err
+				}
+				r.Op, r.Name = op, oid
+			}
+		}
+		return r, nil
+	}
+	if _, err := p.accept("="); err != nil {
+		return nil, err
+	}
+	h, err := p.hash()
+	if err != nil {
+		return nil, err
+	}
+	return &Requirement{Op: OpAnchorHash, Slot: slot, Hash: h}, nil
+}
+
+func (p *parser) slot() (int32, error) {
+	switch {
+	case p.tok.is("leaf"):
+		return SlotLeaf, p.next()
+	case p.tok.is("root"), p.tok.is("anchor"):
+		return SlotAnchor, p.next()
+	}
+	return p.integer()
+}
+
+func (p *parser) integer() (int32, error) {
+	if p.tok.kind != tokWord {
+		return 0, p.errorf("expected number, found %s", p.tok)
+	}
+	n, err := strconv.ParseInt(p.tok.text, 10, 32)
+	if err != nil {
+		return 0, p.errorf("expected number, found %s", p.tok)
+	}
+	return int32(n), p.next()
+}
+
+// bracketed parses "[" key "]".
+func (p *parser) bracketed() (string, error) {
+	if err := p.expect("["); err != nil {
+		return "", err
+	}
+	key, err := p.value()
+	if err != nil {
+		return "", err
+	}
+	return key, p.expect("]")
+}
+
+// value parses a bare word, quoted string or 0x hex constant.
+func (p *parser) value() (string, error) {
+	var v string
+	switch p.tok.kind {
+	case tokWord, tokString:
+		v = p.tok.text
+	case tokHex, tokHash:
+		v = string(p.tok.data)
+	default:
+		return "", p.errorf("expected value, found %s", p.tok)
+	}
+	return v, p.next()
+}
+
+func (p *parser) hash() ([]byte, error) {
+	if p.tok.kind != tokHash && p.tok.kind != tokHex {
+		return nil, p.errorf(`expected H"hash", found %s`, p.tok)
+	}
+	h := p.tok.data
+	return h, p.next()
+}
+
+// match parses the test after a field. A missing test means the field
+// must exist.
+func (p *parser) match() (Match, error) {
+	switch {
+	case p.tok.is("exists"):
+		return Match{Op: MatchExists}, p.next()
+	case p.tok.is("absent"):
+		return Match{Op: MatchAbsent}, p.next()
+	case p.tok.is("~"):
+		if err := p.next(); err != nil {
+			return Match{}, err
+		}
+		v, err := p.value()
+		return Match{Op: MatchContains, Value: v}, err
+	case p.tok.is("="):
+		if err := p.next(); err != nil {
+			return Match{}, err
+		}
+		if p.tok.is("timestamp") {
+			return p.timestamp(MatchOn)
+		}
+		prefix, err := p.accept("*")
+		if err != nil {
+			return Match{}, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return Match{}, err
+		}
+		suffix, err := p.accept("*")
+		if err != nil {
+			return Match{}, err
+		}
+		m := Match{Op: MatchEqual, Value: v}
+		switch {
+		case prefix && suffix:
+			m.Op = MatchContains
+		case prefix:
+			m.Op = MatchEndsWith
+		case suffix:
+			m.Op = MatchBeginsWith
+		}
+		return m, nil
+	}
+	for i, op := range compareOps {
+		if !p.tok.is(op) {
+			continue
+		}
+		if err := p.next(); err != nil {
+			return Match{}, err
+		}
+		if p.tok.is("timestamp") {
+			return p.timestamp(MatchBefore + MatchOp(i))
+		}
+		v, err := p.value()
+		return Match{Op: MatchLessThan + MatchOp(i), Value: v}, err
+	}
+	return Match{Op: MatchExists}, nil
+}
+
+// timestamp parses `timestamp "..."` for a date match.
+func (p *parser) timestamp(op MatchOp) (Match, error) {
+	if err := p.next(); err != nil {
+		return Match{}, err
+	}
+	if p.tok.kind != tokString {
+		return Match{}, p.errorf("expected timestamp string, found %s", p.tok)
+	}
+	t, err := time.Parse(timestampLayout, p.tok.text)
+	if err != nil {
+		return Match{}, p.errorf("invalid timestamp %q", p.tok.text)
+	}
+	return Match{Op: op, Time: t.UTC()}, p.next()
+}
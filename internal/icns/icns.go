@@ -0,0 +1,207 @@
+// Package icns reads and writes Apple icon image (.icns) files.
+//
+// An .icns file is a sequence of elements, each a four-character type
+// and a length followed by data. Encode renders an image at every size
+// an app icon needs, from 16x16 to 512x512@2x, and stores each as PNG,
+// as iconutil does. Parse lists the images in an existing file.
+package icns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+// magic starts every .icns file.
+const magic = "icns"
+
+// iconType describes an element type holding an image.
+type iconType struct {
+	name   string
+	size   int // in points
+	scale  int
+	format string // storage format, when fixed by the type
+}
+
+// types are the image element types, in the order Encode writes them.
+// Types after the first ten are only recognized by Parse.
+var types = []iconType{
+	{"icp4", 16, 1, ""},
+	{"ic11", 16, 2, ""},
+	{"icp5", 32, 1, ""},
+	{"ic12", 32, 2, ""},
+	{"ic07", 128, 1, ""},
+	{"ic13", 128, 2, ""},
+	{"ic08", 256, 1, ""},
+	{"ic14", 256, 2, ""},
+	{"ic09", 512, 1, ""},
+	{"ic10", 512, 2, ""},
+	{"icp6", 64, 1, ""},
+	{"ic04", 16, 1, ""},
+	{"ic05", 32, 1, ""},
+	{"is32", 16, 1, "rgb"},
+	{"il32", 32, 1, "rgb"},
+	{"ih32", 48, 1, "rgb"},
+	{"it32", 128, 1, "rgb"},
+	{"s8mk", 16, 1, "mask"},
+	{"l8mk", 32, 1, "mask"},
+	{"h8mk", 48, 1, "mask"},
+	{"t8mk", 128, 1, "mask"},
+}
+
+// encodedTypes is the number of leading types Encode writes.
+const encodedTypes = 10
+
+func lookup(name string) (iconType, bool) {
+	for _, t := range types {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return iconType{}, false
+}
+
+// Icon describes an image stored in an .icns file.
+type Icon struct {
+	// Type is the element type, such as "ic10".
+	Type string
+
+	// Size is the icon size in points and Scale its pixel density, so
+	// "ic10" is 512 points at scale 2.
+	Size, Scale int
+
+	// Width and Height are the image dimensions in pixels, read from the
+	// image data when it is PNG.
+	Width, Height int
+
+	// Format is the storage format: "png", "jpeg2000", "argb", "rgb" or
+	// "mask".
+	Format string
+
+	// Len is the length of the image data in bytes.
+	Len int
+}
+
+// String returns the size in the form iconutil uses for file names,
+// such as "16x16" or "512x512@2x".
+func (ic Icon) String() string {
+	if ic.Size == 0 {
+		return fmt.Sprintf("%dx%d", ic.Width, ic.Height)
+	}
+	if ic.Scale > 1 {
+		return fmt.Sprintf("%dx%d@%dx", ic.Size, ic.Size, ic.Scale)
+	}
+	return fmt.Sprintf("%dx%d", ic.Size, ic.Size)
+}
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// Parse lists the images in an .icns file, in file order. Elements that
+// hold no image, such as the table of contents, are skipped.
+func Parse(data []byte) ([]Icon, error) {
+	if len(data) < 8 || string(data[:4]) != magic {
+		return nil, errors.New("icns: not an icns file")
+	}
+	if n := binary.BigEndian.Uint32(data[4:8]); int64(n) != int64(len(data)) {
+		return nil, fmt.Errorf("icns: header length %d, file length %d", n, len(data))
+	}
+	var icons []Icon
+	for rest := data[8:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return nil, errors.New("icns: truncated element header")
+		}
+		name := string(rest[:4])
+		n := binary.BigEndian.Uint32(rest[4:8])
+		if n < 8 || int64(n) > int64(len(rest)) {
+			return nil, fmt.Errorf("icns: element %q: invalid length %d", name, n)
+		}
+		body := rest[8:n]
+		rest = rest[n:]
+
+		t, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		ic := Icon{
+			Type:   name,
+			Size:   t.size,
+			Scale:  t.scale,
+			Width:  t.size * t.scale,
+			Height: t.size * t.scale,
+			Format: t.format,
+			Len:    len(body),
+		}
+		switch {
+		case ic.Format != "":
+		case bytes.HasPrefix(body, pngMagic):
+			ic.Format = "png"
+			cfg, err := png.DecodeConfig(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("icns: element %q: %w", name, err)
+			}
+			ic.Width, ic.Height = cfg.Width, cfg.Height
+		case bytes.HasPrefix(body, []byte("ARGB")):
+			ic.Format = "argb"
+		default:
+			ic.Format = "jpeg2000"
+		}
+		icons = append(icons, ic)
+	}
+	return icons, nil
+}
+
+// Encode writes img to w as an .icns file holding every app icon size,
+// from 16x16 to 512x512@2x. A non-square image is centered on a
+// transparent square. For the sharpest large icons, img should be at
+// least 1024x1024 pixels.
+func Encode(w io.Writer, img image.Image) error {
+	if b := img.Bounds(); b.Empty() {
+		return errors.New("icns: empty image")
+	}
+	src := premultiplied(img)
+
+	type element struct {
+		name string
+		data []byte
+	}
+	var elems []element
+	rendered := map[int][]byte{} // pixel size -> PNG
+	for _, t := range types[:encodedTypes] {
+		px := t.size * t.scale
+		data, ok := rendered[px]
+		if !ok {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, resize(src, px)); err != nil {
+				return fmt.Errorf("icns: %w", err)
+			}
+			data = buf.Bytes()
+			rendered[px] = data
+		}
+		elems = append(elems, element{t.name, data})
+	}
+
+	// The table of contents lists each element's type and length.
+	toc := make([]byte, 0, 8*len(elems))
+	total := 8 + 8 + 8*len(elems)
+	for _, e := range elems {
+		toc = append(toc, e.name...)
+		toc = binary.BigEndian.AppendUint32(toc, uint32(8+len(e.data)))
+		total += 8 + len(e.data)
+	}
+	elems = append([]element{{"TOC ", toc}}, elems...)
+
+	out := make([]byte, 0, total)
+	out = append(out, magic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(total))
+	for _, e := range elems {
+		out = append(out, e.name...)
+		out = binary.BigEndian.AppendUint32(out, uint32(8+len(e.data)))
+		out = append(out, e.data...)
+	}
+	_, err := w.Write(out)
+	return err
+}
@@ -0,0 +1,101 @@
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestEncodeParse(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1024, 1024))
+	for y := range 1024 {
+		for x := range 1024 {
+			src.Set(x, y, color.NRGBA{uint8(x / 4), uint8(y / 4), 0x80, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	icons, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"icp4 16x16 16", "ic11 16x16@2x 32", "icp5 32x32 32", "ic12 32x32@2x 64",
+		"ic07 128x128 128", "ic13 128x128@2x 256", "ic08 256x256 256",
+		"ic14 256x256@2x 512", "ic09 512x512 512", "ic10 512x512@2x 1024",
+	}
+	if len(icons) != len(want) {
+		t.Fatalf("Parse returned %d icons, want %d: %v", len(icons), len(want), icons)
+	}
+	for i, ic := range icons {
+		got := fmt.Sprintf("%s %s %d", ic.Type, ic, ic.Width)
+		if got != want[i] || ic.Height != ic.Width || ic.Format != "png" {
+			t.Errorf("icon %d = %s (%dx%d %s), want %s", i, got, ic.Width, ic.Height, ic.Format, want[i])
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	// A wide image is centered, with transparent bands above and below.
+	src := image.NewRGBA(image.Rect(10, 10, 410, 210))
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	for y := 10; y < 210; y++ {
+		for x := 10; x < 410; x++ {
+			src.SetRGBA(x, y, red)
+		}
+	}
+	dst := resize(premultiplied(src), 32)
+	if got := dst.Bounds(); got != image.Rect(0, 0, 32, 32) {
+		t.Fatalf("bounds = %v", got)
+	}
+	for _, tc := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{16, 16, red},
+		{0, 8, red},
+		{31, 23, red},
+		{16, 7, color.RGBA{}},
+		{16, 24, color.RGBA{}},
+	} {
+		if got := dst.RGBAAt(tc.x, tc.y); got != tc.want {
+			t.Errorf("pixel %d,%d = %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	// Averaging a half-transparent edge does not darken it.
+	edge := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	edge.Set(0, 0, color.NRGBA{0xff, 0xff, 0xff, 0xff})
+	edge.Set(0, 1, color.NRGBA{0xff, 0xff, 0xff, 0xff})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resize(premultiplied(edge), 1)); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA); got.R < 0xfe || got.A < 0x7f || got.A > 0x80 {
+		t.Errorf("averaged edge = %v, want white at half opacity", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"PNG\x00\x00\x00\x08",
+		"icns\x00\x00\x00\x09x",
+		"icns\x00\x00\x00\x10ic07\x00\x00\x00\x20",
+		"icns\x00\x00\x00\x0cic07",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded", data)
+		}
+	}
+}
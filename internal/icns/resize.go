@@ -0,0 +1,93 @@
+package icns
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// premultiplied returns img as an *image.RGBA with its origin at 0,0.
+func premultiplied(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// weight is the contribution of source pixel index to a destination pixel.
+type weight struct {
+	index int
+	w     float32
+}
+
+// boxWeights returns, for each of n destination pixels, the source pixels
+// among m that it covers and how much of each. Weights for a pixel sum
+// to one. Downscaling averages the covered area; upscaling repeats
+// pixels.
+func boxWeights(m, n int) [][]weight {
+	scale := float64(m) / float64(n)
+	ws := make([][]weight, n)
+	for i := range ws {
+		lo, hi := float64(i)*scale, float64(i+1)*scale
+		for j := int(lo); j < m && float64(j) < hi; j++ {
+			w := math.Min(float64(j+1), hi) - math.Max(float64(j), lo)
+			if w > 0 {
+				ws[i] = append(ws[i], weight{j, float32(w / scale)})
+			}
+		}
+	}
+	return ws
+}
+
+// resize scales src to fit a size x size square, centered, and returns
+// the result. Filtering works on premultiplied colors, so transparent
+// pixels do not darken the edges of opaque ones.
+func resize(src *image.RGBA, size int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := size, size
+	if sw > sh {
+		dh = max(1, int(math.Round(float64(size)*float64(sh)/float64(sw))))
+	} else if sh > sw {
+		dw = max(1, int(math.Round(float64(size)*float64(sw)/float64(sh))))
+	}
+	ox, oy := (size-dw)/2, (size-dh)/2
+
+	// Scale rows, then columns.
+	xw := boxWeights(sw, dw)
+	tmp := make([]float32, sh*dw*4)
+	for y := range sh {
+		row := src.Pix[y*src.Stride:]
+		for x, ws := range xw {
+			var c [4]float32
+			for _, w := range ws {
+				p := row[w.index*4 : w.index*4+4]
+				for k := range c {
+					c[k] += float32(p[k]) * w.w
+				}
+			}
+			copy(tmp[(y*dw+x)*4:], c[:])
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	yw := boxWeights(sh, dh)
+	for y, ws := range yw {
+		row := dst.Pix[(oy+y)*dst.Stride+ox*4:]
+		for x := range dw {
+			var c [4]float32
+			for _, w := range ws {
+				p := tmp[(w.index*dw+x)*4:]
+				for k := range c {
+					c[k] += p[k] * w.w
+				}
+			}
+			for k := range c {
+				row[x*4+k] = uint8(min(255, max(0, math.Round(float64(c[k])))))
+			}
+		}
+	}
+	return dst
+}
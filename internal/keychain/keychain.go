@@ -0,0 +1,121 @@
+// Package keychain lists the code signing identities in the macOS
+// keychain search list using the security tool.
+package keychain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Identity is a valid code signing identity in the keychain.
+type Identity struct {
+	// SHA1 is the certificate's SHA-1 fingerprint in upper-case hex, as
+	// printed by security and accepted by codesign --sign.
+	SHA1 string
+
+	// Name is the certificate's common name.
+	Name string
+
+	// Certificate is the identity's certificate. It is nil if the
+	// certificate could not be exported from the keychain.
+	Certificate *x509.Certificate
+}
+
+// FindIdentities returns the valid code signing identities in the given
+// keychains, or in the default search list when none are given. The
+// private keys stay in the keychain; only the certificates are read.
+func FindIdentities(keychains ...string) ([]Identity, error) {
+	args := append([]string{"find-identity", "-v", "-p", "codesigning"}, keychains...)
+	out, err := exec.Command("security", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keychain: %w", err)
+	}
+	ids := ParseFindIdentity(out)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args = append([]string{"find-certificate", "-a", "-p"}, keychains...)
+	out, err = exec.Command("security", args...).Output()
+	if err != nil {
+		// The identities are still usable by name with codesign.
+		return ids, nil
+	}
+	certs := ParseFindCertificate(out)
+	for i := range ids {
+		ids[i].Certificate = certs[ids[i].SHA1]
+	}
+	return ids, nil
+}
+
+// ParseFindIdentity parses the output of `security find-identity -v`,
+// whose identity lines hold an index, a SHA-1 fingerprint and a quoted
+// name, as in
+//
+//	$ security find-identity -v -p codesigning
+//	  1) 0123456789ABCDEF0123456789ABCDEF01234567 "Developer ID Application: Name (TEAMID1234)"
+//
+// Duplicate fingerprints, which appear when a policy section is repeated,
+// are reported once.
+func ParseFindIdentity(out []byte) []Identity {
+	var ids []Identity
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		_, rest, ok := strings.Cut(line, ") ")
+		if !ok {
+			continue
+		}
+		hash, name, ok := strings.Cut(rest, " ")
+		if !ok || len(hash) != 2*sha1.Size || !isHex(hash) {
+			continue
+		}
+		start, end := strings.Index(name, `"`), strings.LastIndex(name, `"`)
+		if start < 0 || end <= start {
+			continue
+		}
+		hash = strings.ToUpper(hash)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		ids = append(ids, Identity{SHA1: hash, Name: name[start+1 : end]})
+	}
+	return ids
+}
+
+// ParseFindCertificate parses the output of `security find-certificate
+// -a -p`, returning the certificates keyed by upper-case SHA-1
+// fingerprint. Certificates that fail to parse are skipped.
+func ParseFindCertificate(out []byte) map[string]*x509.Certificate {
+	certs := make(map[string]*x509.Certificate)
+	for {
+		var block *pem.Block
+		block, out = pem.Decode(out)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		sum := sha1.Sum(cert.Raw)
+		certs[strings.ToUpper(hex.EncodeToString(sum[:]))] = cert
+	}
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,62 @@
+package keychain
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/testcert"
+)
+
+const findIdentityOutput = `Policy: Code Signing
+  Matching identities
+  1) 0123456789ABCDEF0123456789ABCDEF01234567 "Developer ID Application: Example Corp (ABCDE12345)"
+  2) 89abcdef0123456789abcdef0123456789abcdef "Apple Development: dev@example.com (FGHIJ67890)"
+     2 identities found
+
+  Valid identities only
+  1) 0123456789ABCDEF0123456789ABCDEF01234567 "Developer ID Application: Example Corp (ABCDE12345)"
+  2) 89abcdef0123456789abcdef0123456789abcdef "Apple Development: dev@example.com (FGHIJ67890)"
+     2 valid identities found
+`
+
+func TestParseFindIdentity(t *testing.T) {
+	ids := ParseFindIdentity([]byte(findIdentityOutput))
+	want := []Identity{
+		{SHA1: "0123456789ABCDEF0123456789ABCDEF01234567", Name: "Developer ID Application: Example Corp (ABCDE12345)"},
+		{SHA1: "89ABCDEF0123456789ABCDEF0123456789ABCDEF", Name: "Apple Development: dev@example.com (FGHIJ67890)"},
+	}
+	if len(ids) != len(want) {
+		t.Fatalf("got %d identities, want %d: %+v", len(ids), len(want), ids)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("identity %d = %+v, want %+v", i, ids[i], want[i])
+		}
+	}
+
+	if ids := ParseFindIdentity([]byte("     0 valid identities found\n")); len(ids) != 0 {
+		t.Errorf("got %d identities from empty output", len(ids))
+	}
+}
+
+func TestParseFindCertificate(t *testing.T) {
+	want, _ := testcert.New(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Developer ID Application: Example Corp (ABCDE12345)"}}, nil, nil)
+	der := want.Raw
+	out := "SHA-1 hash: ignored\n" + string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}))
+
+	certs := ParseFindCertificate([]byte(out))
+	sum := sha1.Sum(der)
+	cert := certs[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	if len(certs) != 1 || cert == nil {
+		t.Fatalf("got %d certificates, want the generated one", len(certs))
+	}
+	if cert.Subject.CommonName != want.Subject.CommonName {
+		t.Errorf("CommonName = %q", cert.Subject.CommonName)
+	}
+}
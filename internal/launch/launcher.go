@@ -44,6 +44,10 @@ type Config struct {
 	UIMode string
 	// IconPath is the path to an .icns file for the Dock icon (transform mode, regular UI only).
 	IconPath string
+	// IconData is an icon image, such as an .icns file macgo rendered, used instead of IconPath.
+	IconData []byte
+	// Signer selects the signer for single-process mode: "codesign", "builtin", or "" (auto).
+	Signer string
 }
 
 // Launcher defines the interface for launching applications.
@@ -3,6 +3,8 @@ package launch
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -31,6 +33,7 @@ import (
 //
 //   - PID Tracking: Child writes its PID to a control FIFO in the pipe directory
 //     after startup. Parent reads the PID (blocking, no polling) for signal forwarding.
+//     The child then reads URLs and files to open from the same FIFO (see ControlLink).
 //
 //   - Signal Forwarding: When parent receives SIGINT/SIGTERM (via context
 //     cancellation), it forwards these signals to the child before exiting.
@@ -57,7 +60,7 @@ type pipeSet struct {
 	stdin   string
 	stdout  string
 	stderr  string
-	control string // FIFO where child writes its PID
+	control string // FIFO where child writes its PID, then reads open events
 }
 
 // readChildPID opens the control FIFO and reads the child's PID.
@@ -457,9 +460,14 @@ func (s *ServicesLauncher) Launch(ctx context.Context, bundlePath, execPath stri
 		}
 	}
 
-	// Read child PID from control FIFO in background (for signal forwarding)
+	// Read child PID from control FIFO in background (for signal forwarding).
+	// After the handshake the child reads open events from the same FIFO,
+	// so publish it for bundle instances launched to open URLs or files.
+	defer unlinkControlPipe(bundlePath, pipes.control)
 	go func() {
-		s.readChildPID(pipes.control, 30*time.Second)
+		if s.readChildPID(pipes.control, 30*time.Second) > 0 {
+			s.linkControlPipe(bundlePath, pipes.control)
+		}
 	}()
 
 	// Set up I/O forwarding only if pipes are available
@@ -711,14 +719,7 @@ func (s *ServicesLauncher) createPipeDirectory() (string, error) {
 	// Clean up stale directories from previous runs (non-blocking)
 	go cleanupStalePipeDirectories()
 
-	// Use ~/Library/Application Support/macgo/ for security
-	// Falls back to /tmp/macgo/ if home dir unavailable
-	var baseDir string
-	if home, err := os.UserHomeDir(); err == nil {
-		baseDir = filepath.Join(home, "Library", "Application Support", "macgo", "pipes")
-	} else {
-		baseDir = filepath.Join(os.TempDir(), "macgo")
-	}
+	baseDir := pipeBaseDir()
 	if err := os.MkdirAll(baseDir, 0700); err != nil {
 		return "", fmt.Errorf("create macgo base directory %s: %w", baseDir, err)
 	}
@@ -732,6 +733,54 @@ func (s *ServicesLauncher) createPipeDirectory() (string, error) {
 	return pipeDir, nil
 }
 
+// pipeBaseDir returns the directory holding the pipe directories.
+// Uses ~/Library/Application Support/macgo/ for security and falls back
+// to /tmp/macgo/ if the home directory is unavailable.
+func pipeBaseDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, "Library", "Application Support", "macgo", "pipes")
+	}
+	return filepath.Join(os.TempDir(), "macgo")
+}
+
+// ControlLink returns the path of the symlink to the control FIFO of the
+// session running the bundle at bundlePath. Once the child has written
+// its PID, the parent links the FIFO there, so that an instance of the
+// bundle launched by LaunchServices to open a URL or document can pass
+// the request on to the running child. The link is named after a hash
+// of the resolved bundle path, which both sides can compute.
+func ControlLink(bundlePath string) string {
+	if resolved, err := filepath.EvalSymlinks(bundlePath); err == nil {
+		bundlePath = resolved
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(bundlePath)))
+	return filepath.Join(pipeBaseDir(), hex.EncodeToString(sum[:8])+".control")
+}
+
+// linkControlPipe points the ControlLink of bundlePath at controlPipe.
+func (s *ServicesLauncher) linkControlPipe(bundlePath, controlPipe string) {
+	link := ControlLink(bundlePath)
+	tmp := fmt.Sprintf("%s.%d", link, os.Getpid())
+	_ = os.Remove(tmp)
+	if err := os.Symlink(controlPipe, tmp); err != nil {
+		s.logger.Debug("failed to link control pipe", "link", link, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		s.logger.Debug("failed to link control pipe", "link", link, "error", err)
+	}
+}
+
+// unlinkControlPipe removes the ControlLink of bundlePath if it still
+// points at controlPipe, leaving links of later sessions in place.
+func unlinkControlPipe(bundlePath, controlPipe string) {
+	link := ControlLink(bundlePath)
+	if target, err := os.Readlink(link); err == nil && target == controlPipe {
+		_ = os.Remove(link)
+	}
+}
+
 // cleanupPipeDirectory removes the temporary pipe directory.
 func (s *ServicesLauncher) cleanupPipeDirectory(pipeDir string) {
 	if err := os.RemoveAll(pipeDir); err != nil {
@@ -742,13 +791,7 @@ func (s *ServicesLauncher) cleanupPipeDirectory(pipeDir string) {
 // cleanupStalePipeDirectories removes pipe directories older than 24 hours.
 // Called asynchronously on startup to prevent accumulation of stale directories.
 func cleanupStalePipeDirectories() {
-	var baseDir string
-	if home, err := os.UserHomeDir(); err == nil {
-		baseDir = filepath.Join(home, "Library", "Application Support", "macgo", "pipes")
-	} else {
-		baseDir = filepath.Join(os.TempDir(), "macgo")
-	}
-
+	baseDir := pipeBaseDir()
 	entries, err := os.ReadDir(baseDir)
 	if err != nil {
 		return // Directory may not exist yet
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"unsafe"
 
 	"github.com/ebitengine/purego"
 	"github.com/ebitengine/purego/objc"
+
+	"github.com/tmc/macgo/internal/codesig"
 )
 
 // singleProcessSentinel is the environment variable that indicates
@@ -128,7 +132,17 @@ func (t *SingleProcessLauncher) writeEntitlements(cfg *Config) (string, error) {
 }
 
 // codesign runs codesign on the binary with the given entitlements.
+// The built-in signer is used instead when selected by cfg.Signer or when
+// codesign is not installed.
 func (t *SingleProcessLauncher) codesign(binaryPath, entitlementsPath string, cfg *Config) error {
+	builtin, err := codesig.UseBuiltin(cfg.Signer, binaryPath)
+	if err != nil {
+		return fmt.Errorf("built-in signer: %w", err)
+	}
+	if builtin {
+		return t.builtinSign(binaryPath, entitlementsPath, cfg)
+	}
+
 	args := []string{
 		"--sign", "-", // ad-hoc
 		"--force",
@@ -152,6 +166,22 @@ func (t *SingleProcessLauncher) codesign(binaryPath, entitlementsPath string, cf
 	return nil
 }
 
+// builtinSign ad-hoc signs the binary in place with the pure-Go signer.
+// Like codesign, it uses the file name as the identifier.
+func (t *SingleProcessLauncher) builtinSign(binaryPath, entitlementsPath string, cfg *Config) error {
+	ents, err := os.ReadFile(entitlementsPath)
+	if err != nil {
+		return fmt.Errorf("read entitlements: %w", err)
+	}
+	if cfg.Debug {
+		t.logger.Debug("codesigning with built-in signer", "path", binaryPath)
+	}
+	return codesig.SignFile(binaryPath, codesig.SignOptions{
+		Identifier:   filepath.Base(binaryPath),
+		Entitlements: ents,
+	})
+}
+
 // activate calls NSApplication setActivationPolicy and activateIgnoringOtherApps
 // to make the process appear as a foreground app with menu bar.
 func (t *SingleProcessLauncher) activate(cfg *Config) error {
@@ -214,7 +244,11 @@ func (t *SingleProcessLauncher) activate(cfg *Config) error {
 	}
 
 	// Set Dock icon if provided and in regular mode
-	if cfg.IconPath != "" && policy == 0 {
+	if len(cfg.IconData) > 0 && policy == 0 {
+		if err := t.setDockIconData(app, cfg.IconData); err != nil {
+			t.logger.Warn("failed to set dock icon", "error", err)
+		}
+	} else if cfg.IconPath != "" && policy == 0 {
 		if err := t.setDockIcon(app, cfg.IconPath); err != nil {
 			t.logger.Warn("failed to set dock icon", "error", err, "path", cfg.IconPath)
 		}
@@ -259,6 +293,41 @@ func (t *SingleProcessLauncher) setDockIcon(app objc.ID, iconPath string) error
 	return nil
 }
 
+// setDockIconData sets image data, in any format NSImage reads, as the
+// application's Dock icon.
+func (t *SingleProcessLauncher) setDockIconData(app objc.ID, data []byte) error {
+	clsNSImage := objc.GetClass("NSImage")
+	if clsNSImage == 0 {
+		return fmt.Errorf("failed to get NSImage class")
+	}
+
+	clsNSData := objc.GetClass("NSData")
+	if clsNSData == 0 {
+		return fmt.Errorf("failed to get NSData class")
+	}
+
+	selDataWithBytes := objc.RegisterName("dataWithBytes:length:")
+	selInitWithData := objc.RegisterName("initWithData:")
+	selAlloc := objc.RegisterName("alloc")
+	selSetAppIcon := objc.RegisterName("setApplicationIconImage:")
+
+	// NSData copies the bytes, so data need not outlive the call.
+	nsData := objc.ID(clsNSData).Send(selDataWithBytes, unsafe.Pointer(&data[0]), len(data))
+	if nsData == 0 {
+		return fmt.Errorf("failed to create NSData for icon")
+	}
+
+	img := objc.ID(clsNSImage).Send(selAlloc)
+	img = img.Send(selInitWithData, nsData)
+	if img == 0 {
+		return fmt.Errorf("failed to load icon image from %d bytes", len(data))
+	}
+
+	app.Send(selSetAppIcon, img)
+	t.logger.Debug("set dock icon", "bytes", len(data))
+	return nil
+}
+
 // permissionToEntitlement maps a permission string to its entitlement key.
 func permissionToEntitlement(perm string) string {
 	switch perm {
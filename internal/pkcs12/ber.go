@@ -0,0 +1,158 @@
+package pkcs12
+
+import (
+	"errors"
+	"fmt"
+)
+
+// berToDER converts the BER encoding Apple's tools write, with
+// indefinite lengths and constructed OCTET STRINGs, into DER that
+// encoding/asn1 accepts. DER input is returned re-encoded unchanged.
+func berToDER(data []byte) ([]byte, error) {
+	out, rest, err := berElement(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after PFX")
+	}
+	return out, nil
+}
+
+// maxBERDepth bounds the nesting of constructed elements.
+const maxBERDepth = 32
+
+// berElement converts one element, returning it and the remaining input.
+func berElement(data []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxBERDepth {
+		return nil, nil, errors.New("ber: nesting too deep")
+	}
+	if len(data) < 2 {
+		return nil, nil, errors.New("ber: truncated element")
+	}
+
+	// Identifier octets; high tag numbers use base-128 continuation bytes.
+	n := 1
+	if data[0]&0x1f == 0x1f {
+		for n < len(data) && data[n]&0x80 != 0 {
+			n++
+		}
+		n++
+		if n >= len(data) {
+			return nil, nil, errors.New("ber: truncated tag")
+		}
+	}
+	tag := data[:n]
+	constructed := data[0]&0x20 != 0
+
+	// Length octets.
+	l := int(data[n])
+	n++
+	indefinite := false
+	switch {
+	case l == 0x80:
+		if !constructed {
+			return nil, nil, errors.New("ber: indefinite length on primitive element")
+		}
+		indefinite = true
+	case l > 0x80:
+		size := l & 0x7f
+		if size > 4 || n+size > len(data) {
+			return nil, nil, errors.New("ber: invalid length")
+		}
+		l = 0
+		for _, b := range data[n : n+size] {
+			l = l<<8 | int(b)
+		}
+		n += size
+	}
+
+	body := data[n:]
+	if !constructed {
+		if l > len(body) {
+			return nil, nil, errors.New("ber: truncated element")
+		}
+		return derTLV(tag, body[:l]), body[l:], nil
+	}
+
+	var rest []byte
+	if !indefinite {
+		if l > len(body) {
+			return nil, nil, errors.New("ber: truncated element")
+		}
+		body, rest = body[:l], body[l:]
+	}
+	var children [][]byte
+	for {
+		if indefinite {
+			if len(body) >= 2 && body[0] == 0 && body[1] == 0 {
+				rest = body[2:]
+				break
+			}
+			if len(body) == 0 {
+				return nil, nil, errors.New("ber: missing end-of-contents")
+			}
+		} else if len(body) == 0 {
+			break
+		}
+		child, r, err := berElement(body, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, child)
+		body = r
+	}
+
+	// A constructed OCTET STRING is the concatenation of its segments.
+	if len(tag) == 1 && tag[0] == 0x24 {
+		var value []byte
+		for _, c := range children {
+			if c[0] != 0x04 {
+				return nil, nil, fmt.Errorf("ber: OCTET STRING segment has tag %#x", c[0])
+			}
+			_, v := splitTLV(c)
+			value = append(value, v...)
+		}
+		return derTLV([]byte{0x04}, value), rest, nil
+	}
+	var value []byte
+	for _, c := range children {
+		value = append(value, c...)
+	}
+	return derTLV(tag, value), rest, nil
+}
+
+// derTLV encodes an element with a definite length.
+func derTLV(tag, value []byte) []byte {
+	out := append([]byte(nil), tag...)
+	switch l := len(value); {
+	case l < 0x80:
+		out = append(out, byte(l))
+	case l < 0x100:
+		out = append(out, 0x81, byte(l))
+	case l < 0x10000:
+		out = append(out, 0x82, byte(l>>8), byte(l))
+	case l < 0x1000000:
+		out = append(out, 0x83, byte(l>>16), byte(l>>8), byte(l))
+	default:
+		out = append(out, 0x84, byte(l>>24), byte(l>>16), byte(l>>8), byte(l))
+	}
+	return append(out, value...)
+}
+
+// splitTLV returns the header and value of a DER element produced by
+// derTLV.
+func splitTLV(der []byte) (header, value []byte) {
+	n := 1
+	if der[0]&0x1f == 0x1f {
+		for der[n]&0x80 != 0 {
+			n++
+		}
+		n++
+	}
+	if der[n]&0x80 != 0 {
+		n += int(der[n] & 0x7f)
+	}
+	n++
+	return der[:n], der[n:]
+}
@@ -0,0 +1,203 @@
+package pkcs12
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// pbeIterations is the key derivation iteration count used by Encode,
+// matching OpenSSL's default.
+const pbeIterations = 2048
+
+// pbeParams are the parameters of the PKCS#12 password-based encryption
+// schemes.
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decrypt decrypts data encrypted with one of the supported
+// password-based encryption schemes and removes its padding.
+func decrypt(alg pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	block, iv, err := pbeCipher(alg, password)
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	if len(data) == 0 || len(data)%bs != 0 {
+		return nil, errors.New("ciphertext is not a multiple of the block size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// A bad key almost always shows up as bad padding.
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > bs {
+		return nil, ErrIncorrectPassword
+	}
+	for _, b := range out[len(out)-pad:] {
+		if int(b) != pad {
+			return nil, ErrIncorrectPassword
+		}
+	}
+	return out[:len(out)-pad], nil
+}
+
+// pbeCipher returns the block cipher and IV for an encryption algorithm.
+func pbeCipher(alg pkix.AlgorithmIdentifier, password string) (cipher.Block, []byte, error) {
+	if alg.Algorithm.Equal(oidPBES2) {
+		return pbes2Cipher(alg.Parameters.FullBytes, password)
+	}
+
+	var keyLen int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch {
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3DES):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd128RC2):
+		keyLen, newCipher = 16, func(key []byte) (cipher.Block, error) { return newRC2Cipher(key, 128) }
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd40RC2):
+		keyLen, newCipher = 5, func(key []byte) (cipher.Block, error) { return newRC2Cipher(key, 40) }
+	default:
+		return nil, nil, fmt.Errorf("unsupported encryption algorithm %v", alg.Algorithm)
+	}
+	var params pbeParams
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, fmt.Errorf("encryption parameters: %w", err)
+	}
+	if params.Iterations < 1 {
+		return nil, nil, fmt.Errorf("invalid iteration count %d", params.Iterations)
+	}
+	pw := bmpString(password)
+	key := pkcs12KDF(sha1.New, params.Salt, pw, params.Iterations, 1, keyLen)
+	iv := pkcs12KDF(sha1.New, params.Salt, pw, params.Iterations, 2, 8)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, iv, nil
+}
+
+// pbes2Cipher returns the cipher and IV for PBES2 (RFC 8018) with PBKDF2.
+// The password is used as UTF-8, as OpenSSL does.
+func pbes2Cipher(paramsDER []byte, password string) (cipher.Block, []byte, error) {
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(paramsDER, &params); err != nil {
+		return nil, nil, fmt.Errorf("PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, fmt.Errorf("PBKDF2 parameters: %w", err)
+	}
+	var prf func() hash.Hash
+	switch alg := kdf.PRF.Algorithm; {
+	case len(alg) == 0, alg.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, nil, fmt.Errorf("unsupported PBKDF2 PRF %v", alg)
+	}
+
+	var keyLen int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case alg.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case alg.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case alg.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, nil, fmt.Errorf("unsupported PBES2 encryption scheme %v", alg)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("PBES2 IV: %w", err)
+	}
+	key, err := pbkdf2.Key(prf, password, kdf.Salt, kdf.Iterations, keyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, nil, fmt.Errorf("PBES2 IV is %d bytes, want %d", len(iv), block.BlockSize())
+	}
+	return block, iv, nil
+}
+
+// encryptPBES2 pads and encrypts data with AES-256-CBC under a key derived
+// with PBKDF2-HMAC-SHA256, returning the algorithm identifier and
+// ciphertext.
+func encryptPBES2(rand io.Reader, data []byte, password string) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, 8)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	if _, err := io.ReadFull(rand, iv); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: pbeIterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	ivDER, err := asn1.Marshal(iv)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivDER}},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	alg := pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}}
+
+	block, _, err := pbes2Cipher(params, password)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	out := append(append([]byte(nil), data...), make([]byte, pad)...)
+	for i := len(data); i < len(out); i++ {
+		out[i] = byte(pad)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return alg, out, nil
+}
@@ -0,0 +1,503 @@
+// Package pkcs12 reads and writes PKCS#12 (RFC 7292) files holding a code
+// signing identity: a private key, its certificate and any intermediates.
+//
+// Decode accepts the files written by Keychain Access and `security
+// export` (BER-encoded, 3DES and RC2 encryption, SHA-1 MAC) as well as
+// those written by OpenSSL 3 (PBES2 with AES and a SHA-256 MAC).
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidSHA1                = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidHMACWithSHA1        = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidPBES2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidAES128CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC          = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidPBEWithSHAAnd3DES   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHAAnd128RC2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}
+	oidPBEWithSHAAnd40RC2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+)
+
+// ErrIncorrectPassword is returned when the file's integrity MAC does not
+// verify, which almost always means the password is wrong.
+var ErrIncorrectPassword = errors.New("pkcs12: incorrect password")
+
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+// Decode parses a PKCS#12 file and returns its private key, the
+// certificate for that key and any other certificates it contains, in
+// file order. The key is an *rsa.PrivateKey, *ecdsa.PrivateKey or
+// ed25519.PrivateKey. Files with more than one private key are rejected.
+func Decode(data []byte, password string) (key crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, err error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	var p pfx
+	rest, err := asn1.Unmarshal(der, &p)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, nil, nil, errors.New("pkcs12: trailing data after PFX")
+	}
+	if p.Version != 3 {
+		return nil, nil, nil, fmt.Errorf("pkcs12: unsupported version %d", p.Version)
+	}
+	if !p.AuthSafe.ContentType.Equal(oidData) {
+		return nil, nil, nil, fmt.Errorf("pkcs12: unsupported authSafe content type %v", p.AuthSafe.ContentType)
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(p.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, nil, nil, fmt.Errorf("pkcs12: authSafe: %w", err)
+	}
+	if len(p.MacData.Mac.Digest) > 0 {
+		if err := p.MacData.verify(authSafe, password); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, nil, nil, fmt.Errorf("pkcs12: authSafe: %w", err)
+	}
+
+	type certEntry struct {
+		cert    *x509.Certificate
+		localID []byte
+	}
+	var certs []certEntry
+	var keyLocalID []byte
+	for _, ci := range contents {
+		bags, err := ci.safeBags(password)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var cb certBag
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+					return nil, nil, nil, fmt.Errorf("pkcs12: certificate bag: %w", err)
+				}
+				if !cb.ID.Equal(oidX509Certificate) {
+					continue
+				}
+				c, err := x509.ParseCertificate(cb.Data)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("pkcs12: %w", err)
+				}
+				certs = append(certs, certEntry{c, bag.localKeyID()})
+			case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidShroudedKeyBag):
+				if key != nil {
+					return nil, nil, nil, errors.New("pkcs12: file contains more than one private key")
+				}
+				pkcs8 := bag.Value.Bytes
+				if bag.ID.Equal(oidShroudedKeyBag) {
+					var epki encryptedPrivateKeyInfo
+					if _, err := asn1.Unmarshal(bag.Value.Bytes, &epki); err != nil {
+						return nil, nil, nil, fmt.Errorf("pkcs12: shrouded key bag: %w", err)
+					}
+					if pkcs8, err = decrypt(epki.Algorithm, epki.EncryptedData, password); err != nil {
+						return nil, nil, nil, fmt.Errorf("pkcs12: private key: %w", err)
+					}
+				}
+				if key, err = x509.ParsePKCS8PrivateKey(pkcs8); err != nil {
+					return nil, nil, nil, fmt.Errorf("pkcs12: private key: %w", err)
+				}
+				keyLocalID = bag.localKeyID()
+			}
+		}
+	}
+	if key == nil {
+		return nil, nil, nil, errors.New("pkcs12: no private key found")
+	}
+
+	// The key's certificate shares its localKeyID; files without IDs are
+	// matched by public key.
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("pkcs12: unsupported private key type %T", key)
+	}
+	pub := signer.Public()
+	leaf := -1
+	for i, e := range certs {
+		if keyLocalID != nil && bytes.Equal(e.localID, keyLocalID) {
+			leaf = i
+			break
+		}
+	}
+	if leaf < 0 {
+		for i, e := range certs {
+			if k, ok := e.cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && k.Equal(pub) {
+				leaf = i
+				break
+			}
+		}
+	}
+	if leaf < 0 {
+		return nil, nil, nil, errors.New("pkcs12: no certificate matches the private key")
+	}
+	for i, e := range certs {
+		if i != leaf {
+			caCerts = append(caCerts, e.cert)
+		}
+	}
+	return key, certs[leaf].cert, caCerts, nil
+}
+
+// safeBags returns the bags of an authSafe entry, decrypting it if needed.
+func (ci contentInfo) safeBags(password string) ([]safeBag, error) {
+	var data []byte
+	switch {
+	case ci.ContentType.Equal(oidData):
+		if _, err := asn1.Unmarshal(ci.Content.Bytes, &data); err != nil {
+			return nil, fmt.Errorf("pkcs12: data: %w", err)
+		}
+	case ci.ContentType.Equal(oidEncryptedData):
+		var ed encryptedData
+		if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+			return nil, fmt.Errorf("pkcs12: encrypted data: %w", err)
+		}
+		eci := ed.EncryptedContentInfo
+		ciphertext := eci.EncryptedContent.Bytes
+		if eci.EncryptedContent.IsCompound {
+			// BER allows the implicitly tagged OCTET STRING to be split
+			// into segments.
+			ciphertext = nil
+			for rest := eci.EncryptedContent.Bytes; len(rest) > 0; {
+				var segment []byte
+				var err error
+				if rest, err = asn1.Unmarshal(rest, &segment); err != nil {
+					return nil, fmt.Errorf("pkcs12: encrypted data: %w", err)
+				}
+				ciphertext = append(ciphertext, segment...)
+			}
+		}
+		var err error
+		if data, err = decrypt(eci.ContentEncryptionAlgorithm, ciphertext, password); err != nil {
+			return nil, fmt.Errorf("pkcs12: encrypted data: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("pkcs12: unsupported content type %v", ci.ContentType)
+	}
+	var bags []safeBag
+	if _, err := asn1.Unmarshal(data, &bags); err != nil {
+		return nil, fmt.Errorf("pkcs12: safe contents: %w", err)
+	}
+	return bags, nil
+}
+
+// localKeyID returns the bag's localKeyID attribute, or nil.
+func (b safeBag) localKeyID() []byte {
+	for _, a := range b.Attributes {
+		if a.ID.Equal(oidLocalKeyID) {
+			var id []byte
+			if _, err := asn1.Unmarshal(a.Value.Bytes, &id); err == nil {
+				return id
+			}
+		}
+	}
+	return nil
+}
+
+// verify checks the MAC over the authSafe contents.
+func (m macData) verify(content []byte, password string) error {
+	h, err := macHash(m.Mac.Algorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if m.Iterations < 1 {
+		return fmt.Errorf("pkcs12: invalid MAC iteration count %d", m.Iterations)
+	}
+	// Some encoders derive the MAC key from an empty password rather than
+	// the encoding of "" as a BMPString; accept either.
+	candidates := [][]byte{bmpString(password)}
+	if password == "" {
+		candidates = append(candidates, nil)
+	}
+	for _, pw := range candidates {
+		if subtle.ConstantTimeCompare(computeMAC(h, content, m.MacSalt, pw, m.Iterations), m.Mac.Digest) == 1 {
+			return nil
+		}
+	}
+	return ErrIncorrectPassword
+}
+
+// computeMAC returns the HMAC of content keyed as PKCS#12 Appendix B
+// specifies.
+func computeMAC(h func() hash.Hash, content, salt, password []byte, iterations int) []byte {
+	key := pkcs12KDF(h, salt, password, iterations, 3, h().Size())
+	mac := hmac.New(h, key)
+	mac.Write(content)
+	return mac.Sum(nil)
+}
+
+func macHash(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidSHA256):
+		return sha256.New, nil
+	}
+	return nil, fmt.Errorf("pkcs12: unsupported MAC algorithm %v", oid)
+}
+
+// bmpString returns s as a NUL-terminated big-endian UTF-16 string, the
+// password encoding used by the PKCS#12 key derivation function.
+func bmpString(s string) []byte {
+	out := make([]byte, 0, 2*len(s)+2)
+	for _, r := range s {
+		if r > 0xffff {
+			// Characters outside the BMP are encoded as surrogate pairs.
+			r -= 0x10000
+			hi, lo := 0xd800+(r>>10), 0xdc00+(r&0x3ff)
+			out = append(out, byte(hi>>8), byte(hi), byte(lo>>8), byte(lo))
+			continue
+		}
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return append(out, 0, 0)
+}
+
+// pkcs12KDF derives size bytes of keying material for the given purpose
+// (1 key, 2 IV, 3 MAC key) as described in RFC 7292 Appendix B.2.
+func pkcs12KDF(h func() hash.Hash, salt, password []byte, iterations int, id byte, size int) []byte {
+	const v = 64 // block size of SHA-1 and SHA-256
+	u := h().Size()
+
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	I := append(fill(salt), fill(password)...)
+	D := bytes.Repeat([]byte{id}, v)
+
+	var out []byte
+	for len(out) < size {
+		d := h()
+		d.Write(D)
+		d.Write(I)
+		A := d.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			d.Reset()
+			d.Write(A)
+			A = d.Sum(A[:0])
+		}
+		out = append(out, A...)
+
+		// I_j = (I_j + B + 1) mod 2^(8v) for each v-byte block of I.
+		B := make([]byte, v)
+		for i := range B {
+			B[i] = A[i%u]
+		}
+		for j := 0; j < len(I); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(I[j+k]) + int(B[k]) + carry
+				I[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// Encode returns a PKCS#12 file holding key, its certificate cert and
+// caCerts, protected with password. It writes what OpenSSL 3 writes by
+// default: PBES2 with AES-256-CBC and PBKDF2-HMAC-SHA256 for the key and
+// certificates, and an HMAC-SHA256 integrity MAC.
+func Encode(rand io.Reader, key crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, password string) ([]byte, error) {
+	localID := sha1.Sum(cert.Raw)
+	localIDAttr, err := newAttribute(oidLocalKeyID, localID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, c := range append([]*x509.Certificate{cert}, caCerts...) {
+		bag, err := newBag(oidCertBag, certBag{ID: oidX509Certificate, Data: c.Raw})
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			bag.Attributes = []pkcs12Attribute{localIDAttr}
+		}
+		certBags = append(certBags, bag)
+	}
+	certContents, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	certAlg, certCipher, err := encryptPBES2(rand, certContents, password)
+	if err != nil {
+		return nil, err
+	}
+	certData, err := asn1.Marshal(encryptedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: certAlg,
+			EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: certCipher},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	keyAlg, keyCipher, err := encryptPBES2(rand, pkcs8, password)
+	if err != nil {
+		return nil, err
+	}
+	keyBag, err := newBag(oidShroudedKeyBag, encryptedPrivateKeyInfo{Algorithm: keyAlg, EncryptedData: keyCipher})
+	if err != nil {
+		return nil, err
+	}
+	keyBag.Attributes = []pkcs12Attribute{localIDAttr}
+	keyContents, err := asn1.Marshal([]safeBag{keyBag})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	keyData, err := asn1.Marshal(keyContents)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+
+	authSafe, err := asn1.Marshal([]contentInfo{
+		{ContentType: oidEncryptedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certData}},
+		{ContentType: oidData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: keyData}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	authSafeOctets, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+
+	salt := make([]byte, 8)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	out, err := asn1.Marshal(pfx{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: authSafeOctets}},
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+				Digest:    computeMAC(sha256.New, authSafe, salt, bmpString(password), pbeIterations),
+			},
+			MacSalt:    salt,
+			Iterations: pbeIterations,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: %w", err)
+	}
+	return out, nil
+}
+
+func newBag(id asn1.ObjectIdentifier, v any) (safeBag, error) {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		return safeBag{}, fmt.Errorf("pkcs12: %w", err)
+	}
+	return safeBag{ID: id, Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}}, nil
+}
+
+func newAttribute(id asn1.ObjectIdentifier, v any) (pkcs12Attribute, error) {
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		return pkcs12Attribute{}, fmt.Errorf("pkcs12: %w", err)
+	}
+	return pkcs12Attribute{ID: id, Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: der}}, nil
+}
@@ -0,0 +1,161 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/tmc/macgo/internal/testcert"
+)
+
+// The fixtures hold the same P-256 key and self-signed certificate, for
+// "Developer ID Application: Example Corp (ABCDE12345)", exported with
+// password "secret" by OpenSSL 3: legacy.p12 with -legacy (RC2-40
+// certificates, 3DES key, SHA-1 MAC) and aes.p12 with the defaults.
+const fixtureCN = "Developer ID Application: Example Corp (ABCDE12345)"
+
+func TestDecodeFixtures(t *testing.T) {
+	for _, name := range []string{"legacy.p12", "aes.p12"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, cert, caCerts, err := Decode(data, "secret")
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if cert.Subject.CommonName != fixtureCN {
+				t.Errorf("CommonName = %q", cert.Subject.CommonName)
+			}
+			if len(caCerts) != 0 {
+				t.Errorf("got %d CA certificates, want 0", len(caCerts))
+			}
+			ec, ok := key.(*ecdsa.PrivateKey)
+			if !ok || !ec.PublicKey.Equal(cert.PublicKey) {
+				t.Errorf("key %T does not match the certificate", key)
+			}
+
+			if _, _, _, err := Decode(data, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+				t.Errorf("Decode with wrong password = %v, want ErrIncorrectPassword", err)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	ca, caKey := testcert.New(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	leaf, leafKey := testcert.New(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Signer"},
+		BasicConstraintsValid: true,
+	}, ca, caKey)
+
+	for _, password := range []string{"p@ss wörd", ""} {
+		data, err := Encode(rand.Reader, leafKey, leaf, []*x509.Certificate{ca}, password)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		key, cert, caCerts, err := Decode(data, password)
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", password, err)
+		}
+		if !cert.Equal(leaf) {
+			t.Errorf("certificate = %q, want %q", cert.Subject.CommonName, leaf.Subject.CommonName)
+		}
+		if len(caCerts) != 1 || !caCerts[0].Equal(ca) {
+			t.Errorf("CA certificates = %v", caCerts)
+		}
+		if !leafKey.Equal(key) {
+			t.Error("private key does not round-trip")
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, _, _, err := Decode([]byte("not a pfx"), ""); err == nil {
+		t.Error("Decode(garbage) succeeded")
+	}
+	data, err := os.ReadFile("testdata/aes.p12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := Decode(append(data, 0), "secret"); err == nil {
+		t.Error("Decode with trailing data succeeded")
+	}
+}
+
+func TestRC2(t *testing.T) {
+	// Test vectors from RFC 2268 section 5.
+	tests := []struct {
+		key       string
+		bits      int
+		plaintext string
+		want      string
+	}{
+		{"0000000000000000", 63, "0000000000000000", "ebb773f993278eff"},
+		{"ffffffffffffffff", 64, "ffffffffffffffff", "278b27e42e2f0d49"},
+		{"3000000000000000", 64, "1000000000000001", "30649edf9be7d2c2"},
+		{"88", 64, "0000000000000000", "61a8a244adacccf0"},
+		{"88bca90e90875a", 64, "0000000000000000", "6ccf4308974c267f"},
+		{"88bca90e90875a7f0f79c384627bafb2", 64, "0000000000000000", "1a807d272bbe5db1"},
+		{"88bca90e90875a7f0f79c384627bafb2", 128, "0000000000000000", "2269552ab0f85ca6"},
+	}
+	for _, tt := range tests {
+		key, _ := hex.DecodeString(tt.key)
+		pt, _ := hex.DecodeString(tt.plaintext)
+		c, err := newRC2Cipher(key, tt.bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct := make([]byte, rc2BlockSize)
+		c.Encrypt(ct, pt)
+		if got := hex.EncodeToString(ct); got != tt.want {
+			t.Errorf("RC2(%s, %d) = %s, want %s", tt.key, tt.bits, got, tt.want)
+		}
+		back := make([]byte, rc2BlockSize)
+		c.Decrypt(back, ct)
+		if !bytes.Equal(back, pt) {
+			t.Errorf("RC2(%s, %d) decrypt = %x, want %x", tt.key, tt.bits, back, pt)
+		}
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	// SEQUENCE (indefinite) { OCTET STRING (constructed, indefinite)
+	// { "ab", "c" }, INTEGER 5 }
+	ber := []byte{
+		0x30, 0x80,
+		0x24, 0x80, 0x04, 0x02, 'a', 'b', 0x04, 0x01, 'c', 0x00, 0x00,
+		0x02, 0x01, 0x05,
+		0x00, 0x00,
+	}
+	want := []byte{0x30, 0x08, 0x04, 0x03, 'a', 'b', 'c', 0x02, 0x01, 0x05}
+	got, err := berToDER(ber)
+	if err != nil {
+		t.Fatalf("berToDER: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("berToDER = %x, want %x", got, want)
+	}
+
+	for _, bad := range [][]byte{
+		{0x30, 0x80, 0x02, 0x01, 0x05},       // missing end-of-contents
+		{0x04, 0x80, 0x00, 0x00},             // indefinite primitive
+		{0x30, 0x05, 0x02, 0x01},             // truncated
+		{0x24, 0x80, 0x02, 0x01, 0x05, 0, 0}, // bad segment
+	} {
+		if _, err := berToDER(bad); err == nil {
+			t.Errorf("berToDER(%x) succeeded", bad)
+		}
+	}
+}
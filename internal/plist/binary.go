@@ -0,0 +1,560 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf16"
+)
+
+// bplistMagic is the header of a binary property list.
+const bplistMagic = "bplist00"
+
+// bplistTrailerSize is the size of the trailer at the end of a binary plist.
+const bplistTrailerSize = 32
+
+// bplistEpoch is the Unix time of the reference date for binary plist
+// dates (CFAbsoluteTime), 2001-01-01T00:00:00Z.
+const bplistEpoch = 978307200
+
+// UID is a keyed-archiver object reference, as found in NSKeyedArchiver
+// plists. XML plists spell it as a dictionary with a single CF$UID key.
+type UID uint64
+
+// Object markers (high nibble) used by the bplist00 format.
+const (
+	bpMarkerNull   = 0x00
+	bpMarkerFalse  = 0x08
+	bpMarkerTrue   = 0x09
+	bpMarkerInt    = 0x10
+	bpMarkerReal   = 0x20
+	bpMarkerDate   = 0x33
+	bpMarkerData   = 0x40
+	bpMarkerASCII  = 0x50
+	bpMarkerUTF16  = 0x60
+	bpMarkerUID    = 0x80
+	bpMarkerArray  = 0xA0
+	bpMarkerSet    = 0xC0
+	bpMarkerDict   = 0xD0
+	bpLengthFollow = 0x0F
+)
+
+// bplistArray and bplistDict are flattened containers holding object refs.
+type bplistArray []uint64
+
+type bplistDict struct {
+	keys, values []uint64
+}
+
+// bplistWriter flattens a normalized value into the bplist00 object table.
+type bplistWriter struct {
+	objects []any
+	unique  map[any]uint64
+}
+
+// encodeBinary returns the bplist00 encoding of a normalized value.
+func encodeBinary(v any) ([]byte, error) {
+	w := &bplistWriter{unique: make(map[any]uint64)}
+	top := w.flatten(v)
+
+	numObjects := uint64(len(w.objects))
+	refSize := minUintSize(numObjects - 1)
+
+	var buf bytes.Buffer
+	buf.WriteString(bplistMagic)
+	offsets := make([]uint64, numObjects)
+	for i, obj := range w.objects {
+		offsets[i] = uint64(buf.Len())
+		if err := writeBinaryObject(&buf, obj, refSize); err != nil {
+			return nil, err
+		}
+	}
+
+	offsetTableOffset := uint64(buf.Len())
+	offsetSize := minUintSize(offsetTableOffset)
+	for _, off := range offsets {
+		writeSizedUint(&buf, off, offsetSize)
+	}
+
+	var trailer [bplistTrailerSize]byte
+	trailer[6] = byte(offsetSize)
+	trailer[7] = byte(refSize)
+	binary.BigEndian.PutUint64(trailer[8:], numObjects)
+	binary.BigEndian.PutUint64(trailer[16:], top)
+	binary.BigEndian.PutUint64(trailer[24:], offsetTableOffset)
+	buf.Write(trailer[:])
+	return buf.Bytes(), nil
+}
+
+// flatten appends v (and its children) to the object table and returns its ref.
+// Scalars that compare equal share one object, as CoreFoundation does.
+func (w *bplistWriter) flatten(v any) uint64 {
+	switch v := v.(type) {
+	case []any:
+		ref := w.add(nil)
+		refs := make(bplistArray, len(v))
+		for i, elem := range v {
+			refs[i] = w.flatten(elem)
+		}
+		w.objects[ref] = refs
+		return ref
+	case map[string]any:
+		ref := w.add(nil)
+		keys := sortedKeys(v)
+		dict := bplistDict{
+			keys:   make([]uint64, len(keys)),
+			values: make([]uint64, len(keys)),
+		}
+		for i, k := range keys {
+			dict.keys[i] = w.flatten(k)
+		}
+		for i, k := range keys {
+			dict.values[i] = w.flatten(v[k])
+		}
+		w.objects[ref] = dict
+		return ref
+	case []byte:
+		return w.add(v)
+	case time.Time:
+		// time.Time values are not reliably comparable; key by instant.
+		key := struct{ unix int64 }{v.UnixNano()}
+		if ref, ok := w.unique[key]; ok {
+			return ref
+		}
+		ref := w.add(v)
+		w.unique[key] = ref
+		return ref
+	default:
+		if ref, ok := w.unique[v]; ok {
+			return ref
+		}
+		ref := w.add(v)
+		w.unique[v] = ref
+		return ref
+	}
+}
+
+func (w *bplistWriter) add(v any) uint64 {
+	w.objects = append(w.objects, v)
+	return uint64(len(w.objects) - 1)
+}
+
+// writeBinaryObject writes a single flattened object.
+func writeBinaryObject(buf *bytes.Buffer, obj any, refSize int) error {
+	switch v := obj.(type) {
+	case bool:
+		if v {
+			buf.WriteByte(bpMarkerTrue)
+		} else {
+			buf.WriteByte(bpMarkerFalse)
+		}
+	case int64:
+		writeBinaryInt(buf, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			writeBinaryInt(buf, int64(v))
+			break
+		}
+		// Values above MaxInt64 use the 16-byte integer form.
+		buf.WriteByte(bpMarkerInt | 4)
+		buf.Write(make([]byte, 8))
+		writeSizedUint(buf, v, 8)
+	case float64:
+		buf.WriteByte(bpMarkerReal | 3)
+		writeSizedUint(buf, math.Float64bits(v), 8)
+	case time.Time:
+		buf.WriteByte(bpMarkerDate)
+		secs := float64(v.Unix()-bplistEpoch) + float64(v.Nanosecond())/1e9
+		writeSizedUint(buf, math.Float64bits(secs), 8)
+	case []byte:
+		writeBinaryHeader(buf, bpMarkerData, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		if isASCII(v) {
+			writeBinaryHeader(buf, bpMarkerASCII, uint64(len(v)))
+			buf.WriteString(v)
+			break
+		}
+		units := utf16.Encode([]rune(v))
+		writeBinaryHeader(buf, bpMarkerUTF16, uint64(len(units)))
+		for _, u := range units {
+			writeSizedUint(buf, uint64(u), 2)
+		}
+	case UID:
+		size := minUintSize(uint64(v))
+		buf.WriteByte(bpMarkerUID | byte(size-1))
+		writeSizedUint(buf, uint64(v), size)
+	case bplistArray:
+		writeBinaryHeader(buf, bpMarkerArray, uint64(len(v)))
+		for _, ref := range v {
+			writeSizedUint(buf, ref, refSize)
+		}
+	case bplistDict:
+		writeBinaryHeader(buf, bpMarkerDict, uint64(len(v.keys)))
+		for _, ref := range v.keys {
+			writeSizedUint(buf, ref, refSize)
+		}
+		for _, ref := range v.values {
+			writeSizedUint(buf, ref, refSize)
+		}
+	default:
+		return fmt.Errorf("plist: cannot encode %T in binary format", obj)
+	}
+	return nil
+}
+
+// writeBinaryInt writes an integer object using the smallest legal width.
+// 1, 2 and 4 byte integers are unsigned; negative values need 8 bytes.
+func writeBinaryInt(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		buf.WriteByte(bpMarkerInt | 3)
+		writeSizedUint(buf, uint64(n), 8)
+		return
+	}
+	size := minUintSize(uint64(n))
+	buf.WriteByte(bpMarkerInt | byte(log2(size)))
+	writeSizedUint(buf, uint64(n), size)
+}
+
+// writeBinaryHeader writes a marker with a length, spilling lengths of 15
+// or more into a following integer object.
+func writeBinaryHeader(buf *bytes.Buffer, marker byte, n uint64) {
+	if n < bpLengthFollow {
+		buf.WriteByte(marker | byte(n))
+		return
+	}
+	buf.WriteByte(marker | bpLengthFollow)
+	writeBinaryInt(buf, int64(n))
+}
+
+// writeSizedUint writes the low size bytes of n in big-endian order.
+func writeSizedUint(buf *bytes.Buffer, n uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(n >> (8 * i)))
+	}
+}
+
+// minUintSize returns the smallest of 1, 2, 4 or 8 bytes that can hold n.
+func minUintSize(n uint64) int {
+	switch {
+	case n <= math.MaxUint8:
+		return 1
+	case n <= math.MaxUint16:
+		return 2
+	case n <= math.MaxUint32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func log2(size int) int {
+	switch size {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 4:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// bplistReader decodes a bplist00 document into generic values.
+type bplistReader struct {
+	data       []byte
+	offsets    []uint64
+	refSize    int
+	offsetSize int
+	// visiting tracks refs on the current decode path to reject cycles.
+	visiting map[uint64]bool
+}
+
+// parseBinary decodes a bplist00 document into a generic value.
+func parseBinary(data []byte) (any, error) {
+	if len(data) < len(bplistMagic)+bplistTrailerSize || string(data[:len(bplistMagic)]) != bplistMagic {
+		return nil, errors.New("plist: not a bplist00 document")
+	}
+
+	trailer := data[len(data)-bplistTrailerSize:]
+	r := &bplistReader{
+		data:       data,
+		offsetSize: int(trailer[6]),
+		refSize:    int(trailer[7]),
+		visiting:   make(map[uint64]bool),
+	}
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	top := binary.BigEndian.Uint64(trailer[16:])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	if !validIntSize(r.offsetSize) || !validIntSize(r.refSize) {
+		return nil, fmt.Errorf("plist: invalid bplist trailer sizes (offset=%d ref=%d)", r.offsetSize, r.refSize)
+	}
+	tableEnd := uint64(len(data) - bplistTrailerSize)
+	if numObjects == 0 || top >= numObjects || tableOffset < uint64(len(bplistMagic)) || tableOffset > tableEnd ||
+		numObjects > (tableEnd-tableOffset)/uint64(r.offsetSize) {
+		return nil, errors.New("plist: corrupt bplist trailer")
+	}
+
+	r.offsets = make([]uint64, numObjects)
+	for i := range r.offsets {
+		pos := tableOffset + uint64(i*r.offsetSize)
+		off := readSizedUint(data[pos:], r.offsetSize)
+		if off < uint64(len(bplistMagic)) || off >= tableOffset {
+			return nil, fmt.Errorf("plist: object %d offset %d out of range", i, off)
+		}
+		r.offsets[i] = off
+	}
+
+	return r.object(top)
+}
+
+func validIntSize(n int) bool {
+	return n == 1 || n == 2 || n == 4 || n == 8
+}
+
+// readSizedUint reads a big-endian unsigned integer of size bytes.
+func readSizedUint(b []byte, size int) uint64 {
+	var n uint64
+	for i := 0; i < size; i++ {
+		n = n<<8 | uint64(b[i])
+	}
+	return n
+}
+
+// bytesAt returns n bytes at off, or an error if they run past the data.
+func (r *bplistReader) bytesAt(off, n uint64) ([]byte, error) {
+	if off > uint64(len(r.data)) || n > uint64(len(r.data))-off {
+		return nil, fmt.Errorf("plist: object at offset %d overruns data", off)
+	}
+	return r.data[off : off+n], nil
+}
+
+// object decodes the object with the given ref.
+func (r *bplistReader) object(ref uint64) (any, error) {
+	if ref >= uint64(len(r.offsets)) {
+		return nil, fmt.Errorf("plist: object ref %d out of range", ref)
+	}
+	if r.visiting[ref] {
+		return nil, fmt.Errorf("plist: object ref %d forms a cycle", ref)
+	}
+
+	off := r.offsets[ref]
+	marker := r.data[off]
+	info := marker & 0x0F
+
+	switch marker & 0xF0 {
+	case bpMarkerNull:
+		switch marker {
+		case bpMarkerFalse:
+			return false, nil
+		case bpMarkerTrue:
+			return true, nil
+		}
+		return nil, fmt.Errorf("plist: unsupported bplist marker 0x%02x", marker)
+	case bpMarkerInt:
+		n, _, err := r.readInt(off)
+		return n, err
+	case bpMarkerReal:
+		switch info {
+		case 2:
+			b, err := r.bytesAt(off+1, 4)
+			if err != nil {
+				return nil, err
+			}
+			return float64(math.Float32frombits(uint32(readSizedUint(b, 4)))), nil
+		case 3:
+			b, err := r.bytesAt(off+1, 8)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(readSizedUint(b, 8)), nil
+		}
+		return nil, fmt.Errorf("plist: unsupported real size %d", 1<<info)
+	case bpMarkerDate & 0xF0:
+		if marker != bpMarkerDate {
+			return nil, fmt.Errorf("plist: unsupported bplist marker 0x%02x", marker)
+		}
+		b, err := r.bytesAt(off+1, 8)
+		if err != nil {
+			return nil, err
+		}
+		secs := math.Float64frombits(readSizedUint(b, 8))
+		if math.IsNaN(secs) || math.IsInf(secs, 0) || math.Abs(secs) > 1<<62 {
+			return nil, fmt.Errorf("plist: invalid date value %v", secs)
+		}
+		whole, frac := math.Modf(secs)
+		return time.Unix(bplistEpoch+int64(whole), int64(frac*1e9)).UTC(), nil
+	case bpMarkerData:
+		start, n, err := r.readLength(off)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytesAt(start, n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case bpMarkerASCII:
+		start, n, err := r.readLength(off)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytesAt(start, n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case bpMarkerUTF16:
+		start, n, err := r.readLength(off)
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64/2 {
+			return nil, errors.New("plist: UTF-16 string length overflow")
+		}
+		b, err := r.bytesAt(start, n*2)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = uint16(readSizedUint(b[i*2:], 2))
+		}
+		return string(utf16.Decode(units)), nil
+	case bpMarkerUID:
+		b, err := r.bytesAt(off+1, uint64(info)+1)
+		if err != nil {
+			return nil, err
+		}
+		if info > 7 {
+			return nil, fmt.Errorf("plist: UID of %d bytes is too large", info+1)
+		}
+		return UID(readSizedUint(b, int(info)+1)), nil
+	case bpMarkerArray, bpMarkerSet:
+		refs, err := r.readRefs(off, 1)
+		if err != nil {
+			return nil, err
+		}
+		r.visiting[ref] = true
+		defer delete(r.visiting, ref)
+		arr := make([]any, len(refs))
+		for i, child := range refs {
+			if arr[i], err = r.object(child); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case bpMarkerDict:
+		refs, err := r.readRefs(off, 2)
+		if err != nil {
+			return nil, err
+		}
+		r.visiting[ref] = true
+		defer delete(r.visiting, ref)
+		n := len(refs) / 2
+		dict := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			k, err := r.object(refs[i])
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("plist: dictionary key of type %s", plistTypeName(k))
+			}
+			if dict[key], err = r.object(refs[n+i]); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("plist: unsupported bplist marker 0x%02x", marker)
+}
+
+// readInt decodes the integer object at off and returns it along with the
+// offset just past it. Integers of 1, 2 and 4 bytes are unsigned, 8 bytes
+// are signed, and 16 bytes are used for values above math.MaxInt64.
+func (r *bplistReader) readInt(off uint64) (any, uint64, error) {
+	marker := r.data[off]
+	if marker&0xF0 != bpMarkerInt {
+		return nil, 0, fmt.Errorf("plist: expected integer at offset %d", off)
+	}
+	size := uint64(1) << (marker & 0x0F)
+	b, err := r.bytesAt(off+1, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	next := off + 1 + size
+	switch size {
+	case 1, 2, 4:
+		return int64(readSizedUint(b, int(size))), next, nil
+	case 8:
+		return int64(readSizedUint(b, 8)), next, nil
+	case 16:
+		hi, lo := readSizedUint(b, 8), readSizedUint(b[8:], 8)
+		if hi != 0 {
+			return nil, 0, errors.New("plist: 128-bit integer out of range")
+		}
+		if lo <= math.MaxInt64 {
+			return int64(lo), next, nil
+		}
+		return lo, next, nil
+	}
+	return nil, 0, fmt.Errorf("plist: unsupported integer size %d", size)
+}
+
+// readLength returns the payload start and length of a sized object.
+func (r *bplistReader) readLength(off uint64) (uint64, uint64, error) {
+	info := r.data[off] & 0x0F
+	if info != bpLengthFollow {
+		return off + 1, uint64(info), nil
+	}
+	if off+1 >= uint64(len(r.data)) {
+		return 0, 0, fmt.Errorf("plist: object at offset %d overruns data", off)
+	}
+	n, next, err := r.readInt(off + 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, ok := n.(int64)
+	if !ok || length < 0 {
+		return 0, 0, fmt.Errorf("plist: invalid object length at offset %d", off)
+	}
+	return next, uint64(length), nil
+}
+
+// readRefs reads the object refs of a container; per is 1 for arrays and 2
+// for dictionaries (keys followed by values).
+func (r *bplistReader) readRefs(off uint64, per uint64) ([]uint64, error) {
+	start, n, err := r.readLength(off)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data))/per {
+		return nil, fmt.Errorf("plist: container at offset %d overruns data", off)
+	}
+	count := n * per
+	b, err := r.bytesAt(start, count*uint64(r.refSize))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, count)
+	for i := range refs {
+		refs[i] = readSizedUint(b[i*r.refSize:], r.refSize)
+	}
+	return refs, nil
+}
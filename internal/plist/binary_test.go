@@ -0,0 +1,244 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pythonBinaryPlist was produced by Python's plistlib (FMT_BINARY), an
+// independent bplist00 implementation, from:
+//
+//	{"CFBundleIdentifier": "com.example.app", "Count": 42, "Neg": -5,
+//	 "Big": 2**40, "Ratio": 0.5, "Enabled": True, "Off": False,
+//	 "Blob": b"hello", "Created": datetime(2024, 3, 1, 11, 30),
+//	 "Tags": ["a", "b", "a"], "Nested": {"Inner": False},
+//	 "Unicode": "café ☃", "Long": "x"*20, "Empty": []}
+const pythonBinaryPlist = "62706c6973743030de0102030405060708090a0b0c0d0e0f1011121314151617181a1b1c1f5342696754426c6f625f1012434642756e646c654964656e74696669657255436f756e74574372656174656455456d70747957456e61626c6564544c6f6e67534e6567564e6573746564534f666655526174696f545461677357556e69636f64651300000100000000004568656c6c6f5f100f636f6d2e6578616d706c652e617070102a3341c5c8f9dc000000a0095f1014787878787878787878787878787878787878787813fffffffffffffffbd1191a55496e6e657208233fe0000000000000a31d1e1d516151626600630061006600e9002026030825292e434951575f64686f73797e868f95a7a9b2b3b4cbd4d7dddee7ebedef00000000000001010000000000000020000000000000000000000000000000fc"
+
+func pythonFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(pythonBinaryPlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func pythonFixtureValue() map[string]any {
+	return map[string]any{
+		"CFBundleIdentifier": "com.example.app",
+		"Count":              int64(42),
+		"Neg":                int64(-5),
+		"Big":                int64(1 << 40),
+		"Ratio":              0.5,
+		"Enabled":            true,
+		"Off":                false,
+		"Blob":               []byte("hello"),
+		"Created":            time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC),
+		"Tags":               []any{"a", "b", "a"},
+		"Nested":             map[string]any{"Inner": false},
+		"Unicode":            "café ☃",
+		"Long":               strings.Repeat("x", 20),
+		"Empty":              []any{},
+	}
+}
+
+func TestDecodeBinaryFixture(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader(pythonFixture(t)))
+	var got any
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if dec.Format() != BinaryFormat {
+		t.Errorf("Format() = %v, want %v", dec.Format(), BinaryFormat)
+	}
+	if want := pythonFixtureValue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %#v\nwant %#v", got, want)
+	}
+}
+
+func TestDecodeBinaryIntoStruct(t *testing.T) {
+	var got struct {
+		ID     string `plist:"CFBundleIdentifier"`
+		Count  int
+		Tags   []string
+		Nested struct{ Inner bool }
+	}
+	if err := Unmarshal(pythonFixture(t), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if got.ID != "com.example.app" || got.Count != 42 || len(got.Tags) != 3 {
+		t.Errorf("decoded struct = %+v", got)
+	}
+}
+
+func TestDecodeDetectsXML(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(sampleXML))
+	var got map[string]any
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if dec.Format() != XMLFormat {
+		t.Errorf("Format() = %v, want %v", dec.Format(), XMLFormat)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	in := pythonFixtureValue()
+	in["Huge"] = uint64(math.MaxUint64)
+	in["Min"] = int64(math.MinInt64)
+	in["Float"] = -1.25e-7
+	in["SubSecond"] = time.Date(1999, 12, 31, 23, 59, 59, 500000000, time.UTC)
+	in["UID"] = UID(7)
+	in["Emoji"] = "🙂 outside the BMP"
+	in["LongData"] = bytes.Repeat([]byte{0xAB}, 300)
+
+	data, err := MarshalFormat(in, BinaryFormat)
+	if err != nil {
+		t.Fatalf("MarshalFormat error: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("bplist00")) {
+		t.Fatalf("binary output missing magic: %q", data[:8])
+	}
+
+	var out any
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch:\n in: %#v\nout: %#v", in, out)
+	}
+}
+
+func TestXMLBinaryXMLRoundTrip(t *testing.T) {
+	var fromXML any
+	if err := Unmarshal([]byte(sampleXML), &fromXML); err != nil {
+		t.Fatalf("Unmarshal XML: %v", err)
+	}
+	bin, err := MarshalFormat(fromXML, BinaryFormat)
+	if err != nil {
+		t.Fatalf("MarshalFormat binary: %v", err)
+	}
+	var fromBinary any
+	if err := Unmarshal(bin, &fromBinary); err != nil {
+		t.Fatalf("Unmarshal binary: %v", err)
+	}
+	xmlAgain, err := MarshalFormat(fromBinary, XMLFormat)
+	if err != nil {
+		t.Fatalf("MarshalFormat XML: %v", err)
+	}
+	xmlFirst, err := Marshal(fromXML)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Equal(xmlFirst, xmlAgain) {
+		t.Errorf("XML differs after binary round trip:\n%s\n---\n%s", xmlFirst, xmlAgain)
+	}
+}
+
+func TestBinaryDeterministicAndUniqued(t *testing.T) {
+	in := map[string]any{"a": "same", "b": "same", "c": []any{"same", "same"}}
+	first, err := MarshalFormat(in, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		again, _ := MarshalFormat(in, BinaryFormat)
+		if !bytes.Equal(first, again) {
+			t.Fatal("binary output is not deterministic")
+		}
+	}
+	if n := bytes.Count(first, []byte("same")); n != 1 {
+		t.Errorf("equal strings should be stored once, found %d copies", n)
+	}
+}
+
+func TestBinaryManyObjects(t *testing.T) {
+	// More than 255 objects forces 2-byte object refs.
+	in := make(map[string]any)
+	for i := 0; i < 400; i++ {
+		in[fmt.Sprintf("key%03d", i)] = int64(i * 1000)
+	}
+	data, err := MarshalFormat(in, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]int
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if len(out) != 400 || out["key399"] != 399000 {
+		t.Errorf("decoded %d entries, key399=%d", len(out), out["key399"])
+	}
+}
+
+func TestXMLUID(t *testing.T) {
+	data, err := Marshal(map[string]any{"root": UID(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<key>CF$UID</key>\n\t\t<integer>3</integer>") {
+		t.Errorf("UID not encoded as CF$UID dict:\n%s", data)
+	}
+	var out map[string]any
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["root"] != UID(3) {
+		t.Errorf("root = %#v, want UID(3)", out["root"])
+	}
+}
+
+func TestDecodeBinaryCorrupt(t *testing.T) {
+	valid := pythonFixture(t)
+
+	corrupt := func(mutate func(b []byte) []byte) []byte {
+		b := append([]byte(nil), valid...)
+		return mutate(b)
+	}
+	trailer := len(valid) - bplistTrailerSize
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"magic only", []byte("bplist00")},
+		{"truncated", valid[:len(valid)-10]},
+		{"bad ref size", corrupt(func(b []byte) []byte { b[trailer+7] = 3; return b })},
+		{"top out of range", corrupt(func(b []byte) []byte { b[trailer+23] = 0xFF; return b })},
+		{"object count too large", corrupt(func(b []byte) []byte { b[trailer+8] = 0x7F; return b })},
+		{"offset table out of range", corrupt(func(b []byte) []byte { b[trailer+31] = 0xFF; b[trailer+30] = 0xFF; return b })},
+		{"self-referencing array", cyclicBinaryPlist()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := Unmarshal(tt.data, &v); err == nil {
+				t.Errorf("Unmarshal succeeded on corrupt input, got %#v", v)
+			}
+		})
+	}
+}
+
+// cyclicBinaryPlist returns a bplist whose only object is an array that
+// contains itself.
+func cyclicBinaryPlist() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("bplist00")
+	buf.Write([]byte{0xA1, 0x00}) // array of one element: ref 0
+	buf.WriteByte(8)              // offset table: object 0 at offset 8
+	var trailer [bplistTrailerSize]byte
+	trailer[6] = 1
+	trailer[7] = 1
+	trailer[15] = 1  // one object
+	trailer[31] = 10 // offset table offset
+	buf.Write(trailer[:])
+	return buf.Bytes()
+}
@@ -0,0 +1,475 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unmarshaler is implemented by types that can decode themselves from a
+// generic plist value (string, bool, int64, uint64, float64, time.Time,
+// []byte, UID, []any or map[string]any).
+type Unmarshaler interface {
+	UnmarshalPlist(v any) error
+}
+
+// Unmarshal parses the property list in data and stores the result in the
+// value pointed to by v.
+//
+// Decoding into an empty interface produces map[string]any for <dict>,
+// []any for <array>, string, bool, int64 (uint64 for values above
+// math.MaxInt64), float64, time.Time, []byte and UID. Struct fields are matched
+// by their `plist` tag or field name; unknown keys are ignored.
+func Unmarshal(data []byte, v any) error {
+	return NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Decoder reads property lists from an input stream. Both XML and binary
+// (bplist00) property lists are accepted; the format is detected
+// automatically.
+type Decoder struct {
+	r      io.Reader
+	format Format
+}
+
+// NewDecoder returns a decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads a property list from the stream and stores it in the value
+// pointed to by v.
+func (d *Decoder) Decode(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("plist: Decode requires a non-nil pointer, got %T", v)
+	}
+
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return fmt.Errorf("plist: %w", err)
+	}
+
+	var val any
+	if bytes.HasPrefix(data, []byte(bplistMagic)) {
+		d.format = BinaryFormat
+		val, err = parseBinary(data)
+	} else {
+		d.format = XMLFormat
+		val, err = parseXML(bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	return assign(rv, val)
+}
+
+// Format returns the format of the most recently decoded property list.
+func (d *Decoder) Format() Format {
+	return d.format
+}
+
+// parseXML reads an XML property list into a generic value.
+func parseXML(r io.Reader) (any, error) {
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, errors.New("plist: no property list found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "plist" {
+			// Tolerate a bare value without the <plist> wrapper.
+			return parseXMLElement(d, start)
+		}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, fmt.Errorf("plist: %w", err)
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				return parseXMLElement(d, t)
+			case xml.EndElement:
+				return nil, errors.New("plist: empty <plist> element")
+			}
+		}
+	}
+}
+
+// parseXMLElement parses the value element that starts with start.
+func parseXMLElement(d *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		return parseXMLDict(d)
+	case "array":
+		return parseXMLArray(d)
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, fmt.Errorf("plist: <%s>: %w", start.Name.Local, err)
+	}
+
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		return parseInteger(strings.TrimSpace(text))
+	case "real":
+		return parseReal(strings.TrimSpace(text))
+	case "date":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("plist: invalid <date>: %w", err)
+		}
+		return t, nil
+	case "data":
+		clean := strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+				return -1
+			}
+			return r
+		}, text)
+		b, err := base64.StdEncoding.DecodeString(clean)
+		if err != nil {
+			return nil, fmt.Errorf("plist: invalid <data>: %w", err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("plist: unexpected element <%s>", start.Name.Local)
+	}
+}
+
+func parseXMLDict(d *xml.Decoder) (any, error) {
+	dict := make(map[string]any)
+	var key *string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("plist: <dict>: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if key == nil {
+				if t.Name.Local != "key" {
+					return nil, fmt.Errorf("plist: expected <key> in <dict>, got <%s>", t.Name.Local)
+				}
+				var k string
+				if err := d.DecodeElement(&k, &t); err != nil {
+					return nil, fmt.Errorf("plist: <key>: %w", err)
+				}
+				key = &k
+				continue
+			}
+			val, err := parseXMLElement(d, t)
+			if err != nil {
+				return nil, err
+			}
+			dict[*key] = val
+			key = nil
+		case xml.EndElement:
+			if key != nil {
+				return nil, fmt.Errorf("plist: missing value for key %q", *key)
+			}
+			if len(dict) == 1 {
+				switch uid := dict["CF$UID"].(type) {
+				case int64:
+					if uid >= 0 {
+						return UID(uid), nil
+					}
+				case uint64:
+					return UID(uid), nil
+				}
+			}
+			return dict, nil
+		}
+	}
+}
+
+func parseXMLArray(d *xml.Decoder) (any, error) {
+	arr := []any{}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("plist: <array>: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			val, err := parseXMLElement(d, t)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		case xml.EndElement:
+			return arr, nil
+		}
+	}
+}
+
+// parseInteger parses a decimal or 0x-prefixed hexadecimal integer.
+func parseInteger(s string) (any, error) {
+	base := 10
+	digits := s
+	neg := strings.HasPrefix(digits, "-")
+	digits = strings.TrimLeft(digits, "+-")
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		base = 16
+		digits = digits[2:]
+	}
+	if neg {
+		digits = "-" + digits
+	}
+	if n, err := strconv.ParseInt(digits, base, 64); err == nil {
+		return n, nil
+	}
+	n, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return nil, fmt.Errorf("plist: invalid <integer> %q", s)
+	}
+	return n, nil
+}
+
+// parseReal parses a <real> value, including CoreFoundation's spellings of
+// infinity and NaN.
+func parseReal(s string) (any, error) {
+	switch strings.ToLower(s) {
+	case "+infinity", "infinity", "inf", "+inf":
+		return math.Inf(1), nil
+	case "-infinity", "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("plist: invalid <real> %q", s)
+	}
+	return f, nil
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// assign stores the generic value src into dst, converting as needed.
+func assign(dst reflect.Value, src any) error {
+	if dst.Kind() != reflect.Pointer && dst.CanAddr() && dst.Addr().Type().Implements(unmarshalerType) {
+		return dst.Addr().Interface().(Unmarshaler).UnmarshalPlist(src)
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		if dst.Type().Implements(unmarshalerType) {
+			return dst.Interface().(Unmarshaler).UnmarshalPlist(src)
+		}
+		return assign(dst.Elem(), src)
+	}
+
+	if dst.Type() == timeType {
+		t, ok := src.(time.Time)
+		if !ok {
+			return typeError(src, dst.Type())
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return typeError(src, dst.Type())
+		}
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	case reflect.String:
+		s, ok := src.(string)
+		if !ok {
+			return typeError(src, dst.Type())
+		}
+		dst.SetString(s)
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return typeError(src, dst.Type())
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch v := src.(type) {
+		case int64:
+			n = v
+		case uint64:
+			if v > math.MaxInt64 {
+				return typeError(src, dst.Type())
+			}
+			n = int64(v)
+		default:
+			return typeError(src, dst.Type())
+		}
+		if dst.OverflowInt(n) {
+			return typeError(src, dst.Type())
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch v := src.(type) {
+		case int64:
+			if v < 0 {
+				return typeError(src, dst.Type())
+			}
+			n = uint64(v)
+		case uint64:
+			n = v
+		case UID:
+			n = uint64(v)
+		default:
+			return typeError(src, dst.Type())
+		}
+		if dst.OverflowUint(n) {
+			return typeError(src, dst.Type())
+		}
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch v := src.(type) {
+		case float64:
+			dst.SetFloat(v)
+		case int64:
+			dst.SetFloat(float64(v))
+		case uint64:
+			dst.SetFloat(float64(v))
+		default:
+			return typeError(src, dst.Type())
+		}
+	case reflect.Slice:
+		if b, ok := src.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		arr, ok := src.([]any)
+		if !ok {
+			return typeError(src, dst.Type())
+		}
+		s := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, elem := range arr {
+			if err := assign(s.Index(i), elem); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		dst.Set(s)
+	case reflect.Array:
+		arr, ok := src.([]any)
+		if !ok {
+			return typeError(src, dst.Type())
+		}
+		for i := 0; i < dst.Len() && i < len(arr); i++ {
+			if err := assign(dst.Index(i), arr[i]); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		dict, ok := src.(map[string]any)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return typeError(src, dst.Type())
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(dict)))
+		}
+		for k, v := range dict {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, v); err != nil {
+				return fmt.Errorf("key %q: %w", k, err)
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		dict, ok := src.(map[string]any)
+		if !ok {
+			return typeError(src, dst.Type())
+		}
+		for _, f := range structFields(dst.Type()) {
+			v, ok := dict[f.name]
+			if !ok {
+				continue
+			}
+			fv, err := fieldByIndexAlloc(dst, f.index)
+			if err != nil {
+				return err
+			}
+			if err := assign(fv, v); err != nil {
+				return fmt.Errorf("key %q: %w", f.name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("plist: cannot decode into Go value of type %s", dst.Type())
+	}
+	return nil
+}
+
+// fieldByIndexAlloc is like reflect.Value.FieldByIndex but allocates nil
+// embedded struct pointers along the way.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("plist: cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// typeError reports a plist value that cannot be stored in a Go type.
+func typeError(src any, t reflect.Type) error {
+	return fmt.Errorf("plist: cannot decode %s into Go value of type %s", plistTypeName(src), t)
+}
+
+// plistTypeName returns the plist element name for a generic value.
+func plistTypeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "<string>"
+	case bool:
+		return "<true/false>"
+	case int64, uint64:
+		return "<integer>"
+	case float64:
+		return "<real>"
+	case time.Time:
+		return "<date>"
+	case []byte:
+		return "<data>"
+	case UID:
+		return "<uid>"
+	case []any:
+		return "<array>"
+	case map[string]any:
+		return "<dict>"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,219 @@
+package plist
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.app</string>
+	<key>Count</key>
+	<integer>42</integer>
+	<key>Ratio</key>
+	<real>0.5</real>
+	<key>Enabled</key>
+	<true/>
+	<key>Created</key>
+	<date>2024-03-01T11:30:00Z</date>
+	<key>Blob</key>
+	<data>
+	aGVs
+	bG8=
+	</data>
+	<key>Tags</key>
+	<array>
+		<string>a</string>
+		<string>b</string>
+	</array>
+	<key>Nested</key>
+	<dict>
+		<key>Inner</key>
+		<false/>
+	</dict>
+	<key>Empty</key>
+	<string/>
+</dict>
+</plist>`
+
+func TestUnmarshalGeneric(t *testing.T) {
+	var got any
+	if err := Unmarshal([]byte(sampleXML), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	want := map[string]any{
+		"CFBundleIdentifier": "com.example.app",
+		"Count":              int64(42),
+		"Ratio":              0.5,
+		"Enabled":            true,
+		"Created":            time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC),
+		"Blob":               []byte("hello"),
+		"Tags":               []any{"a", "b"},
+		"Nested":             map[string]any{"Inner": false},
+		"Empty":              "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal = %#v\nwant %#v", got, want)
+	}
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	type nested struct {
+		Inner bool
+	}
+	var got struct {
+		ID      string `plist:"CFBundleIdentifier"`
+		Count   uint16
+		Ratio   float32
+		Enabled *bool
+		Created time.Time
+		Blob    []byte
+		Tags    []string
+		Nested  nested
+		Missing string
+	}
+	if err := Unmarshal([]byte(sampleXML), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	if got.ID != "com.example.app" || got.Count != 42 || got.Ratio != 0.5 {
+		t.Errorf("scalar fields decoded incorrectly: %+v", got)
+	}
+	if got.Enabled == nil || !*got.Enabled {
+		t.Errorf("Enabled = %v, want pointer to true", got.Enabled)
+	}
+	if !got.Created.Equal(time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC)) {
+		t.Errorf("Created = %v", got.Created)
+	}
+	if string(got.Blob) != "hello" {
+		t.Errorf("Blob = %q, want %q", got.Blob, "hello")
+	}
+	if !reflect.DeepEqual(got.Tags, []string{"a", "b"}) {
+		t.Errorf("Tags = %v", got.Tags)
+	}
+	if got.Nested.Inner {
+		t.Error("Nested.Inner should be false")
+	}
+}
+
+func TestUnmarshalSingleLine(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?><plist version="1.0"><dict><key>A</key><dict><key>B</key><array><integer>1</integer><integer>0x10</integer></array></dict><key>CFBundleIdentifier</key><string>x.y.z</string></dict></plist>`
+
+	var got struct {
+		A struct {
+			B []int
+		}
+		CFBundleIdentifier string
+	}
+	if err := Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if got.CFBundleIdentifier != "x.y.z" {
+		t.Errorf("CFBundleIdentifier = %q", got.CFBundleIdentifier)
+	}
+	if !reflect.DeepEqual(got.A.B, []int{1, 16}) {
+		t.Errorf("A.B = %v, want [1 16]", got.A.B)
+	}
+}
+
+func TestUnmarshalSpecialReals(t *testing.T) {
+	data := `<plist version="1.0"><array><real>+infinity</real><real>-infinity</real><real>nan</real></array></plist>`
+	var got []float64
+	if err := Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if !math.IsInf(got[0], 1) || !math.IsInf(got[1], -1) || !math.IsNaN(got[2]) {
+		t.Errorf("special reals decoded incorrectly: %v", got)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		target any
+		want   string
+	}{
+		{"empty", "", new(any), "no property list"},
+		{"type mismatch", `<plist><string>x</string></plist>`, new(int), "cannot decode <string>"},
+		{"overflow", `<plist><integer>300</integer></plist>`, new(int8), "cannot decode <integer>"},
+		{"negative unsigned", `<plist><integer>-1</integer></plist>`, new(uint), "cannot decode <integer>"},
+		{"bad integer", `<plist><integer>abc</integer></plist>`, new(any), "invalid <integer>"},
+		{"bad date", `<plist><date>yesterday</date></plist>`, new(any), "invalid <date>"},
+		{"dict without key", `<plist><dict><string>x</string></dict></plist>`, new(any), "expected <key>"},
+		{"key without value", `<plist><dict><key>x</key></dict></plist>`, new(any), "missing value"},
+		{"unknown element", `<plist><blob/></plist>`, new(any), "unexpected element"},
+		{"truncated", `<plist><dict><key>x</key>`, new(any), "EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal([]byte(tt.data), tt.target)
+			if err == nil {
+				t.Fatal("Unmarshal succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRequiresPointer(t *testing.T) {
+	var m map[string]any
+	if err := Unmarshal([]byte(sampleXML), m); err == nil {
+		t.Error("Unmarshal into non-pointer should fail")
+	}
+}
+
+type upper string
+
+func (u *upper) UnmarshalPlist(v any) error {
+	s, _ := v.(string)
+	*u = upper(strings.ToUpper(s))
+	return nil
+}
+
+func TestUnmarshalUnmarshaler(t *testing.T) {
+	var got struct {
+		CFBundleIdentifier upper
+	}
+	if err := Unmarshal([]byte(sampleXML), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if got.CFBundleIdentifier != "COM.EXAMPLE.APP" {
+		t.Errorf("CFBundleIdentifier = %q", got.CFBundleIdentifier)
+	}
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	in := map[string]any{
+		"string": "a <b> & 'c'",
+		"int":    int64(-12),
+		"big":    uint64(math.MaxUint64),
+		"real":   3.25,
+		"bool":   true,
+		"date":   time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+		"data":   []byte{0, 1, 2, 255},
+		"array":  []any{"x", int64(1), map[string]any{}},
+		"dict":   map[string]any{"k": []any{}},
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var out any
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch:\n in: %#v\nout: %#v", in, out)
+	}
+}
@@ -0,0 +1,370 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshaler is implemented by types that can convert themselves into a
+// value the plist encoder understands (string, bool, numbers, time.Time,
+// []byte, slices, maps with string keys or structs).
+type Marshaler interface {
+	MarshalPlist() (any, error)
+}
+
+// Format is a property list serialization format.
+type Format int
+
+const (
+	// XMLFormat is the XML property list format ("<plist version="1.0">").
+	XMLFormat Format = iota
+	// BinaryFormat is the binary property list format ("bplist00").
+	BinaryFormat
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case XMLFormat:
+		return "xml"
+	case BinaryFormat:
+		return "binary"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Marshal returns the XML property list encoding of v.
+//
+// Supported Go types map to plist types as follows:
+//
+//	string                        <string>
+//	bool                          <true/> or <false/>
+//	int*, uint*                   <integer>
+//	float32, float64              <real>
+//	time.Time                     <date> (UTC, second precision)
+//	[]byte                        <data> (base64)
+//	UID                           CF$UID reference
+//	slices and arrays             <array>
+//	map[string]T                  <dict>
+//	structs                       <dict>
+//
+// Struct fields are encoded using the field name unless a `plist:"name"`
+// tag is present. The tag options "omitempty" and "-" behave as in
+// encoding/json. Dictionary keys are always written in sorted order so the
+// output is deterministic. Nil pointers, nil interfaces and nil maps are
+// omitted from dictionaries and rejected elsewhere, as plists have no null.
+func Marshal(v any) ([]byte, error) {
+	return MarshalFormat(v, XMLFormat)
+}
+
+// MarshalFormat returns the property list encoding of v in the given format.
+func MarshalFormat(v any, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetFormat(format)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encoder writes property lists to an output stream.
+type Encoder struct {
+	w      io.Writer
+	format Format
+}
+
+// NewEncoder returns an encoder that writes XML property lists to w.
+// Use SetFormat to select the binary format instead.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// SetFormat sets the format used by subsequent calls to Encode.
+func (e *Encoder) SetFormat(format Format) {
+	e.format = format
+}
+
+// Encode writes the property list encoding of v to the stream.
+func (e *Encoder) Encode(v any) error {
+	val, err := normalize(reflect.ValueOf(v))
+	if err != nil {
+		return err
+	}
+	if val == nil {
+		return fmt.Errorf("plist: cannot encode nil value")
+	}
+
+	var data []byte
+	switch e.format {
+	case XMLFormat:
+		var buf bytes.Buffer
+		buf.WriteString(xmlHeader())
+		buf.WriteString("\n<plist version=\"1.0\">\n")
+		writeXMLValue(&buf, val, 0)
+		buf.WriteString("</plist>\n")
+		data = buf.Bytes()
+	case BinaryFormat:
+		if data, err = encodeBinary(val); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("plist: unknown format %v", e.format)
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	uidType       = reflect.TypeOf(UID(0))
+	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+)
+
+// normalize converts an arbitrary Go value into the small set of types the
+// writers understand: string, bool, int64, uint64, float64, time.Time,
+// []byte, UID, []any and map[string]any. A nil result means "no value".
+func normalize(v reflect.Value) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	if v.Type().Implements(marshalerType) {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil, nil
+		}
+		m, err := v.Interface().(Marshaler).MarshalPlist()
+		if err != nil {
+			return nil, fmt.Errorf("plist: %s.MarshalPlist: %w", v.Type(), err)
+		}
+		return normalize(reflect.ValueOf(m))
+	}
+
+	switch v.Type() {
+	case timeType:
+		return v.Interface().(time.Time), nil
+	case uidType:
+		return UID(v.Uint()), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return normalize(v.Elem())
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte(nil), v.Bytes()...), nil
+		}
+		return normalizeArray(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return b, nil
+		}
+		return normalizeArray(v)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("plist: unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		dict := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := normalize(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("plist: key %q: %w", iter.Key().String(), err)
+			}
+			if elem != nil {
+				dict[iter.Key().String()] = elem
+			}
+		}
+		return dict, nil
+	case reflect.Struct:
+		return normalizeStruct(v)
+	default:
+		return nil, fmt.Errorf("plist: unsupported type %s", v.Type())
+	}
+}
+
+func normalizeArray(v reflect.Value) (any, error) {
+	arr := make([]any, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elem, err := normalize(v.Index(i))
+		if err != nil {
+			return nil, fmt.Errorf("plist: index %d: %w", i, err)
+		}
+		if elem == nil {
+			return nil, fmt.Errorf("plist: index %d: nil array element", i)
+		}
+		arr = append(arr, elem)
+	}
+	return arr, nil
+}
+
+func normalizeStruct(v reflect.Value) (any, error) {
+	dict := make(map[string]any)
+	for _, f := range structFields(v.Type()) {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			// Field of a nil embedded struct pointer.
+			continue
+		}
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		elem, err := normalize(fv)
+		if err != nil {
+			return nil, fmt.Errorf("plist: field %s: %w", f.name, err)
+		}
+		if elem != nil {
+			dict[f.name] = elem
+		}
+	}
+	return dict, nil
+}
+
+// field describes an encodable struct field.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields returns the encodable fields of t, honoring `plist` tags and
+// flattening untagged embedded structs.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("plist")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				for _, inner := range structFields(ft) {
+					inner.index = append([]int{i}, inner.index...)
+					fields = append(fields, inner)
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return fields
+}
+
+// sortedKeys returns the keys of dict in sorted order.
+func sortedKeys(dict map[string]any) []string {
+	keys := make([]string, 0, len(dict))
+	for k := range dict {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeXMLValue writes a normalized value as XML at the given tab depth.
+func writeXMLValue(buf *bytes.Buffer, v any, depth int) {
+	indent := strings.Repeat("\t", depth)
+	buf.WriteString(indent)
+	switch v := v.(type) {
+	case string:
+		buf.WriteString("<string>" + EscapeXML(v) + "</string>\n")
+	case bool:
+		if v {
+			buf.WriteString("<true/>\n")
+		} else {
+			buf.WriteString("<false/>\n")
+		}
+	case int64:
+		buf.WriteString("<integer>" + strconv.FormatInt(v, 10) + "</integer>\n")
+	case uint64:
+		buf.WriteString("<integer>" + strconv.FormatUint(v, 10) + "</integer>\n")
+	case float64:
+		buf.WriteString("<real>" + formatReal(v) + "</real>\n")
+	case time.Time:
+		buf.WriteString("<date>" + v.UTC().Format(time.RFC3339) + "</date>\n")
+	case []byte:
+		buf.WriteString("<data>" + base64.StdEncoding.EncodeToString(v) + "</data>\n")
+	case UID:
+		buf.WriteString("<dict>\n")
+		buf.WriteString(indent + "\t<key>CF$UID</key>\n")
+		buf.WriteString(indent + "\t<integer>" + strconv.FormatUint(uint64(v), 10) + "</integer>\n")
+		buf.WriteString(indent + "</dict>\n")
+	case []any:
+		if len(v) == 0 {
+			buf.WriteString("<array/>\n")
+			return
+		}
+		buf.WriteString("<array>\n")
+		for _, elem := range v {
+			writeXMLValue(buf, elem, depth+1)
+		}
+		buf.WriteString(indent + "</array>\n")
+	case map[string]any:
+		if len(v) == 0 {
+			buf.WriteString("<dict/>\n")
+			return
+		}
+		buf.WriteString("<dict>\n")
+		for _, k := range sortedKeys(v) {
+			buf.WriteString(indent + "\t<key>" + EscapeXML(k) + "</key>\n")
+			writeXMLValue(buf, v[k], depth+1)
+		}
+		buf.WriteString(indent + "</dict>\n")
+	}
+}
+
+// formatReal formats a float the way CoreFoundation writes <real> values.
+func formatReal(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+infinity"
+	case math.IsInf(f, -1):
+		return "-infinity"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
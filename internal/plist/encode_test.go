@@ -0,0 +1,215 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalScalars(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"string", "a & b", "<string>a &amp; b</string>"},
+		{"true", true, "<true/>"},
+		{"false", false, "<false/>"},
+		{"int", 42, "<integer>42</integer>"},
+		{"negative int", int8(-7), "<integer>-7</integer>"},
+		{"uint64", uint64(1 << 63), "<integer>9223372036854775808</integer>"},
+		{"float", 1.5, "<real>1.5</real>"},
+		{"float32", float32(0.25), "<real>0.25</real>"},
+		{"date", time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("X", 3600)), "<date>2024-03-01T11:30:00Z</date>"},
+		{"data", []byte("hello"), "<data>aGVsbG8=</data>"},
+		{"empty array", []string{}, "<array/>"},
+		{"empty dict", map[string]any{}, "<dict/>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal(%v) error: %v", tt.value, err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("Marshal(%v) = %s, want it to contain %s", tt.value, data, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalNested(t *testing.T) {
+	v := map[string]any{
+		"NSAppTransportSecurity": map[string]any{
+			"NSAllowsArbitraryLoads": false,
+			"NSExceptionDomains": map[string]any{
+				"example.com": map[string]any{
+					"NSIncludesSubdomains": true,
+				},
+			},
+		},
+		"Numbers": []any{1, 2.5, "three"},
+	}
+
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>NSAppTransportSecurity</key>
+	<dict>
+		<key>NSAllowsArbitraryLoads</key>
+		<false/>
+		<key>NSExceptionDomains</key>
+		<dict>
+			<key>example.com</key>
+			<dict>
+				<key>NSIncludesSubdomains</key>
+				<true/>
+			</dict>
+		</dict>
+	</dict>
+	<key>Numbers</key>
+	<array>
+		<integer>1</integer>
+		<real>2.5</real>
+		<string>three</string>
+	</array>
+</dict>
+</plist>
+`
+	if string(data) != want {
+		t.Errorf("Marshal output mismatch:\ngot:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestMarshalDeterministic(t *testing.T) {
+	v := map[string]any{}
+	for _, k := range []string{"zeta", "alpha", "mu", "beta", "omega", "gamma"} {
+		v[k] = k
+	}
+
+	first, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		again, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		if string(again) != string(first) {
+			t.Fatal("Marshal output is not deterministic")
+		}
+	}
+
+	if strings.Index(string(first), "alpha") > strings.Index(string(first), "zeta") {
+		t.Error("dictionary keys should be sorted")
+	}
+}
+
+func TestMarshalStruct(t *testing.T) {
+	type Inner struct {
+		Enabled bool
+	}
+	type Base struct {
+		Kind string `plist:"kind"`
+	}
+	type Doc struct {
+		Base
+		Name     string            `plist:"CFBundleName"`
+		Count    int               `plist:"count,omitempty"`
+		Skipped  string            `plist:"-"`
+		Inner    *Inner            `plist:"inner,omitempty"`
+		Tags     []string          `plist:"tags"`
+		Extra    map[string]string `plist:"extra"`
+		internal string
+	}
+
+	data, err := Marshal(Doc{
+		Base:     Base{Kind: "app"},
+		Name:     "Demo",
+		Skipped:  "nope",
+		Inner:    &Inner{Enabled: true},
+		Tags:     []string{"x"},
+		internal: "hidden",
+	})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	out := string(data)
+
+	for _, want := range []string{
+		"<key>kind</key>\n\t<string>app</string>",
+		"<key>CFBundleName</key>\n\t<string>Demo</string>",
+		"<key>inner</key>\n\t<dict>\n\t\t<key>Enabled</key>\n\t\t<true/>",
+		"<key>tags</key>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	for _, absent := range []string{"count", "Skipped", "nope", "hidden", "extra"} {
+		if strings.Contains(out, absent) {
+			t.Errorf("output should not contain %q:\n%s", absent, out)
+		}
+	}
+}
+
+type version struct{ major, minor int }
+
+func (v version) MarshalPlist() (any, error) {
+	return []int{v.major, v.minor}, nil
+}
+
+func TestMarshalMarshaler(t *testing.T) {
+	data, err := Marshal(map[string]any{"v": version{1, 2}})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if !strings.Contains(string(data), "<integer>1</integer>\n\t\t<integer>2</integer>") {
+		t.Errorf("Marshaler output not used:\n%s", data)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"nil", nil, "nil value"},
+		{"func", map[string]any{"f": func() {}}, `key "f"`},
+		{"chan", make(chan int), "unsupported type"},
+		{"int keys", map[int]string{1: "a"}, "unsupported map key type"},
+		{"nil element", []any{"a", nil}, "nil array element"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.value)
+			if err == nil {
+				t.Fatalf("Marshal(%v) succeeded, want error", tt.value)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalOmitsNilDictValues(t *testing.T) {
+	var p *string
+	data, err := Marshal(map[string]any{"a": "x", "b": nil, "c": p})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if strings.Contains(string(data), "<key>b</key>") || strings.Contains(string(data), "<key>c</key>") {
+		t.Errorf("nil values should be omitted:\n%s", data)
+	}
+}
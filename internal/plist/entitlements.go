@@ -3,7 +3,6 @@ package plist
 import (
 	"fmt"
 	"os"
-	"sort"
 	"strings"
 )
 
@@ -23,17 +22,20 @@ const (
 
 // EntitlementsConfig holds configuration for generating entitlements.plist files.
 type EntitlementsConfig struct {
-	Permissions    []Permission
-	Custom         []string
-	CustomStrings  map[string]string
-	CustomArrays   map[string][]string
-	AppGroups      []string
+	Permissions   []Permission
+	Custom        []string
+	CustomStrings map[string]string
+	CustomArrays  map[string][]string
+	AppGroups     []string
 }
 
 // WriteEntitlements creates an entitlements.plist file at the specified path.
 // It generates entitlements based on the provided permissions, custom entitlements, and app groups.
 func WriteEntitlements(path string, cfg EntitlementsConfig) error {
-	content := generateEntitlementsContent(cfg)
+	content, err := generateEntitlementsContent(cfg)
+	if err != nil {
+		return err
+	}
 
 	// If no entitlements are specified, don't create an empty file
 	if content == "" {
@@ -44,56 +46,51 @@ func WriteEntitlements(path string, cfg EntitlementsConfig) error {
 }
 
 // generateEntitlementsContent generates the XML content for an entitlements.plist file.
-func generateEntitlementsContent(cfg EntitlementsConfig) string {
-	var entries []string
+// It returns an empty string when cfg requests no entitlements.
+func generateEntitlementsContent(cfg EntitlementsConfig) (string, error) {
+	dict := entitlementsDict(cfg)
+	if len(dict) == 0 {
+		return "", nil
+	}
+
+	data, err := Marshal(dict)
+	if err != nil {
+		return "", fmt.Errorf("encode entitlements: %w", err)
+	}
+	return string(data), nil
+}
+
+// entitlementsDict returns the entitlements dictionary for cfg.
+// Keys are written in sorted order by the encoder, so the output is deterministic.
+func entitlementsDict(cfg EntitlementsConfig) map[string]any {
+	dict := make(map[string]any)
 
 	// Add standard permissions
 	for _, perm := range cfg.Permissions {
 		if entitlement := permissionToEntitlement(perm); entitlement != "" {
-			entries = append(entries, xmlKeyBool(entitlement, true))
+			dict[entitlement] = true
 		}
 	}
 
 	// Add custom entitlements
 	for _, custom := range cfg.Custom {
-		entries = append(entries, xmlKeyBool(custom, true))
+		dict[custom] = true
 	}
 
-	// Add custom string entitlements (sorted for deterministic output)
-	if len(cfg.CustomStrings) > 0 {
-		keys := make([]string, 0, len(cfg.CustomStrings))
-		for k := range cfg.CustomStrings {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			entries = append(entries, xmlKeyValue(k, cfg.CustomStrings[k]))
-		}
+	for k, v := range cfg.CustomStrings {
+		dict[k] = v
 	}
 
-	// Add custom array entitlements (sorted for deterministic output)
-	if len(cfg.CustomArrays) > 0 {
-		keys := make([]string, 0, len(cfg.CustomArrays))
-		for k := range cfg.CustomArrays {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			entries = append(entries, xmlKeyArray(k, cfg.CustomArrays[k]))
-		}
+	for k, v := range cfg.CustomArrays {
+		dict[k] = append([]string{}, v...)
 	}
 
 	// Add app groups entitlements
 	if len(cfg.AppGroups) > 0 {
-		entries = append(entries, xmlKeyArray("com.apple.security.application-groups", cfg.AppGroups))
-	}
-
-	if len(entries) == 0 {
-		return ""
+		dict["com.apple.security.application-groups"] = cfg.AppGroups
 	}
 
-	dictContent := strings.Join(entries, "\n")
-	return wrapPlist(wrapDict(dictContent))
+	return dict
 }
 
 // permissionToEntitlement maps a Permission to its corresponding entitlement key.
@@ -325,7 +325,10 @@ func TestGenerateEntitlementsContentOnlyPermissions(t *testing.T) {
 		Permissions: []Permission{Camera, Files},
 	}
 
-	content := generateEntitlementsContent(cfg)
+	content, err := generateEntitlementsContent(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Should contain XML structure
 	if !strings.Contains(content, `<?xml version="1.0" encoding="UTF-8"?>`) {
@@ -356,7 +359,10 @@ func TestGenerateEntitlementsContentOnlyCustom(t *testing.T) {
 		Custom: []string{"com.apple.security.device.bluetooth", "com.apple.security.device.usb"},
 	}
 
-	content := generateEntitlementsContent(cfg)
+	content, err := generateEntitlementsContent(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expectedEntitlements := []string{
 		`<key>com.apple.security.device.bluetooth</key>`,
@@ -376,7 +382,10 @@ func TestGenerateEntitlementsContentOnlyAppGroups(t *testing.T) {
 		AppGroups: []string{"group.com.example.shared"},
 	}
 
-	content := generateEntitlementsContent(cfg)
+	content, err := generateEntitlementsContent(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expectedElements := []string{
 		`<key>com.apple.security.application-groups</key>`,
@@ -400,7 +409,10 @@ func TestGenerateEntitlementsContentCustomStrings(t *testing.T) {
 		},
 	}
 
-	content := generateEntitlementsContent(cfg)
+	content, err := generateEntitlementsContent(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expectedElements := []string{
 		`<key>com.apple.application-identifier</key>`,
@@ -438,7 +450,10 @@ func TestGenerateEntitlementsContentCustomArrays(t *testing.T) {
 		},
 	}
 
-	content := generateEntitlementsContent(cfg)
+	content, err := generateEntitlementsContent(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expectedElements := []string{
 		`<key>com.apple.developer.applesignin</key>`,
@@ -467,7 +482,10 @@ func TestGenerateEntitlementsContentCustomArraysMultiple(t *testing.T) {
 		},
 	}
 
-	content := generateEntitlementsContent(cfg)
+	content, err := generateEntitlementsContent(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expectedElements := []string{
 		`<key>com.apple.developer.applesignin</key>`,
@@ -3,7 +3,7 @@ package plist
 import (
 	"fmt"
 	"os"
-	"strings"
+	"reflect"
 
 	"github.com/tmc/macgo/bundle"
 )
@@ -16,17 +16,56 @@ type InfoPlistConfig struct {
 	Version        string
 	BackgroundOnly bool
 	CustomKeys     map[string]interface{}
+
+	// Template is a base dictionary, typically parsed from a hand-maintained
+	// Info.plist fragment, that the generated keys are deep-merged into.
+	Template map[string]any
+}
+
+// InfoPlistConflict describes a template or custom key that was overridden
+// because macgo requires a specific value for it.
+type InfoPlistConflict struct {
+	Key      string // Info.plist key
+	Source   string // "template" or "info"
+	Value    any    // value supplied by Source
+	Required any    // value macgo wrote instead
+}
+
+func (c InfoPlistConflict) String() string {
+	return fmt.Sprintf("%s sets %s=%v, but macgo requires %v", c.Source, c.Key, c.Value, c.Required)
+}
+
+// ReadInfoPlistTemplate parses an XML or binary property list whose root is
+// a dictionary, for use as InfoPlistConfig.Template.
+func ReadInfoPlistTemplate(data []byte) (map[string]any, error) {
+	var template map[string]any
+	if err := Unmarshal(data, &template); err != nil {
+		return nil, fmt.Errorf("parse Info.plist template: %w", err)
+	}
+	return template, nil
 }
 
 // WriteInfoPlist creates a minimal Info.plist file at the specified path.
 // It generates a standard macOS app bundle Info.plist with required keys.
 func WriteInfoPlist(path string, cfg InfoPlistConfig) error {
+	content, err := EncodeInfoPlist(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// EncodeInfoPlist returns the Info.plist that WriteInfoPlist would write for cfg.
+func EncodeInfoPlist(cfg InfoPlistConfig) ([]byte, error) {
 	if err := validateInfoPlistConfig(cfg); err != nil {
-		return fmt.Errorf("invalid info plist config: %w", err)
+		return nil, fmt.Errorf("invalid info plist config: %w", err)
 	}
 
-	content := generateInfoPlistContent(cfg)
-	return os.WriteFile(path, []byte(content), 0644)
+	content, err := generateInfoPlistContent(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("encode info plist: %w", err)
+	}
+	return []byte(content), nil
 }
 
 // validateInfoPlistConfig validates the configuration for Info.plist generation.
@@ -47,68 +86,112 @@ func validateInfoPlistConfig(cfg InfoPlistConfig) error {
 }
 
 // generateInfoPlistContent generates the XML content for an Info.plist file.
-func generateInfoPlistContent(cfg InfoPlistConfig) string {
-	var entries []string
-
-	// Helper to check if a key is overridden by CustomKeys
-	isOverridden := func(key string) bool {
-		_, ok := cfg.CustomKeys[key]
-		return ok
-	}
-
-	// Standard required entries
-	if !isOverridden("CFBundleDisplayName") {
-		entries = append(entries, xmlKeyValue("CFBundleDisplayName", cfg.AppName))
+func generateInfoPlistContent(cfg InfoPlistConfig) (string, error) {
+	dict, _, err := MergeInfoPlist(cfg)
+	if err != nil {
+		return "", err
 	}
-	if !isOverridden("CFBundleExecutable") {
-		entries = append(entries, xmlKeyValue("CFBundleExecutable", cfg.ExecName))
+	data, err := Marshal(dict)
+	if err != nil {
+		return "", err
 	}
-	if !isOverridden("CFBundleIdentifier") {
-		entries = append(entries, xmlKeyValue("CFBundleIdentifier", cfg.BundleID))
-	}
-	if !isOverridden("CFBundleName") {
-		entries = append(entries, xmlKeyValue("CFBundleName", cfg.AppName))
-	}
-	if !isOverridden("CFBundlePackageType") {
-		entries = append(entries, xmlKeyValue("CFBundlePackageType", "APPL"))
+	return string(data), nil
+}
+
+// MergeInfoPlist returns the Info.plist dictionary for cfg together with
+// any conflicts between user-supplied keys and the keys macgo requires.
+//
+// Layers are deep-merged in increasing order of precedence: macgo's
+// defaults, cfg.Template, cfg.CustomKeys, and finally the keys macgo
+// requires to launch the bundle (CFBundleExecutable, CFBundleIdentifier and
+// CFBundlePackageType). Nested dictionaries are merged key by key; any other
+// value replaces the lower-precedence one.
+func MergeInfoPlist(cfg InfoPlistConfig) (map[string]any, []InfoPlistConflict, error) {
+	template, err := normalizeDict(cfg.Template)
+	if err != nil {
+		return nil, nil, fmt.Errorf("template: %w", err)
+	}
+	custom, err := normalizeDict(cfg.CustomKeys)
+	if err != nil {
+		return nil, nil, err
 	}
-	if !isOverridden("CFBundleVersion") {
-		entries = append(entries, xmlKeyValue("CFBundleVersion", cfg.Version))
+
+	dict := map[string]any{
+		"CFBundleDisplayName":        cfg.AppName,
+		"CFBundleName":               cfg.AppName,
+		"CFBundleVersion":            cfg.Version,
+		"CFBundleShortVersionString": cfg.Version,
+		"NSHighResolutionCapable":    true,
 	}
-	if !isOverridden("CFBundleShortVersionString") {
-		entries = append(entries, xmlKeyValue("CFBundleShortVersionString", cfg.Version))
+
+	// Only apply default background logic if neither key is set by the
+	// template or custom keys. UIModeAccessory sets LSUIElement=true via
+	// CustomKeys in bundle.go. UIModeRegular sets neither key — the app
+	// appears in the Dock normally.
+	if cfg.BackgroundOnly && !hasAnyKey("LSBackgroundOnly", template, custom) && !hasAnyKey("LSUIElement", template, custom) {
+		dict["LSBackgroundOnly"] = true
 	}
 
-	// Only apply default background logic if neither is overridden.
-	// UIModeAccessory sets LSUIElement=true via CustomKeys in bundle.go.
-	// UIModeRegular sets neither key — the app appears in the Dock normally.
-	if !isOverridden("LSBackgroundOnly") && !isOverridden("LSUIElement") {
-		if cfg.BackgroundOnly {
-			entries = append(entries, xmlKeyBool("LSBackgroundOnly", true))
+	mergeDict(dict, template)
+	mergeDict(dict, custom)
+
+	required := map[string]any{
+		"CFBundleExecutable":  cfg.ExecName,
+		"CFBundleIdentifier":  cfg.BundleID,
+		"CFBundlePackageType": "APPL",
+	}
+	var conflicts []InfoPlistConflict
+	for _, key := range sortedKeys(required) {
+		want := required[key]
+		for _, layer := range []struct {
+			name string
+			dict map[string]any
+		}{{"template", template}, {"info", custom}} {
+			if got, ok := layer.dict[key]; ok && !reflect.DeepEqual(got, want) {
+				conflicts = append(conflicts, InfoPlistConflict{Key: key, Source: layer.name, Value: got, Required: want})
+			}
 		}
+		dict[key] = want
 	}
+	return dict, conflicts, nil
+}
 
-	if !isOverridden("NSHighResolutionCapable") {
-		entries = append(entries, xmlKeyBool("NSHighResolutionCapable", true))
+// normalizeDict converts a user-supplied dictionary into generic plist
+// values so it can be deep-merged.
+func normalizeDict(m map[string]any) (map[string]any, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	v, err := normalize(reflect.ValueOf(m))
+	if err != nil {
+		return nil, err
 	}
+	return v.(map[string]any), nil
+}
 
-	// Add custom keys if provided
-	for key, value := range cfg.CustomKeys {
-		switch v := value.(type) {
-		case string:
-			entries = append(entries, xmlKeyValue(key, v))
-		case bool:
-			entries = append(entries, xmlKeyBool(key, v))
-		case []string:
-			entries = append(entries, xmlKeyArray(key, v))
-		default:
-			// For unsupported types, convert to string
-			entries = append(entries, xmlKeyValue(key, fmt.Sprintf("%v", v)))
+// mergeDict deep-merges src into dst.
+func mergeDict(dst, src map[string]any) {
+	for k, v := range src {
+		srcDict, srcOK := v.(map[string]any)
+		dstDict, dstOK := dst[k].(map[string]any)
+		if srcOK && dstOK {
+			merged := make(map[string]any, len(dstDict)+len(srcDict))
+			mergeDict(merged, dstDict)
+			mergeDict(merged, srcDict)
+			dst[k] = merged
+			continue
 		}
+		dst[k] = v
 	}
+}
 
-	dictContent := strings.Join(entries, "\n")
-	return wrapPlist(wrapDict(dictContent))
+func hasAnyKey(key string, dicts ...map[string]any) bool {
+	for _, d := range dicts {
+		if _, ok := d[key]; ok {
+			return true
+		}
+	}
+	return false
 }
 
 // GenerateDefaultBundleID creates a default bundle ID based on the app name.
@@ -3,6 +3,7 @@ package plist
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -440,3 +441,149 @@ func TestInfoPlistXMLEscaping(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteInfoPlistTypedCustomKeys(t *testing.T) {
+	plistPath := filepath.Join(t.TempDir(), "Info.plist")
+
+	cfg := InfoPlistConfig{
+		AppName:  "TestApp",
+		BundleID: "com.example.testapp",
+		ExecName: "testapp",
+		Version:  "1.0.0",
+		CustomKeys: map[string]interface{}{
+			"LSMinimumSystemVersion": "12.0",
+			"LSArchitecturePriority": []interface{}{"arm64", "x86_64"},
+			"NSAppTransportSecurity": map[string]interface{}{
+				"NSAllowsLocalNetworking": true,
+			},
+			"MacgoBuildNumber": 42,
+		},
+	}
+
+	if err := WriteInfoPlist(plistPath, cfg); err != nil {
+		t.Fatalf("WriteInfoPlist failed: %v", err)
+	}
+	content, err := os.ReadFile(plistPath)
+	if err != nil {
+		t.Fatalf("Failed to read plist file: %v", err)
+	}
+
+	for _, want := range []string{
+		"<key>NSAppTransportSecurity</key>\n\t<dict>\n\t\t<key>NSAllowsLocalNetworking</key>\n\t\t<true/>\n\t</dict>",
+		"<key>MacgoBuildNumber</key>\n\t<integer>42</integer>",
+		"<key>LSArchitecturePriority</key>\n\t<array>\n\t\t<string>arm64</string>",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Info.plist missing %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(string(content), "map[") {
+		t.Errorf("nested dict was stringified:\n%s", content)
+	}
+}
+
+func TestWriteInfoPlistUnsupportedType(t *testing.T) {
+	plistPath := filepath.Join(t.TempDir(), "Info.plist")
+
+	cfg := InfoPlistConfig{
+		AppName:    "TestApp",
+		BundleID:   "com.example.testapp",
+		ExecName:   "testapp",
+		Version:    "1.0.0",
+		CustomKeys: map[string]interface{}{"Bad": make(chan int)},
+	}
+
+	if err := WriteInfoPlist(plistPath, cfg); err == nil {
+		t.Fatal("WriteInfoPlist should fail for unsupported value types")
+	}
+}
+
+func TestMergeInfoPlist(t *testing.T) {
+	cfg := InfoPlistConfig{
+		AppName:        "TestApp",
+		BundleID:       "com.example.testapp",
+		ExecName:       "testapp",
+		Version:        "1.0.0",
+		BackgroundOnly: true,
+		Template: map[string]any{
+			"CFBundleExecutable":     "other",
+			"CFBundleName":           "Template Name",
+			"LSUIElement":            true,
+			"LSMinimumSystemVersion": "11.0",
+			"NSAppTransportSecurity": map[string]any{
+				"NSAllowsArbitraryLoads":  true,
+				"NSAllowsLocalNetworking": false,
+			},
+		},
+		CustomKeys: map[string]interface{}{
+			"CFBundleIdentifier":     "com.example.other",
+			"CFBundlePackageType":    "APPL",
+			"LSMinimumSystemVersion": "12.0",
+			"NSAppTransportSecurity": map[string]interface{}{
+				"NSAllowsLocalNetworking": true,
+			},
+		},
+	}
+
+	dict, conflicts, err := MergeInfoPlist(cfg)
+	if err != nil {
+		t.Fatalf("MergeInfoPlist failed: %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		want any
+	}{
+		{"CFBundleExecutable", "testapp"},             // required beats template
+		{"CFBundleIdentifier", "com.example.testapp"}, // required beats Info
+		{"CFBundleName", "Template Name"},             // template beats default
+		{"CFBundleDisplayName", "TestApp"},            // default kept
+		{"LSMinimumSystemVersion", "12.0"},            // Info beats template
+		{"LSUIElement", true},                         // template suppresses background default
+		// Nested dictionaries merge key by key.
+		{"NSAppTransportSecurity", map[string]any{
+			"NSAllowsArbitraryLoads":  true,
+			"NSAllowsLocalNetworking": true,
+		}},
+	}
+	for _, tt := range tests {
+		if got := dict[tt.key]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.key, got, tt.want)
+		}
+	}
+	if _, ok := dict["LSBackgroundOnly"]; ok {
+		t.Error("LSBackgroundOnly should not be set when the template sets LSUIElement")
+	}
+
+	want := []InfoPlistConflict{
+		{Key: "CFBundleExecutable", Source: "template", Value: "other", Required: "testapp"},
+		{Key: "CFBundleIdentifier", Source: "info", Value: "com.example.other", Required: "com.example.testapp"},
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", conflicts, want)
+	}
+}
+
+func TestReadInfoPlistTemplate(t *testing.T) {
+	for _, format := range []Format{XMLFormat, BinaryFormat} {
+		data, err := MarshalFormat(map[string]any{"LSMinimumSystemVersion": "13.0"}, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template, err := ReadInfoPlistTemplate(data)
+		if err != nil {
+			t.Fatalf("%v: ReadInfoPlistTemplate failed: %v", format, err)
+		}
+		if template["LSMinimumSystemVersion"] != "13.0" {
+			t.Errorf("%v: template = %v", format, template)
+		}
+	}
+
+	data, err := Marshal([]string{"not", "a", "dict"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadInfoPlistTemplate(data); err == nil {
+		t.Error("ReadInfoPlistTemplate should reject a non-dictionary root")
+	}
+}
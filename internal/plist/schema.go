@@ -0,0 +1,286 @@
+package plist
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Kind is the plist type expected for an Info.plist key.
+type Kind int
+
+const (
+	String Kind = iota
+	Bool
+	Integer
+	Real
+	Date
+	Data
+	Array
+	Dict
+)
+
+// String returns the XML element name for k.
+func (k Kind) String() string {
+	switch k {
+	case String:
+		return "<string>"
+	case Bool:
+		return "<true/false>"
+	case Integer:
+		return "<integer>"
+	case Real:
+		return "<real>"
+	case Date:
+		return "<date>"
+	case Data:
+		return "<data>"
+	case Array:
+		return "<array>"
+	case Dict:
+		return "<dict>"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// matches reports whether the normalized value v is of kind k.
+// Integers are accepted where a real is expected.
+func (k Kind) matches(v any) bool {
+	switch v.(type) {
+	case string:
+		return k == String
+	case bool:
+		return k == Bool
+	case int64, uint64:
+		return k == Integer || k == Real
+	case float64:
+		return k == Real
+	case time.Time:
+		return k == Date
+	case []byte:
+		return k == Data
+	case []any:
+		return k == Array
+	case map[string]any:
+		return k == Dict
+	}
+	return false
+}
+
+// InfoKey describes a known Info.plist key.
+type InfoKey struct {
+	Name string
+	Kind Kind
+
+	// Elem is the kind of each element when Kind is Array.
+	Elem Kind
+
+	// Allowed lists the permitted values of a String key (or of each
+	// element of a String array). Empty means any value.
+	Allowed []string
+
+	// Check performs additional validation of a well-typed value.
+	Check func(v any) error
+}
+
+var (
+	bundleIDRe      = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+	systemVersionRe = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+	bonjourTypeRe   = regexp.MustCompile(`^_[A-Za-z0-9-]+\._(tcp|udp)$`)
+)
+
+// ValidateBundleIdentifier checks that id is a reverse-DNS bundle
+// identifier by Apple's rule for CFBundleIdentifier: letters, digits and
+// hyphens, in two or more components separated by periods. Components
+// may start with a digit, as in com.github.tmc.2fa.
+func ValidateBundleIdentifier(id string) error {
+	if !bundleIDRe.MatchString(id) {
+		return fmt.Errorf("%q is not a reverse-DNS identifier (e.g. com.example.app)", id)
+	}
+	return nil
+}
+
+func checkBundleID(v any) error {
+	return ValidateBundleIdentifier(v.(string))
+}
+
+func checkSystemVersion(v any) error {
+	if !systemVersionRe.MatchString(v.(string)) {
+		return fmt.Errorf("%q is not a version like 13.0 or 10.15.7", v)
+	}
+	return nil
+}
+
+func checkNonEmpty(v any) error {
+	if strings.TrimSpace(v.(string)) == "" {
+		return errors.New("must not be empty")
+	}
+	return nil
+}
+
+func checkBonjourServices(v any) error {
+	for _, s := range v.([]any) {
+		if !bonjourTypeRe.MatchString(s.(string)) {
+			return fmt.Errorf("%q is not a Bonjour service type like _http._tcp", s)
+		}
+	}
+	return nil
+}
+
+func checkCategory(v any) error {
+	if !strings.HasPrefix(v.(string), "public.app-category.") {
+		return fmt.Errorf("%q must start with public.app-category.", v)
+	}
+	return nil
+}
+
+func checkPresentationMode(v any) error {
+	var n int64
+	switch v := v.(type) {
+	case int64:
+		n = v
+	case uint64:
+		n = int64(min(v, 5))
+	}
+	if n < 0 || n > 4 {
+		return fmt.Errorf("%d is not between 0 and 4", n)
+	}
+	return nil
+}
+
+// infoKeys is the table of Info.plist keys macgo knows how to check.
+// Keys not listed here are accepted without validation, as Info.plist
+// is open-ended.
+var infoKeys = map[string]InfoKey{}
+
+func init() {
+	for _, k := range []InfoKey{
+		// Core Foundation keys.
+		{Name: "CFBundleIdentifier", Kind: String, Check: checkBundleID},
+		{Name: "CFBundleName", Kind: String, Check: checkNonEmpty},
+		{Name: "CFBundleDisplayName", Kind: String, Check: checkNonEmpty},
+		{Name: "CFBundleExecutable", Kind: String, Check: checkNonEmpty},
+		{Name: "CFBundlePackageType", Kind: String, Allowed: []string{"APPL", "BNDL", "FMWK", "XPC!", "KEXT"}},
+		{Name: "CFBundleVersion", Kind: String, Check: checkNonEmpty},
+		{Name: "CFBundleShortVersionString", Kind: String, Check: checkNonEmpty},
+		{Name: "CFBundleInfoDictionaryVersion", Kind: String, Allowed: []string{"6.0"}},
+		{Name: "CFBundleDevelopmentRegion", Kind: String},
+		{Name: "CFBundleSignature", Kind: String},
+		{Name: "CFBundleIconFile", Kind: String},
+		{Name: "CFBundleIconName", Kind: String},
+		{Name: "CFBundleGetInfoString", Kind: String},
+		{Name: "CFBundleLocalizations", Kind: Array, Elem: String},
+		{Name: "CFBundleSupportedPlatforms", Kind: Array, Elem: String},
+		{Name: "CFBundleAllowMixedLocalizations", Kind: Bool},
+		{Name: "CFBundleURLTypes", Kind: Array, Elem: Dict},
+		{Name: "CFBundleDocumentTypes", Kind: Array, Elem: Dict},
+
+		// Launch Services keys.
+		{Name: "LSUIElement", Kind: Bool},
+		{Name: "LSBackgroundOnly", Kind: Bool},
+		{Name: "LSMinimumSystemVersion", Kind: String, Check: checkSystemVersion},
+		{Name: "LSMinimumSystemVersionByArchitecture", Kind: Dict},
+		{Name: "LSApplicationCategoryType", Kind: String, Check: checkCategory},
+		{Name: "LSArchitecturePriority", Kind: Array, Elem: String, Allowed: []string{"arm64", "arm64e", "x86_64", "i386"}},
+		{Name: "LSEnvironment", Kind: Dict},
+		{Name: "LSFileQuarantineEnabled", Kind: Bool},
+		{Name: "LSMultipleInstancesProhibited", Kind: Bool},
+		{Name: "LSRequiresNativeExecution", Kind: Bool},
+		{Name: "LSUIPresentationMode", Kind: Integer, Check: checkPresentationMode},
+		{Name: "LSApplicationQueriesSchemes", Kind: Array, Elem: String},
+
+		// Cocoa keys.
+		{Name: "NSHighResolutionCapable", Kind: Bool},
+		{Name: "NSPrincipalClass", Kind: String},
+		{Name: "NSMainNibFile", Kind: String},
+		{Name: "NSMainStoryboardFile", Kind: String},
+		{Name: "NSHumanReadableCopyright", Kind: String},
+		{Name: "NSSupportsAutomaticGraphicsSwitching", Kind: Bool},
+		{Name: "NSSupportsSuddenTermination", Kind: Bool},
+		{Name: "NSRequiresAquaSystemAppearance", Kind: Bool},
+		{Name: "NSAppleScriptEnabled", Kind: Bool},
+		{Name: "NSAppTransportSecurity", Kind: Dict},
+		{Name: "NSBonjourServices", Kind: Array, Elem: String, Check: checkBonjourServices},
+		{Name: "NSServices", Kind: Array, Elem: Dict},
+
+		// Uniform Type Identifier declarations.
+		{Name: "UTExportedTypeDeclarations", Kind: Array, Elem: Dict},
+		{Name: "UTImportedTypeDeclarations", Kind: Array, Elem: Dict},
+
+		{Name: "ITSAppUsesNonExemptEncryption", Kind: Bool},
+	} {
+		infoKeys[k.Name] = k
+	}
+}
+
+// LookupInfoKey returns the description of a known Info.plist key.
+// Any key of the form NS*UsageDescription is known and must be a
+// non-empty string.
+func LookupInfoKey(name string) (InfoKey, bool) {
+	if k, ok := infoKeys[name]; ok {
+		return k, true
+	}
+	if strings.HasPrefix(name, "NS") && strings.HasSuffix(name, "UsageDescription") {
+		return InfoKey{Name: name, Kind: String, Check: checkNonEmpty}, true
+	}
+	return InfoKey{}, false
+}
+
+// validate checks the normalized value v against k.
+func (k InfoKey) validate(v any) error {
+	if !k.Kind.matches(v) {
+		return fmt.Errorf("expected %v, got %s", k.Kind, describeValue(v))
+	}
+	values := []any{v}
+	if k.Kind == Array {
+		values = v.([]any)
+		for i, elem := range values {
+			if !k.Elem.matches(elem) {
+				return fmt.Errorf("element %d: expected %v, got %s", i, k.Elem, describeValue(elem))
+			}
+		}
+	}
+	if len(k.Allowed) > 0 {
+		for _, elem := range values {
+			if s, ok := elem.(string); ok && !slices.Contains(k.Allowed, s) {
+				return fmt.Errorf("%q is not one of %s", s, strings.Join(k.Allowed, ", "))
+			}
+		}
+	}
+	if k.Check != nil {
+		return k.Check(v)
+	}
+	return nil
+}
+
+func describeValue(v any) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%s %q", plistTypeName(v), s)
+	}
+	return plistTypeName(v)
+}
+
+// ValidateInfoPlist checks the values of known keys in an Info.plist
+// dictionary against their expected types and allowed values. All
+// problems are reported, one per key in sorted order.
+func ValidateInfoPlist(info map[string]any) error {
+	dict, err := normalizeDict(info)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range sortedKeys(dict) {
+		k, ok := LookupInfoKey(name)
+		if !ok {
+			continue
+		}
+		if err := k.validate(dict[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
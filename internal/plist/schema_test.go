@@ -0,0 +1,146 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateInfoPlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    map[string]any
+		wantErr string // substring; empty means valid
+	}{
+		{
+			name: "valid keys",
+			info: map[string]any{
+				"CFBundleIdentifier":            "com.example.app",
+				"CFBundlePackageType":           "APPL",
+				"LSUIElement":                   true,
+				"LSMinimumSystemVersion":        "13.0",
+				"LSArchitecturePriority":        []string{"arm64", "x86_64"},
+				"LSUIPresentationMode":          4,
+				"NSCameraUsageDescription":      "Take pictures.",
+				"NSBonjourServices":             []string{"_peer-tool._tcp"},
+				"NSAppTransportSecurity":        map[string]any{"NSAllowsLocalNetworking": true},
+				"CFBundleURLTypes":              []map[string]any{{"CFBundleURLSchemes": []string{"x"}}},
+				"SomeUnknownKey":                "anything",
+				"MacgoBuildDate":                time.Unix(0, 0),
+				"LSApplicationCategoryType":     "public.app-category.developer-tools",
+				"ITSAppUsesNonExemptEncryption": false,
+			},
+		},
+		{
+			name:    "LSUIElement string",
+			info:    map[string]any{"LSUIElement": "yes"},
+			wantErr: `LSUIElement: expected <true/false>, got <string> "yes"`,
+		},
+		{
+			name: "bundle ID component starting with a digit",
+			info: map[string]any{"CFBundleIdentifier": "com.github.tmc.2fa.2fa"},
+		},
+		{
+			name:    "bundle ID without dots",
+			info:    map[string]any{"CFBundleIdentifier": "myapp"},
+			wantErr: "CFBundleIdentifier: \"myapp\" is not a reverse-DNS identifier",
+		},
+		{
+			name:    "bundle ID with an empty component",
+			info:    map[string]any{"CFBundleIdentifier": "com..app"},
+			wantErr: "not a reverse-DNS identifier",
+		},
+		{
+			name:    "bundle ID with invalid characters",
+			info:    map[string]any{"CFBundleIdentifier": "com.example.my_app"},
+			wantErr: "not a reverse-DNS identifier",
+		},
+		{
+			name:    "unknown package type",
+			info:    map[string]any{"CFBundlePackageType": "EXE"},
+			wantErr: `CFBundlePackageType: "EXE" is not one of`,
+		},
+		{
+			name:    "array element type",
+			info:    map[string]any{"LSArchitecturePriority": []any{"arm64", 64}},
+			wantErr: "LSArchitecturePriority: element 1: expected <string>, got <integer>",
+		},
+		{
+			name:    "array element value",
+			info:    map[string]any{"LSArchitecturePriority": []string{"ppc"}},
+			wantErr: `"ppc" is not one of`,
+		},
+		{
+			name:    "empty usage description",
+			info:    map[string]any{"NSMicrophoneUsageDescription": " "},
+			wantErr: "NSMicrophoneUsageDescription: must not be empty",
+		},
+		{
+			name:    "usage description not a string",
+			info:    map[string]any{"NSFooUsageDescription": true},
+			wantErr: "NSFooUsageDescription: expected <string>",
+		},
+		{
+			name:    "minimum system version",
+			info:    map[string]any{"LSMinimumSystemVersion": "Sonoma"},
+			wantErr: "LSMinimumSystemVersion: \"Sonoma\" is not a version",
+		},
+		{
+			name:    "bonjour service type",
+			info:    map[string]any{"NSBonjourServices": []string{"http"}},
+			wantErr: "not a Bonjour service type",
+		},
+		{
+			name:    "presentation mode range",
+			info:    map[string]any{"LSUIPresentationMode": 7},
+			wantErr: "LSUIPresentationMode: 7 is not between 0 and 4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInfoPlist(tt.info)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateInfoPlist() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateInfoPlist() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateInfoPlistReportsAllKeys(t *testing.T) {
+	err := ValidateInfoPlist(map[string]any{
+		"LSUIElement":        "yes",
+		"LSBackgroundOnly":   1,
+		"CFBundleIdentifier": "bad",
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 problems, got %d:\n%v", len(lines), err)
+	}
+	for i, prefix := range []string{"CFBundleIdentifier:", "LSBackgroundOnly:", "LSUIElement:"} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], prefix)
+		}
+	}
+}
+
+func TestLookupInfoKey(t *testing.T) {
+	if k, ok := LookupInfoKey("LSUIElement"); !ok || k.Kind != Bool {
+		t.Errorf("LookupInfoKey(LSUIElement) = %+v, %v", k, ok)
+	}
+	if k, ok := LookupInfoKey("NSScreenCaptureUsageDescription"); !ok || k.Kind != String {
+		t.Errorf("LookupInfoKey(NSScreenCaptureUsageDescription) = %+v, %v", k, ok)
+	}
+	if _, ok := LookupInfoKey("MyCustomKey"); ok {
+		t.Error("LookupInfoKey(MyCustomKey) should not be known")
+	}
+}
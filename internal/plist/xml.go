@@ -1,4 +1,4 @@
-// Package plist provides utilities for generating macOS property list files.
+// Package plist provides utilities for reading and writing macOS property list files.
 package plist
 
 import (
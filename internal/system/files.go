@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/tmc/macgo/internal/plist"
 )
 
 // CopyFile copies a file from src to dst.
@@ -182,31 +184,19 @@ func GetBundleID(bundlePath string) string {
 	}
 
 	plistPath := filepath.Join(bundlePath, "Contents", "Info.plist")
-	data, err := os.ReadFile(plistPath)
+	f, err := os.Open(plistPath)
 	if err != nil {
 		return ""
 	}
+	defer func() { _ = f.Close() }()
 
-	// Simple extraction of CFBundleIdentifier
-	// Look for the key and then the next string value
-	lines := strings.Split(string(data), "\n")
-	foundKey := false
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if foundKey && strings.HasPrefix(line, "<string>") && strings.HasSuffix(line, "</string>") {
-			bundleID := strings.TrimPrefix(line, "<string>")
-			bundleID = strings.TrimSuffix(bundleID, "</string>")
-			return bundleID
-		}
-		if strings.Contains(line, "CFBundleIdentifier") {
-			foundKey = true
-		} else if foundKey && !strings.HasPrefix(line, "<string>") {
-			// Key was found but next line isn't a string value
-			foundKey = false
-		}
+	var info struct {
+		CFBundleIdentifier string
 	}
-
-	return ""
+	if err := plist.NewDecoder(f).Decode(&info); err != nil {
+		return ""
+	}
+	return info.CFBundleIdentifier
 }
 
 // CalculateFileSHA256 calculates the SHA256 hash of a file.
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/tmc/macgo/internal/plist"
 )
 
 func TestCopyFile(t *testing.T) {
@@ -466,3 +468,79 @@ func containsString(slice []string, item string) bool {
 	}
 	return false
 }
+
+func TestGetBundleID(t *testing.T) {
+	tests := []struct {
+		name  string
+		plist string
+		want  string
+	}{
+		{
+			name: "multi-line",
+			plist: `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.multi</string>
+</dict>
+</plist>`,
+			want: "com.example.multi",
+		},
+		{
+			name:  "single-line",
+			plist: `<?xml version="1.0" encoding="UTF-8"?><plist version="1.0"><dict><key>CFBundleName</key><string>X</string><key>CFBundleIdentifier</key><string>com.example.single</string></dict></plist>`,
+			want:  "com.example.single",
+		},
+		{
+			name: "nested dict with same key",
+			plist: `<plist version="1.0">
+<dict>
+	<key>Nested</key>
+	<dict><key>CFBundleIdentifier</key><string>wrong</string></dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.right</string>
+</dict>
+</plist>`,
+			want: "com.example.right",
+		},
+		{
+			name:  "malformed",
+			plist: `<plist><dict><key>CFBundleIdentifier</key>`,
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundlePath := filepath.Join(t.TempDir(), "Test.app")
+			contents := filepath.Join(bundlePath, "Contents")
+			if err := os.MkdirAll(contents, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(contents, "Info.plist"), []byte(tt.plist), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := GetBundleID(bundlePath); got != tt.want {
+				t.Errorf("GetBundleID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBundleIDBinaryPlist(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "Binary.app")
+	contents := filepath.Join(bundlePath, "Contents")
+	if err := os.MkdirAll(contents, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := plist.MarshalFormat(map[string]any{"CFBundleIdentifier": "com.example.binary"}, plist.BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(contents, "Info.plist"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetBundleID(bundlePath); got != "com.example.binary" {
+		t.Errorf("GetBundleID() = %q, want %q", got, "com.example.binary")
+	}
+}
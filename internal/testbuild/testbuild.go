@@ -0,0 +1,80 @@
+// Package testbuild cross-compiles small programs for tests.
+package testbuild
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// CommitTime is the time of the commit DarwinTagged builds from.
+const CommitTime = "2024-05-01T12:34:56Z"
+
+// Darwin cross-compiles an empty program for darwin/goarch to the path
+// exe and returns exe. The Go linker ad-hoc signs darwin/arm64
+// executables but not amd64 ones. It skips the test in short mode or when
+// the program cannot be built.
+func Darwin(t testing.TB, goarch, exe string) string {
+	t.Helper()
+	build(t, goarch, exe, "")
+	return exe
+}
+
+// DarwinTagged is like Darwin, but builds from a git repository whose
+// only commit, made at CommitTime, is tagged tag, so that the executable
+// records version control information. It returns the commit hash.
+func DarwinTagged(t testing.TB, goarch, exe, tag string) (revision string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	return build(t, goarch, exe, tag)
+}
+
+func build(t testing.TB, goarch, exe, tag string) (revision string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("cross-compiles a darwin binary")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not available")
+	}
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "go.mod"), []byte("module example.com/hello\n\ngo 1.24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(exe), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(name string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(name, args...)
+		cmd.Dir = src
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_AUTHOR_DATE="+CommitTime, "GIT_COMMITTER_DATE="+CommitTime,
+			"GOOS=darwin", "GOARCH="+goarch, "CGO_ENABLED=0", "GOFLAGS=")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Skipf("%s %s: %v\n%s", name, strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if tag != "" {
+		run("git", "init", "-q")
+		run("git", "add", ".")
+		run("git", "commit", "-q", "-m", "initial")
+		run("git", "tag", tag)
+		revision = run("git", "rev-parse", "HEAD")
+	}
+	run(goTool, "build", "-o", exe, ".")
+	return revision
+}
@@ -0,0 +1,63 @@
+// Package testcert creates certificates and keys for tests.
+package testcert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// New returns a certificate made from tmpl, signed by parent with
+// parentKey or self-signed if parent is nil, and its new ECDSA P-256 key.
+// A missing serial number or validity period is filled in with a unique
+// serial number and a period from an hour ago to an hour from now.
+func New(t testing.TB, tmpl *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.SerialNumber == nil {
+		tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// CodeSigning returns a self-signed code signing certificate for the
+// common name cn and its key. A non-empty ou becomes the certificate's
+// organizational unit, where Apple certificates carry the team ID.
+func CodeSigning(t testing.TB, cn, ou string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	if ou != "" {
+		tmpl.Subject.OrganizationalUnit = []string{ou}
+	}
+	return New(t, tmpl, nil, nil)
+}
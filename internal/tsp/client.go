@@ -0,0 +1,166 @@
+package tsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultURL is Apple's time-stamping authority, which codesign uses.
+const DefaultURL = "http://timestamp.apple.com/ts01"
+
+const (
+	// DefaultRetries is the number of times a failed request is retried.
+	DefaultRetries = 2
+
+	// DefaultRetryDelay is the delay before the first retry. It doubles
+	// with each further attempt.
+	DefaultRetryDelay = time.Second
+
+	// maxResponseSize bounds the size of a time-stamp response.
+	maxResponseSize = 1 << 20
+)
+
+// Client requests time-stamp tokens from a time-stamping authority.
+// The zero value uses DefaultURL.
+type Client struct {
+	// URL is the authority's endpoint. Defaults to DefaultURL.
+	URL string
+
+	// HTTPClient makes the requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	// Retries is how often a request that fails because of the network,
+	// a server error or a "waiting" status is retried. Zero means
+	// DefaultRetries; negative means none.
+	Retries int
+
+	// RetryDelay is the delay before the first retry. Zero means
+	// DefaultRetryDelay.
+	RetryDelay time.Duration
+}
+
+// Timestamp returns a validated time-stamp token over data, such as the
+// value of a CMS signature.
+func (c *Client) Timestamp(ctx context.Context, data []byte) (*Token, error) {
+	sum := sha256.Sum256(data)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(request{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: sum[:],
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tsp: %w", err)
+	}
+
+	retries, delay := c.Retries, c.RetryDelay
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	if delay == 0 {
+		delay = DefaultRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		der, err := c.post(ctx, req)
+		if err == nil {
+			tok, err := Parse(der)
+			if err != nil {
+				return nil, err
+			}
+			if err := tok.check(data, nonce); err != nil {
+				return nil, err
+			}
+			return tok, nil
+		}
+		var te *temporaryError
+		if !errors.As(err, &te) || attempt >= retries {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay << attempt):
+		}
+	}
+}
+
+// temporaryError is a failure worth retrying.
+type temporaryError struct{ err error }
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+func (e *temporaryError) Unwrap() error { return e.err }
+
+// post sends a DER-encoded request and returns the token from a granted
+// response.
+func (c *Client) post(ctx context.Context, req []byte) ([]byte, error) {
+	u := c.URL
+	if u == "" {
+		u = DefaultURL
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("tsp: %w", err)
+	}
+	hreq.Header.Set("Content-Type", "application/timestamp-query")
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(hreq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("tsp: %w", err)
+		}
+		return nil, &temporaryError{fmt.Errorf("tsp: %w", err)}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, &temporaryError{fmt.Errorf("tsp: %w", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("tsp: %s: %s", u, resp.Status)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, &temporaryError{err}
+		}
+		return nil, err
+	}
+
+	var r response
+	if _, err := asn1.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("tsp: response: %w", err)
+	}
+	switch r.Status.Status {
+	case statusGranted, statusGrantedWithMods:
+	case statusWaiting:
+		return nil, &temporaryError{fmt.Errorf("tsp: %s: authority asked to wait", u)}
+	default:
+		msg := strings.Join(r.Status.StatusString, "; ")
+		if msg == "" {
+			msg = "request rejected"
+		}
+		return nil, fmt.Errorf("tsp: %s: %s (status %d)", u, msg, r.Status.Status)
+	}
+	if len(r.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("tsp: %s: granted response has no token", u)
+	}
+	return r.TimeStampToken.FullBytes, nil
+}
@@ -0,0 +1,154 @@
+package tsp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tmc/macgo/internal/cms"
+)
+
+var (
+	// oidSigningCertificateV2 identifies the authority's certificate in
+	// the signed attributes, as RFC 3161 requires (RFC 5816).
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	// oidTestPolicy is the policy of tokens from NewResponder.
+	oidTestPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 99, 1}
+)
+
+// Responder is a minimal time-stamping authority serving RFC 3161
+// requests over HTTP. It is meant for tests and private deployments.
+type Responder struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+
+	// Chain holds intermediate certificates included in tokens.
+	Chain []*x509.Certificate
+
+	// Policy is the policy recorded in tokens.
+	Policy asn1.ObjectIdentifier
+
+	// Now returns the time to stamp. Defaults to time.Now.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	serial int64
+}
+
+// NewResponder returns a Responder with a freshly generated, self-signed
+// time-stamping certificate.
+func NewResponder() (*Responder, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "macgo Test Timestamp Authority"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Responder{Certificate: cert, Key: key, Policy: oidTestPolicy}, nil
+}
+
+// ServeHTTP answers a DER-encoded time-stamp request.
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxResponseSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := r.Respond(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
+
+// Respond returns the DER-encoded response to a DER-encoded request.
+// Malformed or unsupported requests get a rejection.
+func (r *Responder) Respond(der []byte) ([]byte, error) {
+	var q request
+	if rest, err := asn1.Unmarshal(der, &q); err != nil || len(rest) > 0 || q.Version != 1 {
+		return reject("malformed request")
+	}
+	if !q.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || len(q.MessageImprint.HashedMessage) != sha256.Size {
+		return reject("unsupported hash algorithm")
+	}
+
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+	r.mu.Lock()
+	r.serial++
+	serial := big.NewInt(r.serial)
+	r.mu.Unlock()
+
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         r.Policy,
+		MessageImprint: q.MessageImprint,
+		SerialNumber:   serial,
+		GenTime:        now().UTC().Truncate(time.Second),
+		Nonce:          q.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	certHash := sha256.Sum256(r.Certificate.Raw)
+	signingCert, err := cms.NewAttribute(oidSigningCertificateV2, struct {
+		Certs []struct{ CertHash []byte }
+	}{Certs: []struct{ CertHash []byte }{{certHash[:]}}})
+	if err != nil {
+		return nil, err
+	}
+	opts := cms.SignOptions{
+		Time:        now(),
+		ContentType: oidTSTInfo,
+		SignedAttrs: []cms.Attribute{signingCert},
+	}
+	if q.CertReq {
+		opts.Chain = r.Chain
+	}
+	token, err := cms.Sign(info, r.Certificate, r.Key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(response{
+		Status:         statusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+func reject(msg string) ([]byte, error) {
+	return asn1.Marshal(response{Status: statusInfo{Status: statusRejection, StatusString: []string{msg}}})
+}
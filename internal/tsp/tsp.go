@@ -0,0 +1,171 @@
+// Package tsp implements the RFC 3161 Time-Stamp Protocol: requesting
+// time-stamp tokens over code signatures, validating them, and a minimal
+// time-stamping authority for tests.
+package tsp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/tmc/macgo/internal/cms"
+)
+
+var (
+	// oidTSTInfo is the content type of a time-stamp token.
+	oidTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSHA256  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type request struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type statusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type response struct {
+	Status         statusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// PKI status values of a time-stamp response.
+const (
+	statusGranted         = 0
+	statusGrantedWithMods = 1
+	statusRejection       = 2
+	statusWaiting         = 3
+)
+
+// Token is a parsed time-stamp token.
+type Token struct {
+	// Time is when the authority stamped the data.
+	Time time.Time
+
+	// SerialNumber is the token's serial number, unique per authority.
+	SerialNumber *big.Int
+
+	// Policy is the authority's time-stamping policy.
+	Policy asn1.ObjectIdentifier
+
+	// Certificate is the authority's signing certificate.
+	Certificate *x509.Certificate
+
+	// Raw is the DER-encoded token, a CMS ContentInfo.
+	Raw []byte
+
+	digest []byte
+	nonce  *big.Int
+}
+
+// Parse parses a DER-encoded time-stamp token and checks that it is
+// signed by a certificate valid for time-stamping at the time it states.
+// It does not check that the certificate chains to a trusted root.
+func Parse(der []byte) (*Token, error) {
+	sd, err := cms.Parse(der)
+	if err != nil {
+		return nil, fmt.Errorf("tsp: %w", err)
+	}
+	if !sd.ContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("tsp: content type %v is not TSTInfo", sd.ContentType)
+	}
+	if len(sd.Signers) != 1 {
+		return nil, fmt.Errorf("tsp: token has %d signers, want 1", len(sd.Signers))
+	}
+	var info tstInfo
+	if rest, err := asn1.Unmarshal(sd.Content, &info); err != nil {
+		return nil, fmt.Errorf("tsp: TSTInfo: %w", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("tsp: trailing data after TSTInfo")
+	}
+	if info.Version != 1 {
+		return nil, fmt.Errorf("tsp: unsupported TSTInfo version %d", info.Version)
+	}
+
+	s := sd.Signers[0]
+	if err := s.Verify(sd.Content); err != nil {
+		return nil, fmt.Errorf("tsp: %w", err)
+	}
+	cert := s.Certificate
+	if !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return nil, fmt.Errorf("tsp: certificate %q is not valid for time-stamping", cert.Subject.CommonName)
+	}
+	if info.GenTime.Before(cert.NotBefore) || info.GenTime.After(cert.NotAfter) {
+		return nil, fmt.Errorf("tsp: certificate %q is not valid at %v", cert.Subject.CommonName, info.GenTime)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return nil, fmt.Errorf("tsp: unsupported message imprint algorithm %v", info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	return &Token{
+		Time:         info.GenTime,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Certificate:  cert,
+		Raw:          der,
+		digest:       info.MessageImprint.HashedMessage,
+		nonce:        info.Nonce,
+	}, nil
+}
+
+// Verify parses the token in der and checks that it stamps data.
+func Verify(der, data []byte) (*Token, error) {
+	tok, err := Parse(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := tok.check(data, nil); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// check reports whether the token covers data and, when nonce is set,
+// answers the request that carried it.
+func (t *Token) check(data []byte, nonce *big.Int) error {
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(t.digest, sum[:]) {
+		return errors.New("tsp: token does not match the time-stamped data")
+	}
+	if nonce != nil && (t.nonce == nil || t.nonce.Cmp(nonce) != 0) {
+		return errors.New("tsp: token nonce does not match the request")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package tsp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testResponder(t *testing.T) *Responder {
+	t.Helper()
+	r, err := NewResponder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestTimestamp(t *testing.T) {
+	r := testResponder(t)
+	stamp := time.Now().UTC().Truncate(time.Second)
+	r.Now = func() time.Time { return stamp }
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL}
+	data := []byte("signature value")
+	tok, err := c.Timestamp(context.Background(), data)
+	if err != nil {
+		t.Fatalf("Timestamp: %v", err)
+	}
+	if !tok.Time.Equal(stamp) || tok.SerialNumber.Int64() != 1 || !tok.Certificate.Equal(r.Certificate) || !tok.Policy.Equal(oidTestPolicy) {
+		t.Errorf("token = %+v", tok)
+	}
+
+	// The raw token validates on its own, but only for the stamped data.
+	if _, err := Verify(tok.Raw, data); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if _, err := Verify(tok.Raw, []byte("other data")); err == nil {
+		t.Error("Verify of other data succeeded")
+	}
+	tampered := append([]byte(nil), tok.Raw...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Verify(tampered, data); err == nil {
+		t.Error("Verify of a tampered token succeeded")
+	}
+}
+
+func TestTimestampCertificate(t *testing.T) {
+	r := testResponder(t)
+	// A time outside the certificate's validity.
+	r.Now = func() time.Time { return r.Certificate.NotAfter.Add(time.Hour) }
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	_, err := (&Client{URL: srv.URL}).Timestamp(context.Background(), []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "not valid at") {
+		t.Errorf("Timestamp with an expired authority = %v", err)
+	}
+}
+
+func TestTimestampRetry(t *testing.T) {
+	r := testResponder(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		r.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL, RetryDelay: time.Millisecond}
+	if _, err := c.Timestamp(context.Background(), []byte("x")); err != nil {
+		t.Fatalf("Timestamp after transient failures: %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("made %d requests, want 3", n)
+	}
+
+	calls.Store(0)
+	c.Retries = -1
+	if _, err := c.Timestamp(context.Background(), []byte("x")); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Timestamp without retries = %v, want 503 error", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("made %d requests without retries, want 1", n)
+	}
+}
+
+func TestTimestampRejected(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		resp, _ := reject("policy not accepted")
+		w.Write(resp)
+	}))
+	defer srv.Close()
+
+	_, err := (&Client{URL: srv.URL, RetryDelay: time.Millisecond}).Timestamp(context.Background(), []byte("x"))
+	if err == nil || !strings.Contains(err.Error(), "policy not accepted") {
+		t.Errorf("Timestamp = %v, want rejection", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("rejection was retried: %d requests", n)
+	}
+}
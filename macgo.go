@@ -61,12 +61,17 @@ package macgo
 import (
 	"context"
 	"fmt"
+	"image"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 
+	"github.com/tmc/macgo/codesign"
 	"github.com/tmc/macgo/internal/bundle"
+	"github.com/tmc/macgo/internal/plist"
 	"github.com/tmc/macgo/internal/system"
 	"github.com/tmc/macgo/internal/tcc"
 	"github.com/tmc/macgo/permissions"
@@ -108,6 +113,57 @@ const (
 	UIModeRegular = bundle.UIModeRegular
 )
 
+// Signer selects the implementation used to code sign bundles and binaries.
+type Signer = bundle.Signer
+
+const (
+	// SignerAuto uses Apple's codesign tool when it is installed and the
+	// built-in signer otherwise. This is the default.
+	SignerAuto = bundle.SignerAuto
+
+	// SignerCodesign always uses Apple's codesign tool.
+	SignerCodesign = bundle.SignerCodesign
+
+	// SignerBuiltin uses macgo's pure-Go signer, which needs neither Xcode
+	// nor the command line tools. It supports ad-hoc signing only.
+	SignerBuiltin = bundle.SignerBuiltin
+)
+
+// TimestampPolicy controls whether certificate signatures carry a secure
+// timestamp, which notarization requires.
+type TimestampPolicy = bundle.TimestampPolicy
+
+const (
+	// TimestampRequired fails signing when the time-stamping authority
+	// cannot be reached. This is the default.
+	TimestampRequired = bundle.TimestampRequired
+
+	// TimestampOptional signs without a timestamp, with a warning, when
+	// the authority cannot be reached.
+	TimestampOptional = bundle.TimestampOptional
+
+	// TimestampNone never requests a timestamp.
+	TimestampNone = bundle.TimestampNone
+)
+
+// Helper is an executable shipped and signed inside the app bundle.
+type Helper = bundle.Helper
+
+// XPCService is an XPC service bundle in Contents/XPCServices.
+type XPCService = bundle.XPCService
+
+// LaunchAgent is a launchd job in Contents/Library/LaunchAgents.
+type LaunchAgent = bundle.LaunchAgent
+
+// URLType is a set of URL schemes the app is launched for.
+type URLType = bundle.URLType
+
+// DocumentType is a kind of file the app is launched for.
+type DocumentType = bundle.DocumentType
+
+// TypeDeclaration declares a uniform type identifier owned by the app.
+type TypeDeclaration = bundle.TypeDeclaration
+
 // NewConfig creates a new Config with sensible defaults.
 // The zero value is valid, so this is equivalent to &Config{}.
 func NewConfig() *Config {
@@ -124,7 +180,12 @@ type Config struct {
 	// BundleID is the bundle identifier. Defaults to module-based ID (e.g., com.github.user.repo.appname).
 	BundleID string
 
-	// Version is the application version. Defaults to "1.0.0".
+	// Version is the application version. Defaults to the main module
+	// version in the executable's build information (debug.ReadBuildInfo),
+	// or "1.0.0". The VCS commit time becomes CFBundleVersion and, with
+	// the revision, is recorded in the Info.plist; LSMinimumSystemVersion
+	// is taken from the executable. Explicit values, in Version, Info or
+	// the Info.plist template, take precedence.
 	Version string
 
 	// Permissions are the requested macOS permissions.
@@ -152,6 +213,11 @@ type Config struct {
 	// Defaults to false (bundle is kept for reuse).
 	CleanupBundle bool
 
+	// BundleDir is the directory app bundles are created in.
+	// Default: $GOPATH/bin, then ~/go/bin if it exists, then the temp dir.
+	// Bundles are recorded in an index that "macgo bundles" lists and prunes.
+	BundleDir string
+
 	// CodeSignIdentity is the signing identity to use for code signing.
 	// If empty and AutoSign is false, the app bundle will not be signed.
 	// Use "Developer ID Application" for automatic identity selection.
@@ -171,6 +237,24 @@ type Config struct {
 	// If empty, defaults to the bundle identifier.
 	CodeSigningIdentifier string
 
+	// Signer selects the code signing implementation.
+	// Default (SignerAuto): codesign if installed, otherwise the built-in signer.
+	Signer Signer
+
+	// IdentityProvider supplies the signing identity instead of the login
+	// keychain, for example a codesign.FileProvider reading a .p12 file on
+	// a CI runner. CodeSignIdentity, if set, selects among its identities.
+	// Identities with a private key are signed by the built-in signer.
+	IdentityProvider codesign.IdentityProvider
+
+	// TimestampPolicy controls secure timestamps on certificate signatures.
+	// Default (TimestampRequired): signing fails without one.
+	TimestampPolicy TimestampPolicy
+
+	// TimestampURL is the RFC 3161 time-stamping authority.
+	// Default: Apple's, as used by codesign.
+	TimestampURL string
+
 	// ForceDirectExecution forces direct execution instead of LaunchServices.
 	// This preserves terminal I/O (stdin/stdout/stderr) but may not trigger
 	// proper TCC dialogs. Use this for CLI commands that need terminal output.
@@ -179,8 +263,21 @@ type Config struct {
 
 	// Info allows specifying custom Info.plist keys.
 	// This is useful for UsageDescriptions (e.g. NSAccessibilityUsageDescription).
+	// Values may be strings, bools, integers, floats, time.Time, []byte,
+	// slices, structs or nested map[string]any dictionaries.
 	Info map[string]interface{}
 
+	// InfoPlistTemplate is the path to an XML or binary Info.plist used as
+	// the base for the generated one. Keys are deep-merged with precedence
+	// template < Info < keys macgo requires (CFBundleExecutable,
+	// CFBundleIdentifier, CFBundlePackageType); overridden required keys
+	// are reported as warnings.
+	InfoPlistTemplate string
+
+	// InfoPlistTemplateData is an in-memory Info.plist template, for example
+	// one embedded with go:embed. It takes precedence over InfoPlistTemplate.
+	InfoPlistTemplateData []byte
+
 	// CameraUsageDescription sets NSCameraUsageDescription in Info.plist.
 	// When set, macgo also enables Camera permission automatically.
 	CameraUsageDescription string
@@ -211,11 +308,74 @@ type Config struct {
 	// Required for entitlements like keychain-access-groups.
 	ProvisioningProfile string
 
+	// AutoProvisioningProfile, when ProvisioningProfile is empty, embeds the
+	// best non-expired installed profile whose app ID matches BundleID and
+	// the signing team. Profiles are searched in ~/Library/MobileDevice and
+	// Xcode's profile directory, then in ProfileDirs.
+	// Enable via MACGO_AUTO_PROVISIONING_PROFILE=1 or WithAutoProvisioningProfile().
+	AutoProvisioningProfile bool
+
+	// ProfileDirs are extra directories searched by AutoProvisioningProfile.
+	ProfileDirs []string
+
 	// IconPath is the path to an .icns file to use as the app icon.
 	// When specified, the icon is copied to Contents/Resources/ and
 	// CFBundleIconFile is set in the Info.plist.
 	IconPath string
 
+	// IconPNG is the path to a PNG image from which macgo renders the app
+	// icon at every size from 16x16 to 512x512@2x, without iconutil. It
+	// should be at least 1024x1024 pixels. Takes precedence over IconPath.
+	// MACGO_ICON sets IconPNG when the path ends in ".png".
+	IconPNG string
+
+	// IconImage is an image from which the app icon is rendered, like
+	// IconPNG. Takes precedence over IconPNG and IconPath.
+	IconImage image.Image
+
+	// ExtraExecutables are builds of the program for other architectures,
+	// e.g. the amd64 binary when running the arm64 one. When set, the bundle
+	// executable is a universal binary of the running executable and these.
+	ExtraExecutables []string
+
+	// Architectures optionally restricts and orders the slices of the
+	// universal bundle executable, e.g. []string{"arm64", "amd64"}.
+	Architectures []string
+
+	// Helpers are executables copied into Contents/MacOS or
+	// Contents/Helpers and signed, before the app, with the app's
+	// identity.
+	Helpers []Helper
+
+	// XPCServices are XPC service bundles macgo builds, with their own
+	// Info.plist, in Contents/XPCServices and signs with the app's identity.
+	XPCServices []XPCService
+
+	// LaunchAgents are launchd jobs written to Contents/Library/LaunchAgents
+	// for registration with SMAppService.
+	LaunchAgents []LaunchAgent
+
+	// Resources holds files, typically an embed.FS, to copy into
+	// Contents/Resources. Find them at run time with ResourcePath.
+	Resources fs.FS
+
+	// ResourceMap maps files or directories in Resources to paths under
+	// Contents/Resources, e.g. {"applescripts": "Scripts"}. Without it,
+	// all of Resources is copied.
+	ResourceMap map[string]string
+
+	// URLTypes are the URL schemes the app opens (CFBundleURLTypes).
+	// Events delivers the URLs.
+	URLTypes []URLType
+
+	// DocumentTypes are the kinds of files the app opens
+	// (CFBundleDocumentTypes). Events delivers the file paths.
+	DocumentTypes []DocumentType
+
+	// ExportedTypes declares the uniform type identifiers the app owns
+	// (UTExportedTypeDeclarations), typically those of its DocumentTypes.
+	ExportedTypes []TypeDeclaration
+
 	// SingleProcess enables single-process mode: codesign in-place, re-exec,
 	// and call setActivationPolicy instead of creating an app bundle.
 	// This eliminates the two-process architecture entirely.
@@ -223,9 +383,12 @@ type Config struct {
 	SingleProcess bool
 
 	// PostCreateHook is called after the bundle structure is created but
-	// before code signing. Use this to inject additional files (helper
-	// binaries, LaunchDaemon plists) into Contents/. The bundlePath
-	// argument is the .app directory path.
+	// before code signing. Use this to inject additional files into
+	// Contents/; for helper executables, XPC services and LaunchAgents,
+	// prefer Helpers, XPCServices and LaunchAgents. The bundlePath
+	// argument is the .app directory path in a staging directory, which
+	// is renamed into place after signing. A bundle with a hook is
+	// rebuilt on every launch rather than reused.
 	PostCreateHook func(bundlePath string, cfg *Config) error
 }
 
@@ -240,9 +403,16 @@ type Config struct {
 //	MACGO_BUNDLE_ID_PREFIX  - Prefix to add to all bundle IDs
 //	MACGO_DEBUG=1           - Enable debug logging
 //	MACGO_KEEP_BUNDLE=1     - Preserve bundle after execution
+//	MACGO_BUNDLE_DIR        - Directory to create app bundles in
 //	MACGO_CODE_SIGN_IDENTITY - Code signing identity
 //	MACGO_AUTO_SIGN=1       - Enable automatic code signing
 //	MACGO_AD_HOC_SIGN=1     - Enable ad-hoc code signing
+//	MACGO_SIGNER            - Code signer: "codesign" or "builtin" (default: auto)
+//	MACGO_IDENTITY_FILE     - PKCS#12 or PEM file holding the signing identity
+//	MACGO_IDENTITY_KEY_FILE - PEM private key for MACGO_IDENTITY_FILE, if separate
+//	MACGO_IDENTITY_PASSWORD - Password for a PKCS#12 MACGO_IDENTITY_FILE
+//	MACGO_TIMESTAMP_POLICY  - Secure timestamp: "required", "optional" or "none"
+//	MACGO_TIMESTAMP_URL     - RFC 3161 time-stamping authority URL
 //	MACGO_LOCAL_NETWORK_USAGE_DESCRIPTION - Set NSLocalNetworkUsageDescription
 //	MACGO_BONJOUR_SERVICES  - Comma-separated NSBonjourServices entries
 //	MACGO_CAMERA=1          - Request camera permission
@@ -258,7 +428,12 @@ type Config struct {
 //	MACGO_OPEN_NEW_INSTANCE=0 - Disable -n flag (new instance) for open command (enabled by default)
 //	MACGO_DEV_MODE=1        - Dev mode: wrapper exec's original binary, preserves TCC across rebuilds
 //	MACGO_PROVISIONING_PROFILE - Path to provisioning profile to embed in bundle
-//	MACGO_ICON              - Path to app icon (.icns) to embed in bundle
+//	MACGO_AUTO_PROVISIONING_PROFILE=1 - Find an installed provisioning profile for the bundle ID
+//	MACGO_PROFILE_DIRS      - Comma-separated extra directories to search for profiles
+//	MACGO_ICON              - Path to app icon (.icns, or .png to render) to embed in bundle
+//	MACGO_INFO_PLIST_TEMPLATE - Path to an Info.plist template merged into the generated one
+//	MACGO_EXTRA_EXECUTABLES - Comma-separated per-architecture builds for a universal executable
+//	MACGO_ARCHITECTURES     - Comma-separated architectures of the universal executable
 //	MACGO_SINGLE_PROCESS=1  - Single-process mode: codesign + re-exec, no app bundle
 func (c *Config) FromEnv() *Config {
 	if name := os.Getenv("MACGO_APP_NAME"); name != "" {
@@ -277,6 +452,10 @@ func (c *Config) FromEnv() *Config {
 		c.CleanupBundle = true
 	}
 
+	if dir := os.Getenv("MACGO_BUNDLE_DIR"); dir != "" {
+		c.BundleDir = dir
+	}
+
 	if identity := os.Getenv("MACGO_CODE_SIGN_IDENTITY"); identity != "" {
 		c.CodeSignIdentity = identity
 	}
@@ -289,6 +468,26 @@ func (c *Config) FromEnv() *Config {
 		c.AdHocSign = true
 	}
 
+	if signer := os.Getenv("MACGO_SIGNER"); signer != "" {
+		c.Signer = Signer(signer)
+	}
+
+	if path := os.Getenv("MACGO_IDENTITY_FILE"); path != "" {
+		c.IdentityProvider = codesign.FileProvider{
+			Path:     path,
+			KeyPath:  os.Getenv("MACGO_IDENTITY_KEY_FILE"),
+			Password: os.Getenv("MACGO_IDENTITY_PASSWORD"),
+		}
+	}
+
+	if policy := os.Getenv("MACGO_TIMESTAMP_POLICY"); policy != "" {
+		c.TimestampPolicy = TimestampPolicy(policy)
+	}
+
+	if url := os.Getenv("MACGO_TIMESTAMP_URL"); url != "" {
+		c.TimestampURL = url
+	}
+
 	if description := os.Getenv("MACGO_LOCAL_NETWORK_USAGE_DESCRIPTION"); description != "" {
 		c.LocalNetworkUsageDescription = description
 	}
@@ -334,10 +533,31 @@ func (c *Config) FromEnv() *Config {
 		c.ProvisioningProfile = profile
 	}
 
-	if icon := os.Getenv("MACGO_ICON"); icon != "" {
+	if os.Getenv("MACGO_AUTO_PROVISIONING_PROFILE") == "1" {
+		c.AutoProvisioningProfile = true
+	}
+
+	if dirs := system.GetStringSlice("MACGO_PROFILE_DIRS"); len(dirs) > 0 {
+		c.ProfileDirs = dirs
+	}
+
+	if icon := os.Getenv("MACGO_ICON"); strings.EqualFold(filepath.Ext(icon), ".png") {
+		c.IconPNG = icon
+	} else if icon != "" {
 		c.IconPath = icon
 	}
 
+	if template := os.Getenv("MACGO_INFO_PLIST_TEMPLATE"); template != "" {
+		c.InfoPlistTemplate = template
+	}
+
+	if exes := system.GetStringSlice("MACGO_EXTRA_EXECUTABLES"); len(exes) > 0 {
+		c.ExtraExecutables = append(c.ExtraExecutables, exes...)
+	}
+	if archs := system.GetStringSlice("MACGO_ARCHITECTURES"); len(archs) > 0 {
+		c.Architectures = archs
+	}
+
 	// Single-process mode: codesign + re-exec + setActivationPolicy
 	if os.Getenv("MACGO_SINGLE_PROCESS") == "1" {
 		c.SingleProcess = true
@@ -408,6 +628,12 @@ func (c *Config) WithDebug() *Config {
 	return c
 }
 
+// WithBundleDir sets the directory app bundles are created in.
+func (c *Config) WithBundleDir(dir string) *Config {
+	c.BundleDir = dir
+	return c
+}
+
 // WithCodeSigning enables code signing with the specified identity.
 // Use "Developer ID Application" for automatic identity selection.
 func (c *Config) WithCodeSigning(identity string) *Config {
@@ -430,6 +656,41 @@ func (c *Config) WithAdHocSign() *Config {
 	return c
 }
 
+// WithSigner selects the code signing implementation.
+// Use SignerBuiltin to ad-hoc sign without Apple's codesign tool.
+func (c *Config) WithSigner(s Signer) *Config {
+	c.Signer = s
+	return c
+}
+
+// WithIdentityProvider signs with an identity from p instead of the
+// login keychain.
+func (c *Config) WithIdentityProvider(p codesign.IdentityProvider) *Config {
+	c.IdentityProvider = p
+	return c
+}
+
+// WithIdentityFile signs with the identity in a PKCS#12 file, or in a PEM
+// file holding the certificate and private key. The password is only
+// used for PKCS#12 files.
+func (c *Config) WithIdentityFile(path, password string) *Config {
+	c.IdentityProvider = codesign.FileProvider{Path: path, Password: password}
+	return c
+}
+
+// WithTimestampPolicy sets whether certificate signatures must carry a
+// secure timestamp.
+func (c *Config) WithTimestampPolicy(p TimestampPolicy) *Config {
+	c.TimestampPolicy = p
+	return c
+}
+
+// WithTimestampURL sets the RFC 3161 time-stamping authority.
+func (c *Config) WithTimestampURL(url string) *Config {
+	c.TimestampURL = url
+	return c
+}
+
 // WithInfo adds a custom key/value pair to the Info.plist.
 func (c *Config) WithInfo(key string, value interface{}) *Config {
 	if c.Info == nil {
@@ -502,6 +763,15 @@ func (c *Config) WithProvisioningProfile(path string) *Config {
 	return c
 }
 
+// WithAutoProvisioningProfile embeds the best installed provisioning
+// profile for the bundle ID and signing team, also searching dirs.
+// An explicit WithProvisioningProfile takes precedence.
+func (c *Config) WithAutoProvisioningProfile(dirs ...string) *Config {
+	c.AutoProvisioningProfile = true
+	c.ProfileDirs = append(c.ProfileDirs, dirs...)
+	return c
+}
+
 // WithIcon sets the path to an .icns file to use as the app icon.
 // The icon is copied into the bundle's Resources directory.
 func (c *Config) WithIcon(path string) *Config {
@@ -509,6 +779,104 @@ func (c *Config) WithIcon(path string) *Config {
 	return c
 }
 
+// WithIconPNG sets the path to a PNG image from which the app icon is
+// rendered at every size macOS uses.
+func (c *Config) WithIconPNG(path string) *Config {
+	c.IconPNG = path
+	return c
+}
+
+// WithIconImage sets an image from which the app icon is rendered at
+// every size macOS uses.
+func (c *Config) WithIconImage(img image.Image) *Config {
+	c.IconImage = img
+	return c
+}
+
+// WithInfoPlistTemplate sets the path to an Info.plist template that the
+// generated Info.plist is deep-merged into. See Config.InfoPlistTemplate.
+func (c *Config) WithInfoPlistTemplate(path string) *Config {
+	c.InfoPlistTemplate = path
+	return c
+}
+
+// WithInfoPlistTemplateData sets an in-memory Info.plist template.
+// See Config.InfoPlistTemplateData.
+func (c *Config) WithInfoPlistTemplateData(data []byte) *Config {
+	c.InfoPlistTemplateData = data
+	return c
+}
+
+// WithExtraExecutables adds builds of the program for other architectures.
+// The bundle executable becomes a universal binary of the running
+// executable and these files.
+func (c *Config) WithExtraExecutables(paths ...string) *Config {
+	c.ExtraExecutables = append(c.ExtraExecutables, paths...)
+	return c
+}
+
+// WithArchitectures sets the architectures, in order, of the universal
+// bundle executable. Go ("amd64") and Mach-O ("x86_64") names are accepted.
+func (c *Config) WithArchitectures(archs ...string) *Config {
+	c.Architectures = archs
+	return c
+}
+
+// WithHelpers adds executables to ship and sign inside the bundle.
+func (c *Config) WithHelpers(helpers ...Helper) *Config {
+	c.Helpers = append(c.Helpers, helpers...)
+	return c
+}
+
+// WithXPCServices adds XPC services to build and sign inside the bundle.
+func (c *Config) WithXPCServices(services ...XPCService) *Config {
+	c.XPCServices = append(c.XPCServices, services...)
+	return c
+}
+
+// WithLaunchAgents adds LaunchAgent property lists to the bundle.
+func (c *Config) WithLaunchAgents(agents ...LaunchAgent) *Config {
+	c.LaunchAgents = append(c.LaunchAgents, agents...)
+	return c
+}
+
+// WithResources sets the files, typically an embed.FS, to copy into the
+// bundle's Contents/Resources directory.
+func (c *Config) WithResources(fsys fs.FS) *Config {
+	c.Resources = fsys
+	return c
+}
+
+// WithResourceMap copies the file or directory src of Resources to dest
+// under Contents/Resources, instead of copying all of Resources.
+func (c *Config) WithResourceMap(src, dest string) *Config {
+	if c.ResourceMap == nil {
+		c.ResourceMap = make(map[string]string)
+	}
+	c.ResourceMap[src] = dest
+	return c
+}
+
+// WithURLSchemes registers URL schemes, such as "mytool" for mytool://
+// links, that launch the app. Events delivers the URLs.
+func (c *Config) WithURLSchemes(schemes ...string) *Config {
+	c.URLTypes = append(c.URLTypes, URLType{Schemes: schemes})
+	return c
+}
+
+// WithDocumentTypes adds kinds of files that launch the app when opened.
+// Events delivers the file paths.
+func (c *Config) WithDocumentTypes(types ...DocumentType) *Config {
+	c.DocumentTypes = append(c.DocumentTypes, types...)
+	return c
+}
+
+// WithExportedTypes declares uniform type identifiers owned by the app.
+func (c *Config) WithExportedTypes(types ...TypeDeclaration) *Config {
+	c.ExportedTypes = append(c.ExportedTypes, types...)
+	return c
+}
+
 // WithSingleProcess enables single-process mode: codesign in-place, re-exec,
 // and call setActivationPolicy. No app bundle is created. Only works for
 // entitlement-only permissions (Accessibility, Virtualization, Network);
@@ -549,7 +917,7 @@ func (c *Config) Validate() error {
 
 	// Validate bundle ID format if specified
 	if c.BundleID != "" {
-		if err := system.ValidateBundleID(c.BundleID); err != nil {
+		if err := plist.ValidateBundleIdentifier(c.BundleID); err != nil {
 			return fmt.Errorf("invalid bundle ID: %w", err)
 		}
 	}
@@ -567,9 +935,102 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	switch c.Signer {
+	case SignerAuto, SignerCodesign, SignerBuiltin:
+	default:
+		return fmt.Errorf("invalid signer %q: want %q or %q", c.Signer, SignerCodesign, SignerBuiltin)
+	}
+
+	switch c.TimestampPolicy {
+	case "", TimestampRequired, TimestampOptional, TimestampNone:
+	default:
+		return fmt.Errorf("invalid timestamp policy %q: want %q, %q or %q", c.TimestampPolicy, TimestampRequired, TimestampOptional, TimestampNone)
+	}
+
+	for _, h := range c.Helpers {
+		if h.Dir != "" && h.Dir != "MacOS" && h.Dir != "Helpers" {
+			return fmt.Errorf("invalid helper directory %q: want MacOS or Helpers", h.Dir)
+		}
+	}
+	for _, a := range c.LaunchAgents {
+		if a.Label == "" {
+			return fmt.Errorf("invalid LaunchAgent: no label")
+		}
+	}
+	for _, t := range c.URLTypes {
+		if len(t.Schemes) == 0 {
+			return fmt.Errorf("invalid URL type %q: no schemes", t.Name)
+		}
+	}
+	for _, t := range c.DocumentTypes {
+		if t.Name == "" {
+			return fmt.Errorf("invalid document type: no name")
+		}
+	}
+	for _, t := range c.ExportedTypes {
+		if t.Identifier == "" {
+			return fmt.Errorf("invalid exported type %q: no identifier", t.Description)
+		}
+	}
+
+	// Validate known Info.plist keys in the template and custom Info
+	if err := c.validateInfoPlist(); err != nil {
+		return fmt.Errorf("invalid Info.plist: %w", err)
+	}
+
+	if err := c.checkProvisioningProfile(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// checkProvisioningProfile reports an unreadable or expired provisioning
+// profile before a bundle is built around it. macOS refuses to launch
+// apps whose embedded profile has expired.
+func (c *Config) checkProvisioningProfile() error {
+	if c.ProvisioningProfile == "" {
+		return nil
+	}
+	p, err := codesign.ReadProfile(c.ProvisioningProfile)
+	if err != nil {
+		return &Error{
+			Op:   "provisioning profile",
+			Err:  err,
+			Help: "check that ProvisioningProfile (MACGO_PROVISIONING_PROFILE) names a .provisionprofile file downloaded from the Apple Developer portal",
+		}
+	}
+	if p.Expired() {
+		return &Error{
+			Op:   "provisioning profile",
+			Err:  fmt.Errorf("%q (%s) expired on %s", p.Name, c.ProvisioningProfile, p.ExpirationDate.Local().Format("Jan 2, 2006")),
+			Help: "regenerate the profile in the Apple Developer portal and download it again, or remove ProvisioningProfile (MACGO_PROVISIONING_PROFILE)",
+		}
+	}
+	return nil
+}
+
+// validateInfoPlist type-checks the Info.plist template and Info keys.
+func (c *Config) validateInfoPlist() error {
+	data := c.InfoPlistTemplateData
+	if data == nil && c.InfoPlistTemplate != "" {
+		var err error
+		if data, err = os.ReadFile(c.InfoPlistTemplate); err != nil {
+			return fmt.Errorf("read template: %w", err)
+		}
+	}
+	if data != nil {
+		template, err := plist.ReadInfoPlistTemplate(data)
+		if err != nil {
+			return err
+		}
+		if err := plist.ValidateInfoPlist(template); err != nil {
+			return fmt.Errorf("template: %w", err)
+		}
+	}
+	return plist.ValidateInfoPlist(c.Info)
+}
+
 // Start initializes macgo with the given configuration.
 // Creates an app bundle if needed and handles permission requests.
 // On non-macOS platforms, this is a no-op that returns a no-op function and nil error.
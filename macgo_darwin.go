@@ -63,6 +63,7 @@ func startDarwin(ctx context.Context, cfg *Config) error {
 			if cfg.Debug {
 				fmt.Fprintf(os.Stderr, "macgo: child re-entry after dev mode exec (PID: %d)\n", os.Getpid())
 			}
+			finishHandshake()
 			registerExitHandler(cfg.Debug)
 			return nil
 		}
@@ -124,6 +125,11 @@ func startDarwin(ctx context.Context, cfg *Config) error {
 		if cfg.Debug {
 			fmt.Fprintf(os.Stderr, "macgo: already in app bundle\n")
 		}
+		// An instance launched to open URLs or files hands them to the
+		// running session, if any, and exits.
+		if len(cfg.URLTypes) > 0 || len(cfg.DocumentTypes) > 0 {
+			forwardOpenEvents(cfg)
+		}
 		// In DevMode, exec the development binary instead of running bundled code
 		if cfg.DevMode {
 			if cfg.Debug {
@@ -161,6 +167,10 @@ func startDarwin(ctx context.Context, cfg *Config) error {
 		return launchSingleProcess(ctx, cfg)
 	}
 
+	if err := cfg.checkProvisioningProfile(); err != nil {
+		return err
+	}
+
 	// Create or reuse bundle
 	bundleObj, err := createSimpleBundle(execPath, cfg)
 	if err != nil {
@@ -177,6 +187,8 @@ func startDarwin(ctx context.Context, cfg *Config) error {
 	// os.Executable() inside the bundle returns the bundle binary path,
 	// so this is the only way for the child to know the real source binary.
 	os.Setenv("MACGO_ORIGINAL_EXECUTABLE", execPath)
+	// The bundle path lets ResourcePath work in this process.
+	launchedBundle = bundlePath
 
 	// In DevMode, store the source path in env for mismatch detection
 	if cfg.DevMode {
@@ -213,6 +225,17 @@ func launchSingleProcess(ctx context.Context, cfg *Config) error {
 		Entitlements:  cfg.Custom,
 		UIMode:        string(cfg.UIMode),
 		IconPath:      cfg.IconPath,
+		Signer:        string(cfg.Signer),
+	}
+
+	// Render the icon as in a bundle, so the Dock gets every size.
+	if cfg.IconImage != nil || cfg.IconPNG != "" {
+		iconCfg := &bundle.Config{IconPNG: cfg.IconPNG, IconImage: cfg.IconImage}
+		data, err := iconCfg.RenderIcon()
+		if err != nil {
+			return fmt.Errorf("macgo: render icon: %w", err)
+		}
+		launchCfg.IconData = data
 	}
 
 	manager := launch.New()
@@ -278,8 +301,11 @@ func execDevTarget(cfg *Config) error {
 	os.Setenv("MACGO_NO_RELAUNCH", "1")
 
 	// Exec the target - this replaces the current process
-	// The TCC permissions from the signed bundle apply to the exec'd process
-	return syscall.Exec(target, os.Args, os.Environ())
+	// The TCC permissions from the signed bundle apply to the exec'd process.
+	// The target runs outside the bundle, so pass it the bundle path for
+	// ResourcePath; it unsets the variable on startup.
+	env := append(os.Environ(), "MACGO_BUNDLE_PATH="+filepath.Dir(contentsDir))
+	return syscall.Exec(target, os.Args, env)
 }
 
 // createSimpleBundle creates a minimal app bundle with the given configuration.
@@ -291,25 +317,51 @@ func createSimpleBundle(execPath string, cfg *Config) (*bundle.Bundle, error) {
 	}
 
 	bundleCfg := &bundle.Config{
-		AppName:               cfg.AppName,
-		BundleID:              cfg.BundleID,
-		Version:               cfg.Version,
-		Permissions:           permissions,
-		Custom:                cfg.Custom,
-		CustomStrings:         cfg.CustomStrings,
-		CustomArrays:          cfg.CustomArrays,
-		AppGroups:             cfg.AppGroups,
-		Debug:                 cfg.Debug,
-		CleanupBundle:         cfg.CleanupBundle,
-		CodeSignIdentity:      cfg.CodeSignIdentity,
-		CodeSigningIdentifier: cfg.CodeSigningIdentifier,
-		AutoSign:              cfg.AutoSign,
-		AdHocSign:             cfg.AdHocSign,
-		Info:                  cfg.Info,
-		UIMode:                bundle.UIMode(cfg.UIMode),
-		DevMode:               cfg.DevMode,
-		ProvisioningProfile:   cfg.ProvisioningProfile,
-		IconPath:              cfg.IconPath,
+		AppName:                 cfg.AppName,
+		BundleID:                cfg.BundleID,
+		Version:                 cfg.Version,
+		Permissions:             permissions,
+		Custom:                  cfg.Custom,
+		CustomStrings:           cfg.CustomStrings,
+		CustomArrays:            cfg.CustomArrays,
+		AppGroups:               cfg.AppGroups,
+		Debug:                   cfg.Debug,
+		CleanupBundle:           cfg.CleanupBundle,
+		BundleDir:               cfg.BundleDir,
+		CodeSignIdentity:        cfg.CodeSignIdentity,
+		CodeSigningIdentifier:   cfg.CodeSigningIdentifier,
+		AutoSign:                cfg.AutoSign,
+		AdHocSign:               cfg.AdHocSign,
+		Signer:                  cfg.Signer,
+		IdentityProvider:        cfg.IdentityProvider,
+		TimestampPolicy:         cfg.TimestampPolicy,
+		TimestampURL:            cfg.TimestampURL,
+		Info:                    cfg.Info,
+		InfoPlistTemplate:       cfg.InfoPlistTemplate,
+		InfoPlistTemplateData:   cfg.InfoPlistTemplateData,
+		UIMode:                  bundle.UIMode(cfg.UIMode),
+		DevMode:                 cfg.DevMode,
+		ProvisioningProfile:     cfg.ProvisioningProfile,
+		AutoProvisioningProfile: cfg.AutoProvisioningProfile,
+		ProfileDirs:             cfg.ProfileDirs,
+		IconPath:                cfg.IconPath,
+		IconPNG:                 cfg.IconPNG,
+		IconImage:               cfg.IconImage,
+		ExtraExecutables:        cfg.ExtraExecutables,
+		Architectures:           cfg.Architectures,
+		Helpers:                 cfg.Helpers,
+		XPCServices:             cfg.XPCServices,
+		LaunchAgents:            cfg.LaunchAgents,
+		Resources:               cfg.Resources,
+		ResourceMap:             cfg.ResourceMap,
+		URLTypes:                cfg.URLTypes,
+		DocumentTypes:           cfg.DocumentTypes,
+		ExportedTypes:           cfg.ExportedTypes,
+	}
+	if cfg.PostCreateHook != nil {
+		bundleCfg.PostCreateHook = func(bundlePath string) error {
+			return cfg.PostCreateHook(bundlePath, cfg)
+		}
 	}
 
 	b, err := bundle.New(execPath, bundleCfg)
@@ -320,16 +372,7 @@ func createSimpleBundle(execPath string, cfg *Config) (*bundle.Bundle, error) {
 	if err := b.Create(); err != nil {
 		return nil, err
 	}
-
-	// Run user hook between Create and Sign.
-	if cfg.PostCreateHook != nil {
-		if err := cfg.PostCreateHook(b.Path, cfg); err != nil {
-			return nil, fmt.Errorf("post-create hook: %w", err)
-		}
-		// Hook modified bundle contents, so force re-signing even if
-		// Create() determined the bundle was up-to-date.
-		b.ForceResign()
-	}
+	defer b.Discard()
 
 	if err := b.Sign(); err != nil {
 		return nil, err
@@ -462,6 +505,9 @@ func dumpGoroutineStacks() {
 // writeChildPID writes this process's PID to the control FIFO.
 // The parent reads this to enable signal forwarding.
 func writeChildPID(debug bool) error {
+	// Open events may be read from the pipe once the PID is through.
+	defer finishHandshake()
+
 	// Avoid re-writing the PID if Start is called more than once in the
 	// relaunched child process.
 	if os.Getenv("MACGO_CHILD_PID_WRITTEN") == "1" {
@@ -1,11 +1,21 @@
 package macgo
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/tmc/macgo/codesign"
+	"github.com/tmc/macgo/internal/cms"
+	"github.com/tmc/macgo/internal/plist"
 	"github.com/tmc/macgo/internal/system"
+	"github.com/tmc/macgo/internal/testcert"
 )
 
 func TestConfig(t *testing.T) {
@@ -62,6 +72,17 @@ func TestFromEnv(t *testing.T) {
 		"MACGO_MICROPHONE":                      os.Getenv("MACGO_MICROPHONE"),
 		"MACGO_PROVISIONING_PROFILE":            os.Getenv("MACGO_PROVISIONING_PROFILE"),
 		"MACGO_ICON":                            os.Getenv("MACGO_ICON"),
+		"MACGO_SIGNER":                          os.Getenv("MACGO_SIGNER"),
+		"MACGO_EXTRA_EXECUTABLES":               os.Getenv("MACGO_EXTRA_EXECUTABLES"),
+		"MACGO_ARCHITECTURES":                   os.Getenv("MACGO_ARCHITECTURES"),
+		"MACGO_IDENTITY_FILE":                   os.Getenv("MACGO_IDENTITY_FILE"),
+		"MACGO_IDENTITY_KEY_FILE":               os.Getenv("MACGO_IDENTITY_KEY_FILE"),
+		"MACGO_IDENTITY_PASSWORD":               os.Getenv("MACGO_IDENTITY_PASSWORD"),
+		"MACGO_TIMESTAMP_POLICY":                os.Getenv("MACGO_TIMESTAMP_POLICY"),
+		"MACGO_TIMESTAMP_URL":                   os.Getenv("MACGO_TIMESTAMP_URL"),
+		"MACGO_AUTO_PROVISIONING_PROFILE":       os.Getenv("MACGO_AUTO_PROVISIONING_PROFILE"),
+		"MACGO_PROFILE_DIRS":                    os.Getenv("MACGO_PROFILE_DIRS"),
+		"MACGO_BUNDLE_DIR":                      os.Getenv("MACGO_BUNDLE_DIR"),
 	}
 	defer func() {
 		for k, v := range originalEnv {
@@ -83,6 +104,17 @@ func TestFromEnv(t *testing.T) {
 	_ = os.Setenv("MACGO_MICROPHONE", "1")
 	_ = os.Setenv("MACGO_PROVISIONING_PROFILE", "/tmp/test.provisionprofile")
 	_ = os.Setenv("MACGO_ICON", "/tmp/test.icns")
+	_ = os.Setenv("MACGO_SIGNER", "builtin")
+	_ = os.Setenv("MACGO_EXTRA_EXECUTABLES", "/tmp/app-amd64")
+	_ = os.Setenv("MACGO_ARCHITECTURES", "arm64,amd64")
+	_ = os.Setenv("MACGO_IDENTITY_FILE", "/tmp/identity.p12")
+	_ = os.Setenv("MACGO_IDENTITY_KEY_FILE", "")
+	_ = os.Setenv("MACGO_IDENTITY_PASSWORD", "secret")
+	_ = os.Setenv("MACGO_TIMESTAMP_POLICY", "optional")
+	_ = os.Setenv("MACGO_TIMESTAMP_URL", "http://tsa.example.com")
+	_ = os.Setenv("MACGO_AUTO_PROVISIONING_PROFILE", "1")
+	_ = os.Setenv("MACGO_PROFILE_DIRS", "/tmp/profiles,/opt/profiles")
+	_ = os.Setenv("MACGO_BUNDLE_DIR", "/tmp/bundles")
 
 	cfg := new(Config).FromEnv()
 
@@ -122,6 +154,28 @@ func TestFromEnv(t *testing.T) {
 	if cfg.IconPath != "/tmp/test.icns" {
 		t.Errorf("expected IconPath=/tmp/test.icns, got %s", cfg.IconPath)
 	}
+	if cfg.Signer != SignerBuiltin {
+		t.Errorf("expected Signer=builtin, got %q", cfg.Signer)
+	}
+	if len(cfg.ExtraExecutables) != 1 || cfg.ExtraExecutables[0] != "/tmp/app-amd64" {
+		t.Errorf("unexpected ExtraExecutables: %#v", cfg.ExtraExecutables)
+	}
+	if len(cfg.Architectures) != 2 || cfg.Architectures[0] != "arm64" || cfg.Architectures[1] != "amd64" {
+		t.Errorf("unexpected Architectures: %#v", cfg.Architectures)
+	}
+	wantProvider := codesign.FileProvider{Path: "/tmp/identity.p12", Password: "secret"}
+	if cfg.IdentityProvider != wantProvider {
+		t.Errorf("unexpected IdentityProvider: %#v", cfg.IdentityProvider)
+	}
+	if cfg.TimestampPolicy != TimestampOptional || cfg.TimestampURL != "http://tsa.example.com" {
+		t.Errorf("unexpected timestamp settings: %q %q", cfg.TimestampPolicy, cfg.TimestampURL)
+	}
+	if !cfg.AutoProvisioningProfile || len(cfg.ProfileDirs) != 2 || cfg.ProfileDirs[1] != "/opt/profiles" {
+		t.Errorf("unexpected profile discovery settings: %v %#v", cfg.AutoProvisioningProfile, cfg.ProfileDirs)
+	}
+	if cfg.BundleDir != "/tmp/bundles" {
+		t.Errorf("expected BundleDir=/tmp/bundles, got %q", cfg.BundleDir)
+	}
 }
 
 func TestStartOnNonDarwin(t *testing.T) {
@@ -373,3 +427,191 @@ func BenchmarkStart(b *testing.B) {
 		_ = Start(cfg)
 	}
 }
+
+func TestConfigValidateSigner(t *testing.T) {
+	for _, s := range []Signer{SignerAuto, SignerCodesign, SignerBuiltin} {
+		if err := new(Config).WithSigner(s).Validate(); err != nil {
+			t.Errorf("Validate() with signer %q = %v", s, err)
+		}
+	}
+	if err := new(Config).WithSigner("ldid").Validate(); err == nil {
+		t.Error("Validate() accepted unknown signer")
+	}
+}
+
+func TestConfigValidateNested(t *testing.T) {
+	ok := new(Config).
+		WithHelpers(Helper{Path: "/bin/agent", Dir: "Helpers"}).
+		WithLaunchAgents(LaunchAgent{Label: "com.example.agent", Program: "agent"})
+	if err := ok.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if err := new(Config).WithHelpers(Helper{Path: "/bin/agent", Dir: "Resources"}).Validate(); err == nil {
+		t.Error("Validate() accepted a helper outside MacOS and Helpers")
+	}
+	if err := new(Config).WithLaunchAgents(LaunchAgent{Program: "agent"}).Validate(); err == nil {
+		t.Error("Validate() accepted a LaunchAgent without a label")
+	}
+}
+
+// writeProfile writes a signed provisioning profile expiring at expires.
+func writeProfile(t *testing.T, expires time.Time) string {
+	t.Helper()
+	content, err := plist.Marshal(map[string]any{"Name": "Test Profile", "ExpirationDate": expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key := testcert.New(t, &x509.Certificate{Subject: pkix.Name{CommonName: "Test Profile Signing"}}, nil, nil)
+	data, err := cms.Sign(content, cert, key, cms.SignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.provisionprofile")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigValidateProvisioningProfile(t *testing.T) {
+	current := writeProfile(t, time.Now().Add(24*time.Hour))
+	if err := new(Config).WithProvisioningProfile(current).Validate(); err != nil {
+		t.Errorf("Validate() with a current profile = %v", err)
+	}
+
+	expired := writeProfile(t, time.Now().Add(-24*time.Hour))
+	err := new(Config).WithProvisioningProfile(expired).Validate()
+	var merr *Error
+	if !errors.As(err, &merr) || !strings.Contains(err.Error(), "expired") || merr.Help == "" {
+		t.Errorf("Validate() with an expired profile = %v, want *Error with a hint", err)
+	}
+
+	missing := new(Config).WithProvisioningProfile(filepath.Join(t.TempDir(), "missing.provisionprofile"))
+	if err := missing.Validate(); !errors.As(err, &merr) {
+		t.Errorf("Validate() with a missing profile = %v, want *Error", err)
+	}
+}
+
+func TestConfigValidateInfoPlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr bool
+	}{
+		{
+			name: "valid info",
+			cfg:  &Config{Info: map[string]interface{}{"LSUIElement": true}},
+		},
+		{
+			name:    "string LSUIElement",
+			cfg:     &Config{Info: map[string]interface{}{"LSUIElement": "yes"}},
+			wantErr: true,
+		},
+		{
+			name:    "non reverse-DNS CFBundleIdentifier",
+			cfg:     &Config{Info: map[string]interface{}{"CFBundleIdentifier": "myapp"}},
+			wantErr: true,
+		},
+		{
+			name: "invalid template",
+			cfg: new(Config).WithInfoPlistTemplateData([]byte(
+				`<plist version="1.0"><dict><key>LSBackgroundOnly</key><string>no</string></dict></plist>`)),
+			wantErr: true,
+		},
+		{
+			name:    "missing template",
+			cfg:     new(Config).WithInfoPlistTemplate("/nonexistent/Info.plist"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResourcePath(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "ResourceApp.app")
+	script := filepath.Join(bundlePath, "Contents", "Resources", "scripts", "open.applescript")
+	if err := os.MkdirAll(filepath.Dir(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(script, []byte("beep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved string) { launchedBundle = saved }(launchedBundle)
+	launchedBundle = ""
+	if _, err := ResourcePath("scripts/open.applescript"); err == nil {
+		t.Error("ResourcePath outside a bundle succeeded")
+	}
+
+	// The bundle path is taken from the environment once, and not passed
+	// on to child processes.
+	t.Setenv("MACGO_BUNDLE_PATH", bundlePath)
+	launchedBundle = takeBundlePath()
+	if env, ok := os.LookupEnv("MACGO_BUNDLE_PATH"); ok {
+		t.Errorf("MACGO_BUNDLE_PATH = %q after takeBundlePath, want unset", env)
+	}
+	if got, err := ResourcePath("scripts/open.applescript"); err != nil || got != script {
+		t.Errorf("ResourcePath = %q, %v, want %q", got, err, script)
+	}
+	for _, name := range []string{"missing.txt", "../Info.plist", "/etc/passwd"} {
+		if _, err := ResourcePath(name); err == nil {
+			t.Errorf("ResourcePath(%q) succeeded", name)
+		}
+	}
+}
+
+func TestFromEnvIconPNG(t *testing.T) {
+	t.Setenv("MACGO_ICON", "/tmp/icon.PNG")
+	cfg := NewConfig().FromEnv()
+	if cfg.IconPNG != "/tmp/icon.PNG" || cfg.IconPath != "" {
+		t.Errorf("IconPNG = %q, IconPath = %q; want the PNG in IconPNG", cfg.IconPNG, cfg.IconPath)
+	}
+}
+
+func TestConfigValidateDocumentTypes(t *testing.T) {
+	ok := new(Config).
+		WithURLSchemes("mytool").
+		WithDocumentTypes(DocumentType{Name: "MyTool Document", ContentTypes: []string{"com.example.mytool.doc"}}).
+		WithExportedTypes(TypeDeclaration{Identifier: "com.example.mytool.doc", Extensions: []string{"mytool"}})
+	if err := ok.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if err := new(Config).WithURLSchemes().Validate(); err == nil {
+		t.Error("Validate() accepted a URL type without schemes")
+	}
+	if err := new(Config).WithDocumentTypes(DocumentType{Extensions: []string{"mytool"}}).Validate(); err == nil {
+		t.Error("Validate() accepted a document type without a name")
+	}
+	if err := new(Config).WithExportedTypes(TypeDeclaration{Description: "MyTool Document"}).Validate(); err == nil {
+		t.Error("Validate() accepted an exported type without an identifier")
+	}
+}
+
+func TestOpenEventLines(t *testing.T) {
+	for _, e := range []OpenEvent{
+		{URL: "mytool://open?doc=a%20b"},
+		{Path: "/Users/me/My \"Docs\"/notes.mytool"},
+		{Path: "/tmp/line\nbreak.mytool"},
+	} {
+		line := e.marshal()
+		if strings.Count(line, "\n") != 1 {
+			t.Errorf("marshal(%+v) = %q, want a single line", e, line)
+		}
+		got, err := parseOpenEvent(line)
+		if err != nil || got != e {
+			t.Errorf("parseOpenEvent(%q) = %+v, %v, want %+v", line, got, err, e)
+		}
+	}
+	for _, line := range []string{"", "url mytool://x", "open \"x\"", "12345"} {
+		if _, err := parseOpenEvent(line); err == nil {
+			t.Errorf("parseOpenEvent(%q) succeeded", line)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package notary
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// tokenLifetime is how long a token is valid. App Store Connect rejects
+// tokens that expire more than 20 minutes after they are issued.
+const tokenLifetime = 20 * time.Minute
+
+// Credentials identify an App Store Connect API key.
+type Credentials struct {
+	// KeyID is the key's ID, shown next to it in App Store Connect and
+	// embedded in the name of the downloaded AuthKey_<KeyID>.p8 file.
+	KeyID string
+
+	// IssuerID is the team's issuer ID. Leave it empty for an individual
+	// API key, which has none.
+	IssuerID string
+
+	// Key is the private key from the .p8 file; see LoadKey.
+	Key *ecdsa.PrivateKey
+}
+
+// LoadKey reads an App Store Connect private key from a .p8 file.
+func LoadKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParseKey parses the contents of a .p8 file: a PEM-encoded PKCS#8
+// P-256 private key.
+func ParseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("notary: no PEM data in key")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("notary: %w", err)
+	}
+	key, ok := k.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, errors.New("notary: key is not a P-256 ECDSA key")
+	}
+	return key, nil
+}
+
+// Token returns a signed JSON Web Token authorizing App Store Connect
+// requests, issued at now.
+func (c Credentials) Token(now time.Time) (string, error) {
+	if c.Key == nil {
+		return "", errors.New("notary: credentials have no key")
+	}
+	if c.KeyID == "" {
+		return "", errors.New("notary: credentials have no key ID")
+	}
+	header := map[string]string{"alg": "ES256", "kid": c.KeyID, "typ": "JWT"}
+	claims := map[string]any{
+		"aud": "appstoreconnect-v1",
+		"iat": now.Unix(),
+		"exp": now.Add(tokenLifetime).Unix(),
+	}
+	if c.IssuerID != "" {
+		claims["iss"] = c.IssuerID
+	} else {
+		claims["sub"] = "user"
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(h) + "." + enc.EncodeToString(p)
+
+	// JWS signatures are the fixed-width r || s, not ASN.1.
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, c.Key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,63 @@
+package notary
+
+import (
+	"fmt"
+	"time"
+)
+
+// Log is the developer log of a processed submission, which explains
+// why it was accepted or not.
+type Log struct {
+	JobID           string    `json:"jobId"`
+	Status          Status    `json:"status"`
+	StatusSummary   string    `json:"statusSummary"`
+	StatusCode      int       `json:"statusCode"`
+	ArchiveFilename string    `json:"archiveFilename"`
+	UploadDate      time.Time `json:"uploadDate"`
+	SHA256          string    `json:"sha256"`
+
+	// TicketContents lists the code the notarization ticket covers.
+	TicketContents []Ticket `json:"ticketContents"`
+
+	// Issues lists the problems found, if any. Errors cause the
+	// submission to be rejected; warnings do not.
+	Issues []Issue `json:"issues"`
+}
+
+// Errors returns the issues with error severity.
+func (l *Log) Errors() []Issue {
+	var errs []Issue
+	for _, i := range l.Issues {
+		if i.Severity == "error" {
+			errs = append(errs, i)
+		}
+	}
+	return errs
+}
+
+// Ticket is a piece of code covered by a notarization ticket.
+type Ticket struct {
+	Path            string `json:"path"`
+	DigestAlgorithm string `json:"digestAlgorithm"`
+	CDHash          string `json:"cdhash"`
+	Arch            string `json:"arch"`
+}
+
+// Issue is a problem the notary service found in a submission.
+type Issue struct {
+	Severity     string `json:"severity"` // "error" or "warning"
+	Code         *int   `json:"code"`
+	Path         string `json:"path"` // within the archive
+	Message      string `json:"message"`
+	DocURL       string `json:"docUrl"`
+	Architecture string `json:"architecture"`
+}
+
+// String formats the issue on one line, like a compiler diagnostic.
+func (i Issue) String() string {
+	s := i.Path
+	if i.Architecture != "" {
+		s += " (" + i.Architecture + ")"
+	}
+	return fmt.Sprintf("%s: %s: %s", s, i.Severity, i.Message)
+}
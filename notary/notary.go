@@ -0,0 +1,336 @@
+// Package notary submits signed apps to Apple's notary service through
+// its REST API, as `xcrun notarytool` does, without needing Xcode.
+//
+// Requests are authorized with an App Store Connect API key:
+//
+//	key, err := notary.LoadKey("AuthKey_ABC123DEFG.p8")
+//	...
+//	c := &notary.Client{Credentials: notary.Credentials{
+//		KeyID:    "ABC123DEFG",
+//		IssuerID: "57246542-96fe-1a63-e053-0824d011072a",
+//		Key:      key,
+//	}}
+//	sub, err := c.Submit(ctx, "MyApp.app")
+//	...
+//	sub, err = c.Wait(ctx, sub.ID)
+//
+// Once accepted, a Stapler attaches the notarization ticket to the
+// bundle. BaseURL, UploadURL and TicketURL can point at a stand-in
+// server for testing.
+package notary
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the notary service's API endpoint.
+const DefaultBaseURL = "https://appstoreconnect.apple.com/notary/v2"
+
+// DefaultPollInterval is how often Wait checks a submission's status.
+const DefaultPollInterval = 30 * time.Second
+
+// Status is the processing status of a submission.
+type Status string
+
+const (
+	StatusInProgress Status = "In Progress"
+	StatusAccepted   Status = "Accepted"
+	StatusInvalid    Status = "Invalid"
+	StatusRejected   Status = "Rejected"
+)
+
+// Done reports whether the notary service has finished with the
+// submission.
+func (s Status) Done() bool {
+	return s != "" && s != StatusInProgress
+}
+
+// Submission is a submission to the notary service.
+type Submission struct {
+	ID          string
+	Name        string
+	Status      Status
+	CreatedDate time.Time
+}
+
+// Error is an error response from the notary service.
+type Error struct {
+	StatusCode int    // HTTP status
+	Code       string // such as "NOT_FOUND"
+	Title      string
+	Detail     string
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("notary: %s (%s)", msg, e.Code)
+	}
+	return "notary: " + msg
+}
+
+// Client talks to the notary service.
+type Client struct {
+	Credentials
+
+	// BaseURL is the API endpoint; DefaultBaseURL if empty.
+	BaseURL string
+
+	// UploadURL is the S3 endpoint that archives are uploaded to;
+	// DefaultUploadURL if empty.
+	UploadURL string
+
+	// HTTPClient makes the requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	// PollInterval is how often Wait polls; DefaultPollInterval if zero.
+	PollInterval time.Duration
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Submit uploads the app at path for notarization and returns the new
+// submission, which is in progress. A directory such as an .app bundle
+// is zipped first; .zip, .dmg and .pkg files are uploaded as they are.
+func (c *Client) Submit(ctx context.Context, path string) (*Submission, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	if fi.IsDir() {
+		tmp, err := zipToTemp(path)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp)
+		path, name = tmp, name+".zip"
+	} else {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".zip", ".dmg", ".pkg":
+		default:
+			return nil, fmt.Errorf("notary: %s: not an app bundle, .zip, .dmg or .pkg", path)
+		}
+	}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]string{
+		"submissionName": name,
+		"sha256":         fmt.Sprintf("%x", sum),
+	}
+	var resp struct {
+		Data struct {
+			ID         string       `json:"id"`
+			Attributes uploadTarget `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/submissions", body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.ID == "" {
+		return nil, errors.New("notary: submission response has no ID")
+	}
+	if err := c.upload(ctx, resp.Data.Attributes, path, sum); err != nil {
+		return nil, err
+	}
+	return &Submission{ID: resp.Data.ID, Name: name, Status: StatusInProgress}, nil
+}
+
+// Status returns the current state of submission id.
+func (c *Client) Status(ctx context.Context, id string) (*Submission, error) {
+	var resp struct {
+		Data struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Name        string    `json:"name"`
+				Status      Status    `json:"status"`
+				CreatedDate time.Time `json:"createdDate"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/submissions/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	a := resp.Data.Attributes
+	return &Submission{ID: resp.Data.ID, Name: a.Name, Status: a.Status, CreatedDate: a.CreatedDate}, nil
+}
+
+// Wait polls submission id until the notary service has finished with it
+// or ctx is done, and returns its final state. Processing usually takes a
+// few minutes.
+func (c *Client) Wait(ctx context.Context, id string) (*Submission, error) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		sub, err := c.Status(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if sub.Status.Done() {
+			return sub, nil
+		}
+		select {
+		case <-ctx.Done():
+			return sub, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Log fetches and parses the developer log of submission id. It is
+// available once the submission is done.
+func (c *Client) Log(ctx context.Context, id string) (*Log, error) {
+	var resp struct {
+		Data struct {
+			Attributes struct {
+				DeveloperLogURL string `json:"developerLogUrl"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/submissions/"+url.PathEscape(id)+"/logs", nil, &resp); err != nil {
+		return nil, err
+	}
+	logURL := resp.Data.Attributes.DeveloperLogURL
+	if logURL == "" {
+		return nil, errors.New("notary: no developer log URL")
+	}
+
+	// The log URL is presigned, so it takes no authorization.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("notary: fetching log: %w", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("notary: fetching log: %s", r.Status)
+	}
+	var log Log
+	if err := json.NewDecoder(r.Body).Decode(&log); err != nil {
+		return nil, fmt.Errorf("notary: parsing log: %w", err)
+	}
+	return &log, nil
+}
+
+// do sends an authorized API request with body, if any, encoded as JSON,
+// and decodes the response into out.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	token, err := c.Token(time.Now())
+	if err != nil {
+		return err
+	}
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("notary: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("notary: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		var e struct {
+			Errors []struct {
+				Code   string `json:"code"`
+				Title  string `json:"title"`
+				Detail string `json:"detail"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(data, &e) == nil && len(e.Errors) > 0 {
+			apiErr.Code, apiErr.Title, apiErr.Detail = e.Errors[0].Code, e.Errors[0].Title, e.Errors[0].Detail
+		}
+		return apiErr
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("notary: %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// zipToTemp zips the bundle at dir into a temporary file and returns its
+// path.
+func zipToTemp(dir string) (string, error) {
+	f, err := os.CreateTemp("", "macgo-notary-*.zip")
+	if err != nil {
+		return "", err
+	}
+	if err := Zip(f, dir); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
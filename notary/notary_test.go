@@ -0,0 +1,362 @@
+package notary
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "AuthKey_TEST.p8")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadKey(path)
+	if err != nil {
+		t.Fatalf("LoadKey: %v", err)
+	}
+	return key
+}
+
+// verifyToken checks token's ES256 signature against pub and returns its
+// header and claims.
+func verifyToken(token string, pub *ecdsa.PublicKey) (header, claims map[string]any, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("token has %d parts", len(parts))
+	}
+	enc := base64.RawURLEncoding
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return nil, nil, fmt.Errorf("bad signature encoding")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		return nil, nil, fmt.Errorf("signature does not verify")
+	}
+	for i, v := range []*map[string]any{&header, &claims} {
+		data, err := enc.DecodeString(parts[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, nil, err
+		}
+	}
+	return header, claims, nil
+}
+
+func TestToken(t *testing.T) {
+	key := testKey(t)
+	now := time.Unix(1700000000, 0)
+
+	token, err := Credentials{KeyID: "ABC123DEFG", IssuerID: "issuer", Key: key}.Token(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, claims, err := verifyToken(token, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header["alg"] != "ES256" || header["kid"] != "ABC123DEFG" || header["typ"] != "JWT" {
+		t.Errorf("header = %v", header)
+	}
+	if claims["iss"] != "issuer" || claims["aud"] != "appstoreconnect-v1" ||
+		claims["iat"] != float64(now.Unix()) || claims["exp"] != float64(now.Add(20*time.Minute).Unix()) {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// Individual keys have no issuer.
+	token, err = Credentials{KeyID: "ABC123DEFG", Key: key}.Token(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, claims, err = verifyToken(token, &key.PublicKey); err != nil || claims["sub"] != "user" || claims["iss"] != nil {
+		t.Errorf("individual key claims = %v, %v", claims, err)
+	}
+
+	if _, err := (Credentials{KeyID: "ABC123DEFG"}).Token(now); err == nil {
+		t.Error("Token without a key succeeded")
+	}
+	if _, err := ParseKey([]byte("not a key")); err == nil {
+		t.Error("ParseKey of garbage succeeded")
+	}
+}
+
+// fakeNotary stands in for the notary service and its upload bucket.
+type fakeNotary struct {
+	key *ecdsa.PublicKey
+	url string
+
+	mu       sync.Mutex
+	sha256   string
+	uploaded []byte
+	polls    int
+	log      Log
+}
+
+func (f *fakeNotary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == "/notary-submissions/prefix/sub-1":
+		f.serveUpload(w, r)
+		return
+	case r.URL.Path == "/log/sub-1":
+		if r.Header.Get("Authorization") != "" {
+			http.Error(w, "presigned URLs take no authorization", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(f.log)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "NOT_AUTHORIZED")
+		return
+	}
+	if _, claims, err := verifyToken(token, f.key); err != nil || claims["iss"] != "issuer" {
+		writeError(w, http.StatusUnauthorized, "NOT_AUTHORIZED")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v2/submissions":
+		var req struct {
+			Name   string `json:"submissionName"`
+			SHA256 string `json:"sha256"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name != "Hello.app.zip" || len(req.SHA256) != 64 {
+			writeError(w, http.StatusBadRequest, "PARAMETER_ERROR.INVALID")
+			return
+		}
+		f.sha256 = req.SHA256
+		fmt.Fprintf(w, `{"data":{"id":"sub-1","type":"newSubmissions","attributes":{
+			"awsAccessKeyId":"AKID","awsSecretAccessKey":"secret","awsSessionToken":"session",
+			"bucket":"notary-submissions","object":"prefix/sub-1"}},"meta":{}}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/v2/submissions/sub-1":
+		status := StatusInProgress
+		if f.polls++; f.polls > 2 {
+			status = StatusInvalid
+		}
+		fmt.Fprintf(w, `{"data":{"id":"sub-1","type":"submissions","attributes":{
+			"name":"Hello.app.zip","status":%q,"createdDate":"2026-10-16T01:38:09.498Z"}},"meta":{}}`, status)
+	case r.Method == http.MethodGet && r.URL.Path == "/v2/submissions/sub-1/logs":
+		fmt.Fprintf(w, `{"data":{"id":"sub-1","type":"submissionsLog","attributes":{"developerLogUrl":%q}}}`, f.url+"/log/sub-1")
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND")
+	}
+}
+
+func (f *fakeNotary) serveUpload(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) || got != f.sha256 {
+		http.Error(w, "payload hash mismatch", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("X-Amz-Security-Token") != "session" {
+		http.Error(w, "missing session token", http.StatusForbidden)
+		return
+	}
+
+	// Re-sign the request as received and compare.
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	signV4(check, uploadTarget{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, f.sha256, date)
+	if got, want := r.Header.Get("Authorization"), check.Header.Get("Authorization"); got != want {
+		http.Error(w, "signature mismatch", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"+date.Format("20060102")+"/us-west-2/s3/aws4_request, ") {
+		http.Error(w, "bad credential scope", http.StatusForbidden)
+		return
+	}
+	f.uploaded = body
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"errors":[{"status":"%d","code":%q,"title":"fake error","detail":"fake %s"}]}`, status, code, code)
+}
+
+// writeBundle creates a minimal bundle with a framework-style symlink.
+func writeBundle(t *testing.T) string {
+	t.Helper()
+	app := filepath.Join(t.TempDir(), "Hello.app")
+	for name, data := range map[string]string{
+		"Contents/Info.plist":                          "<plist/>",
+		"Contents/MacOS/hello":                         "#!/bin/sh\n",
+		"Contents/Frameworks/A.framework/Versions/A/A": "framework",
+	} {
+		path := filepath.Join(app, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(app, "Contents/MacOS/hello"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("A", filepath.Join(app, "Contents/Frameworks/A.framework/Versions/Current")); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestZip(t *testing.T) {
+	app := writeBundle(t)
+	var buf bytes.Buffer
+	if err := Zip(&buf, app); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if f := files["Hello.app/Contents/MacOS/hello"]; f == nil || f.Mode().Perm() != 0o755 {
+		t.Errorf("executable entry = %v", f)
+	}
+	if files["Hello.app/Contents/"] == nil || !files["Hello.app/Contents/"].Mode().IsDir() {
+		t.Error("missing directory entry for Hello.app/Contents/")
+	}
+	link := files["Hello.app/Contents/Frameworks/A.framework/Versions/Current"]
+	if link == nil || link.Mode()&fs.ModeSymlink == 0 {
+		t.Fatalf("symlink entry = %v", link)
+	}
+	rc, err := link.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(target) != "A" {
+		t.Errorf("symlink target = %q, want %q", target, "A")
+	}
+}
+
+func TestNotarize(t *testing.T) {
+	key := testKey(t)
+	fake := &fakeNotary{key: &key.PublicKey}
+	code := 1
+	fake.log = Log{
+		JobID:           "sub-1",
+		Status:          StatusInvalid,
+		StatusSummary:   "Archive contains critical validation errors",
+		StatusCode:      4000,
+		ArchiveFilename: "Hello.app.zip",
+		Issues: []Issue{
+			{Severity: "error", Code: &code, Path: "Hello.app.zip/Hello.app/Contents/MacOS/hello", Message: "The executable does not have the hardened runtime enabled.", Architecture: "arm64"},
+			{Severity: "warning", Path: "Hello.app.zip/Hello.app/Contents/MacOS/hello", Message: "The signature does not include a secure timestamp."},
+		},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	fake.url = srv.URL
+
+	c := &Client{
+		Credentials:  Credentials{KeyID: "ABC123DEFG", IssuerID: "issuer", Key: key},
+		BaseURL:      srv.URL + "/v2",
+		UploadURL:    srv.URL,
+		PollInterval: time.Millisecond,
+	}
+	ctx := context.Background()
+	app := writeBundle(t)
+
+	sub, err := c.Submit(ctx, app)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if sub.ID != "sub-1" || sub.Name != "Hello.app.zip" {
+		t.Errorf("Submit = %+v", sub)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(fake.uploaded), int64(len(fake.uploaded))); err != nil {
+		t.Errorf("uploaded archive is not a zip: %v", err)
+	}
+
+	sub, err = c.Wait(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if sub.Status != StatusInvalid || fake.polls != 3 || sub.CreatedDate.Year() != 2026 {
+		t.Errorf("Wait = %+v after %d polls", sub, fake.polls)
+	}
+
+	log, err := c.Log(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	if log.StatusCode != 4000 || len(log.Issues) != 2 || *log.Issues[0].Code != 1 {
+		t.Errorf("Log = %+v", log)
+	}
+	errs := log.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("Errors() = %v", errs)
+	}
+	if want := "Hello.app.zip/Hello.app/Contents/MacOS/hello (arm64): error: The executable does not have the hardened runtime enabled."; errs[0].String() != want {
+		t.Errorf("Issue.String() = %q, want %q", errs[0], want)
+	}
+
+	// API errors surface with their code.
+	_, err = c.Status(ctx, "missing")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "NOT_FOUND" {
+		t.Errorf("Status(missing) error = %v", err)
+	}
+	c.IssuerID = "someone-else"
+	if _, err := c.Status(ctx, "sub-1"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Status with wrong issuer error = %v", err)
+	}
+
+	if _, err := c.Submit(ctx, filepath.Join(app, "Contents/Info.plist")); err == nil {
+		t.Error("Submit of a plist succeeded")
+	}
+}
@@ -0,0 +1,201 @@
+package notary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmc/macgo/internal/codesig"
+)
+
+// DefaultTicketURL is the CloudKit endpoint that notarization tickets are
+// published to and looked up from.
+const DefaultTicketURL = "https://api.apple-cloudkit.com/database/1/com.apple.gk.ticket-delivery/production/public/records/lookup"
+
+// ticketMagic starts every notarization ticket.
+const ticketMagic = "s8ch"
+
+var (
+	// ErrNoTicket reports that the ticket service has no ticket for the
+	// code: it was not notarized, or the ticket is not published yet.
+	ErrNoTicket = errors.New("notary: no notarization ticket")
+
+	// ErrNotStapled reports a bundle without a stapled ticket.
+	ErrNotStapled = errors.New("notary: no ticket stapled")
+)
+
+// Stapler fetches notarization tickets and staples them to bundles, as
+// `xcrun stapler staple` does, so they pass Gatekeeper while offline.
+type Stapler struct {
+	// TicketURL is the ticket lookup endpoint; DefaultTicketURL if empty.
+	TicketURL string
+
+	// HTTPClient makes the requests; http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Staple fetches the notarization ticket for the signed bundle at path
+// and writes it to Contents/CodeResources. The bundle must not be
+// modified afterwards, or its CDHash will no longer match the ticket.
+func (s *Stapler) Staple(ctx context.Context, path string) error {
+	ticket, err := s.Fetch(ctx, path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(path, "Contents", codesig.TicketPath), ticket, 0o644)
+}
+
+// Fetch looks up the notarization ticket for the signed bundle at path
+// by the CDHash of its main executable, and checks that it covers every
+// architecture.
+func (s *Stapler) Fetch(ctx context.Context, path string) ([]byte, error) {
+	slices, err := signedSlices(path)
+	if err != nil {
+		return nil, err
+	}
+	cd := slices[0].Signature.CodeDirectory()
+	ticket, err := s.lookup(ctx, fmt.Sprintf("2/%d/%x", cd.HashType, cd.CDHash()[:20]))
+	if err != nil {
+		return nil, fmt.Errorf("%w for %s", err, path)
+	}
+	if err := checkTicket(ticket, slices); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// CheckTicket validates the ticket stapled to the bundle at path: it
+// must be well formed and cover the CDHash of each architecture of the
+// main executable. It returns ErrNotStapled if there is no ticket.
+func CheckTicket(path string) error {
+	ticket, err := os.ReadFile(filepath.Join(path, "Contents", codesig.TicketPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotStapled
+	} else if err != nil {
+		return err
+	}
+	slices, err := signedSlices(path)
+	if err != nil {
+		return err
+	}
+	return checkTicket(ticket, slices)
+}
+
+// checkTicket reports whether ticket lists the CDHash of each slice.
+// Tickets list the truncated 20-byte CDHashes they cover.
+func checkTicket(ticket []byte, slices []*codesig.Slice) error {
+	if !bytes.HasPrefix(ticket, []byte(ticketMagic)) {
+		return errors.New("notary: malformed ticket")
+	}
+	for _, s := range slices {
+		covered := false
+		for _, cd := range s.Signature.CodeDirectories {
+			if h := cd.CDHash(); len(h) >= 20 && bytes.Contains(ticket[len(ticketMagic):], h[:20]) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return fmt.Errorf("notary: ticket does not cover the %s signature (CDHash %x); the bundle changed after notarization",
+				s.Arch(), s.Signature.CodeDirectory().CDHash()[:20])
+		}
+	}
+	return nil
+}
+
+// signedSlices returns the slices of the bundle's main executable,
+// which must all be signed.
+func signedSlices(path string) ([]*codesig.Slice, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("notary: %s: only bundles can be stapled", path)
+	}
+	exe, _, err := codesig.MainExecutable(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := codesig.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range f.Slices {
+		if s.Signature == nil || s.Signature.CodeDirectory() == nil {
+			return nil, fmt.Errorf("notary: %s (%s): %w", exe, s.Arch(), codesig.ErrNotSigned)
+		}
+	}
+	return f.Slices, nil
+}
+
+// lookup fetches the ticket record named name.
+func (s *Stapler) lookup(ctx context.Context, name string) ([]byte, error) {
+	body, err := json.Marshal(map[string]any{
+		"records": []map[string]string{{"recordName": name}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	u := s.TicketURL
+	if u == "" {
+		u = DefaultTicketURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("notary: ticket lookup: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("notary: ticket lookup: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var r struct {
+		Records []struct {
+			RecordName      string `json:"recordName"`
+			ServerErrorCode string `json:"serverErrorCode"`
+			Reason          string `json:"reason"`
+			Fields          struct {
+				SignedTicket struct {
+					Value []byte `json:"value"` // base64
+				} `json:"signedTicket"`
+			} `json:"fields"`
+		} `json:"records"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("notary: ticket lookup: %w", err)
+	}
+	for _, rec := range r.Records {
+		if rec.RecordName != name {
+			continue
+		}
+		switch {
+		case rec.ServerErrorCode == "NOT_FOUND":
+			return nil, ErrNoTicket
+		case rec.ServerErrorCode != "":
+			return nil, fmt.Errorf("notary: ticket lookup: %s: %s", rec.ServerErrorCode, rec.Reason)
+		case len(rec.Fields.SignedTicket.Value) == 0:
+			return nil, ErrNoTicket
+		}
+		return rec.Fields.SignedTicket.Value, nil
+	}
+	return nil, ErrNoTicket
+}
@@ -0,0 +1,133 @@
+package notary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmc/macgo/internal/codesig"
+	"github.com/tmc/macgo/internal/testbuild"
+)
+
+// signedBundle builds a darwin/arm64 executable into Hello.app and signs
+// it ad-hoc.
+func signedBundle(t *testing.T) string {
+	t.Helper()
+	app := filepath.Join(t.TempDir(), "Hello.app")
+	testbuild.Darwin(t, "arm64", filepath.Join(app, "Contents", "MacOS", "hello"))
+	info := `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>hello</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.hello</string>
+</dict>
+</plist>
+`
+	if err := os.WriteFile(filepath.Join(app, "Contents", "Info.plist"), []byte(info), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := codesig.SignBundle(app, codesig.SignOptions{Identifier: "com.example.hello"}); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// fakeTickets stands in for the ticket lookup service, serving a ticket
+// for each record name in tickets.
+func fakeTickets(t *testing.T, tickets map[string][]byte) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Records []struct {
+				RecordName string `json:"recordName"`
+			} `json:"records"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var records []any
+		for _, rec := range req.Records {
+			ticket, ok := tickets[rec.RecordName]
+			if !ok {
+				records = append(records, map[string]string{
+					"recordName": rec.RecordName, "reason": "Record not found", "serverErrorCode": "NOT_FOUND",
+				})
+				continue
+			}
+			records = append(records, map[string]any{
+				"recordName": rec.RecordName,
+				"recordType": "DeveloperIDTicket",
+				"fields":     map[string]any{"signedTicket": map[string]any{"type": "BYTES", "value": ticket}},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"records": records})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStaple(t *testing.T) {
+	app := signedBundle(t)
+	f, err := codesig.Open(filepath.Join(app, "Contents", "MacOS", "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdhash := f.Slices[0].Signature.CodeDirectory().CDHash()[:20]
+	name := fmt.Sprintf("2/2/%x", cdhash)
+	ticket := append([]byte("s8ch\x01\x00\x00\x00"), cdhash...)
+
+	if err := CheckTicket(app); !errors.Is(err, ErrNotStapled) {
+		t.Errorf("CheckTicket(unstapled) = %v, want ErrNotStapled", err)
+	}
+
+	// Not notarized.
+	s := &Stapler{TicketURL: fakeTickets(t, nil).URL}
+	if err := s.Staple(context.Background(), app); !errors.Is(err, ErrNoTicket) {
+		t.Errorf("Staple(not notarized) = %v, want ErrNoTicket", err)
+	}
+
+	// A ticket for some other build.
+	s.TicketURL = fakeTickets(t, map[string][]byte{name: []byte("s8ch\x01\x00\x00\x00other")}).URL
+	if err := s.Staple(context.Background(), app); err == nil || !strings.Contains(err.Error(), "does not cover") {
+		t.Errorf("Staple(wrong ticket) = %v", err)
+	}
+
+	s.TicketURL = fakeTickets(t, map[string][]byte{name: ticket}).URL
+	if err := s.Staple(context.Background(), app); err != nil {
+		t.Fatalf("Staple: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(app, "Contents", "CodeResources"))
+	if err != nil || string(got) != string(ticket) {
+		t.Fatalf("stapled ticket = %q, %v", got, err)
+	}
+	if err := CheckTicket(app); err != nil {
+		t.Errorf("CheckTicket(stapled) = %v", err)
+	}
+	// Stapling does not break the signature.
+	if ms, err := codesig.Verify(app); err != nil || len(ms) != 0 {
+		t.Errorf("Verify(stapled) = %v, %v", ms, err)
+	}
+
+	// Re-signing after stapling invalidates the ticket.
+	if err := codesig.SignBundle(app, codesig.SignOptions{Identifier: "com.example.hello2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTicket(app); err == nil {
+		t.Error("CheckTicket after re-signing succeeded")
+	}
+	if err := os.WriteFile(filepath.Join(app, "Contents", "CodeResources"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTicket(app); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("CheckTicket(garbage) = %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package notary
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// uploadRegion is the AWS region of the bucket that receives submissions.
+const uploadRegion = "us-west-2"
+
+// DefaultUploadURL is the S3 endpoint that submissions are uploaded to.
+const DefaultUploadURL = "https://s3." + uploadRegion + ".amazonaws.com"
+
+// uploadTarget is where the notary service asks for a submission to be
+// uploaded, with short-lived credentials for doing so.
+type uploadTarget struct {
+	AccessKeyID     string `json:"awsAccessKeyId"`
+	SecretAccessKey string `json:"awsSecretAccessKey"`
+	SessionToken    string `json:"awsSessionToken"`
+	Bucket          string `json:"bucket"`
+	Object          string `json:"object"`
+}
+
+// upload PUTs the file at path, whose SHA-256 is sum, to the target
+// object, signing the request with AWS Signature Version 4.
+func (c *Client) upload(ctx context.Context, t uploadTarget, path string, sum []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	base := c.UploadURL
+	if base == "" {
+		base = DefaultUploadURL
+	}
+	// Address the object path-style so the endpoint can be replaced.
+	u, err := url.Parse(strings.TrimSuffix(base, "/") + "/" + awsEscape(t.Bucket) + "/" + awsEscape(t.Object))
+	if err != nil {
+		return fmt.Errorf("notary: upload URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	signV4(req, t, hex.EncodeToString(sum), time.Now())
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("notary: upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("notary: upload: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// signV4 adds AWS Signature Version 4 headers for S3 to req.
+func signV4(req *http.Request, t uploadTarget, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + uploadRegion + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if t.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", t.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.Join(v, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	crHash := sha256.Sum256([]byte(canonRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+t.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, uploadRegion)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+t.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes an S3 object key as AWS signatures require:
+// every byte but '/' and the unreserved characters.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package notary
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Zip writes the bundle at dir to w as a zip archive, as
+// `ditto -c -k --keepParent` does: entries are rooted at the bundle's own
+// name, and symbolic links and file modes are preserved so the signature
+// still verifies when the notary service unpacks it.
+func Zip(w io.Writer, dir string) error {
+	dir = filepath.Clean(dir)
+	parent := filepath.Dir(dir)
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(parent, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		switch {
+		case info.IsDir():
+			hdr.Name += "/"
+			_, err = zw.CreateHeader(hdr)
+			return err
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			hdr.Method = zip.Store
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, target)
+			return err
+		case !info.Mode().IsRegular():
+			return nil
+		}
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
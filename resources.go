@@ -0,0 +1,58 @@
+package macgo
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResourcePath returns the path of the named file in the app bundle's
+// Contents/Resources directory, such as one copied from Config.Resources.
+// The name uses forward slashes, as in an fs.FS.
+//
+// It works inside the bundle and, after Start has created the bundle, in
+// the process that created it, including a dev mode child running the
+// source binary.
+func ResourcePath(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("macgo: invalid resource name %q", name)
+	}
+	bundlePath, err := currentBundle()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(bundlePath, "Contents", "Resources", filepath.FromSlash(name))
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("macgo: resource %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// currentBundle returns the path of the app bundle the process runs in
+// or was launched through.
+func currentBundle() (string, error) {
+	if exe, err := os.Executable(); err == nil {
+		if i := strings.Index(exe, ".app/Contents/MacOS/"); i >= 0 {
+			return exe[:i+len(".app")], nil
+		}
+	}
+	if launchedBundle != "" {
+		return launchedBundle, nil
+	}
+	return "", fmt.Errorf("macgo: not running from an app bundle")
+}
+
+// launchedBundle is the app bundle the process was launched through
+// while running outside it: the bundle Start created, or the one a dev
+// mode child was exec'd from.
+var launchedBundle = takeBundlePath()
+
+// takeBundlePath returns MACGO_BUNDLE_PATH and unsets it, so that child
+// processes do not resolve resources against this process's bundle.
+func takeBundlePath() string {
+	path := os.Getenv("MACGO_BUNDLE_PATH")
+	os.Unsetenv("MACGO_BUNDLE_PATH")
+	return path
+}
@@ -1,6 +1,8 @@
 package teamid
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"reflect"
 	"testing"
 )
@@ -84,3 +86,44 @@ func TestIsValidTeamID(t *testing.T) {
 		}
 	}
 }
+
+func TestFromCertificate(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject pkix.Name
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "organizational unit",
+			subject: pkix.Name{CommonName: "Apple Development: dev@example.com (ZZZZZ99999)", OrganizationalUnit: []string{"ABCDE12345"}},
+			want:    "ABCDE12345",
+		},
+		{
+			name:    "common name suffix",
+			subject: pkix.Name{CommonName: "Developer ID Application: Example Corp (FGHIJ67890)"},
+			want:    "FGHIJ67890",
+		},
+		{
+			name:    "invalid unit falls back to common name",
+			subject: pkix.Name{CommonName: "Developer ID Application: Example Corp (FGHIJ67890)", OrganizationalUnit: []string{"Engineering"}},
+			want:    "FGHIJ67890",
+		},
+		{
+			name:    "no team ID",
+			subject: pkix.Name{CommonName: "Test Signer"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromCertificate(&x509.Certificate{Subject: tt.subject})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FromCertificate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,40 +2,32 @@
 package teamid
 
 import (
+	"crypto/x509"
 	"fmt"
-	"os/exec"
 	"strings"
+
+	"github.com/tmc/macgo/internal/keychain"
 )
 
 // DetectTeamID attempts to automatically detect the Apple Developer Team ID
 // from installed code signing certificates.
 //
-// It searches for Developer ID Application certificates in the system keychain
-// and extracts the team ID from the certificate information. The team ID is
-// typically a 10-character alphanumeric string in parentheses.
+// It searches the keychain for Developer ID Application identities and
+// reads the team ID from each certificate with FromCertificate.
 //
 // Returns the detected team ID or an error if no valid certificate is found.
 func DetectTeamID() (string, error) {
-	cmd := exec.Command("security", "find-identity", "-v", "-p", "codesigning")
-	output, err := cmd.Output()
+	ids, err := keychain.FindIdentities()
 	if err != nil {
-		return "", fmt.Errorf("failed to run security find-identity: %w", err)
+		return "", fmt.Errorf("failed to list signing identities: %w", err)
 	}
-
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		// Look for Developer ID Application certificates
-		// Format: "Developer ID Application: Company Name (TEAMID123456)"
-		if strings.Contains(line, "Developer ID Application:") {
-			// Extract team ID from parentheses
-			start := strings.LastIndex(line, "(")
-			end := strings.LastIndex(line, ")")
-			if start != -1 && end != -1 && end > start {
-				teamID := line[start+1 : end]
-				// Validate team ID format (10 characters, alphanumeric)
-				if IsValidTeamID(teamID) {
-					return teamID, nil
-				}
+	for _, id := range ids {
+		if !strings.HasPrefix(id.Name, "Developer ID Application:") {
+			continue
+		}
+		if id.Certificate != nil {
+			if teamID, err := FromCertificate(id.Certificate); err == nil {
+				return teamID, nil
 			}
 		}
 	}
@@ -43,6 +35,26 @@ func DetectTeamID() (string, error) {
 	return "", fmt.Errorf("no Developer ID Application certificate found with valid team ID")
 }
 
+// FromCertificate returns the team ID of an Apple-issued code signing
+// certificate. Apple records it as the subject's organizational unit; the
+// parenthesized suffix of the common name, as in
+// "Developer ID Application: Company Name (ABC123DEF4)", is used when the
+// certificate has no such unit.
+func FromCertificate(cert *x509.Certificate) (string, error) {
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if IsValidTeamID(ou) {
+			return ou, nil
+		}
+	}
+	cn := cert.Subject.CommonName
+	start := strings.LastIndex(cn, "(")
+	end := strings.LastIndex(cn, ")")
+	if start != -1 && end > start && IsValidTeamID(cn[start+1:end]) {
+		return cn[start+1 : end], nil
+	}
+	return "", fmt.Errorf("certificate %q has no team ID", cn)
+}
+
 // IsValidTeamID checks if a string is a valid Apple Developer Team ID.
 // Team IDs are 10-character alphanumeric strings containing only uppercase letters and digits.
 func IsValidTeamID(teamID string) bool {